@@ -17,6 +17,7 @@
 package virtcontainers
 
 import (
+	"context"
 	"fmt"
 	"syscall"
 
@@ -110,6 +111,10 @@ func newAgentConfig(config PodConfig) interface{} {
 // Agents are running in the guest VM and handling
 // communications between the host and guest.
 type agent interface {
+	// All methods but init() take a context. Implementations must give up and
+	// return ctx.Err() as soon as the context is cancelled or its deadline is
+	// exceeded.
+
 	// init is used to pass agent specific configuration to the agent implementation.
 	// agent implementations also will typically start listening for agent events from
 	// init().
@@ -118,29 +123,50 @@ type agent interface {
 	init(pod *Pod, config interface{}) error
 
 	// start will start the agent.
-	start(pod *Pod) error
+	start(ctx context.Context, pod *Pod) error
 
 	// stop will stop the agent.
-	stop(pod Pod) error
+	stop(ctx context.Context, pod Pod) error
 
 	// exec will tell the agent to run a command in an already running container.
-	exec(pod *Pod, c Container, cmd Cmd) (*Process, error)
+	exec(ctx context.Context, pod *Pod, c Container, cmd Cmd) (*Process, error)
 
 	// startPod will tell the agent to start all containers related to the Pod.
-	startPod(pod Pod) error
+	startPod(ctx context.Context, pod Pod) error
 
 	// stopPod will tell the agent to stop all containers related to the Pod.
-	stopPod(pod Pod) error
+	stopPod(ctx context.Context, pod Pod) error
 
 	// createContainer will tell the agent to create a container related to a Pod.
-	createContainer(pod *Pod, c *Container) error
+	createContainer(ctx context.Context, pod *Pod, c *Container) error
 
 	// startContainer will tell the agent to start a container related to a Pod.
-	startContainer(pod Pod, c Container) error
+	startContainer(ctx context.Context, pod Pod, c Container) error
 
 	// stopContainer will tell the agent to stop a container related to a Pod.
-	stopContainer(pod Pod, c Container) error
+	stopContainer(ctx context.Context, pod Pod, c Container) error
 
 	// killContainer will tell the agent to send a signal to a container related to a Pod.
-	killContainer(pod Pod, c Container, signal syscall.Signal) error
+	killContainer(ctx context.Context, pod Pod, c Container, signal syscall.Signal) error
+
+	// waitContainer will wait for the workload of a container related to a Pod
+	// to exit, and return its exit code.
+	waitContainer(ctx context.Context, pod Pod, c Container) (int, error)
+
+	// watchContainer will call exited with the exit code of the workload
+	// of a container related to a Pod once it exits, without blocking the
+	// caller. Agents not able to report exits on their own do nothing.
+	watchContainer(ctx context.Context, pod Pod, c Container, exited func(exitCode int)) error
+
+	// onlineCPUMem will tell the agent to online the vCPUs and memory
+	// hot plugged into the Pod VM.
+	onlineCPUMem(ctx context.Context, pod Pod) error
+
+	// addInterface will tell the agent to set up a network interface hot
+	// plugged into the Pod VM, and its routes.
+	addInterface(ctx context.Context, pod Pod, endpoint Endpoint) error
+
+	// removeInterface will tell the agent to tear down a network
+	// interface about to be hot unplugged from the Pod VM.
+	removeInterface(ctx context.Context, pod Pod, endpoint Endpoint) error
 }
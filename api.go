@@ -17,53 +17,55 @@
 package virtcontainers
 
 import (
-	"os"
+	"context"
+	"io"
+	"sync"
 	"syscall"
 )
 
 // CreatePod is the virtcontainers pod creation entry point.
 // CreatePod creates a pod and its containers. It does not start them.
 func CreatePod(podConfig PodConfig) (*Pod, error) {
-	// Create the pod.
-	p, err := createPod(podConfig)
-	if err != nil {
-		return nil, err
-	}
+	return CreatePodWithContext(context.Background(), podConfig)
+}
 
-	// Store it.
-	err = p.storePod()
-	if err != nil {
+// CreatePodWithContext is the context aware version of CreatePod.
+func CreatePodWithContext(ctx context.Context, podConfig PodConfig) (_ *Pod, err error) {
+	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
 
-	// Initialize the network.
-	err = p.network.init(&(p.config.NetworkConfig))
-	if err != nil {
-		return nil, err
-	}
+	call, ctx := startAPICall(ctx, "CreatePod", "", "")
+	defer func() { call.end(err) }()
 
-	// Execute prestart hooks inside netns
-	err = p.network.run(p.config.NetworkConfig.NetNSPath, func() error {
-		return p.config.Hooks.preStartHooks()
-	})
-	if err != nil {
+	// Fail before creating anything if the hypervisor cannot run the VM.
+	hypervisorConfig := podConfig.HypervisorConfig.withAnnotations(podConfig.Annotations)
+	if err := checkHypervisor(ctx, podConfig.HypervisorType, hypervisorConfig); err != nil {
 		return nil, err
 	}
 
-	// Add the network
-	networkNS, err := p.network.add(*p, p.config.NetworkConfig)
+	// Create the pod.
+	p, err := createPod(podConfig)
 	if err != nil {
 		return nil, err
 	}
 
-	// Store the network
-	err = p.storage.storePodNetwork(p.id, networkNS)
+	call.setIDs(p.id, "")
+
+	lockFile, err := lockPod(ctx, p.id, exclusiveLock)
 	if err != nil {
+		p.storage.deletePodResources(p.id, nil)
 		return nil, err
 	}
+	defer unlockPod(lockFile)
 
-	// Start the VM
-	err = p.startVM()
+	// Any failure from now on unwinds what has been done so far. This
+	// happens before the pod gets unlocked.
+	rb := &rollback{}
+	defer rb.run()
+
+	// Store it, add the network and start the VM.
+	_, err = p.setup(ctx, rb)
 	if err != nil {
 		return nil, err
 	}
@@ -73,13 +75,29 @@ func CreatePod(podConfig PodConfig) (*Pod, error) {
 		return nil, err
 	}
 
+	rb.commit()
+
 	return p, nil
 }
 
 // DeletePod is the virtcontainers pod deletion entry point.
 // DeletePod will stop an already running container and then delete it.
+// A running or paused pod whose VM went away is moved to the crashed state
+// and deleted.
 func DeletePod(podID string) (*Pod, error) {
-	lockFile, err := lockPod(podID)
+	return DeletePodWithContext(context.Background(), podID)
+}
+
+// DeletePodWithContext is the context aware version of DeletePod.
+func DeletePodWithContext(ctx context.Context, podID string) (_ *Pod, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	call, ctx := startAPICall(ctx, "DeletePod", podID, "")
+	defer func() { call.end(err) }()
+
+	lockFile, err := lockPod(ctx, podID, exclusiveLock)
 	if err != nil {
 		return nil, err
 	}
@@ -91,22 +109,36 @@ func DeletePod(podID string) (*Pod, error) {
 		return nil, err
 	}
 
+	// A pod whose VM went away while no process was following it can
+	// be deleted once it is found crashed.
+	if err := p.checkVM(ctx); err != nil {
+		return nil, err
+	}
+
+	// Nothing is torn down unless the pod can be deleted.
+	state, err := p.deleteCheckState()
+	if err != nil {
+		return nil, err
+	}
+
 	// Fetch the network config
 	networkNS, err := p.storage.fetchPodNetwork(podID)
 	if err != nil {
 		return nil, err
 	}
 
-	// Stop the VM
-	err = p.stopVM()
-	if err != nil {
+	// Stop the VM. The one of a crashed pod may be gone already, or no
+	// longer have a working agent.
+	if state.State == StateCrashed {
+		p.hypervisor.stopPod(ctx)
+	} else if err := p.stopVM(ctx); err != nil {
 		return nil, err
 	}
 
 	// Remove the network
-	err = p.network.remove(*p, networkNS)
+	err = p.network.remove(ctx, *p, networkNS)
 	if err != nil {
-		return nil, err
+		return nil, &NetworkError{Op: "remove the pod network", Err: err}
 	}
 
 	// Delete it.
@@ -128,7 +160,19 @@ func DeletePod(podID string) (*Pod, error) {
 // pod and all its containers.
 // It returns the pod ID.
 func StartPod(podID string) (*Pod, error) {
-	lockFile, err := lockPod(podID)
+	return StartPodWithContext(context.Background(), podID)
+}
+
+// StartPodWithContext is the context aware version of StartPod.
+func StartPodWithContext(ctx context.Context, podID string) (_ *Pod, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	call, ctx := startAPICall(ctx, "StartPod", podID, "")
+	defer func() { call.end(err) }()
+
+	lockFile, err := lockPod(ctx, podID, exclusiveLock)
 	if err != nil {
 		return nil, err
 	}
@@ -147,14 +191,14 @@ func StartPod(podID string) (*Pod, error) {
 	}
 
 	// Start it
-	err = p.start()
+	err = p.start(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	// Execute poststart hooks inside netns
 	err = p.network.run(networkNS.NetNsPath, func() error {
-		return p.config.Hooks.postStartHooks()
+		return p.config.Hooks.postStartHooks(p.id)
 	})
 	if err != nil {
 		return nil, err
@@ -171,7 +215,19 @@ func StartPod(podID string) (*Pod, error) {
 // StopPod is the virtcontainers pod stopping entry point.
 // StopPod will talk to the given agent to stop an existing pod and destroy all containers within that pod.
 func StopPod(podID string) (*Pod, error) {
-	lockFile, err := lockPod(podID)
+	return StopPodWithContext(context.Background(), podID)
+}
+
+// StopPodWithContext is the context aware version of StopPod.
+func StopPodWithContext(ctx context.Context, podID string) (_ *Pod, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	call, ctx := startAPICall(ctx, "StopPod", podID, "")
+	defer func() { call.end(err) }()
+
+	lockFile, err := lockPod(ctx, podID, exclusiveLock)
 	if err != nil {
 		return nil, err
 	}
@@ -190,7 +246,7 @@ func StopPod(podID string) (*Pod, error) {
 	}
 
 	// Stop it.
-	err = p.stop()
+	err = p.stop(ctx)
 	if err != nil {
 		p.delete()
 		return nil, err
@@ -198,7 +254,7 @@ func StopPod(podID string) (*Pod, error) {
 
 	// Execute poststop hooks inside netns
 	err = p.network.run(networkNS.NetNsPath, func() error {
-		return p.config.Hooks.postStopHooks()
+		return p.config.Hooks.postStopHooks(p.id)
 	})
 	if err != nil {
 		p.delete()
@@ -213,69 +269,430 @@ func StopPod(podID string) (*Pod, error) {
 	return p, nil
 }
 
-// RunPod is the virtcontainers pod running entry point.
-// RunPod creates a pod and its containers and then it starts them.
-func RunPod(podConfig PodConfig) (*Pod, error) {
-	// Create the pod.
-	p, err := createPod(podConfig)
+// PausePod is the virtcontainers pod pausing entry point.
+// PausePod freezes the VM of a running pod, without losing its memory state.
+func PausePod(podID string) (*Pod, error) {
+	return PausePodWithContext(context.Background(), podID)
+}
+
+// PausePodWithContext is the context aware version of PausePod.
+func PausePodWithContext(ctx context.Context, podID string) (_ *Pod, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	call, ctx := startAPICall(ctx, "PausePod", podID, "")
+	defer func() { call.end(err) }()
+
+	lockFile, err := lockPod(ctx, podID, exclusiveLock)
 	if err != nil {
 		return nil, err
 	}
+	defer unlockPod(lockFile)
 
-	// Store it.
-	err = p.storePod()
+	// Fetch the pod from storage and create it.
+	p, err := fetchPod(podID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pause it.
+	err = p.pause(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	lockFile, err := lockPod(p.id)
+	err = p.endSession()
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// ResumePod is the virtcontainers pod resuming entry point.
+// ResumePod resumes the VM of a paused pod.
+func ResumePod(podID string) (*Pod, error) {
+	return ResumePodWithContext(context.Background(), podID)
+}
+
+// ResumePodWithContext is the context aware version of ResumePod.
+func ResumePodWithContext(ctx context.Context, podID string) (_ *Pod, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	call, ctx := startAPICall(ctx, "ResumePod", podID, "")
+	defer func() { call.end(err) }()
+
+	lockFile, err := lockPod(ctx, podID, exclusiveLock)
 	if err != nil {
 		return nil, err
 	}
 	defer unlockPod(lockFile)
 
-	// Initialize the network.
-	err = p.network.init(&(p.config.NetworkConfig))
+	// Fetch the pod from storage and create it.
+	p, err := fetchPod(podID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Resume it.
+	err = p.resume(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	// Execute prestart hooks inside netns
-	err = p.network.run(p.config.NetworkConfig.NetNSPath, func() error {
-		return p.config.Hooks.preStartHooks()
+	err = p.endSession()
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// UpdatePodResources is the virtcontainers pod resizing entry point.
+// UpdatePodResources hot plugs or hot unplugs vCPUs and memory into the VM
+// of a running pod. Zero resources are left untouched.
+func UpdatePodResources(podID string, resources Resources) (*Pod, error) {
+	return UpdatePodResourcesWithContext(context.Background(), podID, resources)
+}
+
+// UpdatePodResourcesWithContext is the context aware version of UpdatePodResources.
+func UpdatePodResourcesWithContext(ctx context.Context, podID string, resources Resources) (_ *Pod, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	call, ctx := startAPICall(ctx, "UpdatePodResources", podID, "")
+	defer func() { call.end(err) }()
+
+	lockFile, err := lockPod(ctx, podID, exclusiveLock)
+	if err != nil {
+		return nil, err
+	}
+	defer unlockPod(lockFile)
+
+	p, err := fetchPod(podID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.updateResources(ctx, resources)
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.endSession()
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// AddNetworkInterface is the virtcontainers network interface hot plug entry point.
+// AddNetworkInterface hot plugs a network interface into the VM of a running
+// pod, and has the agent set it up. The interface must already exist in the
+// pod network namespace, e.g. added there by a CNI plugin: endpoint gives
+// its name, NetPair.VirtIface.Name, and its addresses and routes,
+// Properties. The returned endpoint is the interface bridged to the VM.
+func AddNetworkInterface(podID string, endpoint Endpoint) (*Pod, Endpoint, error) {
+	return AddNetworkInterfaceWithContext(context.Background(), podID, endpoint)
+}
+
+// AddNetworkInterfaceWithContext is the context aware version of AddNetworkInterface.
+func AddNetworkInterfaceWithContext(ctx context.Context, podID string, endpoint Endpoint) (_ *Pod, _ Endpoint, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, Endpoint{}, err
+	}
+
+	call, ctx := startAPICall(ctx, "AddNetworkInterface", podID, "")
+	defer func() { call.end(err) }()
+
+	lockFile, err := lockPod(ctx, podID, exclusiveLock)
+	if err != nil {
+		return nil, Endpoint{}, err
+	}
+	defer unlockPod(lockFile)
+
+	p, err := fetchPod(podID)
+	if err != nil {
+		return nil, Endpoint{}, err
+	}
+
+	newEndpoint, err := p.addNetworkInterface(ctx, endpoint)
+	if err != nil {
+		return nil, Endpoint{}, err
+	}
+
+	err = p.endSession()
+	if err != nil {
+		return nil, Endpoint{}, err
+	}
+
+	return p, newEndpoint, nil
+}
+
+// RemoveNetworkInterface is the virtcontainers network interface hot unplug entry point.
+// RemoveNetworkInterface has the agent tear down a network interface
+// AddNetworkInterface hot plugged, and hot unplugs it from the VM of a
+// running pod. The interface is left in the pod network namespace.
+func RemoveNetworkInterface(podID, ifName string) (*Pod, error) {
+	return RemoveNetworkInterfaceWithContext(context.Background(), podID, ifName)
+}
+
+// RemoveNetworkInterfaceWithContext is the context aware version of RemoveNetworkInterface.
+func RemoveNetworkInterfaceWithContext(ctx context.Context, podID, ifName string) (_ *Pod, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	call, ctx := startAPICall(ctx, "RemoveNetworkInterface", podID, "")
+	defer func() { call.end(err) }()
+
+	lockFile, err := lockPod(ctx, podID, exclusiveLock)
+	if err != nil {
+		return nil, err
+	}
+	defer unlockPod(lockFile)
+
+	p, err := fetchPod(podID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.removeNetworkInterface(ctx, ifName)
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.endSession()
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// CheckpointPod is the virtcontainers pod checkpointing entry point.
+// CheckpointPod saves a running or paused pod, VM memory and device state
+// included, into dir. The pod is then removed from the host, only keeping
+// its network namespace, until RestorePod brings it back.
+func CheckpointPod(podID, dir string) (*Pod, error) {
+	return CheckpointPodWithContext(context.Background(), podID, dir)
+}
+
+// CheckpointPodWithContext is the context aware version of CheckpointPod.
+func CheckpointPodWithContext(ctx context.Context, podID, dir string) (_ *Pod, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	call, ctx := startAPICall(ctx, "CheckpointPod", podID, "")
+	defer func() { call.end(err) }()
+
+	lockFile, err := lockPod(ctx, podID, exclusiveLock)
+	if err != nil {
+		return nil, err
+	}
+	defer unlockPod(lockFile)
+
+	p, err := fetchPod(podID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.checkpoint(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// RestorePod is the virtcontainers pod restoring entry point.
+// RestorePod brings a pod checkpointed into dir back to the host, in the
+// state it was when checkpointed.
+func RestorePod(dir string) (*Pod, error) {
+	return RestorePodWithContext(context.Background(), dir)
+}
+
+// RestorePodWithContext is the context aware version of RestorePod.
+func RestorePodWithContext(ctx context.Context, dir string) (_ *Pod, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	call, ctx := startAPICall(ctx, "RestorePod", "", "")
+	defer func() { call.end(err) }()
+
+	podID, err := restoreStorage(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	call.setIDs(podID, "")
+
+	storage := newStorage()
+
+	lockFile, err := lockPod(ctx, podID, exclusiveLock)
+	if err != nil {
+		storage.deletePodResources(podID, nil)
+		return nil, err
+	}
+	defer unlockPod(lockFile)
+
+	// Any failure from now on unwinds what has been done so far. This
+	// happens before the pod gets unlocked.
+	rb := &rollback{}
+	defer rb.run()
+
+	rb.add("pod storage", func() error {
+		return storage.deletePodResources(podID, nil)
 	})
+
+	p, err := fetchPod(podID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.restore(ctx, dir, rb)
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.endSession()
 	if err != nil {
 		return nil, err
 	}
 
-	// Add the network
-	networkNS, err := p.network.add(*p, p.config.NetworkConfig)
+	rb.commit()
+
+	return p, nil
+}
+
+// StartVMPool is the virtcontainers VM pool entry point.
+// StartVMPool boots config.Size VMs, and keeps refilling the pool in the
+// background until the pool is stopped. CreatePod and RunPod take their VM
+// from a pool whose hypervisor, VM and agent configurations match the pod
+// ones, and boot a new VM if there is no such pool or if it is empty.
+func StartVMPool(config VMPoolConfig) (*VMPool, error) {
+	return StartVMPoolWithContext(context.Background(), config)
+}
+
+// StartVMPoolWithContext is the context aware version of StartVMPool.
+// ctx only bounds the initial VMs boot.
+func StartVMPoolWithContext(ctx context.Context, config VMPoolConfig) (_ *VMPool, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	call, ctx := startAPICall(ctx, "StartVMPool", "", "")
+	defer func() { call.end(err) }()
+
+	return startVMPool(ctx, config)
+}
+
+// PoolStatus is the virtcontainers VM pool status entry point.
+// PoolStatus returns the status of the VM pool described by config, which
+// may have been started by another process.
+func PoolStatus(config VMPoolConfig) (VMPoolStatus, error) {
+	return poolStatus(config)
+}
+
+// CheckHypervisor is the virtcontainers hypervisor check entry point.
+// CheckHypervisor probes the QEMU binary config points to, and reports its
+// capabilities and the requirements of config it does not meet. CreatePod, RunPod and
+// StartVMPool fail early when some are missing.
+func CheckHypervisor(config HypervisorConfig) (_ HypervisorCapabilities, err error) {
+	call, ctx := startAPICall(context.Background(), "CheckHypervisor", "", "")
+	defer func() { call.end(err) }()
+
+	return checkQemu(ctx, config)
+}
+
+// GarbageCollect is the virtcontainers garbage collection entry point.
+// GarbageCollect looks for the resources leaked by crashed or killed
+// processes: pods and pooled VMs whose VM is gone, and the network
+// namespaces, hyperstart shared directories, bind mounts and sockets no live
+// pod refers to. It reports them, and removes them if opts.Clean is set.
+func GarbageCollect(opts GCOptions) (GCReport, error) {
+	return GarbageCollectWithContext(context.Background(), opts)
+}
+
+// GarbageCollectWithContext is the context aware version of GarbageCollect.
+func GarbageCollectWithContext(ctx context.Context, opts GCOptions) (_ GCReport, err error) {
+	if err := ctx.Err(); err != nil {
+		return GCReport{}, err
+	}
+
+	call, ctx := startAPICall(ctx, "GarbageCollect", "", "")
+	defer func() { call.end(err) }()
+
+	return garbageCollect(ctx, opts)
+}
+
+// RunPod is the virtcontainers pod running entry point.
+// RunPod creates a pod and its containers and then it starts them.
+func RunPod(podConfig PodConfig) (*Pod, error) {
+	return RunPodWithContext(context.Background(), podConfig)
+}
+
+// RunPodWithContext is the context aware version of RunPod.
+func RunPodWithContext(ctx context.Context, podConfig PodConfig) (_ *Pod, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	call, ctx := startAPICall(ctx, "RunPod", "", "")
+	defer func() { call.end(err) }()
+
+	// Fail before creating anything if the hypervisor cannot run the VM.
+	hypervisorConfig := podConfig.HypervisorConfig.withAnnotations(podConfig.Annotations)
+	if err := checkHypervisor(ctx, podConfig.HypervisorType, hypervisorConfig); err != nil {
+		return nil, err
+	}
+
+	// Create the pod.
+	p, err := createPod(podConfig)
 	if err != nil {
 		return nil, err
 	}
 
-	// Store the network
-	err = p.storage.storePodNetwork(p.id, networkNS)
+	call.setIDs(p.id, "")
+
+	lockFile, err := lockPod(ctx, p.id, exclusiveLock)
 	if err != nil {
+		p.storage.deletePodResources(p.id, nil)
 		return nil, err
 	}
+	defer unlockPod(lockFile)
+
+	// Any failure from now on unwinds what has been done so far. This
+	// happens before the pod gets unlocked.
+	rb := &rollback{}
+	defer rb.run()
 
-	// Start the VM
-	err = p.startVM()
+	// Store it, add the network and start the VM.
+	networkNS, err := p.setup(ctx, rb)
 	if err != nil {
 		return nil, err
 	}
 
 	// Start the pod
-	err = p.start()
+	err = p.start(ctx)
 	if err != nil {
-		p.delete()
 		return nil, err
 	}
 
+	rb.add("pod start", func() error {
+		return p.stop(context.Background())
+	})
+
 	// Execute poststart hooks inside netns
 	err = p.network.run(networkNS.NetNsPath, func() error {
-		return p.config.Hooks.postStartHooks()
+		return p.config.Hooks.postStartHooks(p.id)
 	})
 	if err != nil {
 		return nil, err
@@ -286,71 +703,231 @@ func RunPod(podConfig PodConfig) (*Pod, error) {
 		return nil, err
 	}
 
+	rb.commit()
+
 	return p, nil
 }
 
 // ListPod is the virtcontainers pod listing entry point.
+// ListPod reads the statuses of all the pods at once, without taking the
+// pods locks. The running and paused pods whose VM went away are reported
+// as crashed, without storing it.
 func ListPod() ([]PodStatus, error) {
-	dir, err := os.Open(configStoragePath)
-	if err != nil {
+	return ListPodWithContext(context.Background())
+}
+
+// ListPodWithContext is the context aware version of ListPod.
+func ListPodWithContext(ctx context.Context) (_ []PodStatus, err error) {
+	if err := ctx.Err(); err != nil {
 		return []PodStatus{}, err
 	}
 
-	defer dir.Close()
+	call, _ := startAPICall(ctx, "ListPod", "", "")
+	defer func() { call.end(err) }()
 
-	podsID, err := dir.Readdirnames(0)
+	podStatusList, err := newStorage().fetchPodStatuses()
 	if err != nil {
 		return []PodStatus{}, err
 	}
 
-	var podStatusList []PodStatus
+	// Check the VMs concurrently, so that a few unresponsive VMs cost a
+	// single ping timeout.
+	gone := make([]bool, len(podStatusList))
+	errs := make([]error, len(podStatusList))
+
+	var wg sync.WaitGroup
+	for i, status := range podStatusList {
+		wg.Add(1)
+		go func(i int, status PodStatus) {
+			defer wg.Done()
+			gone[i], errs[i] = podVMGone(ctx, status.ID, status.State.State)
+		}(i, status)
+	}
+	wg.Wait()
 
-	for _, podID := range podsID {
-		podStatus, err := StatusPod(podID)
-		if err != nil {
-			continue
+	for i := range podStatusList {
+		if errs[i] != nil {
+			return []PodStatus{}, errs[i]
 		}
 
-		podStatusList = append(podStatusList, podStatus)
+		if gone[i] {
+			podStatusList[i] = crashedPodStatus(podStatusList[i])
+		}
 	}
 
 	return podStatusList, nil
 }
 
 // StatusPod is the virtcontainers pod status entry point.
+// StatusPod reports a running or paused pod whose VM went away as crashed,
+// without storing it.
 func StatusPod(podID string) (PodStatus, error) {
-	pod, err := fetchPod(podID)
+	return StatusPodWithContext(context.Background(), podID)
+}
+
+// StatusPodWithContext is the context aware version of StatusPod.
+func StatusPodWithContext(ctx context.Context, podID string) (_ PodStatus, err error) {
+	if err := ctx.Err(); err != nil {
+		return PodStatus{}, err
+	}
+
+	call, ctx := startAPICall(ctx, "StatusPod", podID, "")
+	defer func() { call.end(err) }()
+
+	status, err := statusPod(ctx, podID)
 	if err != nil {
 		return PodStatus{}, err
 	}
 
-	var contStatusList []ContainerStatus
-	for _, container := range pod.containers {
-		contStatus := ContainerStatus{
-			ID:     container.id,
-			State:  container.state,
-			PID:    container.process.Pid,
-			RootFs: container.config.RootFs,
-		}
+	gone, err := podVMGone(ctx, podID, status.State.State)
+	if err != nil {
+		return PodStatus{}, err
+	} else if gone {
+		return crashedPodStatus(status), nil
+	}
 
-		contStatusList = append(contStatusList, contStatus)
+	return status, nil
+}
+
+func statusPod(ctx context.Context, podID string) (PodStatus, error) {
+	lockFile, err := lockPodForStatus(ctx, podID)
+	if err != nil {
+		return PodStatus{}, err
 	}
+	defer unlockPod(lockFile)
+
+	return fetchPodStatus(newStorage(), podID)
+}
 
-	podStatus := PodStatus{
-		ID:               pod.id,
-		State:            pod.state,
-		Hypervisor:       pod.config.HypervisorType,
-		Agent:            pod.config.AgentType,
-		ContainersStatus: contStatusList,
+// StatsPod is the virtcontainers pod statistics entry point.
+// StatsPod returns the resource usage of a running or paused pod.
+func StatsPod(podID string) (PodStats, error) {
+	return StatsPodWithContext(context.Background(), podID)
+}
+
+// StatsPodWithContext is the context aware version of StatsPod.
+func StatsPodWithContext(ctx context.Context, podID string) (_ PodStats, err error) {
+	if err := ctx.Err(); err != nil {
+		return PodStats{}, err
 	}
 
-	return podStatus, nil
+	call, ctx := startAPICall(ctx, "StatsPod", podID, "")
+	defer func() { call.end(err) }()
+
+	lockFile, err := lockPodForStatus(ctx, podID)
+	if err != nil {
+		return PodStats{}, err
+	}
+	defer unlockPod(lockFile)
+
+	return fetchPodStats(ctx, newStorage(), podID)
+}
+
+// PodConsoleLog is the virtcontainers pod console log entry point.
+// PodConsoleLog returns a reader of the output logged from a pod VM main
+// console, the one the guest kernel boots on. If follow is true, the reader
+// waits for more output at the end of the log until it is closed. The logs
+// are kept after the pod is deleted, to debug the VMs which failed to boot.
+func PodConsoleLog(podID string, follow bool) (io.ReadCloser, error) {
+	return PodConsoleLogWithContext(context.Background(), podID, follow)
+}
+
+// PodConsoleLogWithContext is the context aware version of PodConsoleLog.
+func PodConsoleLogWithContext(ctx context.Context, podID string, follow bool) (_ io.ReadCloser, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	call, _ := startAPICall(ctx, "PodConsoleLog", podID, "")
+	defer func() { call.end(err) }()
+
+	if podID == "" {
+		return nil, ErrNeedPodID
+	}
+
+	path, err := mainConsoleLogPath(podID)
+	if err != nil {
+		return nil, err
+	}
+
+	return openConsoleLogReader(path, follow)
+}
+
+// ContainerConsoleLog is the virtcontainers container console log entry
+// point.
+// ContainerConsoleLog returns a reader of the output logged from the console
+// of a non interactive container, like PodConsoleLog does for the pod VM
+// main console. The interactive containers consoles are not logged.
+func ContainerConsoleLog(podID, containerID string, follow bool) (io.ReadCloser, error) {
+	return ContainerConsoleLogWithContext(context.Background(), podID, containerID, follow)
+}
+
+// ContainerConsoleLogWithContext is the context aware version of
+// ContainerConsoleLog.
+func ContainerConsoleLogWithContext(ctx context.Context, podID, containerID string, follow bool) (_ io.ReadCloser, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	call, _ := startAPICall(ctx, "ContainerConsoleLog", podID, containerID)
+	defer func() { call.end(err) }()
+
+	if podID == "" {
+		return nil, ErrNeedPodID
+	}
+
+	if containerID == "" {
+		return nil, ErrNeedContainerID
+	}
+
+	path, err := containerConsoleLogPath(podID, containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return openConsoleLogReader(path, follow)
+}
+
+// RotateConsoleLogs is the virtcontainers console logs rotation entry point.
+// RotateConsoleLogs rotates the pod VM console logs which reached their
+// maximum size. The hypervisor appends to the logs, so they are copied and
+// truncated. Nothing else rotates them: it must be called periodically for
+// the logs not to grow unbounded.
+func RotateConsoleLogs() error {
+	return RotateConsoleLogsWithContext(context.Background())
+}
+
+// RotateConsoleLogsWithContext is the context aware version of
+// RotateConsoleLogs.
+func RotateConsoleLogsWithContext(ctx context.Context) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	call, ctx := startAPICall(ctx, "RotateConsoleLogs", "", "")
+	defer func() { call.end(err) }()
+
+	return rotateConsoleLogs(ctx)
 }
 
 // CreateContainer is the virtcontainers container creation entry point.
 // CreateContainer creates a container on a given pod.
+// Only the containers listed at the pod creation can have a block device
+// or image rootfs.
 func CreateContainer(podID string, containerConfig ContainerConfig) (*Pod, *Container, error) {
-	lockFile, err := lockPod(podID)
+	return CreateContainerWithContext(context.Background(), podID, containerConfig)
+}
+
+// CreateContainerWithContext is the context aware version of CreateContainer.
+func CreateContainerWithContext(ctx context.Context, podID string, containerConfig ContainerConfig) (_ *Pod, _ *Container, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	call, ctx := startAPICall(ctx, "CreateContainer", podID, containerConfig.ID)
+	defer func() { call.end(err) }()
+
+	lockFile, err := lockPod(ctx, podID, exclusiveLock)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -361,8 +938,12 @@ func CreateContainer(podID string, containerConfig ContainerConfig) (*Pod, *Cont
 		return nil, nil, err
 	}
 
+	if err := p.checkAddedContainerRootfs(containerConfig); err != nil {
+		return nil, nil, err
+	}
+
 	// Create the container.
-	c, err := createContainer(p, containerConfig)
+	c, err := createContainer(ctx, p, containerConfig)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -392,7 +973,19 @@ func CreateContainer(podID string, containerConfig ContainerConfig) (*Pod, *Cont
 // DeleteContainer deletes a Container from a Pod. If the container is running,
 // it needs to be stopped first.
 func DeleteContainer(podID, containerID string) (*Container, error) {
-	lockFile, err := lockPod(podID)
+	return DeleteContainerWithContext(context.Background(), podID, containerID)
+}
+
+// DeleteContainerWithContext is the context aware version of DeleteContainer.
+func DeleteContainerWithContext(ctx context.Context, podID, containerID string) (_ *Container, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	call, ctx := startAPICall(ctx, "DeleteContainer", podID, containerID)
+	defer func() { call.end(err) }()
+
+	lockFile, err := lockPod(ctx, podID, exclusiveLock)
 	if err != nil {
 		return nil, err
 	}
@@ -404,7 +997,7 @@ func DeleteContainer(podID, containerID string) (*Container, error) {
 	}
 
 	// Fetch the container.
-	c, err := fetchContainer(p, containerID)
+	c, err := fetchContainer(ctx, p, containerID)
 	if err != nil {
 		return nil, err
 	}
@@ -438,7 +1031,19 @@ func DeleteContainer(podID, containerID string) (*Container, error) {
 // StartContainer is the virtcontainers container starting entry point.
 // StartContainer starts an already created container.
 func StartContainer(podID, containerID string) (*Container, error) {
-	lockFile, err := lockPod(podID)
+	return StartContainerWithContext(context.Background(), podID, containerID)
+}
+
+// StartContainerWithContext is the context aware version of StartContainer.
+func StartContainerWithContext(ctx context.Context, podID, containerID string) (_ *Container, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	call, ctx := startAPICall(ctx, "StartContainer", podID, containerID)
+	defer func() { call.end(err) }()
+
+	lockFile, err := lockPod(ctx, podID, exclusiveLock)
 	if err != nil {
 		return nil, err
 	}
@@ -450,13 +1055,13 @@ func StartContainer(podID, containerID string) (*Container, error) {
 	}
 
 	// Fetch the container.
-	c, err := fetchContainer(p, containerID)
+	c, err := fetchContainer(ctx, p, containerID)
 	if err != nil {
 		return nil, err
 	}
 
 	// Start it.
-	err = c.start()
+	err = c.start(ctx)
 	if err != nil {
 		c.delete()
 		return nil, err
@@ -473,7 +1078,19 @@ func StartContainer(podID, containerID string) (*Container, error) {
 // StopContainer is the virtcontainers container stopping entry point.
 // StopContainer stops an already running container.
 func StopContainer(podID, containerID string) (*Container, error) {
-	lockFile, err := lockPod(podID)
+	return StopContainerWithContext(context.Background(), podID, containerID)
+}
+
+// StopContainerWithContext is the context aware version of StopContainer.
+func StopContainerWithContext(ctx context.Context, podID, containerID string) (_ *Container, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	call, ctx := startAPICall(ctx, "StopContainer", podID, containerID)
+	defer func() { call.end(err) }()
+
+	lockFile, err := lockPod(ctx, podID, exclusiveLock)
 	if err != nil {
 		return nil, err
 	}
@@ -485,13 +1102,13 @@ func StopContainer(podID, containerID string) (*Container, error) {
 	}
 
 	// Fetch the container.
-	c, err := fetchContainer(p, containerID)
+	c, err := fetchContainer(ctx, p, containerID)
 	if err != nil {
 		return nil, err
 	}
 
 	// Stop it.
-	err = c.stop()
+	err = c.stop(ctx)
 	if err != nil {
 		c.delete()
 		return nil, err
@@ -508,7 +1125,19 @@ func StopContainer(podID, containerID string) (*Container, error) {
 // EnterContainer is the virtcontainers container command execution entry point.
 // EnterContainer enters an already running container and runs a given command.
 func EnterContainer(podID, containerID string, cmd Cmd) (*Pod, *Container, *Process, error) {
-	lockFile, err := lockPod(podID)
+	return EnterContainerWithContext(context.Background(), podID, containerID, cmd)
+}
+
+// EnterContainerWithContext is the context aware version of EnterContainer.
+func EnterContainerWithContext(ctx context.Context, podID, containerID string, cmd Cmd) (_ *Pod, _ *Container, _ *Process, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	call, ctx := startAPICall(ctx, "EnterContainer", podID, containerID)
+	defer func() { call.end(err) }()
+
+	lockFile, err := lockPod(ctx, podID, exclusiveLock)
 	if err != nil {
 		return nil, nil, nil, err
 	}
@@ -520,13 +1149,13 @@ func EnterContainer(podID, containerID string, cmd Cmd) (*Pod, *Container, *Proc
 	}
 
 	// Fetch the container.
-	c, err := fetchContainer(p, containerID)
+	c, err := fetchContainer(ctx, p, containerID)
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
 	// Enter it.
-	process, err := c.enter(cmd)
+	process, err := c.enter(ctx, cmd)
 	if err != nil {
 		return nil, nil, nil, err
 	}
@@ -542,31 +1171,80 @@ func EnterContainer(podID, containerID string, cmd Cmd) (*Pod, *Container, *Proc
 // StatusContainer is the virtcontainers container status entry point.
 // StatusContainer returns a detailed container status.
 func StatusContainer(podID, containerID string) (ContainerStatus, error) {
-	var contStatus ContainerStatus
+	return StatusContainerWithContext(context.Background(), podID, containerID)
+}
+
+// StatusContainerWithContext is the context aware version of StatusContainer.
+func StatusContainerWithContext(ctx context.Context, podID, containerID string) (_ ContainerStatus, err error) {
+	if err := ctx.Err(); err != nil {
+		return ContainerStatus{}, err
+	}
 
-	pod, err := fetchPod(podID)
+	call, ctx := startAPICall(ctx, "StatusContainer", podID, containerID)
+	defer func() { call.end(err) }()
+
+	lockFile, err := lockPodForStatus(ctx, podID)
 	if err != nil {
 		return ContainerStatus{}, err
 	}
+	defer unlockPod(lockFile)
 
-	for _, container := range pod.containers {
-		if container.id == containerID {
-			contStatus = ContainerStatus{
-				ID:     container.id,
-				State:  container.state,
-				PID:    container.process.Pid,
-				RootFs: container.config.RootFs,
-			}
+	podStatus, err := fetchPodStatus(newStorage(), podID)
+	if err != nil {
+		return ContainerStatus{}, err
+	}
+
+	for _, contStatus := range podStatus.ContainersStatus {
+		if contStatus.ID == containerID {
+			return contStatus, nil
 		}
 	}
 
-	return contStatus, nil
+	return ContainerStatus{}, &NotFoundError{PodID: podID, ContainerID: containerID}
+}
+
+// StatsContainer is the virtcontainers container statistics entry point.
+// StatsContainer returns the resource usage of a container of a running or
+// paused pod. Containers share their pod VM, so only the I/O on a container
+// rootfs drive is its own, the other figures are the ones of the whole pod.
+func StatsContainer(podID, containerID string) (ContainerStats, error) {
+	return StatsContainerWithContext(context.Background(), podID, containerID)
+}
+
+// StatsContainerWithContext is the context aware version of StatsContainer.
+func StatsContainerWithContext(ctx context.Context, podID, containerID string) (_ ContainerStats, err error) {
+	if err := ctx.Err(); err != nil {
+		return ContainerStats{}, err
+	}
+
+	call, ctx := startAPICall(ctx, "StatsContainer", podID, containerID)
+	defer func() { call.end(err) }()
+
+	lockFile, err := lockPodForStatus(ctx, podID)
+	if err != nil {
+		return ContainerStats{}, err
+	}
+	defer unlockPod(lockFile)
+
+	return fetchContainerStats(ctx, newStorage(), podID, containerID)
 }
 
 // KillContainer is the virtcontainers entry point to send a signal
 // to a container running inside a pod.
 func KillContainer(podID, containerID string, signal syscall.Signal) error {
-	lockFile, err := lockPod(podID)
+	return KillContainerWithContext(context.Background(), podID, containerID, signal)
+}
+
+// KillContainerWithContext is the context aware version of KillContainer.
+func KillContainerWithContext(ctx context.Context, podID, containerID string, signal syscall.Signal) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	call, ctx := startAPICall(ctx, "KillContainer", podID, containerID)
+	defer func() { call.end(err) }()
+
+	lockFile, err := lockPod(ctx, podID, exclusiveLock)
 	if err != nil {
 		return err
 	}
@@ -578,13 +1256,13 @@ func KillContainer(podID, containerID string, signal syscall.Signal) error {
 	}
 
 	// Fetch the container.
-	c, err := fetchContainer(p, containerID)
+	c, err := fetchContainer(ctx, p, containerID)
 	if err != nil {
 		return err
 	}
 
 	// Send a signal to the process.
-	err = c.kill(signal)
+	err = c.kill(ctx, signal)
 	if err != nil {
 		return err
 	}
@@ -596,3 +1274,106 @@ func KillContainer(podID, containerID string, signal syscall.Signal) error {
 
 	return nil
 }
+
+// WaitContainer is the virtcontainers entry point to wait for the workload
+// of a running container to exit. It returns the workload exit code, and the
+// container is moved to the stopped state. If the workload has already
+// exited, its recorded exit code is returned straight away.
+func WaitContainer(podID, containerID string) (int, error) {
+	return WaitContainerWithContext(context.Background(), podID, containerID)
+}
+
+// WaitContainerWithContext is the context aware version of WaitContainer.
+func WaitContainerWithContext(ctx context.Context, podID, containerID string) (_ int, err error) {
+	if err := ctx.Err(); err != nil {
+		return -1, err
+	}
+
+	call, ctx := startAPICall(ctx, "WaitContainer", podID, containerID)
+	defer func() { call.end(err) }()
+
+	c, err := fetchContainerToWait(ctx, podID, containerID)
+	if err != nil {
+		return -1, err
+	}
+
+	if !c.process.FinishedAt.IsZero() {
+		return c.process.ExitCode, nil
+	}
+
+	// The pod is not locked while waiting, the workload can run for a
+	// very long time.
+	exitCode, err := c.wait(ctx)
+	if err != nil {
+		return -1, err
+	}
+
+	// The agent watch may have recorded the exit meanwhile, and the
+	// container may have been started again with another process.
+	err = containerExited(ctx, podID, containerID, c.process.Token, exitCode)
+	if err != nil {
+		return -1, err
+	}
+
+	return exitCode, nil
+}
+
+// containerExited records the exit of the container process identified by
+// token, as reported by the agent watch or to a WaitContainer caller. The
+// exit is ignored if it has already been recorded, or if the container has
+// been started again since with another process.
+func containerExited(ctx context.Context, podID, containerID, token string, exitCode int) error {
+	lockFile, err := lockPod(ctx, podID, exclusiveLock)
+	if err != nil {
+		return err
+	}
+	defer unlockPod(lockFile)
+
+	p, err := fetchPod(podID)
+	if err != nil {
+		return err
+	}
+
+	c, err := fetchContainer(ctx, p, containerID)
+	if err != nil {
+		return err
+	}
+
+	if c.process.Token != token || !c.process.FinishedAt.IsZero() {
+		return nil
+	}
+
+	err = c.exited(ctx, exitCode)
+	if err != nil {
+		return err
+	}
+
+	return p.endSession()
+}
+
+// fetchContainerToWait fetches a container, making sure it can be waited for.
+func fetchContainerToWait(ctx context.Context, podID, containerID string) (*Container, error) {
+	lockFile, err := lockPod(ctx, podID, exclusiveLock)
+	if err != nil {
+		return nil, err
+	}
+	defer unlockPod(lockFile)
+
+	p, err := fetchPod(podID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fetch the container.
+	c, err := fetchContainer(ctx, p, containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.waitCheckState()
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
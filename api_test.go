@@ -17,9 +17,12 @@
 package virtcontainers
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -190,6 +193,18 @@ func TestCreatePodFailing(t *testing.T) {
 	}
 }
 
+func TestCreatePodWithContextCanceled(t *testing.T) {
+	config := newTestPodConfigNoop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	p, err := CreatePodWithContext(ctx, config)
+	if p != nil || err != context.Canceled {
+		t.Fatal(err)
+	}
+}
+
 func TestDeletePodNoopAgentSuccessful(t *testing.T) {
 	config := newTestPodConfigNoop()
 
@@ -272,34 +287,477 @@ func TestStartPodHyperstartAgentSuccessful(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	hyperConfig := config.AgentConfig.(HyperConfig)
-	hyperConfig.PauseBinPath = pauseBinPath
-	config.AgentConfig = hyperConfig
+	hyperConfig := config.AgentConfig.(HyperConfig)
+	hyperConfig.PauseBinPath = pauseBinPath
+	config.AgentConfig = hyperConfig
+
+	p, _, err := createAndStartPod(config)
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	p.agent.(*hyper).bindUnmountAllRootfs(*p)
+
+	err = os.Remove(pauseBinPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStartPodFailing(t *testing.T) {
+	podDir := filepath.Join(configStoragePath, testPodID)
+	os.Remove(podDir)
+
+	p, err := StartPod(testPodID)
+	if p != nil || err == nil {
+		t.Fatal()
+	}
+}
+
+func TestStopPodNoopAgentSuccessful(t *testing.T) {
+	config := newTestPodConfigNoop()
+
+	p, _, err := createAndStartPod(config)
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	p, err = StopPod(p.id)
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStopPodHyperstartAgentSuccessful(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip(testDisabledAsNonRoot)
+	}
+
+	config := newTestPodConfigHyperstartAgent()
+
+	pauseBinPath := filepath.Join(testDir, testHyperstartPauseBinName)
+	_, err := os.Create(pauseBinPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hyperConfig := config.AgentConfig.(HyperConfig)
+	hyperConfig.PauseBinPath = pauseBinPath
+	config.AgentConfig = hyperConfig
+
+	p, _, err := createAndStartPod(config)
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	p, err = StopPod(p.id)
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Remove(pauseBinPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStopPodFailing(t *testing.T) {
+	podDir := filepath.Join(configStoragePath, testPodID)
+	os.Remove(podDir)
+
+	p, err := StopPod(testPodID)
+	if p != nil || err == nil {
+		t.Fatal()
+	}
+}
+
+func TestPauseResumePodNoopAgentSuccessful(t *testing.T) {
+	config := newTestPodConfigNoop()
+
+	p, _, err := createAndStartPod(config)
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	p, err = PausePod(p.id)
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	podStatus, err := StatusPod(p.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if podStatus.State.State != StatePaused {
+		t.Fatalf("Pod state %s, expecting %s", podStatus.State.State, StatePaused)
+	}
+
+	p, err = ResumePod(p.id)
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	podStatus, err = StatusPod(p.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if podStatus.State.State != StateRunning {
+		t.Fatalf("Pod state %s, expecting %s", podStatus.State.State, StateRunning)
+	}
+}
+
+func TestPausePodFailingNotStarted(t *testing.T) {
+	config := newTestPodConfigNoop()
+
+	p, err := CreatePod(config)
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	p, err = PausePod(p.id)
+	if p != nil || err == nil {
+		t.Fatal()
+	}
+}
+
+func TestResumePodFailingNotPaused(t *testing.T) {
+	config := newTestPodConfigNoop()
+
+	p, _, err := createAndStartPod(config)
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	p, err = ResumePod(p.id)
+	if p != nil || err == nil {
+		t.Fatal()
+	}
+}
+
+func TestDeletePodFailingPaused(t *testing.T) {
+	config := newTestPodConfigNoop()
+
+	p, _, err := createAndStartPod(config)
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	p, err = PausePod(p.id)
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = DeletePod(p.id)
+	if !IsInvalidState(err) {
+		t.Fatalf("Got %v, expecting a state error", err)
+	}
+
+	// The pod is left untouched, and can still be resumed.
+	p, err = ResumePod(p.id)
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	podStatus, err := StatusPod(p.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if podStatus.State.State != StateRunning {
+		t.Fatalf("Pod state %s, expecting %s", podStatus.State.State, StateRunning)
+	}
+}
+
+func TestPausePodFailing(t *testing.T) {
+	podDir := filepath.Join(configStoragePath, testPodID)
+	os.Remove(podDir)
+
+	p, err := PausePod(testPodID)
+	if p != nil || err == nil {
+		t.Fatal()
+	}
+}
+
+func TestStatsPodNoopAgentSuccessful(t *testing.T) {
+	config := newTestPodConfigNoop()
+
+	p, _, err := createAndStartPod(config)
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := StatsPod(p.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.ID != p.id || stats.Time.IsZero() {
+		t.Fatalf("Unexpected pod statistics %+v", stats)
+	}
+
+	contStats, err := StatsContainer(p.id, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if contStats.ID != "1" || contStats.Pod.ID != p.id {
+		t.Fatalf("Unexpected container statistics %+v", contStats)
+	}
+}
+
+func TestStatsPodFailingNotStarted(t *testing.T) {
+	config := newTestPodConfigNoop()
+
+	p, err := CreatePod(config)
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = StatsPod(p.id)
+	if err == nil {
+		t.Fatal()
+	}
+}
+
+func TestStatsContainerFailingNoContainer(t *testing.T) {
+	config := newTestPodConfigNoop()
+
+	p, _, err := createAndStartPod(config)
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = StatsContainer(p.id, "unknown")
+	if !IsNotFound(err) {
+		t.Fatalf("Got %v, expecting a not found error", err)
+	}
+}
+
+func TestStatsPodFailingNoPod(t *testing.T) {
+	podID := "stats-" + testPodID
+
+	_, err := StatsPod(podID)
+	if !IsNotFound(err) {
+		t.Fatalf("Got %v, expecting a not found error", err)
+	}
+
+	// Getting statistics never creates any pod resource.
+	if _, err := os.Stat(filepath.Join(configStoragePath, podID)); !os.IsNotExist(err) {
+		t.Fatalf("Pod %s config directory should not exist: %v", podID, err)
+	}
+}
+
+func TestUpdatePodResourcesNoopAgentSuccessful(t *testing.T) {
+	config := newTestPodConfigNoop()
+	config.VMConfig = Resources{VCPUs: 1, Memory: 2048}
+
+	p, _, err := createAndStartPod(config)
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	resources := Resources{
+		VCPUs:  4,
+		Memory: 4096,
+	}
+
+	p, err = UpdatePodResources(p.id, resources)
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	fs := filesystem{}
+	podConfig, err := fs.fetchPodConfig(p.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if podConfig.VMConfig != resources {
+		t.Fatalf("Got VM resources %+v, expecting %+v", podConfig.VMConfig, resources)
+	}
+
+	// The hypervisor still handles the VM as booted with the initial
+	// resources.
+	devices, err := fs.fetchPodDevices(p.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Resources{
+		VCPUs:  resources.VCPUs - config.VMConfig.VCPUs,
+		Memory: resources.Memory - config.VMConfig.Memory,
+	}
+
+	if devices.HotpluggedResources != expected {
+		t.Fatalf("Got hot plugged resources %+v, expecting %+v", devices.HotpluggedResources, expected)
+	}
+
+	bootConfig, err := vmBootConfig(&fs, podConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bootConfig.VMConfig != config.VMConfig {
+		t.Fatalf("Got boot resources %+v, expecting %+v", bootConfig.VMConfig, config.VMConfig)
+	}
+
+	// Zero values leave the resources untouched.
+	p, err = UpdatePodResources(p.id, Resources{VCPUs: 2})
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	expected = Resources{VCPUs: 2, Memory: resources.Memory}
+	if p.config.VMConfig != expected {
+		t.Fatalf("Got VM resources %+v, expecting %+v", p.config.VMConfig, expected)
+	}
+
+	mockVMs.Lock()
+	vm := mockVMs.vms[p.id]
+	mockVMs.Unlock()
+
+	if vm.BootResources != config.VMConfig || vm.Resources != expected {
+		t.Fatalf("Unexpected VM %+v, expecting %+v resources", vm, expected)
+	}
+}
+
+// failingOnlineAgent is a noop agent failing to online hot plugged resources.
+type failingOnlineAgent struct {
+	noopAgent
+}
+
+func (a *failingOnlineAgent) onlineCPUMem(ctx context.Context, pod Pod) error {
+	return fmt.Errorf("onlineCPUMem failure")
+}
+
+func TestUpdatePodResourcesFailingOnlineRollback(t *testing.T) {
+	config := newTestPodConfigNoop()
+	config.VMConfig = Resources{VCPUs: 1, Memory: 2048}
+
+	p, _, err := createAndStartPod(config)
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	p, err = fetchPod(p.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.agent = &failingOnlineAgent{}
+
+	err = p.updateResources(context.Background(), Resources{VCPUs: 4, Memory: 4096})
+	if !IsAgentError(err) {
+		t.Fatalf("Got %v, expecting an agent error", err)
+	}
+
+	// The VM is resized back, and nothing is recorded.
+	mockVMs.Lock()
+	vm := mockVMs.vms[p.id]
+	mockVMs.Unlock()
+
+	if vm.Resources != config.VMConfig {
+		t.Fatalf("Got VM resources %+v, expecting %+v", vm.Resources, config.VMConfig)
+	}
+
+	podConfig, err := p.storage.fetchPodConfig(p.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if podConfig.VMConfig != config.VMConfig {
+		t.Fatalf("Got VM resources %+v, expecting %+v", podConfig.VMConfig, config.VMConfig)
+	}
+
+	devices, err := p.storage.fetchPodDevices(p.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if devices.HotpluggedResources != (Resources{}) {
+		t.Fatalf("Unexpected hot plugged resources %+v", devices.HotpluggedResources)
+	}
+}
+
+func TestUpdatePodResourcesFailingNotStarted(t *testing.T) {
+	config := newTestPodConfigNoop()
+
+	p, err := CreatePod(config)
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	p, err = UpdatePodResources(p.id, Resources{VCPUs: 2})
+	if p != nil || err == nil {
+		t.Fatal()
+	}
+}
+
+func TestAddNetworkInterfaceFailingNoNetNS(t *testing.T) {
+	config := newTestPodConfigNoop()
+
+	p, _, err := createAndStartPod(config)
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	endpoint := Endpoint{
+		NetPair: NetworkInterfacePair{
+			VirtIface: NetworkInterface{Name: "eth1"},
+		},
+	}
+
+	_, _, err = AddNetworkInterface(p.id, endpoint)
+	if err == nil {
+		t.Fatal("Hot plugging a network interface without network namespace should fail")
+	}
+
+	_, err = RemoveNetworkInterface(p.id, "eth1")
+	if err == nil {
+		t.Fatal("Hot unplugging an unknown network interface should fail")
+	}
+}
+
+func TestRemoveNetworkInterfaceFailingBootInterface(t *testing.T) {
+	config := newTestPodConfigNoop()
+
+	p, _, err := createAndStartPod(config)
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	networkNS := NetworkNamespace{
+		NetNsPath: "/proc/self/ns/net",
+		Endpoints: []Endpoint{
+			{
+				NetPair: NetworkInterfacePair{
+					VirtIface: NetworkInterface{Name: "eth0"},
+				},
+			},
+		},
+	}
 
-	p, _, err := createAndStartPod(config)
-	if p == nil || err != nil {
+	if err := p.storage.storePodNetwork(p.id, networkNS); err != nil {
 		t.Fatal(err)
 	}
 
-	p.agent.(*hyper).bindUnmountAllRootfs(*p)
+	if _, err := RemoveNetworkInterface(p.id, "eth0"); err == nil {
+		t.Fatal("Hot unplugging a network interface the VM booted with should fail")
+	}
 
-	err = os.Remove(pauseBinPath)
+	stored, err := p.storage.fetchPodNetwork(p.id)
 	if err != nil {
 		t.Fatal(err)
 	}
-}
-
-func TestStartPodFailing(t *testing.T) {
-	podDir := filepath.Join(configStoragePath, testPodID)
-	os.Remove(podDir)
 
-	p, err := StartPod(testPodID)
-	if p != nil || err == nil {
-		t.Fatal()
+	if !reflect.DeepEqual(stored, networkNS) {
+		t.Fatalf("Got network %+v, expecting it unchanged %+v", stored, networkNS)
 	}
 }
 
-func TestStopPodNoopAgentSuccessful(t *testing.T) {
+func TestCheckpointRestorePodNoopAgentSuccessful(t *testing.T) {
 	config := newTestPodConfigNoop()
 
 	p, _, err := createAndStartPod(config)
@@ -307,50 +765,80 @@ func TestStopPodNoopAgentSuccessful(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	p, err = StopPod(p.id)
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p, err = CheckpointPod(p.id, dir)
 	if p == nil || err != nil {
 		t.Fatal(err)
 	}
-}
 
-func TestStopPodHyperstartAgentSuccessful(t *testing.T) {
-	if os.Geteuid() != 0 {
-		t.Skip(testDisabledAsNonRoot)
+	// The pod only lives in the checkpoint now.
+	podDir := filepath.Join(configStoragePath, p.id)
+	if _, err := os.Stat(podDir); err == nil {
+		t.Fatalf("Pod directory %s should have been removed", podDir)
 	}
 
-	config := newTestPodConfigHyperstartAgent()
+	if _, err := os.Stat(filepath.Join(dir, checkpointPodFile)); err != nil {
+		t.Fatal(err)
+	}
 
-	pauseBinPath := filepath.Join(testDir, testHyperstartPauseBinName)
-	_, err := os.Create(pauseBinPath)
+	p, err = RestorePod(dir)
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	podStatus, err := StatusPod(p.id)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	hyperConfig := config.AgentConfig.(HyperConfig)
-	hyperConfig.PauseBinPath = pauseBinPath
-	config.AgentConfig = hyperConfig
+	if podStatus.State.State != StateRunning {
+		t.Fatalf("Pod state %s, expecting %s", podStatus.State.State, StateRunning)
+	}
 
-	p, _, err := createAndStartPod(config)
-	if p == nil || err != nil {
+	// Restoring a pod living on the host must fail, and leave it untouched.
+	_, err = RestorePod(dir)
+	if err == nil {
+		t.Fatal("Restoring an existing pod should fail")
+	}
+
+	if _, err := os.Stat(podDir); err != nil {
 		t.Fatal(err)
 	}
+}
 
-	p, err = StopPod(p.id)
+func TestCheckpointPodFailingNotStarted(t *testing.T) {
+	config := newTestPodConfigNoop()
+
+	p, err := CreatePod(config)
 	if p == nil || err != nil {
 		t.Fatal(err)
 	}
 
-	err = os.Remove(pauseBinPath)
+	dir, err := ioutil.TempDir("", "checkpoint")
 	if err != nil {
 		t.Fatal(err)
 	}
+	defer os.RemoveAll(dir)
+
+	p, err = CheckpointPod(p.id, dir)
+	if p != nil || err == nil {
+		t.Fatal()
+	}
 }
 
-func TestStopPodFailing(t *testing.T) {
-	podDir := filepath.Join(configStoragePath, testPodID)
-	os.Remove(podDir)
+func TestRestorePodFailingNoCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
 
-	p, err := StopPod(testPodID)
+	p, err := RestorePod(dir)
 	if p != nil || err == nil {
 		t.Fatal()
 	}
@@ -432,6 +920,16 @@ func TestListPodSuccessful(t *testing.T) {
 	}
 }
 
+func TestListPodWithContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := ListPodWithContext(ctx)
+	if err != context.Canceled {
+		t.Fatal(err)
+	}
+}
+
 func TestListPodFailing(t *testing.T) {
 	os.RemoveAll(configStoragePath)
 
@@ -753,6 +1251,257 @@ func TestStopContainerNoopAgentSuccessful(t *testing.T) {
 	}
 }
 
+func TestWaitContainerNoopAgentSuccessful(t *testing.T) {
+	contID := "100"
+	config := newTestPodConfigNoop()
+
+	p, _, err := createAndStartPod(config)
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	contConfig := newTestContainerConfigNoop(contID)
+
+	_, c, err := CreateContainer(p.id, contConfig)
+	if c == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = StartContainer(p.id, contID)
+	if c == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	exitCode, err := WaitContainer(p.id, contID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exitCode != 0 {
+		t.Fatalf("Exit code %d, expecting 0", exitCode)
+	}
+
+	contStatus, err := StatusContainer(p.id, contID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if contStatus.State.State != StateStopped {
+		t.Fatalf("Container state %s, expecting %s", contStatus.State.State, StateStopped)
+	}
+
+	if contStatus.ExitCode != exitCode || contStatus.FinishedAt.IsZero() {
+		t.Fatalf("Unexpected container exit status %+v", contStatus)
+	}
+
+	// Restarting the container forgets about the previous exit.
+	c, err = StartContainer(p.id, contID)
+	if c == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	contStatus, err = StatusContainer(p.id, contID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !contStatus.FinishedAt.IsZero() {
+		t.Fatalf("Unexpected container exit status %+v", contStatus)
+	}
+}
+
+func TestWaitContainerFailingContNotStarted(t *testing.T) {
+	contID := "100"
+	config := newTestPodConfigNoop()
+
+	p, _, err := createAndStartPod(config)
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	contConfig := newTestContainerConfigNoop(contID)
+
+	_, c, err := CreateContainer(p.id, contConfig)
+	if c == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = WaitContainer(p.id, contID)
+	if err == nil {
+		t.Fatal()
+	}
+}
+
+func TestWaitContainerFailingNoPod(t *testing.T) {
+	podDir := filepath.Join(configStoragePath, testPodID)
+	os.Remove(podDir)
+
+	_, err := WaitContainer(testPodID, "100")
+	if err == nil {
+		t.Fatal()
+	}
+}
+
+func TestContainerExited(t *testing.T) {
+	contID := "100"
+	config := newTestPodConfigNoop()
+
+	p, _, err := createAndStartPod(config)
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	contConfig := newTestContainerConfigNoop(contID)
+
+	_, c, err := CreateContainer(p.id, contConfig)
+	if c == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = StartContainer(p.id, contID)
+	if c == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	// An exit reported for another process is ignored.
+	err = containerExited(context.Background(), p.id, contID, "stale-token", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contStatus, err := StatusContainer(p.id, contID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if contStatus.State.State != StateRunning || !contStatus.FinishedAt.IsZero() {
+		t.Fatalf("Unexpected container status %+v", contStatus)
+	}
+
+	err = containerExited(context.Background(), p.id, contID, c.Process().Token, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contStatus, err = StatusContainer(p.id, contID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if contStatus.State.State != StateStopped {
+		t.Fatalf("Container state %s, expecting %s", contStatus.State.State, StateStopped)
+	}
+
+	if contStatus.ExitCode != 3 || contStatus.FinishedAt.IsZero() {
+		t.Fatalf("Unexpected container exit status %+v", contStatus)
+	}
+
+	// Waiting for a container which already exited returns the recorded
+	// exit code, without recording the exit again.
+	ch, cancel := SubscribeEvents(EventFilter{PodID: p.id, Types: []EventType{ProcessExited}})
+	defer cancel()
+
+	exitCode, err := WaitContainer(p.id, contID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exitCode != 3 {
+		t.Fatalf("Exit code %d, expecting 3", exitCode)
+	}
+
+	if len(ch) != 0 {
+		t.Fatalf("Unexpected event %+v", <-ch)
+	}
+
+	waitStatus, err := StatusContainer(p.id, contID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !waitStatus.FinishedAt.Equal(contStatus.FinishedAt) {
+		t.Fatalf("Container exit recorded again: %+v", waitStatus)
+	}
+}
+
+func TestSubscribeEventsPodLifecycle(t *testing.T) {
+	config := newTestPodConfigNoop()
+	config.ID = "events-" + testPodID
+
+	ch, cancel := SubscribeEvents(EventFilter{PodID: config.ID})
+	defer cancel()
+
+	p, _, err := createAndStartPod(config)
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	p, err = StopPod(p.id)
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	p, err = DeletePod(p.id)
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	var podEvents []EventType
+	for len(ch) > 0 {
+		e := <-ch
+		if e.Type != ContainerStateChanged {
+			podEvents = append(podEvents, e.Type)
+		}
+	}
+
+	expected := []EventType{PodCreated, PodStarted, PodStopped, PodDeleted}
+	if reflect.DeepEqual(podEvents, expected) == false {
+		t.Fatalf("Got events %v, expecting %v", podEvents, expected)
+	}
+}
+
+func TestSubscribeEventsWatchedContainerExited(t *testing.T) {
+	contID := "100"
+	config := newTestPodConfigNoop()
+	config.ID = "events-" + testPodID
+
+	ch, cancel := SubscribeEvents(EventFilter{PodID: config.ID, Types: []EventType{ProcessExited}})
+	defer cancel()
+
+	p, _, err := createAndStartPod(config)
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	contConfig := newTestContainerConfigNoop(contID)
+
+	_, c, err := CreateContainer(p.id, contConfig)
+	if c == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = StartContainer(p.id, contID)
+	if c == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	// This is what the agent watch of the started container calls when
+	// the workload exits.
+	err = containerExited(context.Background(), p.id, contID, c.Process().Token, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ch) != 1 {
+		t.Fatalf("Got %d events, expecting 1", len(ch))
+	}
+
+	e := <-ch
+	if e.ContainerID != contID || e.ExitCode != 5 {
+		t.Fatalf("Unexpected event %+v", e)
+	}
+}
+
 func TestStartStopContainerHyperstartAgentSuccessful(t *testing.T) {
 	if os.Geteuid() != 0 {
 		t.Skip(testDisabledAsNonRoot)
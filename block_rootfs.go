@@ -0,0 +1,193 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// rootfsDrive is a container rootfs passed through to the VM as a
+// virtio-blk drive.
+type rootfsDrive struct {
+	// ContainerID is the ID of the container the drive is the rootfs of.
+	ContainerID string `json:"containerID"`
+
+	// HostPath is the block device or image file on the host.
+	HostPath string `json:"hostPath"`
+
+	// Device is the drive guest device name, e.g. "vdb".
+	Device string `json:"device"`
+
+	// Fstype is the filesystem type of the drive.
+	Fstype string `json:"fstype"`
+}
+
+// driveID returns the ID the hypervisor knows the drive by.
+func (drive rootfsDrive) driveID() string {
+	return "drive-" + drive.Device
+}
+
+// podDevices describes the devices of a pod VM which cannot be derived
+// from the pod configuration, as the configuration changes while the VM
+// runs.
+type podDevices struct {
+	// RootfsDrives are the containers rootfs drives, in the order they
+	// were given to the hypervisor.
+	RootfsDrives []rootfsDrive `json:"rootfsDrives"`
+
+	// Interfaces are the names of the network interfaces hot plugged
+	// into the running VM.
+	Interfaces []string `json:"interfaces"`
+
+	// HotpluggedResources are the vCPUs and memory hot plugged into the
+	// running VM, on top of the ones it booted with. The pod VMConfig
+	// holds the sum of both.
+	HotpluggedResources Resources `json:"hotpluggedResources"`
+}
+
+// rootfsDrive returns the rootfs drive of a container, if it has one.
+func (devices podDevices) rootfsDrive(containerID string) (rootfsDrive, bool) {
+	for _, drive := range devices.RootfsDrives {
+		if drive.ContainerID == containerID {
+			return drive, true
+		}
+	}
+
+	return rootfsDrive{}, false
+}
+
+// fsMagic is a filesystem superblock magic number, and where it is.
+type fsMagic struct {
+	fstype string
+	offset int64
+	magic  []byte
+}
+
+// fsMagics are the filesystems a rootfs drive can be mounted as.
+var fsMagics = []fsMagic{
+	// The ext4 driver mounts ext2 and ext3 filesystems too.
+	{fstype: "ext4", offset: 1080, magic: []byte{0x53, 0xef}},
+	{fstype: "xfs", offset: 0, magic: []byte("XFSB")},
+	{fstype: "btrfs", offset: 65600, magic: []byte("_BHRfS_M")},
+}
+
+// isBlockRootfs tells if a container rootfs is a block device or an image
+// file, rather than a directory.
+func isBlockRootfs(rootFs string) bool {
+	info, err := os.Stat(rootFs)
+	if err != nil {
+		return false
+	}
+
+	mode := info.Mode()
+
+	return mode.IsRegular() || (mode&os.ModeDevice != 0 && mode&os.ModeCharDevice == 0)
+}
+
+// blockFstype finds out the filesystem type of a block device or image file
+// from its superblock.
+func blockFstype(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	for _, fs := range fsMagics {
+		magic := make([]byte, len(fs.magic))
+		if _, err := f.ReadAt(magic, fs.offset); err != nil && err != io.EOF {
+			return "", err
+		}
+
+		if bytes.Equal(magic, fs.magic) {
+			return fs.fstype, nil
+		}
+	}
+
+	return "", fmt.Errorf("Unknown filesystem on %s", path)
+}
+
+// virtioBlockName returns the guest name of the index-th virtio-blk disk,
+// following the Linux naming: vda to vdz, then vdaa and so on.
+func virtioBlockName(index int) string {
+	name := ""
+
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = string('a'+rune((index-1)%26)) + name
+	}
+
+	return "vd" + name
+}
+
+// newRootfsDrives returns the rootfs drives of the containers podConfig
+// describes, in the order they are given to the hypervisor. The guest names
+// virtio-blk disks in the order it finds them, which is that order, after
+// the guest image disk if any.
+func newRootfsDrives(podConfig PodConfig) ([]rootfsDrive, error) {
+	var drives []rootfsDrive
+
+	index := 0
+	if imageTransport(podConfig.HypervisorConfig) == VirtioBlockImage {
+		index++
+	}
+
+	for _, c := range podConfig.Containers {
+		if c.ID == "" || !isBlockRootfs(c.RootFs) {
+			continue
+		}
+
+		fstype, err := blockFstype(c.RootFs)
+		if err != nil {
+			return nil, fmt.Errorf("Could not pass container %s rootfs through: %s", c.ID, err)
+		}
+
+		drives = append(drives, rootfsDrive{
+			ContainerID: c.ID,
+			HostPath:    c.RootFs,
+			Device:      virtioBlockName(index),
+			Fstype:      fstype,
+		})
+
+		index++
+	}
+
+	return drives, nil
+}
+
+// checkAddedContainerRootfs fails if a container added to an existing pod
+// has a block device or image rootfs. The rootfs drives are given to the
+// VM when it boots, only the containers listed at the pod creation can
+// have one.
+func (p *Pod) checkAddedContainerRootfs(config ContainerConfig) error {
+	if !isBlockRootfs(config.RootFs) {
+		return nil
+	}
+
+	devices, err := p.storage.fetchPodDevices(p.id)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if _, ok := devices.rootfsDrive(config.ID); ok {
+		return nil
+	}
+
+	return fmt.Errorf("Container %s rootfs %s is a block device or image, which can only be passed through when the pod is created", config.ID, config.RootFs)
+}
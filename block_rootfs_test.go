@@ -0,0 +1,254 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeTestRootfsImage writes an image file with the fstype superblock
+// magic, or without any if fstype is empty.
+func writeTestRootfsImage(t *testing.T, name, fstype string) string {
+	data := make([]byte, 128*1024)
+
+	for _, fs := range fsMagics {
+		if fs.fstype == fstype {
+			copy(data[fs.offset:], fs.magic)
+		}
+	}
+
+	path := filepath.Join(testDir, name)
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestBlockFstype(t *testing.T) {
+	for _, fstype := range []string{"ext4", "xfs", "btrfs"} {
+		path := writeTestRootfsImage(t, "rootfs-"+fstype, fstype)
+		defer os.Remove(path)
+
+		if !isBlockRootfs(path) {
+			t.Fatalf("%s should be a block rootfs", path)
+		}
+
+		found, err := blockFstype(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if found != fstype {
+			t.Fatalf("Got %s, expecting %s", found, fstype)
+		}
+	}
+}
+
+func TestBlockFstypeFailingUnknown(t *testing.T) {
+	path := writeTestRootfsImage(t, "rootfs-unknown", "")
+	defer os.Remove(path)
+
+	if _, err := blockFstype(path); err == nil {
+		t.Fatal("Finding out the filesystem of an empty image should fail")
+	}
+}
+
+func TestIsBlockRootfs(t *testing.T) {
+	for _, rootFs := range []string{"", testDir, filepath.Join(testDir, "none"), "/dev/null"} {
+		if isBlockRootfs(rootFs) {
+			t.Fatalf("%q should not be a block rootfs", rootFs)
+		}
+	}
+}
+
+func TestVirtioBlockName(t *testing.T) {
+	for index, name := range map[int]string{
+		0:  "vda",
+		1:  "vdb",
+		25: "vdz",
+		26: "vdaa",
+		27: "vdab",
+		52: "vdba",
+	} {
+		if got := virtioBlockName(index); got != name {
+			t.Fatalf("Got %s for disk %d, expecting %s", got, index, name)
+		}
+	}
+}
+
+func TestNewRootfsDrives(t *testing.T) {
+	ext4 := writeTestRootfsImage(t, "rootfs-drive-ext4", "ext4")
+	defer os.Remove(ext4)
+
+	xfs := writeTestRootfsImage(t, "rootfs-drive-xfs", "xfs")
+	defer os.Remove(xfs)
+
+	podConfig := newTestPodConfigNoop()
+	podConfig.Containers = []ContainerConfig{
+		{ID: "100", RootFs: ext4},
+		{ID: "200", RootFs: filepath.Join(testDir, testBundle)},
+		{ID: "300", RootFs: xfs},
+	}
+
+	expected := []rootfsDrive{
+		{ContainerID: "100", HostPath: ext4, Device: "vda", Fstype: "ext4"},
+		{ContainerID: "300", HostPath: xfs, Device: "vdb", Fstype: "xfs"},
+	}
+
+	drives, err := newRootfsDrives(podConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(drives, expected) {
+		t.Fatalf("Got %+v, expecting %+v", drives, expected)
+	}
+
+	// The guest image disk comes first.
+	podConfig.HypervisorConfig.ImageTransport = VirtioBlockImage
+	expected[0].Device = "vdb"
+	expected[1].Device = "vdc"
+
+	drives, err = newRootfsDrives(podConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(drives, expected) {
+		t.Fatalf("Got %+v, expecting %+v", drives, expected)
+	}
+}
+
+func TestNewRootfsDrivesFailingUnknownFstype(t *testing.T) {
+	path := writeTestRootfsImage(t, "rootfs-drive-unknown", "")
+	defer os.Remove(path)
+
+	podConfig := newTestPodConfigNoop()
+	podConfig.Containers[0].RootFs = path
+
+	if _, err := newRootfsDrives(podConfig); err == nil {
+		t.Fatal("Passing through a rootfs with an unknown filesystem should fail")
+	}
+}
+
+func testStorePodDevices(t *testing.T, storage resourceStorage) {
+	pod := newTestBoltPod("store-devices")
+
+	if err := storage.createAllResources(pod); err != nil {
+		t.Fatal(err)
+	}
+	defer storage.deletePodResources(pod.id, nil)
+
+	devices := podDevices{
+		RootfsDrives: []rootfsDrive{
+			{ContainerID: "100", HostPath: "/dev/dm-1", Device: "vdb", Fstype: "ext4"},
+		},
+	}
+
+	if err := storage.storePodDevices(pod.id, devices); err != nil {
+		t.Fatal(err)
+	}
+
+	fetched, err := storage.fetchPodDevices(pod.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(fetched, devices) {
+		t.Fatalf("Got %+v, expecting %+v", fetched, devices)
+	}
+
+	if err := storage.deletePodResources(pod.id, []podResource{stateFileType}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := storage.fetchPodDevices(pod.id); err == nil {
+		t.Fatal("The devices should have been deleted with the pod state")
+	}
+}
+
+func TestFilesystemStorePodDevices(t *testing.T) {
+	testStorePodDevices(t, &filesystem{})
+}
+
+func TestBoltStorePodDevices(t *testing.T) {
+	testStorePodDevices(t, &boltStorage{})
+}
+
+func TestCreatePodRootfsDrives(t *testing.T) {
+	path := writeTestRootfsImage(t, "rootfs-pod", "ext4")
+	defer os.Remove(path)
+
+	config := newTestPodConfigNoop()
+	config.ID = "rootfs-drives"
+	config.Containers[0].RootFs = path
+
+	p, err := createPod(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.storage.deletePodResources(p.id, nil)
+
+	devices, err := p.storage.fetchPodDevices(p.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	drive, ok := devices.rootfsDrive(config.Containers[0].ID)
+	if !ok {
+		t.Fatalf("No rootfs drive stored for the container: %+v", devices)
+	}
+
+	expected := rootfsDrive{ContainerID: config.Containers[0].ID, HostPath: path, Device: "vda", Fstype: "ext4"}
+	if drive != expected {
+		t.Fatalf("Got %+v, expecting %+v", drive, expected)
+	}
+}
+
+func TestCreateContainerFailingBlockRootfs(t *testing.T) {
+	path := writeTestRootfsImage(t, "rootfs-added", "ext4")
+	defer os.Remove(path)
+
+	p, err := CreatePod(newTestPodConfigNoop())
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+	defer DeletePod(p.id)
+
+	config := newTestContainerConfigNoop("added")
+	config.RootFs = path
+
+	if _, _, err := CreateContainer(p.id, config); err == nil {
+		t.Fatal("Adding a container with an image rootfs to an existing pod should fail")
+	}
+
+	podConfig, err := p.storage.fetchPodConfig(p.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range podConfig.Containers {
+		if c.ID == config.ID {
+			t.Fatalf("Container %s should not have been added to the pod", config.ID)
+		}
+	}
+}
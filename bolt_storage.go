@@ -0,0 +1,499 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltDBFile is the bbolt database file name, stored next to the pods
+// configuration directory.
+const boltDBFile = "pods.db"
+
+// boltOpenTimeout is how long we wait for another process to close the
+// database. bbolt lets either one writer or several readers open it.
+var boltOpenTimeout = 10 * time.Second
+
+// The database holds one bucket per pod in the pods bucket. Each pod bucket
+// holds the pod resources, and one bucket per container in its containers
+// bucket.
+var (
+	boltPodsBucket       = []byte("pods")
+	boltContainersBucket = []byte("containers")
+)
+
+// boltKeys are the keys of the stored resources.
+var boltKeys = map[podResource][]byte{
+	configFileType:  []byte("config"),
+	stateFileType:   []byte("state"),
+	networkFileType: []byte("network"),
+	processFileType: []byte("process"),
+	devicesFileType: []byte("devices"),
+}
+
+// boltRunResources are the resources the filesystem backend keeps in the
+// runtime directory. Deleting the state deletes all of them, as it does
+// with the filesystem backend.
+var boltRunResources = []podResource{stateFileType, networkFileType, processFileType, devicesFileType}
+
+func boltDBPath() string {
+	return filepath.Join(filepath.Dir(configStoragePath), boltDBFile)
+}
+
+// boltStorage is a resourceStorage interface implementation for a bbolt
+// database. The database is only kept open for the time of an operation,
+// for the other processes to get their turn. Only the lock files are kept
+// on the filesystem, as the pods are locked with flock.
+type boltStorage struct {
+	// tx is the transaction all operations are done in, if any.
+	tx *bolt.Tx
+}
+
+func (b *boltStorage) update(fn func(tx *bolt.Tx) error) error {
+	if b.tx != nil {
+		return fn(b.tx)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(boltDBPath()), dirMode); err != nil {
+		return err
+	}
+
+	db, err := bolt.Open(boltDBPath(), 0600, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return fmt.Errorf("Could not open %s: %s", boltDBPath(), err)
+	}
+	defer db.Close()
+
+	return db.Update(fn)
+}
+
+// view runs fn in a read-only transaction, which does not prevent other
+// processes from reading the database.
+func (b *boltStorage) view(fn func(tx *bolt.Tx) error) error {
+	if b.tx != nil {
+		return fn(b.tx)
+	}
+
+	// A read-only database cannot be created.
+	if _, err := os.Stat(boltDBPath()); os.IsNotExist(err) {
+		return b.update(fn)
+	}
+
+	db, err := bolt.Open(boltDBPath(), 0600, &bolt.Options{Timeout: boltOpenTimeout, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("Could not open %s: %s", boltDBPath(), err)
+	}
+	defer db.Close()
+
+	return db.View(fn)
+}
+
+// transaction runs fn in a single bbolt read-write transaction.
+func (b *boltStorage) transaction(fn func(storage resourceStorage) error) error {
+	return b.update(func(tx *bolt.Tx) error {
+		return fn(&boltStorage{tx: tx})
+	})
+}
+
+// bucket returns the bucket of a pod, or of one of its containers if
+// containerID is not empty.
+func (b *boltStorage) bucket(tx *bolt.Tx, podID, containerID string, create bool) (*bolt.Bucket, error) {
+	if podID == "" {
+		return nil, fmt.Errorf("Pod ID cannot be empty")
+	}
+
+	names := [][]byte{boltPodsBucket, []byte(podID)}
+	if containerID != "" {
+		names = append(names, boltContainersBucket, []byte(containerID))
+	}
+
+	var bucket *bolt.Bucket
+	for _, name := range names {
+		var next *bolt.Bucket
+
+		if create {
+			var err error
+			if bucket == nil {
+				next, err = tx.CreateBucketIfNotExists(name)
+			} else {
+				next, err = bucket.CreateBucketIfNotExists(name)
+			}
+
+			if err != nil {
+				return nil, err
+			}
+		} else if bucket == nil {
+			next = tx.Bucket(name)
+		} else {
+			next = bucket.Bucket(name)
+		}
+
+		if next == nil {
+			if containerID != "" {
+				return nil, &NotFoundError{PodID: podID, ContainerID: containerID}
+			}
+
+			return nil, &NotFoundError{PodID: podID}
+		}
+
+		bucket = next
+	}
+
+	return bucket, nil
+}
+
+func (b *boltStorage) createAllResources(pod Pod) error {
+	fs := filesystem{}
+
+	podlockFile, dir, err := fs.podURI(pod.id, lockFileType)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, dirMode); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(podlockFile); err != nil {
+		lockFile, err := os.Create(podlockFile)
+		if err != nil {
+			return err
+		}
+		lockFile.Close()
+	}
+
+	return b.update(func(tx *bolt.Tx) error {
+		if _, err := b.bucket(tx, pod.id, "", true); err != nil {
+			return err
+		}
+
+		for _, container := range pod.containers {
+			if _, err := b.bucket(tx, pod.id, container.id, true); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (b *boltStorage) listPods() ([]string, error) {
+	var podIDs []string
+
+	err := b.view(func(tx *bolt.Tx) error {
+		pods := tx.Bucket(boltPodsBucket)
+		if pods == nil {
+			return nil
+		}
+
+		// Pods are nested buckets, whose value is nil.
+		return pods.ForEach(func(k, v []byte) error {
+			if v == nil {
+				podIDs = append(podIDs, string(k))
+			}
+
+			return nil
+		})
+	})
+
+	return podIDs, err
+}
+
+// fetchPodStatuses reads the statuses of all the pods while the database is
+// opened once, and read-only.
+func (b *boltStorage) fetchPodStatuses() ([]PodStatus, error) {
+	var statuses []PodStatus
+
+	err := b.view(func(tx *bolt.Tx) error {
+		var err error
+		statuses, err = fetchAllPodStatuses(&boltStorage{tx: tx})
+
+		return err
+	})
+
+	return statuses, err
+}
+
+// resourceURI returns bolt://<database>/<pod>[/<container>]/<resource> URIs.
+// The lock files are still on the filesystem.
+func (b *boltStorage) resourceURI(podID, containerID string, resource podResource) (string, string, error) {
+	if podID == "" {
+		return "", "", fmt.Errorf("Pod ID cannot be empty")
+	}
+
+	if resource == lockFileType {
+		fs := filesystem{}
+		return fs.resourceURI(podID, containerID, resource)
+	}
+
+	key, ok := boltKeys[resource]
+	if !ok {
+		return "", "", fmt.Errorf("Invalid pod resource")
+	}
+
+	base := fmt.Sprintf("bolt://%s/%s", boltDBPath(), podID)
+	if containerID != "" {
+		base = fmt.Sprintf("%s/%s", base, containerID)
+	}
+
+	return fmt.Sprintf("%s/%s", base, key), base, nil
+}
+
+func (b *boltStorage) containerURI(podID, containerID string, resource podResource) (string, string, error) {
+	if containerID == "" {
+		return "", "", fmt.Errorf("Container ID cannot be empty")
+	}
+
+	return b.resourceURI(podID, containerID, resource)
+}
+
+func (b *boltStorage) podURI(podID string, resource podResource) (string, string, error) {
+	return b.resourceURI(podID, "", resource)
+}
+
+func (b *boltStorage) storeResource(podID, containerID string, resource podResource, data interface{}) error {
+	var expected podResource
+
+	switch data.(type) {
+	case PodConfig, ContainerConfig:
+		expected = configFileType
+	case State:
+		expected = stateFileType
+	case NetworkNamespace:
+		expected = networkFileType
+	case Process:
+		expected = processFileType
+	case podDevices:
+		expected = devicesFileType
+	default:
+		return fmt.Errorf("Invalid resource data type")
+	}
+
+	if resource != expected {
+		return fmt.Errorf("Invalid pod resource")
+	}
+
+	value, err := encodeDocument(data)
+	if err != nil {
+		return err
+	}
+
+	return b.update(func(tx *bolt.Tx) error {
+		bucket, err := b.bucket(tx, podID, containerID, true)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put(boltKeys[resource], value)
+	})
+}
+
+func (b *boltStorage) fetchResource(podID, containerID string, resource podResource, data interface{}) error {
+	key, ok := boltKeys[resource]
+	if !ok {
+		return fmt.Errorf("Invalid pod resource")
+	}
+
+	return b.view(func(tx *bolt.Tx) error {
+		bucket, err := b.bucket(tx, podID, containerID, false)
+		if err != nil {
+			return err
+		}
+
+		// Report a missing key the way the filesystem backend reports a
+		// missing file, podNotFound() and the gc check it with os.IsNotExist.
+		value := bucket.Get(key)
+		if value == nil {
+			return &os.PathError{
+				Op:   "fetch",
+				Path: filepath.Join(podID, containerID, string(key)),
+				Err:  os.ErrNotExist,
+			}
+		}
+
+		return decodeDocument(value, resource, data)
+	})
+}
+
+// deleteResources deletes resources from a pod or container bucket, and
+// from all its containers buckets.
+func (b *boltStorage) deleteResources(bucket *bolt.Bucket, resources []podResource) error {
+	for _, resource := range resources {
+		if resource == stateFileType {
+			for _, runResource := range boltRunResources {
+				if err := bucket.Delete(boltKeys[runResource]); err != nil {
+					return err
+				}
+			}
+		} else if key, ok := boltKeys[resource]; ok {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+	}
+
+	containers := bucket.Bucket(boltContainersBucket)
+	if containers == nil {
+		return nil
+	}
+
+	return containers.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return nil
+		}
+
+		return b.deleteResources(containers.Bucket(k), resources)
+	})
+}
+
+func (b *boltStorage) storePodResource(podID string, resource podResource, data interface{}) error {
+	return b.storeResource(podID, "", resource, data)
+}
+
+func (b *boltStorage) deletePodResources(podID string, resources []podResource) error {
+	fs := filesystem{}
+
+	err := b.update(func(tx *bolt.Tx) error {
+		pods := tx.Bucket(boltPodsBucket)
+		if pods == nil || pods.Bucket([]byte(podID)) == nil {
+			return nil
+		}
+
+		if resources == nil {
+			return pods.DeleteBucket([]byte(podID))
+		}
+
+		return b.deleteResources(pods.Bucket([]byte(podID)), resources)
+	})
+	if err != nil {
+		return err
+	}
+
+	// The runtime directory holds the lock file, and whatever the
+	// hypervisor and the agent put there.
+	if resources == nil {
+		return fs.deletePodResources(podID, []podResource{stateFileType})
+	}
+
+	return nil
+}
+
+func (b *boltStorage) fetchPodConfig(podID string) (PodConfig, error) {
+	var config PodConfig
+	err := b.fetchResource(podID, "", configFileType, &config)
+
+	return config, err
+}
+
+func (b *boltStorage) fetchPodState(podID string) (State, error) {
+	var state State
+	err := b.fetchResource(podID, "", stateFileType, &state)
+
+	return state, err
+}
+
+func (b *boltStorage) fetchPodNetwork(podID string) (NetworkNamespace, error) {
+	var networkNS NetworkNamespace
+	err := b.fetchResource(podID, "", networkFileType, &networkNS)
+
+	return networkNS, err
+}
+
+func (b *boltStorage) storePodNetwork(podID string, networkNS NetworkNamespace) error {
+	return b.storePodResource(podID, networkFileType, networkNS)
+}
+
+func (b *boltStorage) fetchPodDevices(podID string) (podDevices, error) {
+	var devices podDevices
+	err := b.fetchResource(podID, "", devicesFileType, &devices)
+
+	return devices, err
+}
+
+func (b *boltStorage) storePodDevices(podID string, devices podDevices) error {
+	return b.storePodResource(podID, devicesFileType, devices)
+}
+
+func (b *boltStorage) storeContainerResource(podID, containerID string, resource podResource, data interface{}) error {
+	if containerID == "" {
+		return fmt.Errorf("Container ID cannot be empty")
+	}
+
+	return b.storeResource(podID, containerID, resource, data)
+}
+
+func (b *boltStorage) deleteContainerResources(podID, containerID string, resources []podResource) error {
+	return b.update(func(tx *bolt.Tx) error {
+		pod, err := b.bucket(tx, podID, "", false)
+		if err != nil {
+			return nil
+		}
+
+		containers := pod.Bucket(boltContainersBucket)
+		if containers == nil || containers.Bucket([]byte(containerID)) == nil {
+			return nil
+		}
+
+		if resources == nil {
+			return containers.DeleteBucket([]byte(containerID))
+		}
+
+		return b.deleteResources(containers.Bucket([]byte(containerID)), resources)
+	})
+}
+
+func (b *boltStorage) fetchContainerConfig(podID, containerID string) (ContainerConfig, error) {
+	if containerID == "" {
+		return ContainerConfig{}, fmt.Errorf("Container ID cannot be empty")
+	}
+
+	var config ContainerConfig
+	err := b.fetchResource(podID, containerID, configFileType, &config)
+
+	return config, err
+}
+
+func (b *boltStorage) fetchContainerState(podID, containerID string) (State, error) {
+	if containerID == "" {
+		return State{}, fmt.Errorf("Container ID cannot be empty")
+	}
+
+	var state State
+	err := b.fetchResource(podID, containerID, stateFileType, &state)
+
+	return state, err
+}
+
+func (b *boltStorage) fetchContainerProcess(podID, containerID string) (Process, error) {
+	if containerID == "" {
+		return Process{}, fmt.Errorf("Container ID cannot be empty")
+	}
+
+	var process Process
+	err := b.fetchResource(podID, containerID, processFileType, &process)
+
+	return process, err
+}
+
+func (b *boltStorage) storeContainerProcess(podID, containerID string, process Process) error {
+	return b.storeContainerResource(podID, containerID, processFileType, process)
+}
@@ -0,0 +1,307 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// useBoltStorage switches the API to the bbolt backend, and returns a
+// function switching it back.
+func useBoltStorage() func() {
+	saved := storageType
+	storageType = BoltStorage
+
+	return func() {
+		storageType = saved
+	}
+}
+
+func newTestBoltPod(podID string) Pod {
+	return Pod{
+		id:         podID,
+		containers: []*Container{{id: "100"}},
+	}
+}
+
+func TestBoltStoreFetchResources(t *testing.T) {
+	b := &boltStorage{}
+	pod := newTestBoltPod("bolt-store-fetch")
+
+	if err := b.createAllResources(pod); err != nil {
+		t.Fatal(err)
+	}
+	defer b.deletePodResources(pod.id, nil)
+
+	podConfig := newTestPodConfigNoop()
+	podConfig.ID = pod.id
+	if err := b.storePodResource(pod.id, configFileType, podConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	state := State{State: StateReady}
+	if err := b.storePodResource(pod.id, stateFileType, state); err != nil {
+		t.Fatal(err)
+	}
+
+	process := Process{Token: "token", Pid: 1}
+	if err := b.storeContainerProcess(pod.id, "100", process); err != nil {
+		t.Fatal(err)
+	}
+
+	fetchedConfig, err := b.fetchPodConfig(pod.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(fetchedConfig, podConfig) {
+		t.Fatalf("Got %+v, expecting %+v", fetchedConfig, podConfig)
+	}
+
+	fetchedState, err := b.fetchPodState(pod.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fetchedState != state {
+		t.Fatalf("Got %+v, expecting %+v", fetchedState, state)
+	}
+
+	fetchedProcess, err := b.fetchContainerProcess(pod.id, "100")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(fetchedProcess, process) {
+		t.Fatalf("Got %+v, expecting %+v", fetchedProcess, process)
+	}
+}
+
+func TestBoltStoreResourceFailingWrongDataType(t *testing.T) {
+	b := &boltStorage{}
+	pod := newTestBoltPod("bolt-wrong-type")
+
+	if err := b.createAllResources(pod); err != nil {
+		t.Fatal(err)
+	}
+	defer b.deletePodResources(pod.id, nil)
+
+	if err := b.storePodResource(pod.id, configFileType, State{}); err == nil {
+		t.Fatal("Storing a state as a pod configuration should fail")
+	}
+}
+
+func TestBoltFetchResourceFailingPodNotFound(t *testing.T) {
+	b := &boltStorage{}
+
+	if _, err := b.fetchPodConfig("bolt-not-found"); err == nil {
+		t.Fatal("Fetching a non existing pod should fail")
+	}
+
+	if _, err := b.fetchContainerConfig("bolt-not-found", "100"); err == nil {
+		t.Fatal("Fetching a container of a non existing pod should fail")
+	}
+}
+
+func TestBoltFetchResourceFailingResourceNotFound(t *testing.T) {
+	b := &boltStorage{}
+	pod := newTestBoltPod("bolt-resource-not-found")
+
+	if err := b.storePodResource(pod.id, stateFileType, State{State: StateReady}); err != nil {
+		t.Fatal(err)
+	}
+	defer b.deletePodResources(pod.id, nil)
+
+	_, err := b.fetchPodConfig(pod.id)
+	if !os.IsNotExist(err) {
+		t.Fatalf("Fetching a missing pod configuration should be a not exist error, got %v", err)
+	}
+
+	if !IsNotFound(podNotFound(pod.id, err)) {
+		t.Fatalf("Missing pod configuration should be reported as pod not found, got %v", err)
+	}
+}
+
+func TestBoltDeletePodResources(t *testing.T) {
+	b := &boltStorage{}
+	pod := newTestBoltPod("bolt-delete")
+
+	if err := b.createAllResources(pod); err != nil {
+		t.Fatal(err)
+	}
+	defer b.deletePodResources(pod.id, nil)
+
+	if err := b.storePodResource(pod.id, stateFileType, State{State: StateReady}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.storePodNetwork(pod.id, NetworkNamespace{NetNsPath: "/tmp/netns"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Deleting the state deletes the network, as the filesystem backend does.
+	if err := b.deletePodResources(pod.id, []podResource{stateFileType}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.fetchPodNetwork(pod.id); err == nil {
+		t.Fatal("The pod network should have been deleted")
+	}
+
+	if err := b.deletePodResources(pod.id, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	pods, err := b.listPods()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, podID := range pods {
+		if podID == pod.id {
+			t.Fatalf("Pod %s should have been deleted", pod.id)
+		}
+	}
+}
+
+func TestBoltTransactionRollback(t *testing.T) {
+	b := &boltStorage{}
+	pod := newTestBoltPod("bolt-rollback")
+
+	err := b.transaction(func(storage resourceStorage) error {
+		if err := storage.createAllResources(pod); err != nil {
+			return err
+		}
+
+		if err := storage.storePodResource(pod.id, stateFileType, State{State: StateReady}); err != nil {
+			return err
+		}
+
+		return fmt.Errorf("Transaction failure")
+	})
+	if err == nil {
+		t.Fatal("The transaction error should be returned")
+	}
+
+	if _, err := b.fetchPodState(pod.id); err == nil {
+		t.Fatal("The transaction changes should have been rolled back")
+	}
+}
+
+func TestBoltPodAPI(t *testing.T) {
+	defer useBoltStorage()()
+
+	p, err := CreatePod(newTestPodConfigNoop())
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := p.storage.(*boltStorage); !ok {
+		t.Fatalf("Pod storage %T is not a bbolt storage", p.storage)
+	}
+
+	podStatusList, err := ListPod()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, podStatus := range podStatusList {
+		if podStatus.ID == p.id {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Fatalf("Pod %s not listed in %+v", p.id, podStatusList)
+	}
+
+	if _, err := DeletePod(p.id); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := StatusPod(p.id); err == nil {
+		t.Fatalf("Pod %s should have been deleted", p.id)
+	}
+}
+
+func testFetchPodStatuses(t *testing.T, storage resourceStorage) {
+	pod := newTestBoltPod("fetch-statuses")
+
+	if err := storage.createAllResources(pod); err != nil {
+		t.Fatal(err)
+	}
+	defer storage.deletePodResources(pod.id, nil)
+
+	podConfig := newTestPodConfigNoop()
+	podConfig.ID = pod.id
+	podConfig.Containers[0].ID = "100"
+	if err := storage.storePodResource(pod.id, configFileType, podConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storage.storePodResource(pod.id, stateFileType, State{State: StateRunning}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storage.storeContainerResource(pod.id, "100", stateFileType, State{State: StateRunning}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A pod without state is being created, and is not listed.
+	incomplete := newTestBoltPod("fetch-statuses-incomplete")
+	if err := storage.createAllResources(incomplete); err != nil {
+		t.Fatal(err)
+	}
+	defer storage.deletePodResources(incomplete.id, nil)
+
+	statuses, err := storage.fetchPodStatuses()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found []PodStatus
+	for _, status := range statuses {
+		if status.ID == pod.id || status.ID == incomplete.id {
+			found = append(found, status)
+		}
+	}
+
+	if len(found) != 1 || found[0].State.State != StateRunning {
+		t.Fatalf("Unexpected pod statuses %+v", found)
+	}
+
+	expected, err := fetchPodStatus(storage, pod.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(found[0], expected) {
+		t.Fatalf("Got %+v, expecting %+v", found[0], expected)
+	}
+}
+
+func TestFilesystemFetchPodStatuses(t *testing.T) {
+	testFetchPodStatuses(t, &filesystem{})
+}
+
+func TestBoltFetchPodStatuses(t *testing.T) {
+	testFetchPodStatuses(t, &boltStorage{})
+}
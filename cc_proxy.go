@@ -17,11 +17,13 @@
 package virtcontainers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net"
 	"net/url"
 
+	"github.com/clearcontainers/proxy/api"
 	"github.com/clearcontainers/proxy/client"
 )
 
@@ -37,7 +39,16 @@ type CCProxyConfig struct {
 	URL string
 }
 
-func (p *ccProxy) connectProxy(proxyURL string) (*client.Client, error) {
+func (p *ccProxy) connectProxy(ctx context.Context, proxyURL string) (*client.Client, error) {
+	conn, err := p.dialProxy(ctx, proxyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.NewClient(conn), nil
+}
+
+func (p *ccProxy) dialProxy(ctx context.Context, proxyURL string) (net.Conn, error) {
 	if proxyURL == "" {
 		proxyURL = defaultCCProxyURL
 	}
@@ -60,16 +71,31 @@ func (p *ccProxy) connectProxy(proxyURL string) (*client.Client, error) {
 		address = u.Path
 	}
 
-	conn, err := net.Dial(u.Scheme, address)
-	if err != nil {
-		return nil, err
-	}
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, u.Scheme, address)
+}
 
-	return client.NewClient(conn), nil
+// wait runs a blocking proxy client call, giving up as soon as ctx is done.
+// The proxy client API does not take any context, that's why the only way
+// to unblock a pending call is to close the client connection.
+func (p *ccProxy) wait(ctx context.Context, call func() error) error {
+	errCh := make(chan error, 1)
+
+	go func() {
+		errCh <- call()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		p.client.Close()
+		return ctx.Err()
+	}
 }
 
 // register is the proxy register implementation for ccProxy.
-func (p *ccProxy) register(pod Pod) ([]ProxyInfo, string, error) {
+func (p *ccProxy) register(ctx context.Context, pod Pod) ([]ProxyInfo, string, error) {
 	var err error
 	var proxyInfos []ProxyInfo
 
@@ -78,7 +104,7 @@ func (p *ccProxy) register(pod Pod) ([]ProxyInfo, string, error) {
 		return []ProxyInfo{}, "", fmt.Errorf("Wrong proxy config type, should be CCProxyConfig type")
 	}
 
-	p.client, err = p.connectProxy(ccConfig.URL)
+	p.client, err = p.connectProxy(ctx, ccConfig.URL)
 	if err != nil {
 		return []ProxyInfo{}, "", err
 	}
@@ -93,8 +119,13 @@ func (p *ccProxy) register(pod Pod) ([]ProxyInfo, string, error) {
 		NumIOStreams: len(pod.containers),
 	}
 
-	registerVMReturn, err := p.client.RegisterVM(pod.id, hyperConfig.SockCtlName,
-		hyperConfig.SockTtyName, registerVMOptions)
+	var registerVMReturn *client.RegisterVMReturn
+	err = p.wait(ctx, func() error {
+		var err error
+		registerVMReturn, err = p.client.RegisterVM(pod.id, hyperConfig.SockCtlName,
+			hyperConfig.SockTtyName, registerVMOptions)
+		return err
+	})
 	if err != nil {
 		return []ProxyInfo{}, "", err
 	}
@@ -122,16 +153,18 @@ func (p *ccProxy) register(pod Pod) ([]ProxyInfo, string, error) {
 }
 
 // unregister is the proxy unregister implementation for ccProxy.
-func (p *ccProxy) unregister(pod Pod) error {
+func (p *ccProxy) unregister(ctx context.Context, pod Pod) error {
 	if p.client == nil {
 		return fmt.Errorf("unregister: Client is nil, we can't interact with cc-proxy")
 	}
 
-	return p.client.UnregisterVM(pod.id)
+	return p.wait(ctx, func() error {
+		return p.client.UnregisterVM(pod.id)
+	})
 }
 
 // connect is the proxy connect implementation for ccProxy.
-func (p *ccProxy) connect(pod Pod, createToken bool) (ProxyInfo, string, error) {
+func (p *ccProxy) connect(ctx context.Context, pod Pod, createToken bool) (ProxyInfo, string, error) {
 	var err error
 
 	ccConfig, ok := newProxyConfig(*(pod.config)).(CCProxyConfig)
@@ -139,7 +172,7 @@ func (p *ccProxy) connect(pod Pod, createToken bool) (ProxyInfo, string, error)
 		return ProxyInfo{}, "", fmt.Errorf("Wrong proxy config type, should be CCProxyConfig type")
 	}
 
-	p.client, err = p.connectProxy(ccConfig.URL)
+	p.client, err = p.connectProxy(ctx, ccConfig.URL)
 	if err != nil {
 		return ProxyInfo{}, "", err
 	}
@@ -155,7 +188,12 @@ func (p *ccProxy) connect(pod Pod, createToken bool) (ProxyInfo, string, error)
 		NumIOStreams: numTokens,
 	}
 
-	attachVMReturn, err := p.client.AttachVM(pod.id, attachVMOptions)
+	var attachVMReturn *client.AttachVMReturn
+	err = p.wait(ctx, func() error {
+		var err error
+		attachVMReturn, err = p.client.AttachVM(pod.id, attachVMOptions)
+		return err
+	})
 	if err != nil {
 		return ProxyInfo{}, "", err
 	}
@@ -193,7 +231,7 @@ func (p *ccProxy) disconnect() error {
 }
 
 // sendCmd is the proxy sendCmd implementation for ccProxy.
-func (p *ccProxy) sendCmd(cmd interface{}) (interface{}, error) {
+func (p *ccProxy) sendCmd(ctx context.Context, cmd interface{}) (interface{}, error) {
 	if p.client == nil {
 		return nil, fmt.Errorf("sendCmd: Client is nil, we can't interact with cc-proxy")
 	}
@@ -215,5 +253,89 @@ func (p *ccProxy) sendCmd(cmd interface{}) (interface{}, error) {
 		tokens = append(tokens, proxyCmd.token)
 	}
 
-	return nil, p.client.HyperWithTokens(proxyCmd.cmd, tokens, json.RawMessage(data))
+	return nil, p.wait(ctx, func() error {
+		return p.client.HyperWithTokens(proxyCmd.cmd, tokens, json.RawMessage(data))
+	})
+}
+
+// ccProxyProcessExited is the payload of the cc-proxy ProcessExited
+// notification.
+type ccProxyProcessExited struct {
+	Status int `json:"status"`
+}
+
+// waitProcess is the proxy waitProcess implementation for ccProxy.
+// cc-proxy only forwards the hyperstart exit status of a process to the
+// shim connected with the process token. We connect as this shim on our
+// own connection, and wait for the ProcessExited notification, dropping
+// the process output on the way. This fails if a shim is already connected
+// for the process.
+func (p *ccProxy) waitProcess(ctx context.Context, pod Pod, containerID, processID string) (int, error) {
+	var token string
+	for _, c := range pod.containers {
+		if c.id == containerID {
+			token = c.process.Token
+			break
+		}
+	}
+
+	if token == "" {
+		return -1, fmt.Errorf("waitProcess: No proxy token for process %s of container %s",
+			processID, containerID)
+	}
+
+	ccConfig, ok := newProxyConfig(*(pod.config)).(CCProxyConfig)
+	if !ok {
+		return -1, fmt.Errorf("Wrong proxy config type, should be CCProxyConfig type")
+	}
+
+	conn, err := p.dialProxy(ctx, ccConfig.URL)
+	if err != nil {
+		return -1, err
+	}
+
+	shim := client.NewClient(conn)
+	defer shim.Close()
+
+	exitCh := make(chan int, 1)
+	errCh := make(chan error, 1)
+
+	go func() {
+		if err := shim.ConnectShim(token); err != nil {
+			errCh <- err
+			return
+		}
+
+		for {
+			frame, err := api.ReadFrame(conn)
+			if err != nil {
+				errCh <- err
+				return
+			}
+
+			if frame.Header.Type != api.TypeNotification ||
+				api.Notification(frame.Header.Opcode) != api.NotificationProcessExited {
+				continue
+			}
+
+			var exited ccProxyProcessExited
+			if err := json.Unmarshal(frame.Payload, &exited); err != nil {
+				errCh <- err
+				return
+			}
+
+			exitCh <- exited.Status
+			return
+		}
+	}()
+
+	select {
+	case exitCode := <-exitCh:
+		return exitCode, nil
+	case err := <-errCh:
+		return -1, err
+	case <-ctx.Done():
+		// Closing the connection unblocks the reading goroutine.
+		return -1, ctx.Err()
+	}
 }
@@ -0,0 +1,355 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/containernetworking/cni/pkg/ns"
+)
+
+// A checkpoint directory contains the VM state and devices files the
+// hypervisor saves, and the pod resources exported from the pod storage.
+const (
+	checkpointVMStateFile   = "vm.state"
+	checkpointVMDevicesFile = "vm.devices"
+	checkpointPodFile       = "pod.json"
+)
+
+// containerResources holds the stored resources of a container.
+type containerResources struct {
+	Config  ContainerConfig
+	State   State
+	Process *Process `json:",omitempty"`
+}
+
+// podResources holds the stored resources of a pod, independently from the
+// storage backend they come from.
+type podResources struct {
+	Config     PodConfig
+	State      State
+	Network    NetworkNamespace
+	Devices    podDevices
+	Containers []containerResources
+}
+
+// exportPodResources fetches all the resources of a pod from storage.
+func exportPodResources(storage resourceStorage, podID string) (podResources, error) {
+	var resources podResources
+	var err error
+
+	if resources.Config, err = storage.fetchPodConfig(podID); err != nil {
+		return podResources{}, err
+	}
+
+	if resources.State, err = storage.fetchPodState(podID); err != nil {
+		return podResources{}, err
+	}
+
+	if resources.Network, err = storage.fetchPodNetwork(podID); err != nil {
+		return podResources{}, err
+	}
+
+	if resources.Devices, err = storage.fetchPodDevices(podID); err != nil {
+		return podResources{}, err
+	}
+
+	for _, contConfig := range resources.Config.Containers {
+		c := containerResources{}
+
+		if c.Config, err = storage.fetchContainerConfig(podID, contConfig.ID); err != nil {
+			return podResources{}, err
+		}
+
+		if c.State, err = storage.fetchContainerState(podID, contConfig.ID); err != nil {
+			return podResources{}, err
+		}
+
+		// Containers which have never been started have no process.
+		if process, err := storage.fetchContainerProcess(podID, contConfig.ID); err == nil {
+			c.Process = &process
+		}
+
+		resources.Containers = append(resources.Containers, c)
+	}
+
+	return resources, nil
+}
+
+// importPodResources stores all the resources of a pod, at once for the
+// storage backends supporting transactions.
+func importPodResources(storage resourceStorage, resources podResources) error {
+	podID := resources.Config.ID
+
+	return storage.transaction(func(storage resourceStorage) error {
+		pod := Pod{id: podID}
+		for _, c := range resources.Containers {
+			pod.containers = append(pod.containers, &Container{id: c.Config.ID})
+		}
+
+		if err := storage.createAllResources(pod); err != nil {
+			return err
+		}
+
+		if err := storage.storePodResource(podID, configFileType, resources.Config); err != nil {
+			return err
+		}
+
+		if err := storage.storePodResource(podID, stateFileType, resources.State); err != nil {
+			return err
+		}
+
+		if err := storage.storePodNetwork(podID, resources.Network); err != nil {
+			return err
+		}
+
+		if err := storage.storePodDevices(podID, resources.Devices); err != nil {
+			return err
+		}
+
+		for _, c := range resources.Containers {
+			if err := storage.storeContainerResource(podID, c.Config.ID, configFileType, c.Config); err != nil {
+				return err
+			}
+
+			if err := storage.storeContainerResource(podID, c.Config.ID, stateFileType, c.State); err != nil {
+				return err
+			}
+
+			if c.Process == nil {
+				continue
+			}
+
+			if err := storage.storeContainerProcess(podID, c.Config.ID, *c.Process); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// checkpoint saves a running or paused pod into dir, then removes it from
+// the host. Its network namespace is kept so that restorePod can plug the
+// VM back into it.
+func (p *Pod) checkpoint(ctx context.Context, dir string) error {
+	state, err := p.storage.fetchPodState(p.id)
+	if err != nil {
+		return err
+	}
+
+	if state.State != StateRunning && state.State != StatePaused {
+		return &StateError{PodID: p.id, Op: "checkpoint", From: state.State}
+	}
+
+	networkNS, err := p.storage.fetchPodNetwork(p.id)
+	if err != nil {
+		return err
+	}
+
+	resources, err := exportPodResources(p.storage, p.id)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(resources)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, dirMode); err != nil {
+		return err
+	}
+
+	rb := &rollback{}
+	defer rb.run()
+
+	// The VM is frozen while its state gets saved, and resumed if we fail.
+	if state.State == StateRunning {
+		if err := p.hypervisor.pausePod(ctx); err != nil {
+			return &HypervisorError{Op: "pause the VM", Err: err}
+		}
+
+		rb.add("VM pause", func() error {
+			return p.hypervisor.resumePod(context.Background())
+		})
+	}
+
+	if err := p.hypervisor.saveVM(ctx, dir); err != nil {
+		return &HypervisorError{Op: "save the VM", Err: err}
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, checkpointPodFile), data, 0600); err != nil {
+		return err
+	}
+
+	rb.commit()
+
+	// From now on, the pod lives in the checkpoint.
+	if err := p.stopVM(ctx); err != nil {
+		return err
+	}
+
+	for _, endpoint := range networkNS.Endpoints {
+		if err := unBridgeNetworkPairFunc(networkNS.NetNsPath, endpoint.NetPair)(); err != nil {
+			return err
+		}
+	}
+
+	if err := p.storage.deletePodResources(p.id, nil); err != nil {
+		return err
+	}
+
+	p.logger().Infof("Checkpointed pod into %s", dir)
+
+	return nil
+}
+
+// restoreStorage stores the pod resources of a checkpoint back into the
+// host storage, and returns the ID of the checkpointed pod.
+func restoreStorage(dir string) (string, error) {
+	var resources podResources
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, checkpointPodFile))
+	if err != nil {
+		return "", err
+	}
+
+	if err := json.Unmarshal(data, &resources); err != nil {
+		return "", err
+	}
+
+	podID := resources.Config.ID
+	if podID == "" {
+		return "", ErrNeedPodID
+	}
+
+	storage := newStorage()
+
+	if _, err := storage.fetchPodConfig(podID); err == nil {
+		return "", fmt.Errorf("Pod %s already exists", podID)
+	}
+
+	if err := importPodResources(storage, resources); err != nil {
+		return "", err
+	}
+
+	return podID, nil
+}
+
+// addCheckpointedDevices gives the hypervisor the devices the checkpointed
+// VM had, which fetching the pod does not add: the rootfs drives and network
+// endpoints it booted with, then the ones hot plugged into it. The hypervisor
+// finds out the hot plugged vCPUs and memory from the checkpoint.
+func (p *Pod) addCheckpointedDevices(devices podDevices, networkNS NetworkNamespace) error {
+	for _, drive := range devices.RootfsDrives {
+		if err := p.hypervisor.addDevice(drive, blockDev); err != nil {
+			return &HypervisorError{Op: "add a rootfs drive", Err: err}
+		}
+	}
+
+	hotplugged := make(map[string]bool)
+	for _, ifName := range devices.Interfaces {
+		hotplugged[ifName] = true
+	}
+
+	var endpoints, hotpluggedEndpoints []Endpoint
+	for _, endpoint := range networkNS.Endpoints {
+		if hotplugged[endpoint.NetPair.VirtIface.Name] {
+			hotpluggedEndpoints = append(hotpluggedEndpoints, endpoint)
+		} else {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+
+	if len(endpoints) > 0 {
+		if err := p.hypervisor.addDevice(endpoints, netDev); err != nil {
+			return &HypervisorError{Op: "add the network endpoints", Err: err}
+		}
+	}
+
+	for _, endpoint := range hotpluggedEndpoints {
+		if err := p.hypervisor.addDevice(endpoint, netDev); err != nil {
+			return &HypervisorError{Op: "add a hot plugged network endpoint", Err: err}
+		}
+	}
+
+	return nil
+}
+
+// restore re-plumbs the network of a pod restored from the checkpoint in
+// dir, and relaunches its VM from the saved state. The pod is left
+// running or paused, as it was when checkpointed.
+func (p *Pod) restore(ctx context.Context, dir string, rb *rollback) error {
+	state, err := p.storage.fetchPodState(p.id)
+	if err != nil {
+		return err
+	}
+
+	networkNS, err := p.storage.fetchPodNetwork(p.id)
+	if err != nil {
+		return err
+	}
+
+	for _, endpoint := range networkNS.Endpoints {
+		netPair := endpoint.NetPair
+
+		err := doNetNS(networkNS.NetNsPath, func(_ ns.NetNS) error {
+			return bridgeNetworkPair(netPair)
+		})
+		if err != nil {
+			return err
+		}
+
+		rb.add("network pair "+netPair.Name, unBridgeNetworkPairFunc(networkNS.NetNsPath, netPair))
+	}
+
+	devices, err := p.storage.fetchPodDevices(p.id)
+	if err != nil {
+		return err
+	}
+
+	if err := p.addCheckpointedDevices(devices, networkNS); err != nil {
+		return err
+	}
+
+	err = p.launchVM(ctx, vmRestoreTimeout, func(ctx context.Context, startCh, stopCh chan struct{}) error {
+		return p.hypervisor.restorePod(ctx, dir, startCh, stopCh)
+	})
+	if err != nil {
+		return err
+	}
+
+	rb.add("VM", func() error {
+		return p.stopVM(context.Background())
+	})
+
+	if state.State == StateRunning {
+		if err := p.hypervisor.resumePod(ctx); err != nil {
+			return &HypervisorError{Op: "resume the VM", Err: err}
+		}
+	}
+
+	p.logger().Infof("Restored pod from %s", dir)
+
+	return nil
+}
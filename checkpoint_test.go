@@ -0,0 +1,174 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExportImportPodResources(t *testing.T) {
+	p, err := CreatePod(newTestPodConfigNoop())
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	storage := newStorage()
+
+	resources, err := exportPodResources(storage, p.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resources.Containers) != 1 || resources.Containers[0].Process != nil {
+		t.Fatalf("Unexpected containers resources %+v", resources.Containers)
+	}
+
+	if err := storage.deletePodResources(p.id, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := importPodResources(storage, resources); err != nil {
+		t.Fatal(err)
+	}
+	defer storage.deletePodResources(p.id, nil)
+
+	imported, err := exportPodResources(storage, p.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(imported, resources) {
+		t.Fatalf("Got %+v, expecting %+v", imported, resources)
+	}
+}
+
+// checkpointTestPod starts a pod with a rootfs drive, then hot plugs
+// resources into its VM, and checkpoints it.
+func checkpointTestPod(t *testing.T, podID, dir string) PodConfig {
+	config := newTestPodConfigNoop()
+	config.ID = podID
+	config.VMConfig = Resources{VCPUs: 1, Memory: 2048}
+	config.Containers[0].RootFs = writeTestRootfsImage(t, "rootfs-"+podID, "ext4")
+
+	p, _, err := createAndStartPod(config)
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := UpdatePodResources(p.id, Resources{VCPUs: 2, Memory: 4096}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := CheckpointPod(p.id, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	return config
+}
+
+func TestCheckpointRestorePodDevices(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := checkpointTestPod(t, "checkpoint-devices", dir)
+	defer os.Remove(config.Containers[0].RootFs)
+
+	mockVMs.Lock()
+	_, running := mockVMs.vms[config.ID]
+	mockVMs.Unlock()
+
+	if running {
+		t.Fatal("The checkpointed pod VM should have been stopped")
+	}
+
+	// The mock hypervisor fails to restore a VM whose devices or
+	// resources differ from the saved ones.
+	p, err := RestorePod(dir)
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+	defer p.storage.deletePodResources(p.id, nil)
+
+	mockVMs.Lock()
+	vm := mockVMs.vms[config.ID]
+	mockVMs.Unlock()
+
+	if vm.Resources != (Resources{VCPUs: 2, Memory: 4096}) {
+		t.Fatalf("Unexpected restored VM resources %+v", vm.Resources)
+	}
+
+	if len(vm.Devices) != 1 {
+		t.Fatalf("Unexpected restored VM devices %v", vm.Devices)
+	}
+
+	if err := p.stopVM(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRestorePodFailingMissingDevice(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := checkpointTestPod(t, "checkpoint-missing-device", dir)
+	defer os.Remove(config.Containers[0].RootFs)
+
+	path := filepath.Join(dir, checkpointPodFile)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var resources podResources
+	if err := json.Unmarshal(data, &resources); err != nil {
+		t.Fatal(err)
+	}
+
+	resources.Devices.RootfsDrives = nil
+
+	data, err = json.Marshal(resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := RestorePod(dir)
+	if p != nil || err == nil {
+		t.Fatal("Restoring a VM without its rootfs drive should fail")
+	}
+
+	// The failed restore is rolled back.
+	if _, err := newStorage().fetchPodConfig(config.ID); err == nil {
+		t.Fatalf("Pod %s should not have been restored", config.ID)
+	}
+}
@@ -17,21 +17,26 @@
 package virtcontainers
 
 import (
+	"context"
+
 	"github.com/containernetworking/cni/pkg/ns"
 	cniPlugin "github.com/containers/virtcontainers/pkg/cni"
-	"github.com/golang/glog"
 )
 
 // cni is a network implementation for the CNI plugin.
 type cni struct{}
 
-func (n *cni) addVirtInterfaces(networkNS *NetworkNamespace) error {
+func (n *cni) addVirtInterfaces(ctx context.Context, networkNS *NetworkNamespace) error {
 	netPlugin, err := cniPlugin.NewNetworkPlugin()
 	if err != nil {
 		return err
 	}
 
 	for idx, endpoint := range networkNS.Endpoints {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		result, err := netPlugin.AddNetwork(endpoint.NetPair.ID, networkNS.NetNsPath, endpoint.NetPair.VirtIface.Name)
 		if err != nil {
 			return err
@@ -39,7 +44,7 @@ func (n *cni) addVirtInterfaces(networkNS *NetworkNamespace) error {
 
 		networkNS.Endpoints[idx].Properties = *result
 
-		glog.Infof("AddNetwork results %v\n", *result)
+		subsystemLogger("cni").Debugf("AddNetwork results %+v", *result)
 	}
 
 	return nil
@@ -86,7 +91,7 @@ func (n *cni) run(networkNSPath string, cb func() error) error {
 }
 
 // add adds all needed interfaces inside the network namespace for the CNI network.
-func (n *cni) add(pod Pod, config NetworkConfig) (NetworkNamespace, error) {
+func (n *cni) add(ctx context.Context, pod Pod, config NetworkConfig) (NetworkNamespace, error) {
 	endpoints, err := createNetworkEndpoints(config.NumInterfaces)
 	if err != nil {
 		return NetworkNamespace{}, err
@@ -97,17 +102,33 @@ func (n *cni) add(pod Pod, config NetworkConfig) (NetworkNamespace, error) {
 		Endpoints: endpoints,
 	}
 
-	err = n.addVirtInterfaces(&networkNS)
+	rb := &rollback{}
+	defer rb.run()
+
+	// Registered first as addVirtInterfaces() may fail after having added
+	// some of the endpoints. Removing a network that was not added is fine
+	// with CNI plugins.
+	rb.add("CNI virtual interfaces", func() error {
+		return n.deleteVirtInterfaces(networkNS)
+	})
+
+	err = n.addVirtInterfaces(ctx, &networkNS)
 	if err != nil {
 		return NetworkNamespace{}, err
 	}
 
 	err = doNetNS(networkNS.NetNsPath, func(_ ns.NetNS) error {
 		for _, endpoint := range networkNS.Endpoints {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
 			err = bridgeNetworkPair(endpoint.NetPair)
 			if err != nil {
 				return err
 			}
+
+			rb.add("network pair "+endpoint.NetPair.Name, unBridgeNetworkPairFunc(networkNS.NetNsPath, endpoint.NetPair))
 		}
 
 		return nil
@@ -121,12 +142,14 @@ func (n *cni) add(pod Pod, config NetworkConfig) (NetworkNamespace, error) {
 		return NetworkNamespace{}, err
 	}
 
+	rb.commit()
+
 	return networkNS, nil
 }
 
 // remove unbridges and deletes TAP interfaces. It also removes virtual network
 // interfaces and deletes the network namespace for the CNI network.
-func (n *cni) remove(pod Pod, networkNS NetworkNamespace) error {
+func (n *cni) remove(ctx context.Context, pod Pod, networkNS NetworkNamespace) error {
 	err := doNetNS(networkNS.NetNsPath, func(_ ns.NetNS) error {
 		for _, endpoint := range networkNS.Endpoints {
 			err := unBridgeNetworkPair(endpoint.NetPair)
@@ -17,6 +17,7 @@
 package virtcontainers
 
 import (
+	"context"
 	"fmt"
 	"net"
 
@@ -179,7 +180,7 @@ func (n *cnm) run(networkNSPath string, cb func() error) error {
 }
 
 // add adds all needed interfaces inside the network namespace for the CNM network.
-func (n *cnm) add(pod Pod, config NetworkConfig) (NetworkNamespace, error) {
+func (n *cnm) add(ctx context.Context, pod Pod, config NetworkConfig) (NetworkNamespace, error) {
 	endpoints, err := n.createEndpointsFromScan(config.NetNSPath)
 	if err != nil {
 		return NetworkNamespace{}, err
@@ -190,12 +191,21 @@ func (n *cnm) add(pod Pod, config NetworkConfig) (NetworkNamespace, error) {
 		Endpoints: endpoints,
 	}
 
+	rb := &rollback{}
+	defer rb.run()
+
 	err = doNetNS(networkNS.NetNsPath, func(_ ns.NetNS) error {
 		for _, endpoint := range networkNS.Endpoints {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
 			err := bridgeNetworkPair(endpoint.NetPair)
 			if err != nil {
 				return err
 			}
+
+			rb.add("network pair "+endpoint.NetPair.Name, unBridgeNetworkPairFunc(networkNS.NetNsPath, endpoint.NetPair))
 		}
 
 		return nil
@@ -209,12 +219,14 @@ func (n *cnm) add(pod Pod, config NetworkConfig) (NetworkNamespace, error) {
 		return NetworkNamespace{}, err
 	}
 
+	rb.commit()
+
 	return networkNS, nil
 }
 
 // remove unbridges and deletes TAP interfaces. It also removes virtual network
 // interfaces and deletes the network namespace for the CNM network.
-func (n *cnm) remove(pod Pod, networkNS NetworkNamespace) error {
+func (n *cnm) remove(ctx context.Context, pod Pod, networkNS NetworkNamespace) error {
 	err := doNetNS(networkNS.NetNsPath, func(_ ns.NetNS) error {
 		for _, endpoint := range networkNS.Endpoints {
 			err := unBridgeNetworkPair(endpoint.NetPair)
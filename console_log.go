@@ -0,0 +1,429 @@
+//
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// consoleLogDir is the directory the VM consoles are logged under, one
+// directory per pod.
+var consoleLogDir = defaultRuntimeConfig.ConsoleLogDir
+
+// A console log is rotated by RotateConsoleLogs once it reaches
+// consoleLogMaxSize bytes, and at most consoleLogMaxFiles files are kept per
+// console, the live one included. Nothing else rotates the logs, they grow
+// unbounded unless RotateConsoleLogs is called periodically. At least 2
+// files must be kept, the followers finding out about a rotation from the
+// first rotated file.
+var (
+	consoleLogMaxSize  int64 = 1024 * 1024
+	consoleLogMaxFiles       = 3
+)
+
+// consoleLogRetention is how long the garbage collector keeps the console
+// logs of the pods which no longer exist.
+var consoleLogRetention = 7 * 24 * time.Hour
+
+// consoleLogPollInterval is how often a followed console log is checked
+// for new output.
+var consoleLogPollInterval = 100 * time.Millisecond
+
+// containerConsolePath returns the socket a non interactive container
+// console is exposed through.
+func containerConsolePath(podID, containerID string) string {
+	return filepath.Join(runStoragePath, podID, containerID, defaultConsole)
+}
+
+func podConsoleLogDir(podID string) string {
+	return filepath.Join(consoleLogDir, podID)
+}
+
+func consoleLogPath(podID, name string) string {
+	return filepath.Join(podConsoleLogDir(podID), name+".log")
+}
+
+// consoleLogName returns the log name of the index-th console of a pod VM.
+// The consoles of the containers are logged under their container ID too,
+// for their logs to be found once the pod configuration is gone.
+func consoleLogName(index int, containerID string) string {
+	name := fmt.Sprintf("console%d", index)
+	if containerID != "" {
+		name += "-" + containerID
+	}
+
+	return name
+}
+
+// rotatedLogPath returns the path of the n-th most recent rotated log.
+func rotatedLogPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+// createConsoleLogDir creates the directory the hypervisor logs the pod VM
+// consoles in. The VM consoles exposed through a socket are logged by the
+// hypervisor itself, whether a client is attached to them or not.
+func createConsoleLogDir(podID string) error {
+	return os.MkdirAll(podConsoleLogDir(podID), dirMode)
+}
+
+// rotateConsoleLog rotates a console log once it reaches consoleLogMaxSize.
+// The hypervisor keeps the live file open and appends to it, so the live
+// file is copied to the first rotated file and truncated rather than
+// renamed. The output written while it is being copied is lost.
+func rotateConsoleLog(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if info.Size() < consoleLogMaxSize {
+		return nil
+	}
+
+	for n := consoleLogMaxFiles - 1; n > 1; n-- {
+		if err := os.Rename(rotatedLogPath(path, n-1), rotatedLogPath(path, n)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	// The copy only becomes the first rotated file once the live file
+	// is truncated, for the followers not to read its output twice.
+	copyPath := path + ".copy"
+	if err := copyConsoleLog(path, copyPath); err != nil {
+		os.Remove(copyPath)
+		return err
+	}
+
+	if err := os.Truncate(path, 0); err != nil {
+		os.Remove(copyPath)
+		return err
+	}
+
+	return os.Rename(copyPath, rotatedLogPath(path, 1))
+}
+
+func copyConsoleLog(from, to string) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+
+	return dst.Close()
+}
+
+// isLiveConsoleLog tells if a console logs directory entry is a live log,
+// and returns the index of its console and the ID of the container it is
+// the console of, if any.
+func isLiveConsoleLog(name string) (int, string, bool) {
+	if !strings.HasPrefix(name, "console") || !strings.HasSuffix(name, ".log") {
+		return 0, "", false
+	}
+
+	name = strings.TrimSuffix(strings.TrimPrefix(name, "console"), ".log")
+
+	containerID := ""
+	if i := strings.Index(name, "-"); i >= 0 {
+		name, containerID = name[:i], name[i+1:]
+	}
+
+	index, err := strconv.Atoi(name)
+	if err != nil {
+		return 0, "", false
+	}
+
+	return index, containerID, true
+}
+
+// rotateConsoleLogs rotates the console logs of all the pods, deleted ones
+// included.
+func rotateConsoleLogs(ctx context.Context) error {
+	podIDs, err := listDir(consoleLogDir)
+	if err != nil {
+		return err
+	}
+
+	for _, podID := range podIDs {
+		names, err := listDir(podConsoleLogDir(podID))
+		if err != nil {
+			return err
+		}
+
+		for _, name := range names {
+			if _, _, ok := isLiveConsoleLog(name); !ok {
+				continue
+			}
+
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			err := rotateConsoleLog(filepath.Join(podConsoleLogDir(podID), name))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// mainConsoleLogPath returns the log of the first console of a pod VM,
+// which the guest kernel boots on.
+func mainConsoleLogPath(podID string) (string, error) {
+	names, err := listDir(podConsoleLogDir(podID))
+	if err != nil {
+		return "", err
+	}
+
+	main := -1
+	mainName := ""
+	for _, name := range names {
+		index, _, ok := isLiveConsoleLog(name)
+		if !ok {
+			continue
+		}
+
+		if main < 0 || index < main {
+			main = index
+			mainName = name
+		}
+	}
+
+	if main < 0 {
+		return "", fmt.Errorf("No console log for pod %s", podID)
+	}
+
+	return filepath.Join(podConsoleLogDir(podID), mainName), nil
+}
+
+// containerConsoleLogPath returns the log of the console of a non
+// interactive container.
+func containerConsoleLogPath(podID, containerID string) (string, error) {
+	names, err := listDir(podConsoleLogDir(podID))
+	if err != nil {
+		return "", err
+	}
+
+	for _, name := range names {
+		if _, id, ok := isLiveConsoleLog(name); ok && id == containerID {
+			return filepath.Join(podConsoleLogDir(podID), name), nil
+		}
+	}
+
+	return "", fmt.Errorf("No console log for container %s of pod %s", containerID, podID)
+}
+
+// consoleLogReader reads a console log from its oldest rotated file. When
+// following the log, it waits at the end of the live file for more output,
+// catching up with the rotations of the log, until it is closed or the pod
+// console logs are removed.
+type consoleLogReader struct {
+	path   string
+	follow bool
+
+	// rotated is the first rotated file when the live file was last
+	// caught up with, nil if there was none. A new one means that the
+	// live file has been copied to it and truncated.
+	rotated os.FileInfo
+
+	// mu serializes the reads with Close.
+	mu sync.Mutex
+
+	// pending are the files left to read before the live one, oldest
+	// first.
+	pending []*os.File
+	file    *os.File
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func openConsoleLogReader(path string, follow bool) (*consoleLogReader, error) {
+	r := &consoleLogReader{
+		path:   path,
+		follow: follow,
+		closed: make(chan struct{}),
+	}
+
+	for n := consoleLogMaxFiles - 1; n > 0; n-- {
+		f, err := os.Open(rotatedLogPath(path, n))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			r.Close()
+			return nil, err
+		}
+
+		r.pending = append(r.pending, f)
+
+		if n == 1 {
+			if r.rotated, err = f.Stat(); err != nil {
+				r.Close()
+				return nil, err
+			}
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+
+	r.file = f
+
+	return r, nil
+}
+
+func (r *consoleLogReader) Read(b []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	select {
+	case <-r.closed:
+		return 0, io.EOF
+	default:
+	}
+
+	for {
+		if len(r.pending) > 0 {
+			n, err := r.pending[0].Read(b)
+			if err == io.EOF {
+				r.pending[0].Close()
+				r.pending = r.pending[1:]
+
+				if n == 0 {
+					continue
+				}
+
+				err = nil
+			}
+
+			return n, err
+		}
+
+		n, err := r.file.Read(b)
+		if n > 0 || err != io.EOF || !r.follow {
+			return n, err
+		}
+
+		rotated, err := r.reopen()
+		if err != nil {
+			return 0, err
+		}
+
+		if rotated {
+			continue
+		}
+
+		select {
+		case <-r.closed:
+			return 0, io.EOF
+		case <-time.After(consoleLogPollInterval):
+		}
+	}
+}
+
+// reopen catches up with a rotation of the log. The live file has then been
+// copied to a new first rotated file and truncated: the output not read yet
+// is at the end of the copy, followed by the live file new output.
+func (r *consoleLogReader) reopen() (bool, error) {
+	if _, err := os.Stat(filepath.Dir(r.path)); os.IsNotExist(err) {
+		return false, io.EOF
+	}
+
+	f, err := os.Open(rotatedLogPath(r.path, 1))
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return false, err
+	}
+
+	if r.rotated != nil && os.SameFile(info, r.rotated) {
+		f.Close()
+		return false, nil
+	}
+
+	offset, err := r.file.Seek(0, io.SeekCurrent)
+	if err == nil {
+		_, err = f.Seek(offset, io.SeekStart)
+	}
+	if err == nil {
+		_, err = r.file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return false, err
+	}
+
+	r.pending = append(r.pending, f)
+	r.rotated = info
+
+	return true, nil
+}
+
+// Close stops following the log, waking up a pending read. The reads return
+// io.EOF once it is closed.
+func (r *consoleLogReader) Close() error {
+	r.closeOnce.Do(func() { close(r.closed) })
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, f := range r.pending {
+		f.Close()
+	}
+
+	r.pending = nil
+
+	if r.file != nil {
+		r.file.Close()
+	}
+
+	return nil
+}
+
+// removeConsoleLogs removes the console logs of a pod.
+func removeConsoleLogs(podID string) error {
+	return os.RemoveAll(podConsoleLogDir(podID))
+}
@@ -0,0 +1,278 @@
+//
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// setConsoleLogBounds sets the console logs rotation bounds, and returns a
+// function restoring them.
+func setConsoleLogBounds(maxSize int64, maxFiles int) func() {
+	savedMaxSize := consoleLogMaxSize
+	savedMaxFiles := consoleLogMaxFiles
+	savedPollInterval := consoleLogPollInterval
+
+	consoleLogMaxSize = maxSize
+	consoleLogMaxFiles = maxFiles
+	consoleLogPollInterval = 10 * time.Millisecond
+
+	return func() {
+		consoleLogMaxSize = savedMaxSize
+		consoleLogMaxFiles = savedMaxFiles
+		consoleLogPollInterval = savedPollInterval
+	}
+}
+
+// openTestConsoleLog opens a console log for writing, the way QEMU does.
+func openTestConsoleLog(t *testing.T, path string) *os.File {
+	if err := os.MkdirAll(filepath.Dir(path), dirMode); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return f
+}
+
+// writeConsoleLog appends data to a console log, rotating the logs after
+// each write.
+func writeConsoleLog(t *testing.T, path string, data ...string) {
+	f := openTestConsoleLog(t, path)
+	defer f.Close()
+
+	for _, d := range data {
+		if _, err := f.Write([]byte(d)); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := RotateConsoleLogs(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func checkFileContent(t *testing.T, path, expected string) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != expected {
+		t.Fatalf("Got %q in %s, expecting %q", data, path, expected)
+	}
+}
+
+func TestRotateConsoleLogs(t *testing.T) {
+	defer setConsoleLogBounds(10, 3)()
+
+	path := consoleLogPath("rotation", "console0")
+	defer removeConsoleLogs("rotation")
+
+	writeConsoleLog(t, path, "0123456789ab", "cdefghijklmn", "opq")
+
+	checkFileContent(t, rotatedLogPath(path, 2), "0123456789ab")
+	checkFileContent(t, rotatedLogPath(path, 1), "cdefghijklmn")
+	checkFileContent(t, path, "opq")
+
+	// The oldest output is dropped.
+	writeConsoleLog(t, path, "rstuvwxyz")
+
+	checkFileContent(t, rotatedLogPath(path, 2), "cdefghijklmn")
+	checkFileContent(t, rotatedLogPath(path, 1), "opqrstuvwxyz")
+	checkFileContent(t, path, "")
+
+	if _, err := os.Stat(rotatedLogPath(path, 3)); !os.IsNotExist(err) {
+		t.Fatal("Only 3 log files should be kept")
+	}
+
+	if _, err := os.Stat(path + ".copy"); !os.IsNotExist(err) {
+		t.Fatal("The live log copy should have been renamed")
+	}
+}
+
+func TestPodConsoleLog(t *testing.T) {
+	defer setConsoleLogBounds(10, 3)()
+
+	defer removeConsoleLogs("console-log")
+
+	writeConsoleLog(t, consoleLogPath("console-log", consoleLogName(1, "100")), "container output")
+	writeConsoleLog(t, consoleLogPath("console-log", "console0"), "0123456789", "abcdefghij", "klmnopqrst", "uvwxyz")
+
+	log, err := PodConsoleLog("console-log", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	data, err := ioutil.ReadAll(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "abcdefghijklmnopqrstuvwxyz" {
+		t.Fatalf("Got %q, expecting the main console retained output", data)
+	}
+}
+
+func TestContainerConsoleLog(t *testing.T) {
+	defer removeConsoleLogs("container-console-log")
+
+	writeConsoleLog(t, consoleLogPath("container-console-log", consoleLogName(0, "")), "pod output")
+	writeConsoleLog(t, consoleLogPath("container-console-log", consoleLogName(1, "100")), "first container output")
+	writeConsoleLog(t, consoleLogPath("container-console-log", consoleLogName(2, "container-200")), "second container output")
+
+	for containerID, expected := range map[string]string{
+		"100":           "first container output",
+		"container-200": "second container output",
+	} {
+		log, err := ContainerConsoleLog("container-console-log", containerID, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := ioutil.ReadAll(log)
+		log.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(data) != expected {
+			t.Fatalf("Got %q, expecting %q", data, expected)
+		}
+	}
+
+	if _, err := ContainerConsoleLog("container-console-log", "300", false); err == nil {
+		t.Fatal("Reading the console log of a container without one should fail")
+	}
+
+	if _, err := ContainerConsoleLog("container-console-log", "", false); err != ErrNeedContainerID {
+		t.Fatalf("Got %v, expecting %v", err, ErrNeedContainerID)
+	}
+}
+
+func TestPodConsoleLogFailing(t *testing.T) {
+	if _, err := PodConsoleLog("", false); err != ErrNeedPodID {
+		t.Fatalf("Got %v, expecting %v", err, ErrNeedPodID)
+	}
+
+	if _, err := PodConsoleLog("no-console-log", false); err == nil {
+		t.Fatal("Reading a missing console log should fail")
+	}
+}
+
+// readUntil reads from r until it got expected, or fails after a while.
+func readUntil(t *testing.T, r io.Reader, expected string) {
+	var got bytes.Buffer
+
+	done := make(chan error, 1)
+	go func() {
+		b := make([]byte, 4)
+		for got.Len() < len(expected) {
+			n, err := r.Read(b)
+			got.Write(b[:n])
+			if err != nil {
+				done <- err
+				return
+			}
+		}
+
+		done <- nil
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Timed out reading %q", expected)
+	}
+
+	if got.String() != expected {
+		t.Fatalf("Got %q, expecting %q", got.String(), expected)
+	}
+}
+
+func TestPodConsoleLogFollow(t *testing.T) {
+	defer setConsoleLogBounds(10, 3)()
+
+	path := consoleLogPath("console-log-follow", "console0")
+	defer removeConsoleLogs("console-log-follow")
+
+	w := openTestConsoleLog(t, path)
+	defer w.Close()
+
+	if _, err := w.Write([]byte("booting")); err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := PodConsoleLog("console-log-follow", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	readUntil(t, log, "booting")
+
+	// The output written before a rotation and not read yet is not
+	// lost, nor read twice.
+	if _, err := w.Write([]byte(" the guest")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RotateConsoleLogs(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w.Write([]byte(" kernel")); err != nil {
+		t.Fatal(err)
+	}
+
+	readUntil(t, log, " the guest kernel")
+
+	if _, err := w.Write([]byte(" done")); err != nil {
+		t.Fatal(err)
+	}
+
+	readUntil(t, log, " done")
+
+	closed := make(chan error, 1)
+	go func() {
+		_, err := log.Read(make([]byte, 1))
+		closed <- err
+	}()
+
+	log.Close()
+
+	select {
+	case err := <-closed:
+		if err != io.EOF {
+			t.Fatalf("Got %v, expecting %v", err, io.EOF)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Closing the log should have stopped following it")
+	}
+}
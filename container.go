@@ -17,19 +17,25 @@
 package virtcontainers
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"syscall"
+	"time"
 
 	"github.com/01org/ciao/ssntp/uuid"
-	"github.com/golang/glog"
 )
 
 // Process gathers data related to a container process.
 type Process struct {
 	Token string
 	Pid   int
+
+	// ExitCode and FinishedAt are only meaningful once the process
+	// has exited, i.e. when FinishedAt is not zero.
+	ExitCode   int
+	FinishedAt time.Time
 }
 
 // ContainerStatus describes a container status.
@@ -38,6 +44,11 @@ type ContainerStatus struct {
 	State  State
 	PID    int
 	RootFs string
+
+	// ExitCode is the exit code of the container workload. It is only
+	// meaningful when FinishedAt is not zero.
+	ExitCode   int
+	FinishedAt time.Time
 }
 
 // ContainerConfig describes one container runtime configuration.
@@ -123,22 +134,22 @@ func (c *Container) fetchProcess() (Process, error) {
 }
 
 // fetchContainer fetches a container config from a pod ID and returns a Container.
-func fetchContainer(pod *Pod, containerID string) (*Container, error) {
-	fs := filesystem{}
-	config, err := fs.fetchContainerConfig(pod.id, containerID)
-	if err != nil {
+func fetchContainer(ctx context.Context, pod *Pod, containerID string) (*Container, error) {
+	config, err := pod.storage.fetchContainerConfig(pod.id, containerID)
+	if os.IsNotExist(err) {
+		return nil, &NotFoundError{PodID: pod.id, ContainerID: containerID}
+	} else if err != nil {
 		return nil, err
 	}
 
-	glog.Infof("Info structure:\n%+v\n", config)
+	containerLogger(pod.id, containerID).Debugf("Fetched container config")
 
-	return createContainer(pod, config)
+	return createContainer(ctx, pod, config)
 }
 
 // storeContainer stores a container config.
 func (c *Container) storeContainer() error {
-	fs := filesystem{}
-	err := fs.storeContainerResource(c.pod.id, c.id, configFileType, *(c.config))
+	err := c.pod.storage.storeContainerResource(c.pod.id, c.id, configFileType, *(c.config))
 	if err != nil {
 		return err
 	}
@@ -156,6 +167,13 @@ func (c *Container) setContainerState(state stateString) error {
 		return err
 	}
 
+	events.publish(Event{
+		Type:        ContainerStateChanged,
+		PodID:       c.podID,
+		ContainerID: c.id,
+		State:       state,
+	})
+
 	return nil
 }
 
@@ -211,7 +229,7 @@ func createContainers(pod *Pod, contConfigs []ContainerConfig) ([]*Container, er
 	return containers, nil
 }
 
-func createContainer(pod *Pod, contConfig ContainerConfig) (*Container, error) {
+func createContainer(ctx context.Context, pod *Pod, contConfig ContainerConfig) (*Container, error) {
 	if contConfig.valid() == false {
 		return nil, fmt.Errorf("Invalid container configuration")
 	}
@@ -251,8 +269,8 @@ func createContainer(pod *Pod, contConfig ContainerConfig) (*Container, error) {
 	// specific case.
 	pod.containers = append(pod.containers, c)
 
-	if err := c.pod.agent.createContainer(pod, c); err != nil {
-		return nil, err
+	if err := c.pod.agent.createContainer(ctx, pod, c); err != nil {
+		return nil, &AgentError{Op: "create the container", Err: err}
 	}
 
 	if err := c.pod.setContainerState(c.id, StateReady); err != nil {
@@ -269,7 +287,7 @@ func (c *Container) delete() error {
 	}
 
 	if state.State != StateReady && state.State != StateStopped {
-		return fmt.Errorf("Container not ready or stopped, impossible to delete")
+		return &StateError{PodID: c.podID, ContainerID: c.id, Op: "delete", From: state.State}
 	}
 
 	err = c.pod.storage.deleteContainerResources(c.podID, c.id, nil)
@@ -292,7 +310,7 @@ func (c *Container) fetchState(cmd string) (State, error) {
 	}
 
 	if state.State != StateRunning {
-		return State{}, fmt.Errorf("Pod not running, impossible to %s the container", cmd)
+		return State{}, &StateError{PodID: c.podID, Op: cmd + " the container", From: state.State}
 	}
 
 	state, err = c.pod.storage.fetchContainerState(c.podID, c.id)
@@ -303,14 +321,14 @@ func (c *Container) fetchState(cmd string) (State, error) {
 	return state, nil
 }
 
-func (c *Container) start() error {
+func (c *Container) start(ctx context.Context) error {
 	state, err := c.fetchState("start")
 	if err != nil {
 		return err
 	}
 
 	if state.State != StateReady && state.State != StateStopped {
-		return fmt.Errorf("Container not ready or stopped, impossible to start")
+		return &StateError{PodID: c.podID, ContainerID: c.id, Op: "start", From: state.State, To: StateRunning}
 	}
 
 	err = state.validTransition(StateReady, StateRunning)
@@ -321,10 +339,21 @@ func (c *Container) start() error {
 		}
 	}
 
-	err = c.pod.agent.startContainer(*(c.pod), *c)
+	err = c.pod.agent.startContainer(ctx, *(c.pod), *c)
 	if err != nil {
-		c.stop()
-		return err
+		c.stop(ctx)
+		return &AgentError{Op: "start the container", Err: err}
+	}
+
+	// Forget about any previous run.
+	if !c.process.FinishedAt.IsZero() {
+		c.process.ExitCode = 0
+		c.process.FinishedAt = time.Time{}
+
+		err = c.storeProcess()
+		if err != nil {
+			return err
+		}
 	}
 
 	err = c.setContainerState(StateRunning)
@@ -332,17 +361,19 @@ func (c *Container) start() error {
 		return err
 	}
 
+	c.watch()
+
 	return nil
 }
 
-func (c *Container) stop() error {
+func (c *Container) stop(ctx context.Context) error {
 	state, err := c.fetchState("stop")
 	if err != nil {
 		return err
 	}
 
 	if state.State != StateRunning {
-		return fmt.Errorf("Container not running, impossible to stop")
+		return &StateError{PodID: c.podID, ContainerID: c.id, Op: "stop", From: state.State, To: StateStopped}
 	}
 
 	err = state.validTransition(StateRunning, StateStopped)
@@ -350,14 +381,14 @@ func (c *Container) stop() error {
 		return err
 	}
 
-	err = c.pod.agent.killContainer(*(c.pod), *c, syscall.SIGTERM)
+	err = c.pod.agent.killContainer(ctx, *(c.pod), *c, syscall.SIGTERM)
 	if err != nil {
-		return err
+		return &AgentError{Op: "kill the container", Err: err}
 	}
 
-	err = c.pod.agent.stopContainer(*(c.pod), *c)
+	err = c.pod.agent.stopContainer(ctx, *(c.pod), *c)
 	if err != nil {
-		return err
+		return &AgentError{Op: "stop the container", Err: err}
 	}
 
 	err = c.setContainerState(StateStopped)
@@ -368,35 +399,125 @@ func (c *Container) stop() error {
 	return nil
 }
 
-func (c *Container) enter(cmd Cmd) (*Process, error) {
+func (c *Container) enter(ctx context.Context, cmd Cmd) (*Process, error) {
 	state, err := c.fetchState("enter")
 	if err != nil {
 		return nil, err
 	}
 
 	if state.State != StateRunning {
-		return nil, fmt.Errorf("Container not running, impossible to enter")
+		return nil, &StateError{PodID: c.podID, ContainerID: c.id, Op: "enter", From: state.State}
 	}
 
-	process, err := c.pod.agent.exec(c.pod, *c, cmd)
+	process, err := c.pod.agent.exec(ctx, c.pod, *c, cmd)
 	if err != nil {
-		return nil, err
+		return nil, &AgentError{Op: "enter the container", Err: err}
 	}
 
 	return process, nil
 }
 
-func (c *Container) kill(signal syscall.Signal) error {
+func (c *Container) kill(ctx context.Context, signal syscall.Signal) error {
 	state, err := c.fetchState("signal")
 	if err != nil {
 		return err
 	}
 
 	if state.State != StateRunning {
-		return fmt.Errorf("Container not running, impossible to signal the container")
+		return &StateError{PodID: c.podID, ContainerID: c.id, Op: "signal", From: state.State}
+	}
+
+	err = c.pod.agent.killContainer(ctx, *(c.pod), *c, signal)
+	if err != nil {
+		return &AgentError{Op: "signal the container", Err: err}
+	}
+
+	return nil
+}
+
+// waitCheckState checks the container can be waited for, which is the case
+// when it is running, or when the exit of its workload has been recorded.
+func (c *Container) waitCheckState() error {
+	state, err := c.fetchState("wait for")
+	if err != nil {
+		return err
+	}
+
+	if state.State == StateRunning {
+		return nil
+	}
+
+	if state.State == StateStopped && !c.process.FinishedAt.IsZero() {
+		return nil
+	}
+
+	return &StateError{PodID: c.podID, ContainerID: c.id, Op: "wait for", From: state.State}
+}
+
+// wait waits for the container workload to exit and returns its exit code.
+// As this can take a very long time, it is not supposed to be called with
+// the pod locked.
+func (c *Container) wait(ctx context.Context) (int, error) {
+	exitCode, err := c.pod.agent.waitContainer(ctx, *(c.pod), *c)
+	if err != nil {
+		return exitCode, &AgentError{Op: "wait for the container", Err: err}
+	}
+
+	return exitCode, nil
+}
+
+// watch has the agent report the exit of the container workload, so that
+// its exit code is recorded and the container is stopped even if nobody
+// waits for it. The watch only lives as long as the calling process.
+func (c *Container) watch() {
+	logger := podLogger("container", c.podID).WithFields(Fields{"container": c.id})
+	token := c.process.Token
+
+	err := c.pod.agent.watchContainer(context.Background(), *(c.pod), *c, func(exitCode int) {
+		err := containerExited(context.Background(), c.podID, c.id, token, exitCode)
+		if err != nil {
+			logger.Warnf("Could not record the container exit: %v", err)
+		}
+	})
+	if err != nil {
+		logger.Warnf("Could not watch the container: %v", err)
+	}
+}
+
+// exited records the exit code of the container workload and moves the
+// container to the stopped state, unless it has been stopped meanwhile.
+func (c *Container) exited(ctx context.Context, exitCode int) error {
+	c.process.ExitCode = exitCode
+	c.process.FinishedAt = time.Now().UTC()
+
+	err := c.storeProcess()
+	if err != nil {
+		return err
+	}
+
+	events.publish(Event{
+		Type:        ProcessExited,
+		Time:        c.process.FinishedAt,
+		PodID:       c.podID,
+		ContainerID: c.id,
+		ExitCode:    exitCode,
+	})
+
+	state, err := c.pod.storage.fetchContainerState(c.podID, c.id)
+	if err != nil {
+		return err
+	}
+
+	if state.State != StateRunning {
+		return nil
 	}
 
-	err = c.pod.agent.killContainer(*(c.pod), *c, signal)
+	err = c.pod.agent.stopContainer(ctx, *(c.pod), *c)
+	if err != nil {
+		return &AgentError{Op: "stop the container", Err: err}
+	}
+
+	err = c.setContainerState(StateStopped)
 	if err != nil {
 		return err
 	}
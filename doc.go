@@ -24,5 +24,10 @@ Virtcontainers will create one VM per pod, and containers will be created as
 processes within the pod VM.
 
 The virtcontainers package manages both pods and containers lifecycles.
+
+The pod VM consoles are logged under the runtime configuration ConsoleLogDir.
+The logs are only bounded if RotateConsoleLogs is called periodically, e.g.
+from a timer: virtcontainers is a library, and runs no process of its own
+to rotate them.
 */
 package virtcontainers
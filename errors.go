@@ -18,6 +18,9 @@ package virtcontainers
 
 import (
 	"errors"
+	"fmt"
+	"os"
+	"time"
 )
 
 // common error objects used for argument checking
@@ -25,3 +28,226 @@ var (
 	ErrNeedPodID       = errors.New("Pod ID cannot be empty")
 	ErrNeedContainerID = errors.New("Container ID cannot be empty")
 )
+
+// ErrPodLocked is returned when a pod lock is held by another process for
+// longer than we can wait.
+var ErrPodLocked = errors.New("Pod is locked by another process")
+
+// NotFoundError is returned when a pod, or a container of a pod, does not
+// exist.
+type NotFoundError struct {
+	PodID       string
+	ContainerID string
+}
+
+func (e *NotFoundError) Error() string {
+	if e.ContainerID != "" {
+		return fmt.Sprintf("Container %s of pod %s not found", e.ContainerID, e.PodID)
+	}
+
+	return fmt.Sprintf("Pod %s not found", e.PodID)
+}
+
+// StateError is returned when an operation is not allowed in the current
+// state of a pod, or of a container if ContainerID is set. To is the state
+// the operation would have moved it to, and is empty for the operations
+// not changing its state.
+type StateError struct {
+	PodID       string
+	ContainerID string
+	Op          string
+	From        stateString
+	To          stateString
+}
+
+func (e *StateError) Error() string {
+	var object string
+	switch {
+	case e.ContainerID != "":
+		object = fmt.Sprintf("Container %s", e.ContainerID)
+	case e.PodID != "":
+		object = fmt.Sprintf("Pod %s", e.PodID)
+	}
+
+	if e.To != "" {
+		if object == "" {
+			return fmt.Sprintf("Invalid state transition from %s to %s", e.From, e.To)
+		}
+
+		return fmt.Sprintf("%s: invalid state transition from %s to %s", object, e.From, e.To)
+	}
+
+	return fmt.Sprintf("%s is %s, impossible to %s", object, e.From, e.Op)
+}
+
+// HypervisorError wraps a failure of the hypervisor to carry out Op.
+type HypervisorError struct {
+	Op  string
+	Err error
+}
+
+func (e *HypervisorError) Error() string {
+	return fmt.Sprintf("Hypervisor failed to %s: %s", e.Op, e.Err)
+}
+
+// Unwrap returns the error the hypervisor failed with.
+func (e *HypervisorError) Unwrap() error {
+	return e.Err
+}
+
+// AgentError wraps a failure of the guest agent to carry out Op.
+type AgentError struct {
+	Op  string
+	Err error
+}
+
+func (e *AgentError) Error() string {
+	return fmt.Sprintf("Agent failed to %s: %s", e.Op, e.Err)
+}
+
+// Unwrap returns the error the agent failed with.
+func (e *AgentError) Unwrap() error {
+	return e.Err
+}
+
+// ProxyError wraps a failure of the agent proxy to carry out Op.
+type ProxyError struct {
+	Op  string
+	Err error
+}
+
+func (e *ProxyError) Error() string {
+	return fmt.Sprintf("Proxy failed to %s: %s", e.Op, e.Err)
+}
+
+// Unwrap returns the error the proxy failed with.
+func (e *ProxyError) Unwrap() error {
+	return e.Err
+}
+
+// NetworkError wraps a failure to carry out Op on a pod network.
+type NetworkError struct {
+	Op  string
+	Err error
+}
+
+func (e *NetworkError) Error() string {
+	return fmt.Sprintf("Network failed to %s: %s", e.Op, e.Err)
+}
+
+// Unwrap returns the error the network failed with.
+func (e *NetworkError) Unwrap() error {
+	return e.Err
+}
+
+// TimeoutError is returned when Op did not complete in time.
+type TimeoutError struct {
+	Op      string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("Timed out after %s waiting to %s", e.Timeout, e.Op)
+}
+
+// Cause returns the error at the root of the err wrapping chain.
+func Cause(err error) error {
+	for {
+		wrapper, ok := err.(interface {
+			Unwrap() error
+		})
+		if !ok || wrapper.Unwrap() == nil {
+			return err
+		}
+
+		err = wrapper.Unwrap()
+	}
+}
+
+// findError checks if err, or any of the errors it wraps, matches.
+func findError(err error, match func(error) bool) bool {
+	for err != nil {
+		if match(err) {
+			return true
+		}
+
+		wrapper, ok := err.(interface {
+			Unwrap() error
+		})
+		if !ok {
+			return false
+		}
+
+		err = wrapper.Unwrap()
+	}
+
+	return false
+}
+
+// IsNotFound checks if err comes from a pod or container not existing.
+func IsNotFound(err error) bool {
+	return findError(err, func(err error) bool {
+		_, ok := err.(*NotFoundError)
+		return ok
+	})
+}
+
+// IsInvalidState checks if err comes from an operation not allowed in the
+// current pod or container state.
+func IsInvalidState(err error) bool {
+	return findError(err, func(err error) bool {
+		_, ok := err.(*StateError)
+		return ok
+	})
+}
+
+// IsHypervisorError checks if err comes from a hypervisor failure.
+func IsHypervisorError(err error) bool {
+	return findError(err, func(err error) bool {
+		_, ok := err.(*HypervisorError)
+		return ok
+	})
+}
+
+// IsAgentError checks if err comes from a guest agent failure.
+func IsAgentError(err error) bool {
+	return findError(err, func(err error) bool {
+		_, ok := err.(*AgentError)
+		return ok
+	})
+}
+
+// IsProxyError checks if err comes from an agent proxy failure.
+func IsProxyError(err error) bool {
+	return findError(err, func(err error) bool {
+		_, ok := err.(*ProxyError)
+		return ok
+	})
+}
+
+// IsNetworkError checks if err comes from a pod network failure.
+func IsNetworkError(err error) bool {
+	return findError(err, func(err error) bool {
+		_, ok := err.(*NetworkError)
+		return ok
+	})
+}
+
+// IsTimeout checks if err comes from an operation, or a wait for a pod
+// lock, which did not complete in time.
+func IsTimeout(err error) bool {
+	return findError(err, func(err error) bool {
+		_, ok := err.(*TimeoutError)
+		return ok || err == ErrPodLocked
+	})
+}
+
+// podNotFound turns a storage error about a missing pod into a
+// NotFoundError.
+func podNotFound(podID string, err error) error {
+	if os.IsNotExist(err) {
+		return &NotFoundError{PodID: podID}
+	}
+
+	return err
+}
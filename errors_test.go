@@ -0,0 +1,104 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestErrorPredicates(t *testing.T) {
+	cause := errors.New("cause")
+	timeout := &TimeoutError{Op: "connect", Timeout: time.Second}
+
+	for _, test := range []struct {
+		err        error
+		predicates []func(error) bool
+	}{
+		{&NotFoundError{PodID: "pod"}, []func(error) bool{IsNotFound}},
+		{&StateError{PodID: "pod", Op: "delete", From: StateRunning}, []func(error) bool{IsInvalidState}},
+		{&HypervisorError{Op: "start the VM", Err: timeout}, []func(error) bool{IsHypervisorError, IsTimeout}},
+		{&AgentError{Op: "start", Err: &ProxyError{Op: "connect", Err: cause}}, []func(error) bool{IsAgentError, IsProxyError}},
+		{&NetworkError{Op: "add", Err: cause}, []func(error) bool{IsNetworkError}},
+		{ErrPodLocked, []func(error) bool{IsTimeout}},
+	} {
+		matched := 0
+		for _, predicate := range []func(error) bool{IsNotFound, IsInvalidState, IsHypervisorError,
+			IsAgentError, IsProxyError, IsNetworkError, IsTimeout} {
+			if predicate(test.err) {
+				matched++
+			}
+		}
+
+		if matched != len(test.predicates) {
+			t.Fatalf("%v matched %d predicates, expecting %d", test.err, matched, len(test.predicates))
+		}
+
+		for _, predicate := range test.predicates {
+			if !predicate(test.err) {
+				t.Fatalf("Unexpected predicate failure for %v", test.err)
+			}
+		}
+	}
+
+	if IsNotFound(nil) || IsNotFound(cause) {
+		t.Fatal("Plain errors should not match any predicate")
+	}
+}
+
+func TestErrorCause(t *testing.T) {
+	cause := errors.New("cause")
+	err := &AgentError{Op: "start", Err: &ProxyError{Op: "connect", Err: cause}}
+
+	if Cause(err) != cause {
+		t.Fatalf("Got %v, expecting %v", Cause(err), cause)
+	}
+
+	if Cause(cause) != cause {
+		t.Fatalf("Got %v, expecting %v", Cause(cause), cause)
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	if _, err := StartPod("not-a-pod"); !IsNotFound(err) {
+		t.Fatalf("Got %v, expecting a not found error", err)
+	}
+
+	p, err := RunPod(newTestPodConfigNoop())
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := StatusContainer(p.id, "not-a-container"); !IsNotFound(err) {
+		t.Fatalf("Got %v, expecting a not found error", err)
+	}
+
+	_, err = DeletePod(p.id)
+	if !IsInvalidState(err) {
+		t.Fatalf("Got %v, expecting an invalid state error", err)
+	}
+
+	stateErr, ok := Cause(err).(*StateError)
+	if !ok || stateErr.PodID != p.id || stateErr.From != StateRunning {
+		t.Fatalf("Unexpected state error %+v", err)
+	}
+
+	if _, err := ResumePod(p.id); !IsInvalidState(err) {
+		t.Fatalf("Got %v, expecting an invalid state error", err)
+	}
+}
@@ -0,0 +1,233 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType describes the type of a lifecycle event.
+type EventType string
+
+const (
+	// PodCreated is sent when a pod has been created.
+	PodCreated EventType = "pod-created"
+
+	// PodStarted is sent when a pod has been started.
+	PodStarted EventType = "pod-started"
+
+	// PodPaused is sent when a pod has been paused.
+	PodPaused EventType = "pod-paused"
+
+	// PodResumed is sent when a paused pod has been resumed.
+	PodResumed EventType = "pod-resumed"
+
+	// PodStopped is sent when a pod has been stopped.
+	PodStopped EventType = "pod-stopped"
+
+	// PodDeleted is sent when a pod has been deleted.
+	PodDeleted EventType = "pod-deleted"
+
+	// ContainerStateChanged is sent when a container moves to a new state.
+	ContainerStateChanged EventType = "container-state-changed"
+
+	// PodCrashed is sent when a pod VM went away without being asked to.
+	PodCrashed EventType = "pod-crashed"
+
+	// VMCrashed is sent when a pod VM hypervisor exited without powering
+	// the VM off.
+	VMCrashed EventType = "vm-crashed"
+
+	// VMShutdown is sent when a pod VM has been powered off without being
+	// asked to.
+	VMShutdown EventType = "vm-shutdown"
+
+	// VMPanicked is sent when a pod VM guest kernel panicked.
+	VMPanicked EventType = "vm-panicked"
+
+	// VMReset is sent when a pod VM has been reset without being asked to.
+	VMReset EventType = "vm-reset"
+
+	// VMStopped is sent when a running pod VM execution has been stopped
+	// without being asked to. The pod is then paused.
+	VMStopped EventType = "vm-stopped"
+
+	// ProcessExited is sent when a container workload has exited, as
+	// reported by the agent to the process which started the container
+	// or to a WaitContainer caller.
+	ProcessExited EventType = "process-exited"
+
+	// HookFailed is sent when an OCI hook failed.
+	HookFailed EventType = "hook-failed"
+)
+
+// Event is a pod or container lifecycle event.
+type Event struct {
+	Type EventType
+	Time time.Time
+
+	PodID string
+
+	// ContainerID is empty for pod level events.
+	ContainerID string
+
+	// State is the new state, for state change events.
+	State stateString
+
+	// ExitCode is only set for ProcessExited events.
+	ExitCode int
+
+	// Message gives details about failures.
+	Message string
+}
+
+// EventFilter selects the events a subscriber receives.
+// Empty fields match all events.
+type EventFilter struct {
+	PodID       string
+	ContainerID string
+	Types       []EventType
+}
+
+// match checks if an event goes through the filter.
+func (f EventFilter) match(e Event) bool {
+	if f.PodID != "" && f.PodID != e.PodID {
+		return false
+	}
+
+	if f.ContainerID != "" && f.ContainerID != e.ContainerID {
+		return false
+	}
+
+	if len(f.Types) == 0 {
+		return true
+	}
+
+	for _, t := range f.Types {
+		if t == e.Type {
+			return true
+		}
+	}
+
+	return false
+}
+
+// eventChannelSize is the number of events a subscriber can lag behind
+// before we start dropping events for it.
+const eventChannelSize = 64
+
+type eventSubscriber struct {
+	filter EventFilter
+	ch     chan Event
+}
+
+// eventBus dispatches events to all the subscribers of the current process.
+type eventBus struct {
+	sync.Mutex
+	subscribers map[*eventSubscriber]struct{}
+}
+
+var events = &eventBus{
+	subscribers: make(map[*eventSubscriber]struct{}),
+}
+
+func (b *eventBus) subscribe(filter EventFilter) *eventSubscriber {
+	s := &eventSubscriber{
+		filter: filter,
+		ch:     make(chan Event, eventChannelSize),
+	}
+
+	b.Lock()
+	b.subscribers[s] = struct{}{}
+	b.Unlock()
+
+	return s
+}
+
+func (b *eventBus) unsubscribe(s *eventSubscriber) {
+	b.Lock()
+	defer b.Unlock()
+
+	if _, exist := b.subscribers[s]; !exist {
+		return
+	}
+
+	delete(b.subscribers, s)
+	close(s.ch)
+}
+
+// publish never blocks: an event is dropped for any subscriber not keeping up.
+func (b *eventBus) publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	for s := range b.subscribers {
+		if !s.filter.match(e) {
+			continue
+		}
+
+		select {
+		case s.ch <- e:
+		default:
+			podLogger("events", e.PodID).Warnf("Dropping %s event, subscriber too slow", e.Type)
+		}
+	}
+}
+
+// SubscribeEvents is the virtcontainers entry point to receive lifecycle
+// events. It returns a channel streaming all events matching filter, and a
+// function cancelling the subscription and closing that channel.
+//
+// The event bus is local to the current process: events are only delivered
+// to subscribers living in the process where they happen, there is no cross
+// process transport. Pod and container lifecycle events come from the API
+// calls made by this process, VM events from the monitor of the VMs it
+// launched, and ProcessExited from the agent watch of the containers it
+// started. A process only subscribing gets no events from other processes.
+func SubscribeEvents(filter EventFilter) (<-chan Event, func()) {
+	s := events.subscribe(filter)
+
+	return s.ch, func() {
+		events.unsubscribe(s)
+	}
+}
+
+// podStateEvent maps a pod state transition to its event type.
+func podStateEvent(oldState, newState stateString) EventType {
+	switch newState {
+	case StateReady:
+		return PodCreated
+	case StateRunning:
+		if oldState == StatePaused {
+			return PodResumed
+		}
+		return PodStarted
+	case StatePaused:
+		return PodPaused
+	case StateStopped:
+		return PodStopped
+	case StateCrashed:
+		return PodCrashed
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,137 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func testEventFilterMatch(t *testing.T, filter EventFilter, e Event, expected bool) {
+	if filter.match(e) != expected {
+		t.Fatalf("Filter %+v matching event %+v should be %v", filter, e, expected)
+	}
+}
+
+func TestEventFilterMatch(t *testing.T) {
+	e := Event{
+		Type:        ContainerStateChanged,
+		PodID:       testPodID,
+		ContainerID: "100",
+	}
+
+	testEventFilterMatch(t, EventFilter{}, e, true)
+	testEventFilterMatch(t, EventFilter{PodID: testPodID}, e, true)
+	testEventFilterMatch(t, EventFilter{PodID: "other"}, e, false)
+	testEventFilterMatch(t, EventFilter{ContainerID: "100"}, e, true)
+	testEventFilterMatch(t, EventFilter{ContainerID: "101"}, e, false)
+	testEventFilterMatch(t, EventFilter{Types: []EventType{PodStarted, ContainerStateChanged}}, e, true)
+	testEventFilterMatch(t, EventFilter{Types: []EventType{PodStarted}}, e, false)
+}
+
+func TestPodStateEvent(t *testing.T) {
+	transitions := []struct {
+		oldState stateString
+		newState stateString
+		expected EventType
+	}{
+		{"", StateReady, PodCreated},
+		{StateReady, StateRunning, PodStarted},
+		{StateStopped, StateRunning, PodStarted},
+		{StateRunning, StatePaused, PodPaused},
+		{StatePaused, StateRunning, PodResumed},
+		{StateRunning, StateStopped, PodStopped},
+		{StateRunning, StateCrashed, PodCrashed},
+	}
+
+	for _, tr := range transitions {
+		eventType := podStateEvent(tr.oldState, tr.newState)
+		if eventType != tr.expected {
+			t.Fatalf("Got %s from %s to %s, expecting %s", eventType, tr.oldState, tr.newState, tr.expected)
+		}
+	}
+}
+
+func receiveEvent(t *testing.T, ch <-chan Event) Event {
+	select {
+	case e := <-ch:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for an event")
+	}
+
+	return Event{}
+}
+
+func TestSubscribeEvents(t *testing.T) {
+	ch, cancel := SubscribeEvents(EventFilter{PodID: testPodID})
+	defer cancel()
+
+	events.publish(Event{Type: PodStarted, PodID: "other"})
+	events.publish(Event{Type: PodStarted, PodID: testPodID})
+
+	e := receiveEvent(t, ch)
+	if e.Type != PodStarted || e.PodID != testPodID || e.Time.IsZero() {
+		t.Fatalf("Unexpected event %+v", e)
+	}
+
+	select {
+	case e := <-ch:
+		t.Fatalf("Unexpected event %+v", e)
+	default:
+	}
+}
+
+func TestSubscribeEventsCancel(t *testing.T) {
+	ch, cancel := SubscribeEvents(EventFilter{})
+
+	cancel()
+	cancel()
+
+	if _, ok := <-ch; ok {
+		t.Fatal("Channel should be closed")
+	}
+
+	// Publishing to no subscriber should not panic.
+	events.publish(Event{Type: PodStarted, PodID: testPodID})
+}
+
+func TestSubscribeEventsSlowSubscriber(t *testing.T) {
+	ch, cancel := SubscribeEvents(EventFilter{PodID: testPodID})
+	defer cancel()
+
+	for i := 0; i < eventChannelSize*2; i++ {
+		events.publish(Event{Type: PodStarted, PodID: testPodID})
+	}
+
+	if len(ch) != eventChannelSize {
+		t.Fatalf("Got %d pending events, expecting %d", len(ch), eventChannelSize)
+	}
+}
+
+func TestHookFailedEvent(t *testing.T) {
+	ch, cancel := SubscribeEvents(EventFilter{Types: []EventType{HookFailed}})
+	defer cancel()
+
+	hookFailed(testPodID, "PreStartHook", Hook{Path: "/bin/hook"}, fmt.Errorf("failure"))
+
+	e := receiveEvent(t, ch)
+	if e.PodID != testPodID || e.Message == "" {
+		t.Fatalf("Unexpected event %+v", e)
+	}
+}
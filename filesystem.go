@@ -17,7 +17,6 @@
 package virtcontainers
 
 import (
-	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -42,6 +41,9 @@ const (
 
 	// lockFileType represents a lock file type
 	lockFileType
+
+	// devicesFileType represents a pod devices file type
+	devicesFileType
 )
 
 // configFile is the file name used for every JSON pod configuration.
@@ -56,6 +58,9 @@ const networkFile = "network.json"
 // processFile is the file name storing a container process.
 const processFile = "process.json"
 
+// devicesFile is the file name storing a pod VM devices.
+const devicesFile = "devices.json"
+
 // lockFile is the file name locking the usage of a pod.
 const lockFileName = "lock"
 
@@ -67,11 +72,76 @@ const storagePathSuffix = "/virtcontainers/pods"
 
 // configStoragePath is the pod configuration directory.
 // It will contain one config.json file for each created pod.
-var configStoragePath = filepath.Join("/var/lib", storagePathSuffix)
+var configStoragePath = defaultRuntimeConfig.ConfigStoragePath
 
 // runStoragePath is the pod runtime directory.
 // It will contain one state.json and one lock file for each created pod.
-var runStoragePath = filepath.Join("/run", storagePathSuffix)
+var runStoragePath = defaultRuntimeConfig.RunStoragePath
+
+// StorageType describes a resource storage backend.
+type StorageType string
+
+const (
+	// FilesystemStorage stores every pod and container resource into its
+	// own JSON file.
+	FilesystemStorage StorageType = "filesystem"
+
+	// BoltStorage stores all the pods and containers resources into a
+	// single bbolt database.
+	BoltStorage StorageType = "bolt"
+)
+
+// Set sets a storage type based on the input string.
+func (sType *StorageType) Set(value string) error {
+	switch value {
+	case "filesystem":
+		*sType = FilesystemStorage
+		return nil
+	case "bolt":
+		*sType = BoltStorage
+		return nil
+	default:
+		return fmt.Errorf("Unknown storage type %s", value)
+	}
+}
+
+// String converts a storage type to a string.
+func (sType *StorageType) String() string {
+	switch *sType {
+	case FilesystemStorage:
+		return string(FilesystemStorage)
+	case BoltStorage:
+		return string(BoltStorage)
+	default:
+		return ""
+	}
+}
+
+// storageType is the resource storage backend used by all the API calls.
+var storageType = FilesystemStorage
+
+// SetStorageType selects the resource storage backend. It must be called
+// before any other API call, and all the processes sharing pods must use
+// the same backend.
+func SetStorageType(sType StorageType) error {
+	switch sType {
+	case FilesystemStorage, BoltStorage:
+		storageType = sType
+		return nil
+	default:
+		return fmt.Errorf("Unknown storage type %s", sType)
+	}
+}
+
+// newStorage returns the selected resource storage backend.
+func newStorage() resourceStorage {
+	switch storageType {
+	case BoltStorage:
+		return &boltStorage{}
+	default:
+		return &filesystem{}
+	}
+}
 
 // resourceStorage is the virtcontainers resources (configuration, state, etc...)
 // storage interface.
@@ -80,6 +150,17 @@ type resourceStorage interface {
 	// Create all resources for a pod
 	createAllResources(pod Pod) error
 
+	// listPods returns the IDs of all the stored pods.
+	listPods() ([]string, error)
+
+	// fetchPodStatuses reads the statuses of all the stored pods, in a
+	// single read-only transaction for the backends supporting them.
+	fetchPodStatuses() ([]PodStatus, error)
+
+	// transaction runs fn with a storage whose changes are all applied
+	// or none of them is, for the backends supporting it.
+	transaction(fn func(storage resourceStorage) error) error
+
 	// Resources URIs functions return both the URI
 	// for the actual resource and the URI base.
 	containerURI(podID, containerID string, resource podResource) (string, string, error)
@@ -92,6 +173,8 @@ type resourceStorage interface {
 	fetchPodState(podID string) (State, error)
 	fetchPodNetwork(podID string) (NetworkNamespace, error)
 	storePodNetwork(podID string, networkNS NetworkNamespace) error
+	fetchPodDevices(podID string) (podDevices, error)
+	storePodDevices(podID string, devices podDevices) error
 
 	// Container resources
 	storeContainerResource(podID, containerID string, resource podResource, data interface{}) error
@@ -145,33 +228,90 @@ func (fs *filesystem) createAllResources(pod Pod) (err error) {
 	return nil
 }
 
+func (fs *filesystem) listPods() ([]string, error) {
+	dir, err := os.Open(configStoragePath)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+
+	return dir.Readdirnames(0)
+}
+
+func (fs *filesystem) fetchPodStatuses() ([]PodStatus, error) {
+	return fetchAllPodStatuses(fs)
+}
+
+// transaction runs fn with the filesystem itself, as the filesystem backend
+// does not support transactions.
+func (fs *filesystem) transaction(fn func(storage resourceStorage) error) error {
+	return fn(fs)
+}
+
+// storeFile stores data as a versioned document. The document is written
+// to a temporary file, synced, and then renamed over path, so that path
+// always holds either the previous or the new document, even across a
+// crash.
 func (fs *filesystem) storeFile(path string, data interface{}) error {
-	f, err := os.Create(path)
+	doc, err := encodeDocument(data)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
-	jsonOut, err := json.Marshal(data)
+	dir := filepath.Dir(path)
+
+	f, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".")
 	if err != nil {
-		return fmt.Errorf("Could not marshall data: %s", err)
+		return err
 	}
-	f.Write(jsonOut)
 
-	return nil
+	tmpPath := f.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := f.Write(doc); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	return syncDir(dir)
 }
 
-func (fs *filesystem) fetchFile(path string, data interface{}) error {
-	fileData, err := ioutil.ReadFile(path)
+// syncDir makes a rename into dir durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
 	if err != nil {
 		return err
 	}
+	defer d.Close()
+
+	return d.Sync()
+}
 
-	err = json.Unmarshal([]byte(string(fileData)), data)
+// fetchFile fetches a document stored by storeFile, or by a previous
+// version of virtcontainers, into data.
+func (fs *filesystem) fetchFile(path string, resource podResource, data interface{}) error {
+	fileData, err := ioutil.ReadFile(path)
 	if err != nil {
 		return err
 	}
 
+	if err := decodeDocument(fileData, resource, data); err != nil {
+		return fmt.Errorf("Could not decode %s: %s", path, err)
+	}
+
 	return nil
 }
 
@@ -186,7 +326,7 @@ func resourceDir(podID, containerID string, resource podResource) (string, error
 	case configFileType:
 		path = configStoragePath
 		break
-	case stateFileType, networkFileType, processFileType, lockFileType:
+	case stateFileType, networkFileType, processFileType, lockFileType, devicesFileType:
 		path = runStoragePath
 		break
 	default:
@@ -220,6 +360,8 @@ func (fs *filesystem) resourceURI(podID, containerID string, resource podResourc
 		filename = networkFile
 	case processFileType:
 		filename = processFile
+	case devicesFileType:
+		filename = devicesFile
 	case lockFileType:
 		filename = lockFileName
 		break
@@ -294,6 +436,18 @@ func (fs *filesystem) storeResource(podID, containerID string, resource podResou
 
 		return fs.storeFile(processFile, file)
 
+	case podDevices:
+		if resource != devicesFileType {
+			return fmt.Errorf("Invalid pod resource")
+		}
+
+		devicesFile, _, err := fs.resourceURI(podID, containerID, devicesFileType)
+		if err != nil {
+			return err
+		}
+
+		return fs.storeFile(devicesFile, file)
+
 	default:
 		return fmt.Errorf("Invalid resource data type")
 	}
@@ -309,7 +463,7 @@ func (fs *filesystem) fetchResource(podID, containerID string, resource podResou
 	case configFileType:
 		if containerID == "" {
 			config := PodConfig{}
-			err = fs.fetchFile(path, &config)
+			err = fs.fetchFile(path, resource, &config)
 			if err != nil {
 				return nil, err
 			}
@@ -318,7 +472,7 @@ func (fs *filesystem) fetchResource(podID, containerID string, resource podResou
 		}
 
 		config := ContainerConfig{}
-		err = fs.fetchFile(path, &config)
+		err = fs.fetchFile(path, resource, &config)
 		if err != nil {
 			return nil, err
 		}
@@ -327,7 +481,7 @@ func (fs *filesystem) fetchResource(podID, containerID string, resource podResou
 
 	case stateFileType:
 		state := State{}
-		err = fs.fetchFile(path, &state)
+		err = fs.fetchFile(path, resource, &state)
 		if err != nil {
 			return nil, err
 		}
@@ -336,7 +490,7 @@ func (fs *filesystem) fetchResource(podID, containerID string, resource podResou
 
 	case networkFileType:
 		networkNS := NetworkNamespace{}
-		err = fs.fetchFile(path, &networkNS)
+		err = fs.fetchFile(path, resource, &networkNS)
 		if err != nil {
 			return nil, err
 		}
@@ -345,12 +499,21 @@ func (fs *filesystem) fetchResource(podID, containerID string, resource podResou
 
 	case processFileType:
 		process := Process{}
-		err = fs.fetchFile(path, &process)
+		err = fs.fetchFile(path, resource, &process)
 		if err != nil {
 			return nil, err
 		}
 
 		return process, nil
+
+	case devicesFileType:
+		devices := podDevices{}
+		err = fs.fetchFile(path, resource, &devices)
+		if err != nil {
+			return nil, err
+		}
+
+		return devices, nil
 	}
 
 	return nil, fmt.Errorf("Invalid pod resource")
@@ -406,6 +569,24 @@ func (fs *filesystem) storePodNetwork(podID string, networkNS NetworkNamespace)
 	return fs.storePodResource(podID, networkFileType, networkNS)
 }
 
+func (fs *filesystem) fetchPodDevices(podID string) (podDevices, error) {
+	data, err := fs.fetchResource(podID, "", devicesFileType)
+	if err != nil {
+		return podDevices{}, err
+	}
+
+	switch devices := data.(type) {
+	case podDevices:
+		return devices, nil
+	}
+
+	return podDevices{}, fmt.Errorf("Unknown devices type")
+}
+
+func (fs *filesystem) storePodDevices(podID string, devices podDevices) error {
+	return fs.storePodResource(podID, devicesFileType, devices)
+}
+
 func (fs *filesystem) deletePodResources(podID string, resources []podResource) error {
 	if resources == nil {
 		resources = []podResource{configFileType, stateFileType}
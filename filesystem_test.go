@@ -136,7 +136,7 @@ func TestFilesystemStoreFileSuccessfulNotExisting(t *testing.T) {
 		Field2: "value2",
 	}
 
-	expected := "{\"Field1\":\"value1\",\"Field2\":\"value2\"}"
+	expected := "{\"schemaVersion\":1,\"data\":{\"Field1\":\"value1\",\"Field2\":\"value2\"}}"
 
 	err := fs.storeFile(path, data)
 	if err != nil {
@@ -170,7 +170,7 @@ func TestFilesystemStoreFileSuccessfulExisting(t *testing.T) {
 		Field2: "value2",
 	}
 
-	expected := "{\"Field1\":\"value1\",\"Field2\":\"value2\"}"
+	expected := "{\"schemaVersion\":1,\"data\":{\"Field1\":\"value1\",\"Field2\":\"value2\"}}"
 
 	err = fs.storeFile(path, data)
 	if err != nil {
@@ -201,6 +201,49 @@ func TestFilesystemStoreFileFailingMarshalling(t *testing.T) {
 	}
 }
 
+func TestFilesystemStoreFileKeepsPreviousOnFailure(t *testing.T) {
+	fs := &filesystem{}
+
+	dir, err := ioutil.TempDir(testDir, "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "testFilesystem")
+
+	data := TestNoopStructure{
+		Field1: "value1",
+		Field2: "value2",
+	}
+
+	if err := fs.storeFile(path, data); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fs.storeFile(path, make(chan bool)); err == nil {
+		t.Fatal()
+	}
+
+	fetched := TestNoopStructure{}
+	if err := fs.fetchFile(path, configFileType, &fetched); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(fetched, data) {
+		t.Fatalf("Got %+v, expecting %+v", fetched, data)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 1 {
+		t.Fatalf("Temporary files left behind in %s: %d files", dir, len(files))
+	}
+}
+
 func TestFilesystemFetchFileSuccessful(t *testing.T) {
 	fs := &filesystem{}
 	data := TestNoopStructure{}
@@ -221,7 +264,7 @@ func TestFilesystemFetchFileSuccessful(t *testing.T) {
 	}
 	f.Close()
 
-	err = fs.fetchFile(path, &data)
+	err = fs.fetchFile(path, configFileType, &data)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -243,7 +286,7 @@ func TestFilesystemFetchFileFailingNoFile(t *testing.T) {
 	path := filepath.Join(testDir, "testFilesystem")
 	os.Remove(path)
 
-	err := fs.fetchFile(path, &data)
+	err := fs.fetchFile(path, configFileType, &data)
 	if err == nil {
 		t.Fatal()
 	}
@@ -262,7 +305,7 @@ func TestFilesystemFetchFileFailingUnMarshalling(t *testing.T) {
 	}
 	f.Close()
 
-	err = fs.fetchFile(path, data)
+	err = fs.fetchFile(path, configFileType, data)
 	if err == nil {
 		t.Fatal()
 	}
@@ -426,3 +469,38 @@ func TestFilesystemFetchResourceFailingWrongResourceType(t *testing.T) {
 		t.Fatal()
 	}
 }
+
+func TestStorageTypeSetAndString(t *testing.T) {
+	for _, value := range []string{"filesystem", "bolt"} {
+		var sType StorageType
+
+		if err := sType.Set(value); err != nil {
+			t.Fatal(err)
+		}
+
+		if sType.String() != value {
+			t.Fatalf("Got %s, expecting %s", sType.String(), value)
+		}
+	}
+
+	var sType StorageType
+	if err := sType.Set("foo"); err == nil {
+		t.Fatal("Setting an unknown storage type should fail")
+	}
+}
+
+func TestSetStorageType(t *testing.T) {
+	defer SetStorageType(storageType)
+
+	if err := SetStorageType(BoltStorage); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := newStorage().(*boltStorage); !ok {
+		t.Fatal("The bbolt storage should have been selected")
+	}
+
+	if err := SetStorageType(StorageType("foo")); err == nil {
+		t.Fatal("Setting an unknown storage type should fail")
+	}
+}
@@ -0,0 +1,582 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// gcGracePeriod protects the resources being created from the garbage
+// collector: nothing modified more recently than that is considered leaked.
+var gcGracePeriod = time.Minute
+
+// mountInfoPath is the mount table of the current process.
+var mountInfoPath = "/proc/self/mountinfo"
+
+// GCOptions tunes the garbage collector.
+type GCOptions struct {
+	// Clean removes the leaked resources. They are only reported otherwise.
+	Clean bool
+}
+
+// LeakType describes the type of a leaked resource.
+type LeakType string
+
+const (
+	// LeakedPod is a pod whose VM is gone, or whose storage is incomplete.
+	LeakedPod LeakType = "pod"
+
+	// LeakedPooledVM is a pre-booted VM from a VM pool whose VM is gone.
+	LeakedPooledVM LeakType = "pooled-vm"
+
+	// LeakedNetNS is a network namespace no pod refers to.
+	LeakedNetNS LeakType = "netns"
+
+	// LeakedSharedDir is a hyperstart shared directory no pod refers to.
+	LeakedSharedDir LeakType = "shared-dir"
+
+	// LeakedMount is a container rootfs still bind mounted into a leaked
+	// hyperstart shared directory.
+	LeakedMount LeakType = "mount"
+
+	// LeakedSocket is a hyperstart socket no VM listens to.
+	LeakedSocket LeakType = "socket"
+
+	// LeakedConsoleLog is the console logs directory of a pod which no
+	// longer exists, once consoleLogRetention has passed.
+	LeakedConsoleLog LeakType = "console-log"
+)
+
+// Leak describes a leaked resource.
+type Leak struct {
+	Type LeakType
+
+	// ID is the pod or VM ID for pods and pooled VMs, and the host path
+	// for all other resources.
+	ID string
+
+	// Reason tells why the resource is considered leaked.
+	Reason string
+
+	// Cleaned is true if the resource has been removed.
+	Cleaned bool
+
+	// Error is the reason why the resource could not be removed.
+	Error string
+}
+
+// GCReport lists the leaked resources found by the garbage collector.
+type GCReport struct {
+	Leaks []Leak
+}
+
+// dialSocket checks that a process is listening to a unix socket.
+func dialSocket(ctx context.Context, path string) error {
+	var d net.Dialer
+
+	conn, err := d.DialContext(ctx, "unix", path)
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
+
+// recentlyModified returns true if path has been modified during the
+// garbage collector grace period. Missing files are not.
+func recentlyModified(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	return time.Since(info.ModTime()) < gcGracePeriod
+}
+
+// listDir returns the names of the entries of dir, if it exists.
+func listDir(dir string) ([]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+
+	return names, nil
+}
+
+// unescapeMountPath decodes the octal escapes of a mountinfo path.
+func unescapeMountPath(path string) string {
+	var b bytes.Buffer
+
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if c, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+
+		b.WriteByte(path[i])
+	}
+
+	return b.String()
+}
+
+// mountPointsUnder returns the mount points below dir, the deepest first.
+func mountPointsUnder(dir string) ([]string, error) {
+	f, err := os.Open(mountInfoPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	prefix := filepath.Clean(dir) + "/"
+
+	var mounts []string
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+
+		mountPoint := unescapeMountPath(fields[4])
+		if strings.HasPrefix(mountPoint, prefix) {
+			mounts = append(mounts, mountPoint)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// Children sort after their parents.
+	sort.Sort(sort.Reverse(sort.StringSlice(mounts)))
+
+	return mounts, nil
+}
+
+// gcCollector walks the host looking for leaked resources. The resources
+// of the live pods and pooled VMs are recorded while walking the pods, so
+// that everything else can be found leaked afterwards.
+type gcCollector struct {
+	ctx    context.Context
+	opts   GCOptions
+	report GCReport
+
+	// live holds the IDs of the pods and pooled VMs whose VM is alive.
+	live map[string]bool
+
+	// netNSPaths holds the network namespaces of the live pods.
+	netNSPaths map[string]bool
+}
+
+func (gc *gcCollector) logger(leak Leak) Logger {
+	fields := Fields{
+		SubsystemField: "gc",
+		OperationField: "clean",
+	}
+
+	if leak.Type == LeakedPod {
+		fields[PodIDField] = leak.ID
+	}
+
+	return GetLogger().WithFields(fields)
+}
+
+// found records a leaked resource, and removes it if we are asked to.
+func (gc *gcCollector) found(leak Leak, clean func() error) {
+	if gc.opts.Clean {
+		if err := clean(); err != nil {
+			gc.logger(leak).Errorf("Could not clean leaked %s %s: %s", leak.Type, leak.ID, err)
+			leak.Error = err.Error()
+		} else {
+			gc.logger(leak).Infof("Cleaned leaked %s %s", leak.Type, leak.ID)
+			leak.Cleaned = true
+		}
+	}
+
+	gc.report.Leaks = append(gc.report.Leaks, leak)
+}
+
+// podStale checks if a pod is leaked, and returns the reason why.
+func (gc *gcCollector) podStale(podID string) (string, bool) {
+	storage := newStorage()
+
+	config, err := storage.fetchPodConfig(podID)
+	if err != nil {
+		return "missing configuration", true
+	}
+
+	if _, err := storage.fetchPodState(podID); err != nil {
+		return "missing state", true
+	}
+
+	// Pods get their VM when they are created, and keep it until they are
+	// deleted, whatever their state.
+	if err := pingPodVM(gc.ctx, config); err != nil {
+		return fmt.Sprintf("VM is gone: %s", err), true
+	}
+
+	return "", false
+}
+
+// cleanPod removes a leaked pod network and storage. Its shared directory,
+// sockets and network namespace are left for the next steps to find.
+func (gc *gcCollector) cleanPod(podID string) error {
+	storage := newStorage()
+
+	// A locked pod is being operated on, hence alive.
+	lockFile, err := tryLockPod(podID, exclusiveLock)
+	if err == ErrPodLocked {
+		return err
+	} else if err == nil {
+		defer unlockPod(lockFile)
+
+		// The pod may have been deleted or fixed since we checked it.
+		if _, stale := gc.podStale(podID); !stale {
+			return fmt.Errorf("Pod %s is not leaked anymore", podID)
+		}
+	}
+
+	config, err := storage.fetchPodConfig(podID)
+	if err == nil {
+		networkNS, err := storage.fetchPodNetwork(podID)
+		if err == nil && networkNS.NetNsPath != "" {
+			p := Pod{
+				id:      podID,
+				config:  &config,
+				storage: storage,
+			}
+
+			if err := newNetwork(config.NetworkModel).remove(gc.ctx, p, networkNS); err != nil {
+				podLogger("gc", podID).Warnf("Could not remove pod network: %s", err)
+			}
+		}
+	}
+
+	if err := storage.deletePodResources(podID, nil); err != nil {
+		return err
+	}
+
+	events.publish(Event{
+		Type:  PodDeleted,
+		PodID: podID,
+	})
+
+	return nil
+}
+
+func (gc *gcCollector) collectPods() error {
+	configIDs, err := newStorage().listPods()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	runIDs, err := listDir(runStoragePath)
+	if err != nil {
+		return err
+	}
+
+	podIDs := make(map[string]bool)
+	for _, id := range append(configIDs, runIDs...) {
+		if !strings.HasPrefix(id, pooledVMPrefix) {
+			podIDs[id] = true
+		}
+	}
+
+	for podID := range podIDs {
+		if err := gc.ctx.Err(); err != nil {
+			return err
+		}
+
+		reason, stale := gc.podStale(podID)
+
+		if stale && (recentlyModified(filepath.Join(configStoragePath, podID)) ||
+			recentlyModified(filepath.Join(runStoragePath, podID))) {
+			stale = false
+		}
+
+		if !stale {
+			gc.live[podID] = true
+			gc.addNetNSPaths(podID)
+			continue
+		}
+
+		id := podID
+		gc.found(Leak{Type: LeakedPod, ID: id, Reason: reason}, func() error {
+			return gc.cleanPod(id)
+		})
+	}
+
+	return nil
+}
+
+func (gc *gcCollector) addNetNSPaths(podID string) {
+	storage := newStorage()
+
+	if config, err := storage.fetchPodConfig(podID); err == nil && config.NetworkConfig.NetNSPath != "" {
+		gc.netNSPaths[config.NetworkConfig.NetNSPath] = true
+	}
+
+	if networkNS, err := storage.fetchPodNetwork(podID); err == nil && networkNS.NetNsPath != "" {
+		gc.netNSPaths[networkNS.NetNsPath] = true
+	}
+}
+
+func (gc *gcCollector) collectPooledVMs() error {
+	runIDs, err := listDir(runStoragePath)
+	if err != nil {
+		return err
+	}
+
+	vms := make(map[string]bool)
+
+	for _, vmID := range runIDs {
+		if !strings.HasPrefix(vmID, pooledVMPrefix) {
+			continue
+		}
+
+		vms[vmID] = true
+
+		runPath := filepath.Join(runStoragePath, vmID)
+		err := dialSocket(gc.ctx, filepath.Join(runPath, controlSocket))
+		if err == nil || recentlyModified(runPath) {
+			gc.live[vmID] = true
+			continue
+		}
+
+		id := vmID
+		gc.found(Leak{Type: LeakedPooledVM, ID: id, Reason: fmt.Sprintf("VM is gone: %s", err)}, func() error {
+			readyFiles, err := filepath.Glob(filepath.Join(vmPoolDir("*"), id))
+			if err != nil {
+				return err
+			}
+
+			for _, f := range readyFiles {
+				if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+					return err
+				}
+			}
+
+			return removePooledVMResources(pooledVM{ID: id})
+		})
+	}
+
+	// Ready VMs are published once their run directory exists.
+	readyFiles, err := filepath.Glob(filepath.Join(vmPoolDir("*"), pooledVMPrefix+"*"))
+	if err != nil {
+		return err
+	}
+
+	for _, f := range readyFiles {
+		if vms[filepath.Base(f)] || recentlyModified(f) {
+			continue
+		}
+
+		path := f
+		gc.found(Leak{Type: LeakedPooledVM, ID: filepath.Base(f), Reason: "missing run directory"}, func() error {
+			return os.Remove(path)
+		})
+	}
+
+	return nil
+}
+
+func (gc *gcCollector) collectSharedDirs() error {
+	ids, err := listDir(defaultSharedDir)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		dir := filepath.Join(defaultSharedDir, id)
+
+		if gc.live[id] || recentlyModified(dir) {
+			continue
+		}
+
+		mounts, err := mountPointsUnder(dir)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range mounts {
+			mountPoint := m
+			gc.found(Leak{Type: LeakedMount, ID: mountPoint, Reason: "no pod " + id}, func() error {
+				return unix.Unmount(mountPoint, unix.MNT_DETACH)
+			})
+		}
+
+		gc.found(Leak{Type: LeakedSharedDir, ID: dir, Reason: "no pod " + id}, func() error {
+			// Never remove a directory some container rootfs is still
+			// bind mounted into.
+			mounts, err := mountPointsUnder(dir)
+			if err != nil {
+				return err
+			}
+
+			if len(mounts) > 0 {
+				return fmt.Errorf("%s still has %d mounts", dir, len(mounts))
+			}
+
+			return os.RemoveAll(dir)
+		})
+	}
+
+	return nil
+}
+
+func (gc *gcCollector) collectSockets() error {
+	for _, template := range defaultSockPathTemplates {
+		sockets, err := filepath.Glob(strings.Replace(template, "%s", "*", 1))
+		if err != nil {
+			return err
+		}
+
+		for _, socket := range sockets {
+			err := dialSocket(gc.ctx, socket)
+			if err == nil || recentlyModified(socket) {
+				continue
+			}
+
+			path := socket
+			gc.found(Leak{Type: LeakedSocket, ID: path, Reason: err.Error()}, func() error {
+				return os.Remove(path)
+			})
+		}
+	}
+
+	return nil
+}
+
+func (gc *gcCollector) collectNetNS() error {
+	names, err := listDir(netNSOwnerDir())
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		ownerFile := filepath.Join(netNSOwnerDir(), name)
+
+		data, err := ioutil.ReadFile(ownerFile)
+		if err != nil {
+			continue
+		}
+
+		path := string(data)
+		if gc.netNSPaths[path] || recentlyModified(ownerFile) {
+			continue
+		}
+
+		gc.found(Leak{Type: LeakedNetNS, ID: path, Reason: "no pod"}, func() error {
+			// Removing a leaked pod may have removed it already.
+			if _, err := os.Stat(path); os.IsNotExist(err) {
+				return os.Remove(ownerFile)
+			}
+
+			return deleteNetNS(path, true)
+		})
+	}
+
+	return nil
+}
+
+// collectConsoleLogs finds the console logs of the pods which no longer
+// exist. They are kept for a while after their pod is deleted, for the VMs
+// which failed to boot to be debugged.
+func (gc *gcCollector) collectConsoleLogs() error {
+	podIDs, err := listDir(consoleLogDir)
+	if err != nil {
+		return err
+	}
+
+	storage := newStorage()
+
+	for _, podID := range podIDs {
+		dir := podConsoleLogDir(podID)
+
+		if _, err := storage.fetchPodConfig(podID); err == nil {
+			continue
+		}
+
+		if info, err := os.Stat(dir); err != nil || time.Since(info.ModTime()) < consoleLogRetention {
+			continue
+		}
+
+		id := podID
+		gc.found(Leak{Type: LeakedConsoleLog, ID: dir, Reason: "no pod " + id}, func() error {
+			return removeConsoleLogs(id)
+		})
+	}
+
+	return nil
+}
+
+// garbageCollect finds the resources leaked by crashed or killed processes,
+// and removes them if opts.Clean is set. The pods are collected first, for
+// their resources to be found leaked by the next steps.
+func garbageCollect(ctx context.Context, opts GCOptions) (GCReport, error) {
+	gc := &gcCollector{
+		ctx:        ctx,
+		opts:       opts,
+		live:       make(map[string]bool),
+		netNSPaths: make(map[string]bool),
+	}
+
+	steps := []func() error{
+		gc.collectPods,
+		gc.collectPooledVMs,
+		gc.collectSharedDirs,
+		gc.collectSockets,
+		gc.collectNetNS,
+		gc.collectConsoleLogs,
+	}
+
+	for _, step := range steps {
+		if err := ctx.Err(); err != nil {
+			return gc.report, err
+		}
+
+		if err := step(); err != nil {
+			return gc.report, err
+		}
+	}
+
+	return gc.report, nil
+}
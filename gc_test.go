@@ -0,0 +1,374 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// gcTestEnv points the garbage collector to a temporary host.
+type gcTestEnv struct {
+	dir string
+
+	savedGracePeriod   time.Duration
+	savedSharedDir     string
+	savedSockTemplates []string
+	savedMountInfoPath string
+	savedConsoleLogDir string
+}
+
+func newGCTestEnv(t *testing.T) *gcTestEnv {
+	dir, err := ioutil.TempDir(testDir, "gc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := &gcTestEnv{
+		dir:                dir,
+		savedGracePeriod:   gcGracePeriod,
+		savedSharedDir:     defaultSharedDir,
+		savedSockTemplates: defaultSockPathTemplates,
+		savedMountInfoPath: mountInfoPath,
+		savedConsoleLogDir: consoleLogDir,
+	}
+
+	gcGracePeriod = 0
+	defaultSharedDir = filepath.Join(dir, "shared")
+	defaultSockPathTemplates = []string{filepath.Join(dir, "hyper-pod-%s.sock")}
+	mountInfoPath = filepath.Join(dir, "mountinfo")
+	consoleLogDir = filepath.Join(dir, "consoles")
+
+	for _, d := range []string{defaultSharedDir, filepath.Join(dir, "netns"), netNSOwnerDir()} {
+		if err := os.MkdirAll(d, dirMode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := ioutil.WriteFile(mountInfoPath, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return env
+}
+
+func (env *gcTestEnv) restore() {
+	gcGracePeriod = env.savedGracePeriod
+	defaultSharedDir = env.savedSharedDir
+	defaultSockPathTemplates = env.savedSockTemplates
+	mountInfoPath = env.savedMountInfoPath
+	consoleLogDir = env.savedConsoleLogDir
+
+	os.RemoveAll(env.dir)
+}
+
+// createStalePod creates a QEMU pod without any QEMU running it.
+func createStalePod(t *testing.T) *Pod {
+	config := newTestPodConfigNoop()
+	config.HypervisorType = QemuHypervisor
+
+	p, err := createPod(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.storePod(); err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+func findLeak(report GCReport, leakType LeakType, id string) (Leak, bool) {
+	for _, leak := range report.Leaks {
+		if leak.Type == leakType && leak.ID == id {
+			return leak, true
+		}
+	}
+
+	return Leak{}, false
+}
+
+func TestUnescapeMountPath(t *testing.T) {
+	path := unescapeMountPath(`/tmp/with\040space/and\134backslash`)
+	if path != `/tmp/with space/and\backslash` {
+		t.Fatalf("Unexpected path %q", path)
+	}
+}
+
+func TestMountPointsUnder(t *testing.T) {
+	env := newGCTestEnv(t)
+	defer env.restore()
+
+	mountInfo := `22 1 8:1 / / rw,relatime - ext4 /dev/sda1 rw
+40 22 8:1 /bundle /tmp/shared/pod/c1/rootfs rw,relatime - ext4 /dev/sda1 rw
+41 22 8:1 /bundle /tmp/shared/pod/c1/rootfs/proc rw,relatime - proc proc rw
+42 22 8:1 /bundle /tmp/shared/pod2/c1/rootfs rw,relatime - ext4 /dev/sda1 rw
+43 22 8:1 /bundle /tmp/shared/pod/c\0402/rootfs rw,relatime - ext4 /dev/sda1 rw
+`
+	if err := ioutil.WriteFile(mountInfoPath, []byte(mountInfo), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	mounts, err := mountPointsUnder("/tmp/shared/pod")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"/tmp/shared/pod/c1/rootfs/proc",
+		"/tmp/shared/pod/c1/rootfs",
+		"/tmp/shared/pod/c 2/rootfs",
+	}
+
+	if !reflect.DeepEqual(mounts, expected) {
+		t.Fatalf("Got %v, expecting %v", mounts, expected)
+	}
+}
+
+func TestGarbageCollectReport(t *testing.T) {
+	env := newGCTestEnv(t)
+	defer env.restore()
+
+	stale := createStalePod(t)
+	defer stale.storage.deletePodResources(stale.id, nil)
+
+	live, err := CreatePod(newTestPodConfigNoop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sharedDir := filepath.Join(defaultSharedDir, stale.id)
+	if err := os.MkdirAll(sharedDir, dirMode); err != nil {
+		t.Fatal(err)
+	}
+
+	socket := filepath.Join(env.dir, "hyper-pod-"+stale.id+".sock")
+	if err := ioutil.WriteFile(socket, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	netNS := filepath.Join(env.dir, "netns", "cni-leaked")
+	if err := ioutil.WriteFile(netNS, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(netNSOwnerFile(netNS), []byte(netNS), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(netNSOwnerFile(netNS))
+
+	// Created by another virtcontainers instance.
+	otherNetNS := filepath.Join(env.dir, "netns", "cni-other")
+	if err := ioutil.WriteFile(otherNetNS, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := GarbageCollect(GCOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []Leak{
+		{Type: LeakedPod, ID: stale.id},
+		{Type: LeakedSharedDir, ID: sharedDir},
+		{Type: LeakedSocket, ID: socket},
+		{Type: LeakedNetNS, ID: netNS},
+	} {
+		leak, ok := findLeak(report, expected.Type, expected.ID)
+		if !ok {
+			t.Fatalf("Leaked %s %s not found in %+v", expected.Type, expected.ID, report)
+		}
+
+		if leak.Cleaned {
+			t.Fatalf("Leaked %s %s should not have been cleaned", expected.Type, expected.ID)
+		}
+	}
+
+	if _, ok := findLeak(report, LeakedPod, live.id); ok {
+		t.Fatalf("Live pod %s reported as leaked", live.id)
+	}
+
+	if _, ok := findLeak(report, LeakedNetNS, otherNetNS); ok {
+		t.Fatal("Network namespaces not created by us should not be reported")
+	}
+
+	if _, err := os.Stat(filepath.Join(configStoragePath, stale.id)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGarbageCollectClean(t *testing.T) {
+	env := newGCTestEnv(t)
+	defer env.restore()
+
+	stale := createStalePod(t)
+
+	sharedDir := filepath.Join(defaultSharedDir, stale.id)
+	if err := os.MkdirAll(filepath.Join(sharedDir, "c1", "rootfs"), dirMode); err != nil {
+		t.Fatal(err)
+	}
+
+	socket := filepath.Join(env.dir, "hyper-pod-"+stale.id+".sock")
+	if err := ioutil.WriteFile(socket, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := GarbageCollect(GCOptions{Clean: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, leakType := range []LeakType{LeakedPod, LeakedSharedDir, LeakedSocket} {
+		id := stale.id
+		switch leakType {
+		case LeakedSharedDir:
+			id = sharedDir
+		case LeakedSocket:
+			id = socket
+		}
+
+		leak, ok := findLeak(report, leakType, id)
+		if !ok || !leak.Cleaned {
+			t.Fatalf("Leaked %s %s has not been cleaned: %+v", leakType, id, leak)
+		}
+	}
+
+	for _, path := range []string{
+		filepath.Join(configStoragePath, stale.id),
+		filepath.Join(runStoragePath, stale.id),
+		sharedDir,
+		socket,
+	} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("%s should have been removed", path)
+		}
+	}
+}
+
+func TestGarbageCollectKeepsMountedSharedDir(t *testing.T) {
+	env := newGCTestEnv(t)
+	defer env.restore()
+
+	sharedDir := filepath.Join(defaultSharedDir, "gone")
+	rootfs := filepath.Join(sharedDir, "c1", "rootfs")
+	if err := os.MkdirAll(rootfs, dirMode); err != nil {
+		t.Fatal(err)
+	}
+
+	// The fake mount table never changes, as if unmounting failed.
+	mountInfo := "40 22 8:1 /bundle " + rootfs + " rw,relatime - ext4 /dev/sda1 rw\n"
+	if err := ioutil.WriteFile(mountInfoPath, []byte(mountInfo), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := GarbageCollect(GCOptions{Clean: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := findLeak(report, LeakedMount, rootfs); !ok {
+		t.Fatalf("Leaked mount %s not found in %+v", rootfs, report)
+	}
+
+	leak, ok := findLeak(report, LeakedSharedDir, sharedDir)
+	if !ok || leak.Cleaned {
+		t.Fatalf("Shared directory %s should have been kept: %+v", sharedDir, leak)
+	}
+
+	if _, err := os.Stat(rootfs); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGarbageCollectGracePeriod(t *testing.T) {
+	env := newGCTestEnv(t)
+	defer env.restore()
+
+	stale := createStalePod(t)
+	defer stale.storage.deletePodResources(stale.id, nil)
+
+	gcGracePeriod = env.savedGracePeriod
+
+	report, err := GarbageCollect(GCOptions{Clean: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := findLeak(report, LeakedPod, stale.id); ok {
+		t.Fatalf("Pod %s has just been created, it should not be reported", stale.id)
+	}
+}
+
+func TestGarbageCollectConsoleLogs(t *testing.T) {
+	env := newGCTestEnv(t)
+	defer env.restore()
+
+	live, err := CreatePod(newTestPodConfigNoop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeConsoleLog(t, consoleLogPath(live.id, "console0"), "live")
+	writeConsoleLog(t, consoleLogPath("deleted", "console0"), "deleted")
+
+	report, err := GarbageCollect(GCOptions{Clean: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := findLeak(report, LeakedConsoleLog, podConsoleLogDir("deleted")); ok {
+		t.Fatal("Console logs should be kept for a while after their pod is deleted")
+	}
+
+	savedRetention := consoleLogRetention
+	defer func() { consoleLogRetention = savedRetention }()
+	consoleLogRetention = 0
+
+	report, err = GarbageCollect(GCOptions{Clean: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leak, ok := findLeak(report, LeakedConsoleLog, podConsoleLogDir("deleted"))
+	if !ok || !leak.Cleaned {
+		t.Fatalf("Deleted pod console logs have not been cleaned: %+v", report)
+	}
+
+	if _, ok := findLeak(report, LeakedConsoleLog, podConsoleLogDir(live.id)); ok {
+		t.Fatalf("Live pod %s console logs reported as leaked", live.id)
+	}
+
+	if _, err := os.Stat(podConsoleLogDir(live.id)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGarbageCollectCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := GarbageCollectWithContext(ctx, GCOptions{})
+	if err != context.Canceled {
+		t.Fatalf("Got %v, expecting %v", err, context.Canceled)
+	}
+}
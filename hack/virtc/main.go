@@ -19,8 +19,10 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/user"
+	"sort"
 	"strings"
 	"text/tabwriter"
 
@@ -58,6 +60,24 @@ var podConfigFlags = []cli.Flag{
 		Usage: "the agent's proxy",
 	},
 
+	cli.GenericFlag{
+		Name:  "image-transport",
+		Value: new(vc.ImageTransport),
+		Usage: "how the guest image is exposed to the VM (nvdimm, virtio-blk or virtio-scsi)",
+	},
+
+	cli.StringFlag{
+		Name:  "machine-type",
+		Value: "",
+		Usage: "the VM machine type (pc-lite by default)",
+	},
+
+	cli.GenericFlag{
+		Name:  "accelerator",
+		Value: new(vc.Accelerator),
+		Usage: "the VM accelerator (kvm or tcg)",
+	},
+
 	cli.StringFlag{
 		Name:  "proxy-url",
 		Value: "",
@@ -165,6 +185,16 @@ func buildPodConfig(context *cli.Context) (vc.PodConfig, error) {
 		return vc.PodConfig{}, fmt.Errorf("Could not convert proxy type")
 	}
 
+	imageTransport, ok := context.Generic("image-transport").(*vc.ImageTransport)
+	if ok != true {
+		return vc.PodConfig{}, fmt.Errorf("Could not convert image transport")
+	}
+
+	accelerator, ok := context.Generic("accelerator").(*vc.Accelerator)
+	if ok != true {
+		return vc.PodConfig{}, fmt.Errorf("Could not convert accelerator")
+	}
+
 	volumes, ok := context.Generic("volume").(*vc.Volumes)
 	if ok != true {
 		return vc.PodConfig{}, fmt.Errorf("Could not convert to volume list")
@@ -184,6 +214,9 @@ func buildPodConfig(context *cli.Context) (vc.PodConfig, error) {
 		KernelPath:     "/usr/share/clear-containers/vmlinux.container",
 		ImagePath:      "/usr/share/clear-containers/clear-containers.img",
 		HypervisorPath: "/usr/bin/qemu-lite-system-x86_64",
+		ImageTransport: *imageTransport,
+		MachineType:    context.String("machine-type"),
+		Accelerator:    *accelerator,
 	}
 
 	netConfig := vc.NetworkConfig{
@@ -381,6 +414,24 @@ func stopPod(context *cli.Context) error {
 	return nil
 }
 
+func pausePod(context *cli.Context) error {
+	_, err := vc.PausePod(context.String("id"))
+	if err != nil {
+		return fmt.Errorf("Could not pause pod: %s", err)
+	}
+
+	return nil
+}
+
+func resumePod(context *cli.Context) error {
+	_, err := vc.ResumePod(context.String("id"))
+	if err != nil {
+		return fmt.Errorf("Could not resume pod: %s", err)
+	}
+
+	return nil
+}
+
 func listPods(context *cli.Context) error {
 	podStatusList, err := vc.ListPod()
 	if err != nil {
@@ -423,6 +474,27 @@ func statusPod(context *cli.Context) error {
 	return nil
 }
 
+func podLogs(context *cli.Context) error {
+	var log io.ReadCloser
+	var err error
+
+	if containerID := context.String("container"); containerID != "" {
+		log, err = vc.ContainerConsoleLog(context.String("id"), containerID, context.Bool("follow"))
+	} else {
+		log, err = vc.PodConsoleLog(context.String("id"), context.Bool("follow"))
+	}
+	if err != nil {
+		return fmt.Errorf("Could not get pod console log: %s", err)
+	}
+	defer log.Close()
+
+	if _, err := io.Copy(os.Stdout, log); err != nil {
+		return fmt.Errorf("Could not read pod console log: %s", err)
+	}
+
+	return nil
+}
+
 var runPodCommand = cli.Command{
 	Name:  "run",
 	Usage: "run a pod",
@@ -486,6 +558,36 @@ var stopPodCommand = cli.Command{
 	},
 }
 
+var pausePodCommand = cli.Command{
+	Name:  "pause",
+	Usage: "pause an existing pod",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "id",
+			Value: "",
+			Usage: "the pod identifier",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		return checkPodArgs(context, pausePod)
+	},
+}
+
+var resumePodCommand = cli.Command{
+	Name:  "resume",
+	Usage: "resume a paused pod",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "id",
+			Value: "",
+			Usage: "the pod identifier",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		return checkPodArgs(context, resumePod)
+	},
+}
+
 var listPodsCommand = cli.Command{
 	Name:  "list",
 	Usage: "list all existing pods",
@@ -509,6 +611,30 @@ var statusPodCommand = cli.Command{
 	},
 }
 
+var logsPodCommand = cli.Command{
+	Name:  "logs",
+	Usage: "prints a pod VM console log",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "id",
+			Value: "",
+			Usage: "the pod identifier",
+		},
+		cli.StringFlag{
+			Name:  "container",
+			Value: "",
+			Usage: "print the console log of this non interactive container instead",
+		},
+		cli.BoolFlag{
+			Name:  "follow",
+			Usage: "wait for more output at the end of the log",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		return checkPodArgs(context, podLogs)
+	},
+}
+
 func createContainer(context *cli.Context) error {
 	console := context.String("console")
 
@@ -760,6 +886,159 @@ var statusContainerCommand = cli.Command{
 	},
 }
 
+var gcFormat = "%s\t%s\t%s\t%s\n"
+
+func garbageCollect(context *cli.Context) error {
+	report, err := vc.GarbageCollect(vc.GCOptions{
+		Clean: context.Bool("clean"),
+	})
+	if err != nil {
+		return fmt.Errorf("Could not collect garbage: %s", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 2, 8, 1, '\t', 0)
+	fmt.Fprintf(w, gcFormat, "TYPE", "ID", "REASON", "CLEANED")
+
+	for _, leak := range report.Leaks {
+		cleaned := fmt.Sprint(leak.Cleaned)
+		if leak.Error != "" {
+			cleaned = leak.Error
+		}
+
+		fmt.Fprintf(w, gcFormat, leak.Type, leak.ID, leak.Reason, cleaned)
+	}
+
+	w.Flush()
+
+	return nil
+}
+
+var gcCommand = cli.Command{
+	Name:  "gc",
+	Usage: "report leaked pods and host resources",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "clean",
+			Usage: "remove the leaked resources",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		return garbageCollect(context)
+	},
+}
+
+var rotateLogsCommand = cli.Command{
+	Name:  "rotate-logs",
+	Usage: "rotate the pod VM console logs",
+	Action: func(context *cli.Context) error {
+		if err := vc.RotateConsoleLogs(); err != nil {
+			return fmt.Errorf("Could not rotate the console logs: %s", err)
+		}
+
+		return nil
+	},
+}
+
+var checkFormat = "%s\t%v\n"
+
+func checkHypervisor(context *cli.Context) error {
+	caps, err := vc.CheckHypervisor(vc.HypervisorConfig{
+		HypervisorPath: context.String("hypervisor-path"),
+	})
+	if err != nil {
+		return fmt.Errorf("Could not check the hypervisor: %s", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 2, 8, 1, '\t', 0)
+	fmt.Fprintf(w, checkFormat, "PATH", caps.Path)
+	fmt.Fprintf(w, checkFormat, "VERSION", caps.Version)
+	fmt.Fprintf(w, checkFormat, "MACHINE TYPES", strings.Join(caps.MachineTypes, ","))
+	fmt.Fprintf(w, checkFormat, "ACCELERATORS", strings.Join(caps.Accelerators, ","))
+	fmt.Fprintf(w, checkFormat, "NVDIMM", caps.NVDIMM)
+	fmt.Fprintf(w, checkFormat, "KVM", caps.KVM)
+	fmt.Fprintf(w, checkFormat, "SUPPORTED", caps.Supported())
+
+	for _, missing := range caps.Missing {
+		fmt.Fprintf(w, checkFormat, "MISSING", missing)
+	}
+
+	w.Flush()
+
+	return nil
+}
+
+var checkCommand = cli.Command{
+	Name:  "check",
+	Usage: "check that the hypervisor can run pods",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "hypervisor-path",
+			Value: "/usr/bin/qemu-lite-system-x86_64",
+			Usage: "the hypervisor binary",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		return checkHypervisor(context)
+	},
+}
+
+// glogLogger is the virtcontainers Logger of virtc, logging through glog.
+// Debug entries are V(1) entries.
+type glogLogger struct {
+	fields vc.Fields
+}
+
+func (l glogLogger) WithFields(fields vc.Fields) vc.Logger {
+	merged := vc.Fields{}
+
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+
+	for k, v := range fields {
+		merged[k] = v
+	}
+
+	return glogLogger{fields: merged}
+}
+
+func (l glogLogger) format(format string, args ...interface{}) string {
+	var keys []string
+	for k := range l.fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	msg := fmt.Sprintf(format, args...)
+	for _, k := range keys {
+		msg += fmt.Sprintf(" %s=%v", k, l.fields[k])
+	}
+
+	return msg
+}
+
+func (l glogLogger) DebugEnabled() bool {
+	return bool(glog.V(1))
+}
+
+func (l glogLogger) Debugf(format string, args ...interface{}) {
+	if glog.V(1) {
+		glog.InfoDepth(1, l.format(format, args...))
+	}
+}
+
+func (l glogLogger) Infof(format string, args ...interface{}) {
+	glog.InfoDepth(1, l.format(format, args...))
+}
+
+func (l glogLogger) Warnf(format string, args ...interface{}) {
+	glog.WarningDepth(1, l.format(format, args...))
+}
+
+func (l glogLogger) Errorf(format string, args ...interface{}) {
+	glog.ErrorDepth(1, l.format(format, args...))
+}
+
 func glogFlagShim(fakeVals map[string]string) {
 	flag.VisitAll(func(fl *flag.Flag) {
 		if val, ok := fakeVals[fl.Name]; ok {
@@ -832,7 +1111,10 @@ func main() {
 				runPodCommand,
 				startPodCommand,
 				stopPodCommand,
+				pausePodCommand,
+				resumePodCommand,
 				statusPodCommand,
+				logsPodCommand,
 			},
 		},
 		{
@@ -847,9 +1129,38 @@ func main() {
 				statusContainerCommand,
 			},
 		},
+		gcCommand,
+		rotateLogsCommand,
+		checkCommand,
 	}
 
 	virtc.Flags = append(virtc.Flags, glogFlags...)
+	virtc.Flags = append(virtc.Flags, cli.GenericFlag{
+		Name:  "storage",
+		Value: new(vc.StorageType),
+		Usage: "the pods storage backend (filesystem or bolt)",
+	})
+	virtc.Flags = append(virtc.Flags, cli.StringFlag{
+		Name:  "root",
+		Value: "",
+		Usage: "the directory to keep all the pods resources under",
+	})
+	virtc.Before = func(c *cli.Context) error {
+		vc.SetLogger(glogLogger{})
+
+		if root := c.String("root"); root != "" {
+			if err := vc.SetRuntimeConfig(vc.RuntimeConfig{Root: root}); err != nil {
+				return err
+			}
+		}
+
+		sType, ok := c.Generic("storage").(*vc.StorageType)
+		if !ok || *sType == "" {
+			return nil
+		}
+
+		return vc.SetStorageType(*sType)
+	}
 	virtc.Action = func(c *cli.Context) error {
 		glogShim(c)
 		return nil
@@ -24,7 +24,6 @@ import (
 	"os/exec"
 	"time"
 
-	"github.com/golang/glog"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 )
 
@@ -41,6 +40,10 @@ type Hooks struct {
 	PreStartHooks  []Hook
 	PostStartHooks []Hook
 	PostStopHooks  []Hook
+
+	// PostStopOnVMExit runs the PostStopHooks when the VM of a started
+	// pod goes away without being asked to.
+	PostStopOnVMExit bool
 }
 
 func buildHookState(processID int) specs.State {
@@ -87,22 +90,41 @@ func (h *Hook) runHook() error {
 				return fmt.Errorf("%s: stdout: %s, stderr: %s", err, stdout.String(), stderr.String())
 			}
 		case <-time.After(time.Duration(h.Timeout) * time.Second):
-			return fmt.Errorf("Hook timeout")
+			return &TimeoutError{Op: "run hook " + h.Path, Timeout: time.Duration(h.Timeout) * time.Second}
 		}
 	}
 
 	return nil
 }
 
-func (h *Hooks) preStartHooks() error {
+// hookFailed reports a hook failure to the event subscribers.
+func hookFailed(podID string, hookType string, hook Hook, err error) {
+	events.publish(Event{
+		Type:    HookFailed,
+		PodID:   podID,
+		Message: fmt.Sprintf("%s %s: %s", hookType, hook.Path, err),
+	})
+}
+
+func hookLogger(podID, hookType string, hook Hook) Logger {
+	return podLogger("hook", podID).WithFields(Fields{
+		OperationField: hookType,
+		"path":         hook.Path,
+	})
+}
+
+func (h *Hooks) preStartHooks(podID string) error {
 	if len(h.PreStartHooks) == 0 {
 		return nil
 	}
 
 	for _, hook := range h.PreStartHooks {
+		begin := time.Now()
 		err := hook.runHook()
+		observeHook("PreStartHook", begin, err)
 		if err != nil {
-			glog.Errorf("PreStartHook error: %s\n", err)
+			hookLogger(podID, "PreStartHook", hook).Errorf("Hook failed: %s", err)
+			hookFailed(podID, "PreStartHook", hook, err)
 			return err
 		}
 	}
@@ -110,34 +132,40 @@ func (h *Hooks) preStartHooks() error {
 	return nil
 }
 
-func (h *Hooks) postStartHooks() error {
+func (h *Hooks) postStartHooks(podID string) error {
 	if len(h.PostStartHooks) == 0 {
 		return nil
 	}
 
 	for _, hook := range h.PostStartHooks {
+		begin := time.Now()
 		err := hook.runHook()
+		observeHook("PostStartHook", begin, err)
 		if err != nil {
 			// In case of post start hook, the error is not fatal,
 			// just need to be logged.
-			glog.Infof("PostStartHook error: %s\n", err)
+			hookLogger(podID, "PostStartHook", hook).Warnf("Hook failed: %s", err)
+			hookFailed(podID, "PostStartHook", hook, err)
 		}
 	}
 
 	return nil
 }
 
-func (h *Hooks) postStopHooks() error {
+func (h *Hooks) postStopHooks(podID string) error {
 	if len(h.PostStopHooks) == 0 {
 		return nil
 	}
 
 	for _, hook := range h.PostStopHooks {
+		begin := time.Now()
 		err := hook.runHook()
+		observeHook("PostStopHook", begin, err)
 		if err != nil {
 			// In case of post stop hook, the error is not fatal,
 			// just need to be logged.
-			glog.Infof("PostStopHook error: %s\n", err)
+			hookLogger(podID, "PostStopHook", hook).Warnf("Hook failed: %s", err)
+			hookFailed(podID, "PostStopHook", hook, err)
 		}
 	}
 
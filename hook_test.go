@@ -104,17 +104,17 @@ func testHooks(t *testing.T, hook *Hook) {
 		PostStopHooks:  []Hook{*hook},
 	}
 
-	err := hooks.preStartHooks()
+	err := hooks.preStartHooks(testPodID)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	err = hooks.postStartHooks()
+	err = hooks.postStartHooks(testPodID)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	err = hooks.postStopHooks()
+	err = hooks.postStopHooks(testPodID)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -127,17 +127,17 @@ func testFailingHooks(t *testing.T, hook *Hook) {
 		PostStopHooks:  []Hook{*hook},
 	}
 
-	err := hooks.preStartHooks()
+	err := hooks.preStartHooks(testPodID)
 	if err == nil {
 		t.Fatal(err)
 	}
 
-	err = hooks.postStartHooks()
+	err = hooks.postStartHooks(testPodID)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	err = hooks.postStopHooks()
+	err = hooks.postStopHooks(testPodID)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -158,17 +158,17 @@ func TestFailingHooks(t *testing.T) {
 func TestEmptyHooks(t *testing.T) {
 	hooks := &Hooks{}
 
-	err := hooks.preStartHooks()
+	err := hooks.preStartHooks(testPodID)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	err = hooks.postStartHooks()
+	err = hooks.postStartHooks(testPodID)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	err = hooks.postStopHooks()
+	err = hooks.postStopHooks(testPodID)
 	if err != nil {
 		t.Fatal(err)
 	}
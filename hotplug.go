@@ -0,0 +1,221 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/01org/ciao/ssntp/uuid"
+	"github.com/containernetworking/cni/pkg/ns"
+)
+
+// checkRunning checks that the pod is running, as its VM devices can only
+// be hot plugged then.
+func (p *Pod) checkRunning(op string) error {
+	state, err := p.storage.fetchPodState(p.id)
+	if err != nil {
+		return err
+	}
+
+	if state.State != StateRunning {
+		return &StateError{PodID: p.id, Op: op, From: state.State}
+	}
+
+	return nil
+}
+
+// addNetworkInterface hot plugs a network interface into the VM of a
+// running pod. The interface must already exist in the pod network
+// namespace, endpoint giving its name and properties. It is bridged to a
+// new TAP interface, and the agent sets it up in the guest.
+func (p *Pod) addNetworkInterface(ctx context.Context, endpoint Endpoint) (Endpoint, error) {
+	if err := p.checkRunning("hot plug a network interface"); err != nil {
+		return Endpoint{}, err
+	}
+
+	ifName := endpoint.NetPair.VirtIface.Name
+	if ifName == "" {
+		return Endpoint{}, fmt.Errorf("Network interface name cannot be empty")
+	}
+
+	networkNS, err := p.storage.fetchPodNetwork(p.id)
+	if err != nil {
+		return Endpoint{}, err
+	}
+
+	if networkNS.NetNsPath == "" {
+		return Endpoint{}, fmt.Errorf("Pod %s has no network namespace", p.id)
+	}
+
+	devices, err := p.storage.fetchPodDevices(p.id)
+	if err != nil {
+		return Endpoint{}, err
+	}
+
+	taps := make(map[string]bool)
+	for _, e := range networkNS.Endpoints {
+		if e.NetPair.VirtIface.Name == ifName {
+			return Endpoint{}, fmt.Errorf("Pod %s already has a %s network interface", p.id, ifName)
+		}
+
+		taps[e.NetPair.TAPIface.Name] = true
+	}
+
+	// The endpoint index names its TAP interface and bridge.
+	idx := 0
+	for taps[fmt.Sprintf("tap%d", idx)] {
+		idx++
+	}
+
+	newEndpoint, err := createNetworkEndpoint(idx, uuid.Generate().String(), ifName)
+	if err != nil {
+		return Endpoint{}, err
+	}
+	newEndpoint.Properties = endpoint.Properties
+
+	rb := &rollback{}
+	defer rb.run()
+
+	err = doNetNS(networkNS.NetNsPath, func(_ ns.NetNS) error {
+		return bridgeNetworkPair(newEndpoint.NetPair)
+	})
+	if err != nil {
+		return Endpoint{}, err
+	}
+
+	rb.add("network pair "+newEndpoint.NetPair.Name, unBridgeNetworkPairFunc(networkNS.NetNsPath, newEndpoint.NetPair))
+
+	err = p.network.run(networkNS.NetNsPath, func() error {
+		return p.hypervisor.hotplugAddDevice(ctx, newEndpoint, netDev)
+	})
+	if err != nil {
+		return Endpoint{}, &HypervisorError{Op: "hot plug a network interface", Err: err}
+	}
+
+	rb.add("network interface "+ifName, func() error {
+		return p.network.run(networkNS.NetNsPath, func() error {
+			return p.hypervisor.hotplugRemoveDevice(context.Background(), newEndpoint, netDev)
+		})
+	})
+
+	err = p.agent.addInterface(ctx, *p, newEndpoint)
+	if err != nil {
+		return Endpoint{}, &AgentError{Op: "set up the hot plugged network interface", Err: err}
+	}
+
+	rb.add("network interface setup "+ifName, func() error {
+		return p.agent.removeInterface(context.Background(), *p, newEndpoint)
+	})
+
+	networkNS.Endpoints = append(networkNS.Endpoints, newEndpoint)
+	devices.Interfaces = append(devices.Interfaces, ifName)
+
+	err = p.storage.transaction(func(storage resourceStorage) error {
+		if err := storage.storePodNetwork(p.id, networkNS); err != nil {
+			return err
+		}
+
+		return storage.storePodDevices(p.id, devices)
+	})
+	if err != nil {
+		return Endpoint{}, err
+	}
+
+	rb.commit()
+
+	p.logger().Infof("Hot plugged network interface %s", ifName)
+
+	return newEndpoint, nil
+}
+
+// removeNetworkInterface has the agent tear down a network interface
+// addNetworkInterface hot plugged, hot unplugs it from the VM of a running
+// pod, and unbridges it. The interface is left in the pod network namespace.
+// The interfaces the VM booted with cannot be removed.
+func (p *Pod) removeNetworkInterface(ctx context.Context, ifName string) error {
+	if err := p.checkRunning("hot unplug a network interface"); err != nil {
+		return err
+	}
+
+	networkNS, err := p.storage.fetchPodNetwork(p.id)
+	if err != nil {
+		return err
+	}
+
+	devices, err := p.storage.fetchPodDevices(p.id)
+	if err != nil {
+		return err
+	}
+
+	hotplugged := -1
+	for j, name := range devices.Interfaces {
+		if name == ifName {
+			hotplugged = j
+			break
+		}
+	}
+
+	if hotplugged < 0 {
+		return fmt.Errorf("Pod %s has no hot plugged %s network interface", p.id, ifName)
+	}
+
+	for i, endpoint := range networkNS.Endpoints {
+		if endpoint.NetPair.VirtIface.Name != ifName {
+			continue
+		}
+
+		err = p.agent.removeInterface(ctx, *p, endpoint)
+		if err != nil {
+			return &AgentError{Op: "tear down the hot plugged network interface", Err: err}
+		}
+
+		err = p.network.run(networkNS.NetNsPath, func() error {
+			return p.hypervisor.hotplugRemoveDevice(ctx, endpoint, netDev)
+		})
+		if err != nil {
+			return &HypervisorError{Op: "hot unplug a network interface", Err: err}
+		}
+
+		err = doNetNS(networkNS.NetNsPath, func(_ ns.NetNS) error {
+			return unBridgeNetworkPair(endpoint.NetPair)
+		})
+		if err != nil {
+			return err
+		}
+
+		networkNS.Endpoints = append(networkNS.Endpoints[:i], networkNS.Endpoints[i+1:]...)
+		devices.Interfaces = append(devices.Interfaces[:hotplugged], devices.Interfaces[hotplugged+1:]...)
+
+		err = p.storage.transaction(func(storage resourceStorage) error {
+			if err := storage.storePodNetwork(p.id, networkNS); err != nil {
+				return err
+			}
+
+			return storage.storePodDevices(p.id, devices)
+		})
+		if err != nil {
+			return err
+		}
+
+		p.logger().Infof("Hot unplugged network interface %s", ifName)
+
+		return nil
+	}
+
+	return fmt.Errorf("Pod %s has no %s network interface", p.id, ifName)
+}
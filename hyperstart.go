@@ -17,21 +17,25 @@
 package virtcontainers
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"syscall"
-
-	"github.com/golang/glog"
+	"time"
 
 	"github.com/containers/virtcontainers/pkg/hyperstart"
 )
 
-var defaultSockPathTemplates = []string{"/tmp/hyper-pod-%s.sock", "/tmp/tty-pod%s.sock"}
+var defaultSockPathTemplates = []string{
+	filepath.Join(defaultRuntimeConfig.SocketDir, hyperCtlSockTemplate),
+	filepath.Join(defaultRuntimeConfig.SocketDir, hyperTtySockTemplate),
+}
 var defaultChannelTemplate = "sh.hyper.channel.%d"
 var defaultDeviceIDTemplate = "channel%d"
 var defaultIDTemplate = "charch%d"
-var defaultSharedDir = "/tmp/hyper/shared/pods/"
+var defaultSharedDir = defaultRuntimeConfig.SharedDir
 var defaultPauseBinDir = "/usr/bin/"
 var mountTag = "hyperShared"
 var rootfsDir = "rootfs"
@@ -54,8 +58,6 @@ type HyperConfig struct {
 
 func (c *HyperConfig) validate(pod Pod) bool {
 	if len(c.Sockets) == 0 {
-		glog.Infof("No sockets from configuration\n")
-
 		podSocketPaths := []string{
 			fmt.Sprintf(defaultSockPathTemplates[0], pod.id),
 			fmt.Sprintf(defaultSockPathTemplates[1], pod.id),
@@ -83,7 +85,7 @@ func (c *HyperConfig) validate(pod Pod) bool {
 		c.PauseBinPath = filepath.Join(defaultPauseBinDir, pauseBinName)
 	}
 
-	glog.Infof("Hyperstart config %v\n", c)
+	podLogger("hyperstart", pod.id).Debugf("Hyperstart config %+v", c)
 
 	return true
 }
@@ -100,6 +102,15 @@ type hyperstartProxyCmd struct {
 	token   string
 }
 
+// sendCmd sends a hyperstart command through the proxy.
+func (h *hyper) sendCmd(ctx context.Context, proxyCmd hyperstartProxyCmd) error {
+	begin := time.Now()
+	_, err := h.proxy.sendCmd(ctx, proxyCmd)
+	observeHyperstartCommand(proxyCmd.cmd, begin, err)
+
+	return err
+}
+
 func (h *hyper) buildHyperContainerProcess(cmd Cmd, terminal bool) (*hyperstart.Process, error) {
 	var envVars []hyperstart.EnvironmentVar
 
@@ -124,6 +135,57 @@ func (h *hyper) buildHyperContainerProcess(cmd Cmd, terminal bool) (*hyperstart.
 	return process, nil
 }
 
+// buildNetworkInterfaceAndRoutes builds the hyperstart interface and
+// routes of a network endpoint, netIface being its virtual interface.
+func buildNetworkInterfaceAndRoutes(endpoint Endpoint, netIface net.Interface) (hyperstart.NetworkIface, []hyperstart.Route) {
+	var ipAddrs []hyperstart.IPAddress
+	for _, ipConfig := range endpoint.Properties.IPs {
+		// Skip IPv6 because not supported by hyperstart
+		if ipConfig.Version == "6" || ipConfig.Address.IP.To4() == nil {
+			continue
+		}
+
+		netMask, _ := ipConfig.Address.Mask.Size()
+
+		ipAddr := hyperstart.IPAddress{
+			IPAddress: ipConfig.Address.IP.String(),
+			NetMask:   fmt.Sprintf("%d", netMask),
+		}
+
+		ipAddrs = append(ipAddrs, ipAddr)
+	}
+
+	iface := hyperstart.NetworkIface{
+		NewDevice:   endpoint.NetPair.VirtIface.Name,
+		IPAddresses: ipAddrs,
+		MTU:         fmt.Sprintf("%d", netIface.MTU),
+		MACAddr:     endpoint.NetPair.VirtIface.HardAddr,
+	}
+
+	var routes []hyperstart.Route
+	for _, r := range endpoint.Properties.Routes {
+		// Skip IPv6 because not supported by hyperstart
+		if r.Dst.IP.To4() == nil {
+			continue
+		}
+
+		gateway := r.GW.String()
+		if gateway == "<nil>" {
+			gateway = ""
+		}
+
+		route := hyperstart.Route{
+			Dest:    r.Dst.String(),
+			Gateway: gateway,
+			Device:  endpoint.NetPair.VirtIface.Name,
+		}
+
+		routes = append(routes, route)
+	}
+
+	return iface, routes
+}
+
 func (h *hyper) buildNetworkInterfacesAndRoutes(pod Pod) ([]hyperstart.NetworkIface, []hyperstart.Route, error) {
 	networkNS, err := pod.storage.fetchPodNetwork(pod.id)
 	if err != nil {
@@ -147,51 +209,10 @@ func (h *hyper) buildNetworkInterfacesAndRoutes(pod Pod) ([]hyperstart.NetworkIf
 			return []hyperstart.NetworkIface{}, []hyperstart.Route{}, err
 		}
 
-		var ipAddrs []hyperstart.IPAddress
-		for _, ipConfig := range endpoint.Properties.IPs {
-			// Skip IPv6 because not supported by hyperstart
-			if ipConfig.Version == "6" || ipConfig.Address.IP.To4() == nil {
-				continue
-			}
-
-			netMask, _ := ipConfig.Address.Mask.Size()
-
-			ipAddr := hyperstart.IPAddress{
-				IPAddress: ipConfig.Address.IP.String(),
-				NetMask:   fmt.Sprintf("%d", netMask),
-			}
-
-			ipAddrs = append(ipAddrs, ipAddr)
-		}
-
-		iface := hyperstart.NetworkIface{
-			NewDevice:   endpoint.NetPair.VirtIface.Name,
-			IPAddresses: ipAddrs,
-			MTU:         fmt.Sprintf("%d", netIface.MTU),
-			MACAddr:     endpoint.NetPair.VirtIface.HardAddr,
-		}
+		iface, ifaceRoutes := buildNetworkInterfaceAndRoutes(endpoint, netIface)
 
 		ifaces = append(ifaces, iface)
-
-		for _, r := range endpoint.Properties.Routes {
-			// Skip IPv6 because not supported by hyperstart
-			if r.Dst.IP.To4() == nil {
-				continue
-			}
-
-			gateway := r.GW.String()
-			if gateway == "<nil>" {
-				gateway = ""
-			}
-
-			route := hyperstart.Route{
-				Dest:    r.Dst.String(),
-				Gateway: gateway,
-				Device:  endpoint.NetPair.VirtIface.Name,
-			}
-
-			routes = append(routes, route)
-		}
+		routes = append(routes, ifaceRoutes...)
 	}
 
 	return ifaces, routes, nil
@@ -228,6 +249,22 @@ func (h *hyper) bindUnmountContainerRootfs(podID, cID string) error {
 	return nil
 }
 
+// rootfsDrive returns the drive a block device or image container rootfs
+// was passed through as.
+func (h *hyper) rootfsDrive(pod Pod, c Container) (rootfsDrive, error) {
+	devices, err := pod.storage.fetchPodDevices(pod.id)
+	if err != nil {
+		return rootfsDrive{}, fmt.Errorf("Container %s rootfs %s was not passed through: %s", c.id, c.rootFs, err)
+	}
+
+	drive, ok := devices.rootfsDrive(c.id)
+	if !ok {
+		return rootfsDrive{}, fmt.Errorf("Container %s rootfs %s can only be passed through when the pod is created", c.id, c.rootFs)
+	}
+
+	return drive, nil
+}
+
 func (h *hyper) bindUnmountAllRootfs(pod Pod) {
 	for _, c := range pod.containers {
 		h.bindUnmountContainerRootfs(pod.id, c.id)
@@ -287,10 +324,12 @@ func (h *hyper) init(pod *Pod, config interface{}) (err error) {
 }
 
 // start is the agent starting implementation for hyperstart.
-func (h *hyper) start(pod *Pod) error {
-	proxyInfos, url, err := h.proxy.register(*pod)
+func (h *hyper) start(ctx context.Context, pod *Pod) error {
+	span, proxyCtx := pod.startSpan(ctx, "proxy.register")
+	proxyInfos, url, err := h.proxy.register(proxyCtx, *pod)
+	finishSpan(span, err)
 	if err != nil {
-		return err
+		return &ProxyError{Op: "register the pod", Err: err}
 	}
 
 	if len(proxyInfos) != len(pod.containers) {
@@ -309,27 +348,35 @@ func (h *hyper) start(pod *Pod) error {
 		}
 	}
 
-	return h.proxy.disconnect()
+	if err := h.proxy.disconnect(); err != nil {
+		return &ProxyError{Op: "disconnect", Err: err}
+	}
+
+	return nil
 }
 
 // stop is the agent stopping implementation for hyperstart.
-func (h *hyper) stop(pod Pod) error {
-	if _, _, err := h.proxy.connect(pod, false); err != nil {
-		return err
+func (h *hyper) stop(ctx context.Context, pod Pod) error {
+	if _, _, err := h.proxy.connect(ctx, pod, false); err != nil {
+		return &ProxyError{Op: "connect", Err: err}
 	}
 
-	if err := h.proxy.unregister(pod); err != nil {
-		return err
+	if err := h.proxy.unregister(ctx, pod); err != nil {
+		return &ProxyError{Op: "unregister the pod", Err: err}
 	}
 
-	return h.proxy.disconnect()
+	if err := h.proxy.disconnect(); err != nil {
+		return &ProxyError{Op: "disconnect", Err: err}
+	}
+
+	return nil
 }
 
 // exec is the agent command execution implementation for hyperstart.
-func (h *hyper) exec(pod *Pod, c Container, cmd Cmd) (*Process, error) {
-	proxyInfo, url, err := h.proxy.connect(*pod, true)
+func (h *hyper) exec(ctx context.Context, pod *Pod, c Container, cmd Cmd) (*Process, error) {
+	proxyInfo, url, err := h.proxy.connect(ctx, *pod, true)
 	if err != nil {
-		return nil, err
+		return nil, &ProxyError{Op: "connect", Err: err}
 	}
 
 	pod.url = url
@@ -350,12 +397,12 @@ func (h *hyper) exec(pod *Pod, c Container, cmd Cmd) (*Process, error) {
 		token:   proxyInfo.Token,
 	}
 
-	if _, err := h.proxy.sendCmd(proxyCmd); err != nil {
-		return nil, err
+	if err := h.sendCmd(ctx, proxyCmd); err != nil {
+		return nil, &ProxyError{Op: "send a command", Err: err}
 	}
 
 	if err := h.proxy.disconnect(); err != nil {
-		return nil, err
+		return nil, &ProxyError{Op: "disconnect", Err: err}
 	}
 
 	processInfo := &Process{
@@ -366,10 +413,10 @@ func (h *hyper) exec(pod *Pod, c Container, cmd Cmd) (*Process, error) {
 }
 
 // startPod is the agent Pod starting implementation for hyperstart.
-func (h *hyper) startPod(pod Pod) error {
-	proxyInfo, _, err := h.proxy.connect(pod, true)
+func (h *hyper) startPod(ctx context.Context, pod Pod) error {
+	proxyInfo, _, err := h.proxy.connect(ctx, pod, true)
 	if err != nil {
-		return err
+		return &ProxyError{Op: "connect", Err: err}
 	}
 
 	ifaces, routes, err := h.buildNetworkInterfacesAndRoutes(pod)
@@ -390,27 +437,31 @@ func (h *hyper) startPod(pod Pod) error {
 		message: hyperPod,
 	}
 
-	if _, err := h.proxy.sendCmd(proxyCmd); err != nil {
-		return err
+	if err := h.sendCmd(ctx, proxyCmd); err != nil {
+		return &ProxyError{Op: "send a command", Err: err}
 	}
 
-	if err := h.startPauseContainer(pod.id, proxyInfo.Token); err != nil {
+	if err := h.startPauseContainer(ctx, pod.id, proxyInfo.Token); err != nil {
 		return err
 	}
 
 	for _, c := range pod.containers {
-		if err := h.startOneContainer(pod, *c); err != nil {
+		if err := h.startOneContainer(ctx, pod, *c); err != nil {
 			return err
 		}
 	}
 
-	return h.proxy.disconnect()
+	if err := h.proxy.disconnect(); err != nil {
+		return &ProxyError{Op: "disconnect", Err: err}
+	}
+
+	return nil
 }
 
 // stopPod is the agent Pod stopping implementation for hyperstart.
-func (h *hyper) stopPod(pod Pod) error {
-	if _, _, err := h.proxy.connect(pod, false); err != nil {
-		return err
+func (h *hyper) stopPod(ctx context.Context, pod Pod) error {
+	if _, _, err := h.proxy.connect(ctx, pod, false); err != nil {
+		return &ProxyError{Op: "connect", Err: err}
 	}
 
 	for _, c := range pod.containers {
@@ -423,28 +474,28 @@ func (h *hyper) stopPod(pod Pod) error {
 			continue
 		}
 
-		if err := h.killOneContainer(c.id, syscall.SIGTERM); err != nil {
+		if err := h.killOneContainer(ctx, c.id, syscall.SIGTERM); err != nil {
 			return err
 		}
 
-		if err := h.stopOneContainer(pod.id, c.id); err != nil {
+		if err := h.stopOneContainer(ctx, pod.id, c.id); err != nil {
 			return err
 		}
 	}
 
-	if err := h.stopPauseContainer(pod.id); err != nil {
+	if err := h.stopPauseContainer(ctx, pod.id); err != nil {
 		return err
 	}
 
 	if err := h.proxy.disconnect(); err != nil {
-		return err
+		return &ProxyError{Op: "disconnect", Err: err}
 	}
 
 	return nil
 }
 
 // startPauseContainer starts a specific container running the pause binary provided.
-func (h *hyper) startPauseContainer(podID, token string) error {
+func (h *hyper) startPauseContainer(ctx context.Context, podID, token string) error {
 	cmd := Cmd{
 		Args:    []string{fmt.Sprintf("./%s", pauseBinName)},
 		Envs:    []EnvVar{},
@@ -473,14 +524,14 @@ func (h *hyper) startPauseContainer(podID, token string) error {
 		token:   token,
 	}
 
-	if _, err := h.proxy.sendCmd(proxyCmd); err != nil {
-		return err
+	if err := h.sendCmd(ctx, proxyCmd); err != nil {
+		return &ProxyError{Op: "send a command", Err: err}
 	}
 
 	return nil
 }
 
-func (h *hyper) startOneContainer(pod Pod, c Container) error {
+func (h *hyper) startOneContainer(ctx context.Context, pod Pod, c Container) error {
 	process, err := h.buildHyperContainerProcess(c.config.Cmd, c.config.Interactive)
 	if err != nil {
 		return err
@@ -493,7 +544,18 @@ func (h *hyper) startOneContainer(pod Pod, c Container) error {
 		Process: process,
 	}
 
-	if err := h.bindMountContainerRootfs(pod.id, c.id, c.rootFs); err != nil {
+	if isBlockRootfs(c.rootFs) {
+		// The drive holds the root filesystem itself, hyperstart
+		// mounts it from /dev/<image>.
+		drive, err := h.rootfsDrive(pod, c)
+		if err != nil {
+			return err
+		}
+
+		container.Image = drive.Device
+		container.Fstype = drive.Fstype
+		container.Rootfs = "/"
+	} else if err := h.bindMountContainerRootfs(pod.id, c.id, c.rootFs); err != nil {
 		h.bindUnmountAllRootfs(pod)
 		return err
 	}
@@ -504,18 +566,18 @@ func (h *hyper) startOneContainer(pod Pod, c Container) error {
 		token:   c.process.Token,
 	}
 
-	if _, err := h.proxy.sendCmd(proxyCmd); err != nil {
-		return err
+	if err := h.sendCmd(ctx, proxyCmd); err != nil {
+		return &ProxyError{Op: "send a command", Err: err}
 	}
 
 	return nil
 }
 
 // createContainer is the agent Container creation implementation for hyperstart.
-func (h *hyper) createContainer(pod *Pod, c *Container) error {
-	proxyInfo, url, err := h.proxy.connect(*pod, true)
+func (h *hyper) createContainer(ctx context.Context, pod *Pod, c *Container) error {
+	proxyInfo, url, err := h.proxy.connect(ctx, *pod, true)
 	if err != nil {
-		return err
+		return &ProxyError{Op: "connect", Err: err}
 	}
 
 	pod.url = url
@@ -528,24 +590,32 @@ func (h *hyper) createContainer(pod *Pod, c *Container) error {
 		return err
 	}
 
-	return h.proxy.disconnect()
+	if err := h.proxy.disconnect(); err != nil {
+		return &ProxyError{Op: "disconnect", Err: err}
+	}
+
+	return nil
 }
 
 // startContainer is the agent Container starting implementation for hyperstart.
-func (h *hyper) startContainer(pod Pod, c Container) error {
-	if _, _, err := h.proxy.connect(pod, false); err != nil {
-		return err
+func (h *hyper) startContainer(ctx context.Context, pod Pod, c Container) error {
+	if _, _, err := h.proxy.connect(ctx, pod, false); err != nil {
+		return &ProxyError{Op: "connect", Err: err}
 	}
 
-	if err := h.startOneContainer(pod, c); err != nil {
+	if err := h.startOneContainer(ctx, pod, c); err != nil {
 		return err
 	}
 
-	return h.proxy.disconnect()
+	if err := h.proxy.disconnect(); err != nil {
+		return &ProxyError{Op: "disconnect", Err: err}
+	}
+
+	return nil
 }
 
-func (h *hyper) stopPauseContainer(podID string) error {
-	if err := h.killOneContainer(pauseContainerName, syscall.SIGKILL); err != nil {
+func (h *hyper) stopPauseContainer(ctx context.Context, podID string) error {
+	if err := h.killOneContainer(ctx, pauseContainerName, syscall.SIGKILL); err != nil {
 		return err
 	}
 
@@ -557,23 +627,23 @@ func (h *hyper) stopPauseContainer(podID string) error {
 }
 
 // stopContainer is the agent Container stopping implementation for hyperstart.
-func (h *hyper) stopContainer(pod Pod, c Container) error {
-	if _, _, err := h.proxy.connect(pod, false); err != nil {
-		return err
+func (h *hyper) stopContainer(ctx context.Context, pod Pod, c Container) error {
+	if _, _, err := h.proxy.connect(ctx, pod, false); err != nil {
+		return &ProxyError{Op: "connect", Err: err}
 	}
 
-	if err := h.stopOneContainer(pod.id, c.id); err != nil {
+	if err := h.stopOneContainer(ctx, pod.id, c.id); err != nil {
 		return err
 	}
 
 	if err := h.proxy.disconnect(); err != nil {
-		return err
+		return &ProxyError{Op: "disconnect", Err: err}
 	}
 
 	return nil
 }
 
-func (h *hyper) stopOneContainer(podID, cID string) error {
+func (h *hyper) stopOneContainer(ctx context.Context, podID, cID string) error {
 	removeCommand := hyperstart.RemoveCommand{
 		Container: cID,
 	}
@@ -583,8 +653,8 @@ func (h *hyper) stopOneContainer(podID, cID string) error {
 		message: removeCommand,
 	}
 
-	if _, err := h.proxy.sendCmd(proxyCmd); err != nil {
-		return err
+	if err := h.sendCmd(ctx, proxyCmd); err != nil {
+		return &ProxyError{Op: "send a command", Err: err}
 	}
 
 	if err := h.bindUnmountContainerRootfs(podID, cID); err != nil {
@@ -595,23 +665,23 @@ func (h *hyper) stopOneContainer(podID, cID string) error {
 }
 
 // killContainer is the agent process signal implementation for hyperstart.
-func (h *hyper) killContainer(pod Pod, c Container, signal syscall.Signal) error {
-	if _, _, err := h.proxy.connect(pod, false); err != nil {
-		return err
+func (h *hyper) killContainer(ctx context.Context, pod Pod, c Container, signal syscall.Signal) error {
+	if _, _, err := h.proxy.connect(ctx, pod, false); err != nil {
+		return &ProxyError{Op: "connect", Err: err}
 	}
 
-	if err := h.killOneContainer(c.id, signal); err != nil {
+	if err := h.killOneContainer(ctx, c.id, signal); err != nil {
 		return err
 	}
 
 	if err := h.proxy.disconnect(); err != nil {
-		return err
+		return &ProxyError{Op: "disconnect", Err: err}
 	}
 
 	return nil
 }
 
-func (h *hyper) killOneContainer(cID string, signal syscall.Signal) error {
+func (h *hyper) killOneContainer(ctx context.Context, cID string, signal syscall.Signal) error {
 	killCmd := hyperstart.KillCommand{
 		Container: cID,
 		Signal:    signal,
@@ -622,9 +692,144 @@ func (h *hyper) killOneContainer(cID string, signal syscall.Signal) error {
 		message: killCmd,
 	}
 
-	if _, err := h.proxy.sendCmd(proxyCmd); err != nil {
+	if err := h.sendCmd(ctx, proxyCmd); err != nil {
+		return &ProxyError{Op: "send a command", Err: err}
+	}
+
+	return nil
+}
+
+// waitContainer is the agent Container waiting implementation for hyperstart.
+// hyperstart identifies the workload of a container with the container ID.
+func (h *hyper) waitContainer(ctx context.Context, pod Pod, c Container) (int, error) {
+	if _, _, err := h.proxy.connect(ctx, pod, false); err != nil {
+		return -1, &ProxyError{Op: "connect", Err: err}
+	}
+
+	exitCode, err := h.proxy.waitProcess(ctx, pod, c.id, c.id)
+	if err != nil {
+		h.proxy.disconnect()
+		return -1, &ProxyError{Op: "wait for the process", Err: err}
+	}
+
+	if err := h.proxy.disconnect(); err != nil {
+		return -1, &ProxyError{Op: "disconnect", Err: err}
+	}
+
+	return exitCode, nil
+}
+
+// watchContainer is the agent Container watching implementation for
+// hyperstart. It waits for the container process to exit from a goroutine,
+// through its own proxy handle as the watch outlives the current call.
+func (h *hyper) watchContainer(ctx context.Context, pod Pod, c Container, exited func(exitCode int)) error {
+	proxy, err := newProxy(pod.config.ProxyType)
+	if err != nil {
+		return err
+	}
+
+	watcher := &hyper{
+		config: h.config,
+		proxy:  proxy,
+	}
+
+	go func() {
+		exitCode, err := watcher.waitContainer(ctx, pod, c)
+		if err != nil {
+			if ctx.Err() == nil {
+				podLogger("hyperstart", pod.id).Warnf("Could not wait for container %s: %v", c.id, err)
+			}
+			return
+		}
+
+		exited(exitCode)
+	}()
+
+	return nil
+}
+
+// addInterface is the agent network interface hot plug implementation for
+// hyperstart. The guest interface is found by its MAC address, renamed and
+// given its addresses, and then its routes are added.
+func (h *hyper) addInterface(ctx context.Context, pod Pod, endpoint Endpoint) error {
+	networkNS, err := pod.storage.fetchPodNetwork(pod.id)
+	if err != nil {
+		return err
+	}
+
+	netIfaces, err := getIfacesFromNetNs(networkNS.NetNsPath)
+	if err != nil {
+		return err
+	}
+
+	netIface, err := getNetIfaceByName(endpoint.NetPair.VirtIface.Name, netIfaces)
+	if err != nil {
 		return err
 	}
 
+	iface, routes := buildNetworkInterfaceAndRoutes(endpoint, netIface)
+
+	proxyCmds := []hyperstartProxyCmd{
+		{
+			cmd:     hyperstart.SetupInterface,
+			message: iface,
+		},
+	}
+
+	if len(routes) > 0 {
+		proxyCmds = append(proxyCmds, hyperstartProxyCmd{
+			cmd:     hyperstart.SetupRoute,
+			message: hyperstart.Routes{Routes: routes},
+		})
+	}
+
+	return h.sendProxyCmds(ctx, pod, proxyCmds)
+}
+
+// removeInterface is the agent network interface hot unplug implementation
+// for hyperstart. hyperstart has no command to remove an interface, so the
+// guest interface is set up again without any address, which drops the
+// routes going through it too.
+func (h *hyper) removeInterface(ctx context.Context, pod Pod, endpoint Endpoint) error {
+	return h.sendProxyCmds(ctx, pod, []hyperstartProxyCmd{
+		{
+			cmd: hyperstart.SetupInterface,
+			message: hyperstart.NetworkIface{
+				Device:      endpoint.NetPair.VirtIface.Name,
+				IPAddresses: []hyperstart.IPAddress{},
+				MACAddr:     endpoint.NetPair.VirtIface.HardAddr,
+			},
+		},
+	})
+}
+
+// onlineCPUMem is the agent vCPUs and memory onlining implementation for
+// hyperstart.
+func (h *hyper) onlineCPUMem(ctx context.Context, pod Pod) error {
+	return h.sendProxyCmds(ctx, pod, []hyperstartProxyCmd{
+		{
+			cmd: hyperstart.OnlineCPUMem,
+		},
+	})
+}
+
+// sendProxyCmds connects to the pod proxy, sends it commands in order, and
+// disconnects.
+func (h *hyper) sendProxyCmds(ctx context.Context, pod Pod, proxyCmds []hyperstartProxyCmd) error {
+	if _, _, err := h.proxy.connect(ctx, pod, false); err != nil {
+		return &ProxyError{Op: "connect", Err: err}
+	}
+
+	for _, proxyCmd := range proxyCmds {
+		if err := h.sendCmd(ctx, proxyCmd); err != nil {
+			h.proxy.disconnect()
+			return &ProxyError{Op: "send a command", Err: err}
+		}
+	}
+
+	if err := h.proxy.disconnect(); err != nil {
+		return &ProxyError{Op: "disconnect", Err: err}
+	}
+
 	return nil
 }
@@ -17,7 +17,13 @@
 package virtcontainers
 
 import (
+	"net"
+	"reflect"
 	"testing"
+
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+	types "github.com/containernetworking/cni/pkg/types/current"
+	"github.com/containers/virtcontainers/pkg/hyperstart"
 )
 
 func TestHyperstartValidateNoSocketsSuccessful(t *testing.T) {
@@ -67,3 +73,47 @@ func TestHyperstartValidateNSocketSuccessful(t *testing.T) {
 	testHyperstartValidateNSocket(t, 0, true)
 	testHyperstartValidateNSocket(t, 2, true)
 }
+
+func TestBuildNetworkInterfaceAndRoutes(t *testing.T) {
+	_, ipv4, _ := net.ParseCIDR("172.17.0.2/16")
+	_, ipv6, _ := net.ParseCIDR("2001:db8::2/64")
+	_, dst, _ := net.ParseCIDR("0.0.0.0/0")
+
+	ipv4.IP = net.ParseIP("172.17.0.2")
+
+	endpoint := Endpoint{
+		NetPair: NetworkInterfacePair{
+			VirtIface: NetworkInterface{
+				Name:     "eth1",
+				HardAddr: "02:00:ca:fe:00:01",
+			},
+		},
+		Properties: types.Result{
+			IPs: []*types.IPConfig{
+				{Version: "4", Address: *ipv4},
+				{Version: "6", Address: *ipv6},
+			},
+			Routes: []*cniTypes.Route{
+				{Dst: *dst, GW: net.ParseIP("172.17.0.1")},
+			},
+		},
+	}
+
+	iface, routes := buildNetworkInterfaceAndRoutes(endpoint, net.Interface{MTU: 1500})
+
+	expectedIface := hyperstart.NetworkIface{
+		NewDevice:   "eth1",
+		IPAddresses: []hyperstart.IPAddress{{IPAddress: "172.17.0.2", NetMask: "16"}},
+		MTU:         "1500",
+		MACAddr:     "02:00:ca:fe:00:01",
+	}
+
+	if !reflect.DeepEqual(iface, expectedIface) {
+		t.Fatalf("Got %+v\nExpecting %+v", iface, expectedIface)
+	}
+
+	expectedRoutes := []hyperstart.Route{{Dest: "0.0.0.0/0", Gateway: "172.17.0.1", Device: "eth1"}}
+	if !reflect.DeepEqual(routes, expectedRoutes) {
+		t.Fatalf("Got %+v\nExpecting %+v", routes, expectedRoutes)
+	}
+}
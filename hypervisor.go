@@ -17,6 +17,7 @@
 package virtcontainers
 
 import (
+	"context"
 	"fmt"
 )
 
@@ -57,6 +58,79 @@ const (
 	serialPortDev
 )
 
+// ImageTransport describes how the guest image is exposed to the VM.
+type ImageTransport string
+
+const (
+	// NVDIMMImage maps the guest image into the guest memory through an
+	// NVDIMM device, and mounts it with DAX. It is the default transport.
+	NVDIMMImage ImageTransport = "nvdimm"
+
+	// VirtioBlockImage exposes the guest image as a virtio-blk disk.
+	VirtioBlockImage ImageTransport = "virtio-blk"
+
+	// VirtioSCSIImage exposes the guest image as a disk behind a
+	// virtio-scsi controller.
+	VirtioSCSIImage ImageTransport = "virtio-scsi"
+)
+
+// Set sets an image transport based on the input string.
+func (transport *ImageTransport) Set(value string) error {
+	switch ImageTransport(value) {
+	case NVDIMMImage, VirtioBlockImage, VirtioSCSIImage:
+		*transport = ImageTransport(value)
+		return nil
+	default:
+		return fmt.Errorf("Unknown image transport %s", value)
+	}
+}
+
+// String converts an image transport to a string.
+func (transport *ImageTransport) String() string {
+	return string(*transport)
+}
+
+// Accelerator describes how the VM runs the guest code.
+type Accelerator string
+
+const (
+	// KVMAccelerator runs the guest code with KVM. It is the default
+	// accelerator.
+	KVMAccelerator Accelerator = "kvm"
+
+	// TCGAccelerator emulates the guest CPU, on hosts without KVM.
+	TCGAccelerator Accelerator = "tcg"
+)
+
+// Set sets an accelerator based on the input string.
+func (accel *Accelerator) Set(value string) error {
+	switch Accelerator(value) {
+	case KVMAccelerator, TCGAccelerator:
+		*accel = Accelerator(value)
+		return nil
+	default:
+		return fmt.Errorf("Unknown accelerator %s", value)
+	}
+}
+
+// String converts an accelerator to a string.
+func (accel *Accelerator) String() string {
+	return string(*accel)
+}
+
+// The pod annotations overriding the HypervisorConfig VM settings of a
+// single pod.
+const (
+	// MachineTypeAnnotation overrides HypervisorConfig.MachineType.
+	MachineTypeAnnotation = "com.github.containers.virtcontainers.machine_type"
+
+	// AcceleratorAnnotation overrides HypervisorConfig.Accelerator.
+	AcceleratorAnnotation = "com.github.containers.virtcontainers.accelerator"
+
+	// CPUModelAnnotation overrides HypervisorConfig.CPUModel.
+	CPUModelAnnotation = "com.github.containers.virtcontainers.cpu_model"
+)
+
 // Set sets an hypervisor type based on the input string.
 func (hType *HypervisorType) Set(value string) error {
 	switch value {
@@ -112,6 +186,33 @@ type HypervisorConfig struct {
 	// HypervisorPath is the hypervisor executable host path.
 	HypervisorPath string
 
+	// ImageTransport is how the guest image is exposed to the VM.
+	// NVDIMMImage is used if it is empty.
+	ImageTransport ImageTransport
+
+	// MachineType is the emulated machine type, "pc-lite" by default.
+	MachineType string
+
+	// Accelerator is how the VM runs the guest code. KVMAccelerator is
+	// used if it is empty.
+	Accelerator Accelerator
+
+	// CPUModel is the guest CPU model, "host" by default with KVM and
+	// "qemu64" with TCG.
+	CPUModel string
+
+	// GlobalParam is a global device property, e.g.
+	// "kvm-pit.lost_tick_policy=discard", the default with KVM.
+	GlobalParam string
+
+	// RTCBase is where the guest clock starts from, "utc" (the default)
+	// or "localtime".
+	RTCBase string
+
+	// RTCDriftFix is how the guest clock catches up with lost ticks,
+	// "slew" (the default) or "none".
+	RTCDriftFix string
+
 	// KernelParams are additional guest kernel parameters.
 	KernelParams []Param
 
@@ -136,9 +237,55 @@ func (conf *HypervisorConfig) valid() (bool, error) {
 		return false, fmt.Errorf("Missing hypervisor path")
 	}
 
+	switch conf.ImageTransport {
+	case "", NVDIMMImage, VirtioBlockImage, VirtioSCSIImage:
+	default:
+		return false, fmt.Errorf("Unknown image transport %s", conf.ImageTransport)
+	}
+
+	switch conf.Accelerator {
+	case "", KVMAccelerator, TCGAccelerator:
+	default:
+		return false, fmt.Errorf("Unknown accelerator %s", conf.Accelerator)
+	}
+
+	if conf.Accelerator == TCGAccelerator && conf.CPUModel == "host" {
+		return false, fmt.Errorf("The host CPU model needs KVM")
+	}
+
+	switch conf.RTCBase {
+	case "", "utc", "localtime":
+	default:
+		return false, fmt.Errorf("Unknown RTC base %s", conf.RTCBase)
+	}
+
+	switch conf.RTCDriftFix {
+	case "", "slew", "none":
+	default:
+		return false, fmt.Errorf("Unknown RTC drift fix %s", conf.RTCDriftFix)
+	}
+
 	return true, nil
 }
 
+// withAnnotations returns conf with the VM settings overridden by the pod
+// annotations.
+func (conf HypervisorConfig) withAnnotations(annotations map[string]string) HypervisorConfig {
+	if machineType, ok := annotations[MachineTypeAnnotation]; ok {
+		conf.MachineType = machineType
+	}
+
+	if accel, ok := annotations[AcceleratorAnnotation]; ok {
+		conf.Accelerator = Accelerator(accel)
+	}
+
+	if cpuModel, ok := annotations[CPUModelAnnotation]; ok {
+		conf.CPUModel = cpuModel
+	}
+
+	return conf
+}
+
 func appendParam(params []Param, parameter string, value string) []Param {
 	return append(params, Param{parameter, value})
 }
@@ -168,8 +315,26 @@ func serializeParams(params []Param, delim string) []string {
 // The default hypervisor implementation is Qemu.
 type hypervisor interface {
 	init(config HypervisorConfig) error
+	check(ctx context.Context) (HypervisorCapabilities, error)
 	createPod(podConfig PodConfig) error
-	startPod(startCh, stopCh chan struct{}) error
-	stopPod() error
+	startPod(ctx context.Context, startCh, stopCh chan struct{}) error
+	stopPod(ctx context.Context) error
+	pausePod(ctx context.Context) error
+	resumePod(ctx context.Context) error
+	statsPod(ctx context.Context) (PodStats, error)
+	resizePod(ctx context.Context, resources Resources) (Resources, error)
+	// saveVM saves the VM state and devices into a checkpoint directory,
+	// and restorePod relaunches an identical VM from there.
+	saveVM(ctx context.Context, dir string) error
+	restorePod(ctx context.Context, dir string, startCh, stopCh chan struct{}) error
+	bootPooledVM(ctx context.Context) error
+	adoptPooledVM(ctx context.Context, vm pooledVM, startCh, stopCh chan struct{}) error
+	pingVM(ctx context.Context) error
 	addDevice(devInfo interface{}, devType deviceType) error
+
+	// hotplugAddDevice and hotplugRemoveDevice plug devices into and out
+	// of the running VM. addDevice only adds devices to a VM about to
+	// be started.
+	hotplugAddDevice(ctx context.Context, devInfo interface{}, devType deviceType) error
+	hotplugRemoveDevice(ctx context.Context, devInfo interface{}, devType deviceType) error
 }
@@ -0,0 +1,109 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// kvmDevicePath is the KVM device the hypervisor needs to open.
+var kvmDevicePath = "/dev/kvm"
+
+// HypervisorCapabilities describes what an hypervisor binary supports on
+// this host, and the virtcontainers requirements it does not meet.
+type HypervisorCapabilities struct {
+	// Path is the hypervisor binary host path.
+	Path string
+
+	// Version is the hypervisor version, e.g. "2.9.0".
+	Version string
+
+	// MachineTypes are the machine types the hypervisor can emulate.
+	MachineTypes []string
+
+	// Accelerators are the accelerators the hypervisor was built with.
+	// It is empty if the hypervisor cannot list them.
+	Accelerators []string
+
+	// NVDIMM, VirtioBlock and VirtioSCSI tell if the hypervisor can
+	// emulate the devices the guest image can be exposed through.
+	NVDIMM      bool
+	VirtioBlock bool
+	VirtioSCSI  bool
+
+	// KVM tells if the KVM device can be opened for reading and writing.
+	KVM bool
+
+	// Missing lists the requirements the hypervisor does not meet. Pods
+	// cannot be created with it unless Missing is empty.
+	Missing []string
+}
+
+// Supported tells if the hypervisor meets all the virtcontainers
+// requirements.
+func (caps HypervisorCapabilities) Supported() bool {
+	return len(caps.Missing) == 0
+}
+
+func (caps *HypervisorCapabilities) missing(format string, args ...interface{}) {
+	caps.Missing = append(caps.Missing, fmt.Sprintf(format, args...))
+}
+
+// kvmAccessible checks that the KVM device can be opened for reading and
+// writing, as the hypervisor will.
+func kvmAccessible() bool {
+	f, err := os.OpenFile(kvmDevicePath, os.O_RDWR, 0)
+	if err != nil {
+		return false
+	}
+
+	f.Close()
+
+	return true
+}
+
+// checkHypervisor checks that the hypervisor described by hType and config
+// can run a VM on this host, so that pods fail to be created before any of
+// their resources exist.
+func checkHypervisor(ctx context.Context, hType HypervisorType, config HypervisorConfig) error {
+	hypervisor, err := newHypervisor(hType)
+	if err != nil {
+		// The pod configuration validation falls back to QEMU.
+		hypervisor = &qemu{}
+	}
+
+	if err := hypervisor.init(config); err != nil {
+		return &HypervisorError{Op: "initialize", Err: err}
+	}
+
+	caps, err := hypervisor.check(ctx)
+	if err != nil {
+		return &HypervisorError{Op: "check its capabilities", Err: err}
+	}
+
+	if !caps.Supported() {
+		return &HypervisorError{
+			Op:  "check its capabilities",
+			Err: fmt.Errorf("%s does not meet the requirements, missing: %s", caps.Path, strings.Join(caps.Missing, ", ")),
+		}
+	}
+
+	return nil
+}
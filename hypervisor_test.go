@@ -152,6 +152,55 @@ func TestHypervisorConfigNoHypervisorPath(t *testing.T) {
 	testHypervisorConfigValid(t, hypervisorConfig, false)
 }
 
+func TestHypervisorConfigUnknownImageTransport(t *testing.T) {
+	hypervisorConfig := &HypervisorConfig{
+		KernelPath:     fmt.Sprintf("%s/%s", testDir, testKernel),
+		ImagePath:      fmt.Sprintf("%s/%s", testDir, testImage),
+		HypervisorPath: fmt.Sprintf("%s/%s", testDir, testHypervisor),
+		ImageTransport: "floppy",
+	}
+
+	testHypervisorConfigValid(t, hypervisorConfig, false)
+}
+
+func TestHypervisorConfigInvalidVMSettings(t *testing.T) {
+	for _, config := range []HypervisorConfig{
+		{Accelerator: "xen"},
+		{Accelerator: TCGAccelerator, CPUModel: "host"},
+		{RTCBase: "gmt"},
+		{RTCDriftFix: "fast"},
+	} {
+		config.KernelPath = fmt.Sprintf("%s/%s", testDir, testKernel)
+		config.ImagePath = fmt.Sprintf("%s/%s", testDir, testImage)
+		config.HypervisorPath = fmt.Sprintf("%s/%s", testDir, testHypervisor)
+
+		testHypervisorConfigValid(t, &config, false)
+	}
+}
+
+func TestHypervisorConfigWithAnnotations(t *testing.T) {
+	config := HypervisorConfig{
+		MachineType: "pc",
+		CPUModel:    "Haswell",
+	}
+
+	config = config.withAnnotations(map[string]string{
+		MachineTypeAnnotation:   "q35",
+		AcceleratorAnnotation:   "tcg",
+		"org.example.unrelated": "value",
+	})
+
+	expected := HypervisorConfig{
+		MachineType: "q35",
+		Accelerator: TCGAccelerator,
+		CPUModel:    "Haswell",
+	}
+
+	if !reflect.DeepEqual(config, expected) {
+		t.Fatalf("Got %+v, expecting %+v", config, expected)
+	}
+}
+
 func TestHypervisorConfigIsValid(t *testing.T) {
 	hypervisorConfig := &HypervisorConfig{
 		KernelPath:     fmt.Sprintf("%s/%s", testDir, testKernel),
@@ -0,0 +1,200 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/containers/virtcontainers/pkg/hyperstart"
+)
+
+// Fields are the structured fields of a log entry.
+type Fields map[string]interface{}
+
+// The fields virtcontainers sets on its log entries.
+const (
+	// PodIDField is the ID of the pod an entry is about.
+	PodIDField = "pod"
+
+	// ContainerIDField is the ID of the container an entry is about.
+	ContainerIDField = "container"
+
+	// OperationField is the operation being run, e.g. "start".
+	OperationField = "operation"
+
+	// SubsystemField is the part of virtcontainers logging, e.g. "qemu".
+	SubsystemField = "subsystem"
+
+	// DurationField is how long the operation took, as a time.Duration.
+	DurationField = "duration"
+)
+
+// Logger is the virtcontainers logging interface. Callers set their own
+// implementation with SetLogger.
+type Logger interface {
+	// WithFields returns a Logger adding fields to all its entries.
+	WithFields(fields Fields) Logger
+
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// DebugLogger is implemented by the Loggers telling whether they write
+// debug entries. virtcontainers skips building the verbose logs, such as
+// the QMP traffic, for the Loggers not implementing it or returning false.
+type DebugLogger interface {
+	DebugEnabled() bool
+}
+
+func debugEnabled(logger Logger) bool {
+	d, ok := logger.(DebugLogger)
+	return ok && d.DebugEnabled()
+}
+
+var (
+	virtLogLock sync.RWMutex
+	virtLog     Logger = stdLogger{}
+)
+
+func init() {
+	hyperstart.SetLogger(subsystemLogger("hyperstart"))
+}
+
+// SetLogger sets the Logger used by all the API calls. It should be called
+// before any other API call. A nil logger restores the default one, which
+// writes to the standard library log package and drops debug entries. Use
+// SetLogger(NewDefaultLogger(true)) to keep them.
+func SetLogger(logger Logger) {
+	if logger == nil {
+		logger = stdLogger{}
+	}
+
+	virtLogLock.Lock()
+	virtLog = logger
+	virtLogLock.Unlock()
+
+	hyperstart.SetLogger(subsystemLogger("hyperstart"))
+}
+
+// GetLogger returns the Logger set with SetLogger, for the packages built
+// on top of virtcontainers to log through it too.
+func GetLogger() Logger {
+	virtLogLock.RLock()
+	defer virtLogLock.RUnlock()
+
+	return virtLog
+}
+
+func subsystemLogger(subsystem string) Logger {
+	return GetLogger().WithFields(Fields{SubsystemField: subsystem})
+}
+
+func podLogger(subsystem, podID string) Logger {
+	return GetLogger().WithFields(Fields{
+		SubsystemField: subsystem,
+		PodIDField:     podID,
+	})
+}
+
+func containerLogger(podID, containerID string) Logger {
+	return GetLogger().WithFields(Fields{
+		SubsystemField:   "container",
+		PodIDField:       podID,
+		ContainerIDField: containerID,
+	})
+}
+
+// NewDefaultLogger returns the default Logger, writing logfmt like entries
+// to the standard library log package. Debug entries are only written when
+// debug is true.
+func NewDefaultLogger(debug bool) Logger {
+	return stdLogger{debug: debug}
+}
+
+// stdLogger is the default Logger, writing logfmt like entries to the
+// standard library logger.
+type stdLogger struct {
+	fields Fields
+	debug  bool
+}
+
+func (l stdLogger) WithFields(fields Fields) Logger {
+	merged := make(Fields, len(l.fields)+len(fields))
+
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+
+	for k, v := range fields {
+		merged[k] = v
+	}
+
+	return stdLogger{fields: merged, debug: l.debug}
+}
+
+func (l stdLogger) DebugEnabled() bool {
+	return l.debug
+}
+
+func (l stdLogger) log(level, format string, args ...interface{}) {
+	entry := []string{
+		"level=" + level,
+		"msg=" + strconv.Quote(fmt.Sprintf(format, args...)),
+	}
+
+	keys := make([]string, 0, len(l.fields))
+	for k := range l.fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		value := fmt.Sprint(l.fields[k])
+		if strings.ContainsAny(value, " \"=") {
+			value = strconv.Quote(value)
+		}
+
+		entry = append(entry, k+"="+value)
+	}
+
+	log.Print(strings.Join(entry, " "))
+}
+
+func (l stdLogger) Debugf(format string, args ...interface{}) {
+	if l.debug {
+		l.log("debug", format, args...)
+	}
+}
+
+func (l stdLogger) Infof(format string, args ...interface{}) {
+	l.log("info", format, args...)
+}
+
+func (l stdLogger) Warnf(format string, args ...interface{}) {
+	l.log("warning", format, args...)
+}
+
+func (l stdLogger) Errorf(format string, args ...interface{}) {
+	l.log("error", format, args...)
+}
@@ -0,0 +1,185 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testLogEntry struct {
+	level  string
+	msg    string
+	fields Fields
+}
+
+// testLogger records the log entries of all the loggers derived from it.
+type testLogger struct {
+	fields  Fields
+	lock    *sync.Mutex
+	entries *[]testLogEntry
+}
+
+func newTestLogger() testLogger {
+	return testLogger{
+		fields:  Fields{},
+		lock:    &sync.Mutex{},
+		entries: &[]testLogEntry{},
+	}
+}
+
+func (l testLogger) WithFields(fields Fields) Logger {
+	merged := Fields{}
+
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+
+	for k, v := range fields {
+		merged[k] = v
+	}
+
+	return testLogger{fields: merged, lock: l.lock, entries: l.entries}
+}
+
+func (l testLogger) log(level, format string, args ...interface{}) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	*l.entries = append(*l.entries, testLogEntry{
+		level:  level,
+		msg:    fmt.Sprintf(format, args...),
+		fields: l.fields,
+	})
+}
+
+func (l testLogger) Debugf(format string, args ...interface{}) { l.log("debug", format, args...) }
+func (l testLogger) Infof(format string, args ...interface{})  { l.log("info", format, args...) }
+func (l testLogger) Warnf(format string, args ...interface{})  { l.log("warning", format, args...) }
+func (l testLogger) Errorf(format string, args ...interface{}) { l.log("error", format, args...) }
+
+func (l testLogger) DebugEnabled() bool {
+	return true
+}
+
+func (l testLogger) find(msg string) (testLogEntry, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for _, entry := range *l.entries {
+		if entry.msg == msg {
+			return entry, true
+		}
+	}
+
+	return testLogEntry{}, false
+}
+
+func TestSetLogger(t *testing.T) {
+	logger := newTestLogger()
+	SetLogger(logger)
+	defer SetLogger(nil)
+
+	p, err := RunPod(newTestPodConfigNoop())
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	entry, ok := logger.find("Started pod")
+	if !ok {
+		t.Fatalf("No pod start entry in %+v", *logger.entries)
+	}
+
+	if entry.level != "info" || entry.fields[PodIDField] != p.id ||
+		entry.fields[OperationField] != "start" || entry.fields[SubsystemField] != "pod" {
+		t.Fatalf("Unexpected pod start entry %+v", entry)
+	}
+
+	if _, ok := entry.fields[DurationField].(time.Duration); !ok {
+		t.Fatalf("No duration in pod start entry %+v", entry)
+	}
+
+	SetLogger(nil)
+
+	if _, ok := GetLogger().(stdLogger); !ok {
+		t.Fatalf("Got %T, expecting the default logger", GetLogger())
+	}
+}
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(log.LstdFlags)
+	}()
+
+	logger := stdLogger{}.WithFields(Fields{PodIDField: "pod1"})
+	logger.WithFields(Fields{OperationField: "start the VM"}).Infof("Started %s", "VM")
+	logger.Debugf("Dropped")
+
+	expected := `level=info msg="Started VM" operation="start the VM" pod=pod1` + "\n"
+	if buf.String() != expected {
+		t.Fatalf("Got %q, expecting %q", buf.String(), expected)
+	}
+
+	buf.Reset()
+	NewDefaultLogger(true).WithFields(Fields{PodIDField: "pod1"}).Debugf("Kept")
+
+	expected = `level=debug msg="Kept" pod=pod1` + "\n"
+	if buf.String() != expected {
+		t.Fatalf("Got %q, expecting %q", buf.String(), expected)
+	}
+}
+
+func TestQMPLogger(t *testing.T) {
+	if newQMPLogger("pod1").V(2) {
+		t.Fatal("Verbose QMP logs should be skipped by the default logger")
+	}
+
+	logger := newTestLogger()
+	SetLogger(logger)
+	defer SetLogger(nil)
+
+	qmpLog := newQMPLogger("pod1")
+	if !qmpLog.V(2) {
+		t.Fatal("Verbose QMP logs should be passed to a debug logger")
+	}
+
+	qmpLog.Infof("verbose")
+	qmpLog.Warningf("warning")
+	qmpLog.Errorf("error")
+
+	for _, expected := range []testLogEntry{
+		{level: "debug", msg: "verbose"},
+		{level: "warning", msg: "warning"},
+		{level: "error", msg: "error"},
+	} {
+		entry, ok := logger.find(expected.msg)
+		if !ok || entry.level != expected.level || entry.fields[SubsystemField] != "qmp" ||
+			entry.fields[PodIDField] != "pod1" {
+			t.Fatalf("Unexpected entry %+v, expecting %+v", entry, expected)
+		}
+	}
+}
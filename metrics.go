@@ -0,0 +1,220 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/containers/virtcontainers/pkg/hyperstart"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "virtcontainers"
+
+// The results API calls are labelled with. Failed calls get the kind of
+// their error.
+const (
+	resultOK           = "ok"
+	resultNotFound     = "not_found"
+	resultInvalidState = "invalid_state"
+	resultTimeout      = "timeout"
+	resultHypervisor   = "hypervisor_error"
+	resultAgent        = "agent_error"
+	resultProxy        = "proxy_error"
+	resultNetwork      = "network_error"
+	resultError        = "error"
+)
+
+var (
+	apiCallDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "api_call_duration_seconds",
+		Help:      "API calls latency, by operation and result.",
+	}, []string{"operation", "result"})
+
+	hypervisorLaunchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "hypervisor_launch_duration_seconds",
+		Help:      "Time to launch a VM and get it started, by hypervisor.",
+	}, []string{"hypervisor"})
+
+	qmpCommandDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "qmp_command_duration_seconds",
+		Help:      "QMP commands latency, by command and result.",
+	}, []string{"command", "result"})
+
+	hyperstartCommandDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "hyperstart_command_duration_seconds",
+		Help:      "Hyperstart commands latency, by command code and result.",
+	}, []string{"code", "command", "result"})
+
+	hookDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "hook_duration_seconds",
+		Help:      "Hooks execution time, by hook type.",
+	}, []string{"type"})
+
+	hookFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "hook_failures_total",
+		Help:      "Failed hooks, by hook type.",
+	}, []string{"type"})
+
+	podsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "pods"),
+		"Stored pods, by state.",
+		[]string{"state"}, nil)
+
+	containersDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "containers"),
+		"Stored containers, by state.",
+		[]string{"state"}, nil)
+)
+
+// metricsCollectors are all the virtcontainers metrics.
+var metricsCollectors = []prometheus.Collector{
+	apiCallDuration,
+	hypervisorLaunchDuration,
+	qmpCommandDuration,
+	hyperstartCommandDuration,
+	hookDuration,
+	hookFailures,
+	stateCollector{},
+}
+
+// metricsCollector collects all the virtcontainers metrics at once.
+type metricsCollector struct{}
+
+func (c metricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, collector := range metricsCollectors {
+		collector.Describe(ch)
+	}
+}
+
+func (c metricsCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, collector := range metricsCollectors {
+		collector.Collect(ch)
+	}
+}
+
+// metricsRegistry holds all the virtcontainers metrics, rather than the
+// default registry, for callers to decide where to expose them.
+var metricsRegistry = prometheus.NewRegistry()
+
+func init() {
+	metricsRegistry.MustRegister(metricsCollector{})
+}
+
+// MetricsHandler returns an http.Handler serving the virtcontainers metrics
+// in the Prometheus exposition format.
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+// MetricsCollector returns a prometheus.Collector of all the virtcontainers
+// metrics, for callers to register into their own registry.
+func MetricsCollector() prometheus.Collector {
+	return metricsCollector{}
+}
+
+// metricsResult returns the result label of an operation error.
+func metricsResult(err error) string {
+	switch {
+	case err == nil:
+		return resultOK
+	case IsNotFound(err):
+		return resultNotFound
+	case IsInvalidState(err):
+		return resultInvalidState
+	case IsTimeout(err):
+		return resultTimeout
+	case IsHypervisorError(err):
+		return resultHypervisor
+	case IsAgentError(err):
+		return resultAgent
+	case IsProxyError(err):
+		return resultProxy
+	case IsNetworkError(err):
+		return resultNetwork
+	}
+
+	return resultError
+}
+
+func observeAPICall(operation string, begin time.Time, err error) {
+	apiCallDuration.WithLabelValues(operation, metricsResult(err)).Observe(time.Since(begin).Seconds())
+}
+
+func observeHypervisorLaunch(hType HypervisorType, begin time.Time) {
+	hypervisorLaunchDuration.WithLabelValues(string(hType)).Observe(time.Since(begin).Seconds())
+}
+
+func observeQMPCommand(command string, begin time.Time, err error) {
+	qmpCommandDuration.WithLabelValues(command, metricsResult(err)).Observe(time.Since(begin).Seconds())
+}
+
+func observeHyperstartCommand(command string, begin time.Time, err error) {
+	code := strconv.FormatUint(uint64(hyperstart.CodeList[command]), 10)
+
+	hyperstartCommandDuration.WithLabelValues(code, command, metricsResult(err)).Observe(time.Since(begin).Seconds())
+}
+
+func observeHook(hookType string, begin time.Time, err error) {
+	hookDuration.WithLabelValues(hookType).Observe(time.Since(begin).Seconds())
+
+	if err != nil {
+		hookFailures.WithLabelValues(hookType).Inc()
+	}
+}
+
+// stateCollector counts the stored pods and containers by state, when
+// scraped. It does not take the pods locks, a pod being modified is counted
+// in its previous or its new state.
+type stateCollector struct{}
+
+func (c stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- podsDesc
+	ch <- containersDesc
+}
+
+func (c stateCollector) Collect(ch chan<- prometheus.Metric) {
+	statuses, err := newStorage().fetchPodStatuses()
+	if err != nil {
+		return
+	}
+
+	pods := map[stateString]int{}
+	containers := map[stateString]int{}
+
+	for _, status := range statuses {
+		pods[status.State.State]++
+
+		for _, container := range status.ContainersStatus {
+			containers[container.State.State]++
+		}
+	}
+
+	for _, state := range []stateString{StateReady, StateRunning, StatePaused, StateStopped, StateCrashed} {
+		ch <- prometheus.MustNewConstMetric(podsDesc, prometheus.GaugeValue, float64(pods[state]), string(state))
+		ch <- prometheus.MustNewConstMetric(containersDesc, prometheus.GaugeValue, float64(containers[state]), string(state))
+	}
+}
@@ -0,0 +1,165 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// findMetric returns the metric of a family matching all the given labels.
+func findMetric(t *testing.T, name string, labels map[string]string) *dto.Metric {
+	families, err := metricsRegistry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+
+		for _, metric := range family.GetMetric() {
+			matched := 0
+			for _, pair := range metric.GetLabel() {
+				if value, ok := labels[pair.GetName()]; ok && value == pair.GetValue() {
+					matched++
+				}
+			}
+
+			if matched == len(labels) {
+				return metric
+			}
+		}
+	}
+
+	return nil
+}
+
+func apiCallCount(t *testing.T, operation, result string) uint64 {
+	metric := findMetric(t, "virtcontainers_api_call_duration_seconds", map[string]string{
+		"operation": operation,
+		"result":    result,
+	})
+	if metric == nil {
+		return 0
+	}
+
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func TestMetricsResult(t *testing.T) {
+	for _, test := range []struct {
+		err    error
+		result string
+	}{
+		{nil, resultOK},
+		{&NotFoundError{PodID: "pod"}, resultNotFound},
+		{&StateError{PodID: "pod", Op: "delete", From: StateRunning}, resultInvalidState},
+		{&HypervisorError{Op: "start the VM", Err: &TimeoutError{Op: "connect"}}, resultTimeout},
+		{&AgentError{Op: "start", Err: &ProxyError{Op: "connect", Err: errors.New("")}}, resultAgent},
+		{errors.New(""), resultError},
+	} {
+		if result := metricsResult(test.err); result != test.result {
+			t.Fatalf("Got %s for %v, expecting %s", result, test.err, test.result)
+		}
+	}
+}
+
+func TestAPICallMetrics(t *testing.T) {
+	okCount := apiCallCount(t, "RunPod", resultOK)
+	notFoundCount := apiCallCount(t, "StartPod", resultNotFound)
+
+	p, err := RunPod(newTestPodConfigNoop())
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := StartPod("not-a-pod"); err == nil {
+		t.Fatal("Starting an unknown pod should fail")
+	}
+
+	if count := apiCallCount(t, "RunPod", resultOK); count != okCount+1 {
+		t.Fatalf("Got %d successful RunPod calls, expecting %d", count, okCount+1)
+	}
+
+	if count := apiCallCount(t, "StartPod", resultNotFound); count != notFoundCount+1 {
+		t.Fatalf("Got %d not found StartPod calls, expecting %d", count, notFoundCount+1)
+	}
+
+	launch := findMetric(t, "virtcontainers_hypervisor_launch_duration_seconds", map[string]string{
+		"hypervisor": string(MockHypervisor),
+	})
+	if launch == nil || launch.GetHistogram().GetSampleCount() == 0 {
+		t.Fatal("The VM launch time should have been measured")
+	}
+
+	pods := findMetric(t, "virtcontainers_pods", map[string]string{"state": string(StateRunning)})
+	if pods == nil || pods.GetGauge().GetValue() < 1 {
+		t.Fatalf("Running pods not counted: %v", pods)
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	server := httptest.NewServer(MetricsHandler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(body), "virtcontainers_pods{") {
+		t.Fatalf("No pods count in %s", body)
+	}
+}
+
+func TestMetricsCollector(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(MetricsCollector()); err != nil {
+		t.Fatal(err)
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, family := range families {
+		if family.GetName() == "virtcontainers_pods" {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Fatalf("No pods count in %+v", families)
+	}
+}
@@ -16,7 +16,73 @@
 
 package virtcontainers
 
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// mockHotplug records a device hot plug or hot unplug.
+type mockHotplug struct {
+	devInfo interface{}
+	devType deviceType
+	remove  bool
+}
+
+// mockVM is a running mock VM: the description of its devices, sorted, the
+// resources it booted with and its current resources. Like real VMs, mock
+// VMs outlive the mockHypervisor which started them, and checkpoints save
+// them.
+type mockVM struct {
+	Devices       []string
+	BootResources Resources
+	Resources     Resources
+}
+
+// mockVMs are the running mock VMs, by pod ID.
+var mockVMs = struct {
+	sync.Mutex
+	vms map[string]mockVM
+}{vms: make(map[string]mockVM)}
+
+func mockDeviceName(devInfo interface{}, devType deviceType) string {
+	return fmt.Sprintf("%d %+v", devType, devInfo)
+}
+
 type mockHypervisor struct {
+	podID     string
+	devices   []string
+	hotplugs  []mockHotplug
+	resources Resources
+}
+
+// vm returns the VM the mock hypervisor would start.
+func (m *mockHypervisor) vm() mockVM {
+	devices := append([]string{}, m.devices...)
+	sort.Strings(devices)
+
+	return mockVM{
+		Devices:       devices,
+		BootResources: m.resources,
+		Resources:     m.resources,
+	}
+}
+
+// updateVM updates the running VM of the pod, if any.
+func (m *mockHypervisor) updateVM(update func(vm *mockVM)) {
+	mockVMs.Lock()
+	defer mockVMs.Unlock()
+
+	if vm, ok := mockVMs.vms[m.podID]; ok {
+		update(&vm)
+		sort.Strings(vm.Devices)
+		mockVMs.vms[m.podID] = vm
+	}
 }
 
 func (m *mockHypervisor) init(config HypervisorConfig) error {
@@ -28,20 +94,177 @@ func (m *mockHypervisor) init(config HypervisorConfig) error {
 	return nil
 }
 
+func (m *mockHypervisor) check(ctx context.Context) (HypervisorCapabilities, error) {
+	return HypervisorCapabilities{}, nil
+}
+
 func (m *mockHypervisor) createPod(podConfig PodConfig) error {
+	m.podID = podConfig.ID
+	m.resources = podConfig.VMConfig
+
 	return nil
 }
 
-func (m *mockHypervisor) startPod(startCh, stopCh chan struct{}) error {
+func (m *mockHypervisor) startPod(ctx context.Context, startCh, stopCh chan struct{}) error {
 	var msg struct{}
-	startCh <- msg
+
+	select {
+	case startCh <- msg:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	mockVMs.Lock()
+	mockVMs.vms[m.podID] = m.vm()
+	mockVMs.Unlock()
+
+	return nil
+}
+
+func (m *mockHypervisor) stopPod(ctx context.Context) error {
+	mockVMs.Lock()
+	delete(mockVMs.vms, m.podID)
+	mockVMs.Unlock()
+
+	return nil
+}
+
+func (m *mockHypervisor) pausePod(ctx context.Context) error {
+	return nil
+}
+
+func (m *mockHypervisor) resumePod(ctx context.Context) error {
+	return nil
+}
+
+func (m *mockHypervisor) statsPod(ctx context.Context) (PodStats, error) {
+	return PodStats{}, nil
+}
+
+// resizePod resizes the running VM, whose resources may have been resized
+// already by another mockHypervisor, as QEMU does.
+func (m *mockHypervisor) resizePod(ctx context.Context, resources Resources) (Resources, error) {
+	var previous Resources
+
+	current := m.resources
+
+	mockVMs.Lock()
+	if vm, ok := mockVMs.vms[m.podID]; ok {
+		current = vm.Resources
+	}
+	mockVMs.Unlock()
+
+	if resources.VCPUs > 0 {
+		previous.VCPUs = current.VCPUs
+		current.VCPUs = resources.VCPUs
+	}
+
+	if resources.Memory > 0 {
+		previous.Memory = current.Memory
+		current.Memory = resources.Memory
+	}
+
+	m.updateVM(func(vm *mockVM) {
+		vm.Resources = current
+	})
+
+	return previous, nil
+}
+
+func (m *mockHypervisor) saveVM(ctx context.Context, dir string) error {
+	mockVMs.Lock()
+	vm, ok := mockVMs.vms[m.podID]
+	mockVMs.Unlock()
+
+	if !ok {
+		return fmt.Errorf("Pod %s VM is not running", m.podID)
+	}
+
+	data, err := json.Marshal(vm)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, checkpointVMDevicesFile), data, 0600)
+}
+
+// restorePod fails like QEMU does when the VM it restores does not have the
+// devices and boot resources of the saved one. The hot plugged resources come
+// back with the saved state.
+func (m *mockHypervisor) restorePod(ctx context.Context, dir string, startCh, stopCh chan struct{}) error {
+	data, err := ioutil.ReadFile(filepath.Join(dir, checkpointVMDevicesFile))
+	if err != nil {
+		return err
+	}
+
+	var saved mockVM
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+
+	vm := m.vm()
+	if !reflect.DeepEqual(vm.Devices, saved.Devices) || vm.BootResources != saved.BootResources {
+		return fmt.Errorf("Restored VM %+v does not match the saved VM %+v", vm, saved)
+	}
+
+	if err := m.startPod(ctx, startCh, stopCh); err != nil {
+		return err
+	}
+
+	m.updateVM(func(vm *mockVM) {
+		vm.Resources = saved.Resources
+	})
+
+	return nil
+}
+
+func (m *mockHypervisor) bootPooledVM(ctx context.Context) error {
 	return nil
 }
 
-func (m *mockHypervisor) stopPod() error {
+func (m *mockHypervisor) adoptPooledVM(ctx context.Context, vm pooledVM, startCh, stopCh chan struct{}) error {
+	return m.startPod(ctx, startCh, stopCh)
+}
+
+func (m *mockHypervisor) pingVM(ctx context.Context) error {
+	mockVMs.Lock()
+	defer mockVMs.Unlock()
+
+	if _, ok := mockVMs.vms[m.podID]; !ok {
+		return fmt.Errorf("Pod %s VM is not running", m.podID)
+	}
+
 	return nil
 }
 
 func (m *mockHypervisor) addDevice(devInfo interface{}, devType deviceType) error {
+	m.devices = append(m.devices, mockDeviceName(devInfo, devType))
+
+	return nil
+}
+
+func (m *mockHypervisor) hotplugAddDevice(ctx context.Context, devInfo interface{}, devType deviceType) error {
+	m.hotplugs = append(m.hotplugs, mockHotplug{devInfo: devInfo, devType: devType})
+
+	m.updateVM(func(vm *mockVM) {
+		vm.Devices = append(vm.Devices, mockDeviceName(devInfo, devType))
+	})
+
+	return nil
+}
+
+func (m *mockHypervisor) hotplugRemoveDevice(ctx context.Context, devInfo interface{}, devType deviceType) error {
+	m.hotplugs = append(m.hotplugs, mockHotplug{devInfo: devInfo, devType: devType, remove: true})
+
+	name := mockDeviceName(devInfo, devType)
+	m.updateVM(func(vm *mockVM) {
+		for i, device := range vm.Devices {
+			if device == name {
+				vm.Devices = append(vm.Devices[:i], vm.Devices[i+1:]...)
+				return
+			}
+		}
+	})
+
 	return nil
 }
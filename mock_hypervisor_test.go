@@ -17,7 +17,10 @@
 package virtcontainers
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"testing"
 	"time"
 )
@@ -49,7 +52,7 @@ func TestMockHypervisorInit(t *testing.T) {
 }
 
 func TestMockHypervisorCreatePod(t *testing.T) {
-	var m *mockHypervisor
+	m := &mockHypervisor{}
 
 	config := PodConfig{}
 
@@ -60,12 +63,12 @@ func TestMockHypervisorCreatePod(t *testing.T) {
 }
 
 func TestMockHypervisorStartPod(t *testing.T) {
-	var m *mockHypervisor
+	m := &mockHypervisor{}
 
 	startCh := make(chan struct{})
 	stopCh := make(chan struct{})
 
-	go m.startPod(startCh, stopCh)
+	go m.startPod(context.Background(), startCh, stopCh)
 
 	select {
 	case <-startCh:
@@ -75,20 +78,150 @@ func TestMockHypervisorStartPod(t *testing.T) {
 	}
 }
 
+func TestMockHypervisorStartPodCanceled(t *testing.T) {
+	var m *mockHypervisor
+
+	startCh := make(chan struct{})
+	stopCh := make(chan struct{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := m.startPod(ctx, startCh, stopCh)
+	if err != context.Canceled {
+		t.Fatal(err)
+	}
+}
+
 func TestMockHypervisorStopPod(t *testing.T) {
+	m := &mockHypervisor{}
+
+	err := m.stopPod(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMockHypervisorPausePod(t *testing.T) {
 	var m *mockHypervisor
 
-	err := m.stopPod()
+	err := m.pausePod(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
 }
 
-func TestMockHypervisorAddDevice(t *testing.T) {
+func TestMockHypervisorResumePod(t *testing.T) {
+	var m *mockHypervisor
+
+	err := m.resumePod(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMockHypervisorStatsPod(t *testing.T) {
 	var m *mockHypervisor
 
+	_, err := m.statsPod(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMockHypervisorAddDevice(t *testing.T) {
+	m := &mockHypervisor{}
+
 	err := m.addDevice(nil, imgDev)
 	if err != nil {
 		t.Fatal(err)
 	}
 }
+
+func TestMockHypervisorResizePod(t *testing.T) {
+	m := &mockHypervisor{
+		resources: Resources{VCPUs: 1, Memory: 2048},
+	}
+
+	previous, err := m.resizePod(context.Background(), Resources{VCPUs: 2, Memory: 4096})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if previous != (Resources{VCPUs: 1, Memory: 2048}) {
+		t.Fatalf("Unexpected previous resources %+v", previous)
+	}
+}
+
+func TestMockHypervisorBootPooledVM(t *testing.T) {
+	var m *mockHypervisor
+
+	err := m.bootPooledVM(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMockHypervisorAdoptPooledVM(t *testing.T) {
+	m := &mockHypervisor{}
+
+	startCh := make(chan struct{}, 1)
+	stopCh := make(chan struct{})
+
+	err := m.adoptPooledVM(context.Background(), pooledVM{ID: "vm-test"}, startCh, stopCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-startCh:
+	default:
+		t.Fatal("Adopting a pooled VM should notify its start")
+	}
+}
+
+func TestMockHypervisorSaveRestoreVM(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	drive := rootfsDrive{ContainerID: "1", HostPath: "/dev/sdb", Device: "vda"}
+	endpoint := Endpoint{NetPair: NetworkInterfacePair{TAPIface: NetworkInterface{Name: "tap1"}}}
+
+	m := &mockHypervisor{}
+	if err := m.createPod(PodConfig{ID: "mock-checkpoint", VMConfig: Resources{VCPUs: 1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	m.addDevice(drive, blockDev)
+
+	if err := m.startPod(context.Background(), make(chan struct{}, 1), nil); err != nil {
+		t.Fatal(err)
+	}
+	defer m.stopPod(context.Background())
+
+	if err := m.hotplugAddDevice(context.Background(), endpoint, netDev); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.saveVM(context.Background(), dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// Restoring without the hot plugged network endpoint must fail.
+	restored := &mockHypervisor{}
+	restored.createPod(PodConfig{ID: "mock-checkpoint", VMConfig: Resources{VCPUs: 1}})
+	restored.addDevice(drive, blockDev)
+
+	if err := restored.restorePod(context.Background(), dir, make(chan struct{}, 1), nil); err == nil {
+		t.Fatal("Restoring a VM with different devices should fail")
+	}
+
+	restored.addDevice(endpoint, netDev)
+
+	if err := restored.restorePod(context.Background(), dir, make(chan struct{}, 1), nil); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -17,10 +17,14 @@
 package virtcontainers
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"os"
+	"path/filepath"
+	"unsafe"
 
 	"github.com/01org/ciao/ssntp/uuid"
 	"github.com/containernetworking/cni/pkg/ns"
@@ -175,7 +179,9 @@ func getLinkByName(netHandle *netlink.Handle, name string, expectedLink netlink.
 	return nil, fmt.Errorf("Incorrect link type %s, expecting %s", link.Type(), expectedLink.Type())
 }
 
-func bridgeNetworkPair(netPair NetworkInterfacePair) error {
+// bridgeNetworkPair creates the TAP interface and the bridge linking it to
+// the veth interface. On failure, it deletes the links it has created.
+func bridgeNetworkPair(netPair NetworkInterfacePair) (err error) {
 	netHandle, err := netlink.NewHandle()
 	if err != nil {
 		return err
@@ -186,6 +192,11 @@ func bridgeNetworkPair(netPair NetworkInterfacePair) error {
 	if err != nil {
 		return fmt.Errorf("Could not create TAP interface: %s", err)
 	}
+	defer func() {
+		if err != nil {
+			netHandle.LinkDel(tapLink)
+		}
+	}()
 
 	vethLink, err := getLinkByName(netHandle, netPair.VirtIface.Name, &netlink.Veth{})
 	if err != nil {
@@ -205,6 +216,11 @@ func bridgeNetworkPair(netPair NetworkInterfacePair) error {
 	if err != nil {
 		return fmt.Errorf("Could not create bridge: %s", err)
 	}
+	defer func() {
+		if err != nil {
+			netHandle.LinkDel(bridgeLink)
+		}
+	}()
 
 	if err := netHandle.LinkSetMaster(tapLink, bridgeLink.(*netlink.Bridge)); err != nil {
 		return fmt.Errorf("Could not attach TAP %s to the bridge %s: %s",
@@ -284,12 +300,144 @@ func unBridgeNetworkPair(netPair NetworkInterfacePair) error {
 	return nil
 }
 
+// unBridgeNetworkPairFunc returns a function unbridging netPair from within
+// the network namespace netNSPath.
+func unBridgeNetworkPairFunc(netNSPath string, netPair NetworkInterfacePair) func() error {
+	return func() error {
+		return doNetNS(netNSPath, func(_ ns.NetNS) error {
+			return unBridgeNetworkPair(netPair)
+		})
+	}
+}
+
+// interfaceStats returns the traffic counters of a host network interface.
+func interfaceStats(netHandle *netlink.Handle, name string) (InterfaceStats, error) {
+	stats := InterfaceStats{Name: name}
+
+	link, err := netHandle.LinkByName(name)
+	if err != nil {
+		return stats, fmt.Errorf("Could not get link %s: %s", name, err)
+	}
+
+	s := link.Attrs().Statistics
+	if s == nil {
+		return stats, nil
+	}
+
+	stats.RxBytes = uint64(s.RxBytes)
+	stats.RxPackets = uint64(s.RxPackets)
+	stats.RxErrors = uint64(s.RxErrors)
+	stats.RxDropped = uint64(s.RxDropped)
+	stats.TxBytes = uint64(s.TxBytes)
+	stats.TxPackets = uint64(s.TxPackets)
+	stats.TxErrors = uint64(s.TxErrors)
+	stats.TxDropped = uint64(s.TxDropped)
+
+	return stats, nil
+}
+
+// endpointsStats returns the TAP and veth interfaces counters of all the
+// endpoints of a network namespace.
+func endpointsStats(networkNS NetworkNamespace) ([]EndpointStats, error) {
+	var stats []EndpointStats
+
+	if networkNS.NetNsPath == "" || len(networkNS.Endpoints) == 0 {
+		return stats, nil
+	}
+
+	err := doNetNS(networkNS.NetNsPath, func(_ ns.NetNS) error {
+		netHandle, err := netlink.NewHandle()
+		if err != nil {
+			return err
+		}
+		defer netHandle.Delete()
+
+		for _, endpoint := range networkNS.Endpoints {
+			tapStats, err := interfaceStats(netHandle, endpoint.NetPair.TAPIface.Name)
+			if err != nil {
+				return err
+			}
+
+			virtStats, err := interfaceStats(netHandle, endpoint.NetPair.VirtIface.Name)
+			if err != nil {
+				return err
+			}
+
+			stats = append(stats, EndpointStats{
+				Name:      endpoint.NetPair.Name,
+				TAPIface:  tapStats,
+				VirtIface: virtStats,
+			})
+		}
+
+		return nil
+	})
+
+	return stats, err
+}
+
+// tunDevice is the TUN/TAP clone device.
+const tunDevice = "/dev/net/tun"
+
+// ifReq is the ioctl request structure for the TUNSETIFF ioctl.
+type ifReq struct {
+	Name  [unix.IFNAMSIZ]byte
+	Flags uint16
+	pad   [40 - unix.IFNAMSIZ - 2]byte
+}
+
+// openTAP attaches to an existing TAP interface of the current network
+// namespace and returns its file.
+func openTAP(name string) (*os.File, error) {
+	if len(name) >= unix.IFNAMSIZ {
+		return nil, fmt.Errorf("Interface name %s too long", name)
+	}
+
+	tap, err := os.OpenFile(tunDevice, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var req ifReq
+	copy(req.Name[:], name)
+	req.Flags = unix.IFF_TAP | unix.IFF_NO_PI | unix.IFF_VNET_HDR
+
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, tap.Fd(), uintptr(unix.TUNSETIFF), uintptr(unsafe.Pointer(&req)))
+	if errno != 0 {
+		tap.Close()
+		return nil, fmt.Errorf("Could not attach to TAP %s: %s", name, errno)
+	}
+
+	return tap, nil
+}
+
+// netNSOwnerDir holds one file per network namespace we created, storing
+// its path. Network namespaces are host wide, and this tells the garbage
+// collector which ones belong to this virtcontainers instance.
+func netNSOwnerDir() string {
+	return filepath.Join(filepath.Dir(runStoragePath), "netns")
+}
+
+func netNSOwnerFile(netNSPath string) string {
+	return filepath.Join(netNSOwnerDir(), filepath.Base(netNSPath))
+}
+
 func createNetNS() (string, error) {
 	n, err := ns.NewNS()
 	if err != nil {
 		return "", err
 	}
 
+	if err := os.MkdirAll(netNSOwnerDir(), dirMode); err != nil {
+		deleteNetNS(n.Path(), true)
+		return "", err
+	}
+
+	if err := ioutil.WriteFile(netNSOwnerFile(n.Path()), []byte(n.Path()), 0600); err != nil {
+		deleteNetNS(n.Path(), true)
+		return "", err
+	}
+
 	return n.Path(), nil
 }
 
@@ -333,6 +481,10 @@ func deleteNetNS(netNSPath string, mounted bool) error {
 		}
 	}
 
+	if err := os.Remove(netNSOwnerFile(netNSPath)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
 	return nil
 }
 
@@ -446,9 +598,11 @@ type network interface {
 	run(networkNSPath string, cb func() error) error
 
 	// add adds all needed interfaces inside the network namespace.
-	add(pod Pod, config NetworkConfig) (NetworkNamespace, error)
+	// It returns ctx.Err() if the context is done before all the
+	// interfaces have been added.
+	add(ctx context.Context, pod Pod, config NetworkConfig) (NetworkNamespace, error)
 
 	// remove unbridges and deletes TAP interfaces. It also removes virtual network
 	// interfaces and deletes the network namespace.
-	remove(pod Pod, networkNS NetworkNamespace) error
+	remove(ctx context.Context, pod Pod, networkNS NetworkNamespace) error
 }
@@ -17,6 +17,7 @@
 package virtcontainers
 
 import (
+	"context"
 	"syscall"
 )
 
@@ -31,46 +32,76 @@ func (n *noopAgent) init(pod *Pod, config interface{}) error {
 }
 
 // start is the Noop agent starting implementation. It does nothing.
-func (n *noopAgent) start(pod *Pod) error {
+func (n *noopAgent) start(ctx context.Context, pod *Pod) error {
 	return nil
 }
 
 // stop is the Noop agent stopping implementation. It does nothing.
-func (n *noopAgent) stop(pod Pod) error {
+func (n *noopAgent) stop(ctx context.Context, pod Pod) error {
 	return nil
 }
 
 // exec is the Noop agent command execution implementation. It does nothing.
-func (n *noopAgent) exec(pod *Pod, c Container, cmd Cmd) (*Process, error) {
+func (n *noopAgent) exec(ctx context.Context, pod *Pod, c Container, cmd Cmd) (*Process, error) {
 	return nil, nil
 }
 
 // startPod is the Noop agent Pod starting implementation. It does nothing.
-func (n *noopAgent) startPod(pod Pod) error {
+func (n *noopAgent) startPod(ctx context.Context, pod Pod) error {
 	return nil
 }
 
 // stopPod is the Noop agent Pod stopping implementation. It does nothing.
-func (n *noopAgent) stopPod(pod Pod) error {
+func (n *noopAgent) stopPod(ctx context.Context, pod Pod) error {
 	return nil
 }
 
 // createContainer is the Noop agent Container creation implementation. It does nothing.
-func (n *noopAgent) createContainer(pod *Pod, c *Container) error {
+func (n *noopAgent) createContainer(ctx context.Context, pod *Pod, c *Container) error {
 	return nil
 }
 
 // startContainer is the Noop agent Container starting implementation. It does nothing.
-func (n *noopAgent) startContainer(pod Pod, c Container) error {
+func (n *noopAgent) startContainer(ctx context.Context, pod Pod, c Container) error {
 	return nil
 }
 
 // stopContainer is the Noop agent Container stopping implementation. It does nothing.
-func (n *noopAgent) stopContainer(pod Pod, c Container) error {
+func (n *noopAgent) stopContainer(ctx context.Context, pod Pod, c Container) error {
 	return nil
 }
 
 // killContainer is the Noop agent Container signaling implementation. It does nothing.
-func (n *noopAgent) killContainer(pod Pod, c Container, signal syscall.Signal) error {
+func (n *noopAgent) killContainer(ctx context.Context, pod Pod, c Container, signal syscall.Signal) error {
+	return nil
+}
+
+// waitContainer is the Noop agent Container waiting implementation. It does
+// nothing and reports a successful exit.
+func (n *noopAgent) waitContainer(ctx context.Context, pod Pod, c Container) (int, error) {
+	return 0, nil
+}
+
+// watchContainer is the Noop agent Container watching implementation. It
+// does nothing, as no workload ever exits.
+func (n *noopAgent) watchContainer(ctx context.Context, pod Pod, c Container, exited func(exitCode int)) error {
+	return nil
+}
+
+// onlineCPUMem is the Noop agent vCPUs and memory onlining implementation.
+// It does nothing.
+func (n *noopAgent) onlineCPUMem(ctx context.Context, pod Pod) error {
+	return nil
+}
+
+// addInterface is the Noop agent network interface hot plug implementation.
+// It does nothing.
+func (n *noopAgent) addInterface(ctx context.Context, pod Pod, endpoint Endpoint) error {
+	return nil
+}
+
+// removeInterface is the Noop agent network interface hot unplug
+// implementation. It does nothing.
+func (n *noopAgent) removeInterface(ctx context.Context, pod Pod, endpoint Endpoint) error {
 	return nil
 }
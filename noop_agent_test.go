@@ -17,6 +17,7 @@
 package virtcontainers
 
 import (
+	"context"
 	"testing"
 )
 
@@ -34,7 +35,7 @@ func TestNoopAgentStartAgent(t *testing.T) {
 	n := &noopAgent{}
 	pod := &Pod{}
 
-	err := n.start(pod)
+	err := n.start(context.Background(), pod)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -46,7 +47,7 @@ func TestNoopAgentExec(t *testing.T) {
 	container := Container{}
 	cmd := Cmd{}
 
-	if _, err := n.exec(pod, container, cmd); err != nil {
+	if _, err := n.exec(context.Background(), pod, container, cmd); err != nil {
 		t.Fatal(err)
 	}
 }
@@ -55,7 +56,7 @@ func TestNoopAgentStartPod(t *testing.T) {
 	n := &noopAgent{}
 	pod := Pod{}
 
-	err := n.startPod(pod)
+	err := n.startPod(context.Background(), pod)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -65,7 +66,7 @@ func TestNoopAgentStopPod(t *testing.T) {
 	n := &noopAgent{}
 	pod := Pod{}
 
-	err := n.stopPod(pod)
+	err := n.stopPod(context.Background(), pod)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -75,7 +76,7 @@ func TestNoopAgentStopAgent(t *testing.T) {
 	n := &noopAgent{}
 	pod := Pod{}
 
-	err := n.stop(pod)
+	err := n.stop(context.Background(), pod)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -86,7 +87,7 @@ func TestNoopAgentCreateContainer(t *testing.T) {
 	pod := &Pod{}
 	container := &Container{}
 
-	err := n.createContainer(pod, container)
+	err := n.createContainer(context.Background(), pod, container)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -97,7 +98,7 @@ func TestNoopAgentStartContainer(t *testing.T) {
 	pod := Pod{}
 	container := Container{}
 
-	err := n.startContainer(pod, container)
+	err := n.startContainer(context.Background(), pod, container)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -108,7 +109,32 @@ func TestNoopAgentStopContainer(t *testing.T) {
 	pod := Pod{}
 	container := Container{}
 
-	err := n.stopContainer(pod, container)
+	err := n.stopContainer(context.Background(), pod, container)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNoopAgentWaitContainer(t *testing.T) {
+	n := &noopAgent{}
+	pod := Pod{}
+	container := Container{}
+
+	exitCode, err := n.waitContainer(context.Background(), pod, container)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exitCode != 0 {
+		t.Fatalf("Exit code %d, expecting 0", exitCode)
+	}
+}
+
+func TestNoopAgentOnlineCPUMem(t *testing.T) {
+	n := &noopAgent{}
+	pod := Pod{}
+
+	err := n.onlineCPUMem(context.Background(), pod)
 	if err != nil {
 		t.Fatal(err)
 	}
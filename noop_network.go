@@ -16,6 +16,10 @@
 
 package virtcontainers
 
+import (
+	"context"
+)
+
 // noopNetwork a.k.a. NO-OP Network is an empty network implementation, for
 // testing and mocking purposes.
 type noopNetwork struct {
@@ -36,13 +40,13 @@ func (n *noopNetwork) run(networkNSPath string, cb func() error) error {
 
 // add adds all needed interfaces inside the network namespace the Noop network.
 // It does nothing.
-func (n *noopNetwork) add(pod Pod, config NetworkConfig) (NetworkNamespace, error) {
+func (n *noopNetwork) add(ctx context.Context, pod Pod, config NetworkConfig) (NetworkNamespace, error) {
 	return NetworkNamespace{}, nil
 }
 
 // remove unbridges and deletes TAP interfaces. It also removes virtual network
 // interfaces and deletes the network namespace for the Noop network.
 // It does nothing.
-func (n *noopNetwork) remove(pod Pod, networkNS NetworkNamespace) error {
+func (n *noopNetwork) remove(ctx context.Context, pod Pod, networkNS NetworkNamespace) error {
 	return nil
 }
@@ -16,13 +16,17 @@
 
 package virtcontainers
 
+import (
+	"context"
+)
+
 type noopProxy struct{}
 
 var noopProxyURL = "noopProxyURL"
 
 // register is the proxy register implementation for testing purpose.
 // It does nothing.
-func (p *noopProxy) register(pod Pod) ([]ProxyInfo, string, error) {
+func (p *noopProxy) register(ctx context.Context, pod Pod) ([]ProxyInfo, string, error) {
 	var proxyInfos []ProxyInfo
 
 	for i := 0; i < len(pod.containers); i++ {
@@ -36,13 +40,13 @@ func (p *noopProxy) register(pod Pod) ([]ProxyInfo, string, error) {
 
 // unregister is the proxy unregister implementation for testing purpose.
 // It does nothing.
-func (p *noopProxy) unregister(pod Pod) error {
+func (p *noopProxy) unregister(ctx context.Context, pod Pod) error {
 	return nil
 }
 
 // connect is the proxy connect implementation for testing purpose.
 // It does nothing.
-func (p *noopProxy) connect(pod Pod, createToken bool) (ProxyInfo, string, error) {
+func (p *noopProxy) connect(ctx context.Context, pod Pod, createToken bool) (ProxyInfo, string, error) {
 	return ProxyInfo{}, noopProxyURL, nil
 }
 
@@ -54,6 +58,13 @@ func (p *noopProxy) disconnect() error {
 
 // sendCmd is the proxy sendCmd implementation for testing purpose.
 // It does nothing.
-func (p *noopProxy) sendCmd(cmd interface{}) (interface{}, error) {
+func (p *noopProxy) sendCmd(ctx context.Context, cmd interface{}) (interface{}, error) {
 	return nil, nil
 }
+
+// waitProcess is the proxy waitProcess implementation for testing purpose.
+// No process ever exits behind the noop proxy, it waits until ctx is done.
+func (p *noopProxy) waitProcess(ctx context.Context, pod Pod, containerID, processID string) (int, error) {
+	<-ctx.Done()
+	return -1, ctx.Err()
+}
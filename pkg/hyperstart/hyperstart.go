@@ -17,6 +17,7 @@
 package hyperstart
 
 import (
+	"context"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
@@ -449,6 +450,16 @@ func (h *Hyperstart) WaitForReady() error {
 
 // WaitForPAE waits for a PROCESSASYNCEVENT message on CTL channel.
 func (h *Hyperstart) WaitForPAE(containerID, processID string) (*PAECommand, error) {
+	return h.WaitForPAEWithContext(context.Background(), containerID, processID)
+}
+
+// WaitForPAEWithContext is the context aware version of WaitForPAE.
+// The process exit status is available from the returned PAECommand.
+func (h *Hyperstart) WaitForPAEWithContext(ctx context.Context, containerID, processID string) (*PAECommand, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	if h.ctlMulticast == nil {
 		return nil, fmt.Errorf("No multicast available for CTL channel")
 	}
@@ -458,10 +469,17 @@ func (h *Hyperstart) WaitForPAE(containerID, processID string) (*PAECommand, err
 		return nil, err
 	}
 
-	msg := <-channel
+	var msg *DecodedMessage
+	select {
+	case msg = <-channel:
+	case <-ctx.Done():
+		// Keep the multicaster from blocking on the event.
+		go func() { <-channel }()
+		return nil, ctx.Err()
+	}
 
 	var paeData PAECommand
-	err = json.Unmarshal(msg.Message, paeData)
+	err = json.Unmarshal(msg.Message, &paeData)
 	if err != nil {
 		return nil, err
 	}
@@ -480,6 +498,17 @@ func (h *Hyperstart) WaitForPAE(containerID, processID string) (*PAECommand, err
 // and the command writing an atomic operation protected by a mutex.
 // Waiting for the reply from multicaster doesn't need to be protected by this mutex.
 func (h *Hyperstart) SendCtlMessage(cmd string, data []byte) (*DecodedMessage, error) {
+	return h.SendCtlMessageWithContext(context.Background(), cmd, data)
+}
+
+// SendCtlMessageWithContext is the context aware version of SendCtlMessage.
+// It stops waiting for hyperstart's answer as soon as ctx is done. The reply
+// is still consumed in the background so that the multicaster never blocks.
+func (h *Hyperstart) SendCtlMessageWithContext(ctx context.Context, cmd string, data []byte) (*DecodedMessage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	if h.ctlMulticast == nil {
 		return nil, fmt.Errorf("No multicast available for CTL channel")
 	}
@@ -510,7 +539,13 @@ func (h *Hyperstart) SendCtlMessage(cmd string, data []byte) (*DecodedMessage, e
 
 	h.ctlMutex.Unlock()
 
-	msgRecv := <-channel
+	var msgRecv *DecodedMessage
+	select {
+	case msgRecv = <-channel:
+	case <-ctx.Done():
+		go func() { <-channel }()
+		return nil, ctx.Err()
+	}
 
 	err = h.CheckReturnedCode(msgRecv.Code, AckCode)
 	if err != nil {
@@ -17,6 +17,7 @@
 package hyperstart_test
 
 import (
+	"context"
 	"math"
 	"net"
 	"reflect"
@@ -534,6 +535,68 @@ func TestWaitForReadyError(t *testing.T) {
 	}
 }
 
+func TestWaitForPAE(t *testing.T) {
+	mockHyper, h, err := connectMockHyperstart(t, true)
+	if err != nil {
+		t.Fatal()
+	}
+	defer mockHyper.Stop()
+	defer disconnectHyperstart(h)
+
+	event := PAECommand{
+		Container: "container",
+		Process:   "process",
+		Event:     "finished",
+		Status:    3,
+	}
+
+	data, err := FormatMessage(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Events are dropped when nobody listens for them, so keep sending
+	// until the listener got registered.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Millisecond):
+				mockHyper.SendMessage(int(ProcessAsyncEventCode), data)
+			}
+		}
+	}()
+
+	pae, err := h.WaitForPAE(event.Container, event.Process)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reflect.DeepEqual(*pae, event) == false {
+		t.Fatalf("Got %+v, expecting %+v", *pae, event)
+	}
+}
+
+func TestWaitForPAEWithContextCanceled(t *testing.T) {
+	mockHyper, h, err := connectMockHyperstart(t, true)
+	if err != nil {
+		t.Fatal()
+	}
+	defer mockHyper.Stop()
+	defer disconnectHyperstart(h)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = h.WaitForPAEWithContext(ctx, "container", "process")
+	if err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+}
+
 var cmdList = []string{
 	Version,
 	StartPod,
@@ -576,3 +639,20 @@ func TestSendCtlMessage(t *testing.T) {
 		testSendCtlMessage(t, cmd)
 	}
 }
+
+func TestSendCtlMessageWithContextCanceled(t *testing.T) {
+	mockHyper, h, err := connectMockHyperstart(t, true)
+	if err != nil {
+		t.Fatal()
+	}
+	defer mockHyper.Stop()
+	defer disconnectHyperstart(h)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = h.SendCtlMessageWithContext(ctx, Ping, []byte{})
+	if err != context.Canceled {
+		t.Fatal()
+	}
+}
@@ -0,0 +1,56 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package hyperstart
+
+import (
+	"sync"
+)
+
+// Logger is the logging interface of the hyperstart package. The
+// virtcontainers Logger implements it, and virtcontainers sets it.
+type Logger interface {
+	Infof(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+type nopLogger struct{}
+
+func (l nopLogger) Infof(format string, args ...interface{})  {}
+func (l nopLogger) Errorf(format string, args ...interface{}) {}
+
+var (
+	logLock sync.RWMutex
+	log     Logger = nopLogger{}
+)
+
+// SetLogger sets the package Logger. Nothing is logged until it is set.
+func SetLogger(logger Logger) {
+	if logger == nil {
+		logger = nopLogger{}
+	}
+
+	logLock.Lock()
+	log = logger
+	logLock.Unlock()
+}
+
+func logger() Logger {
+	logLock.RLock()
+	defer logLock.RUnlock()
+
+	return log
+}
@@ -21,8 +21,6 @@ import (
 	"fmt"
 	"net"
 	"sync"
-
-	"github.com/golang/glog"
 )
 
 type ctlDataType string
@@ -56,13 +54,13 @@ func startCtlMonitor(ctlConn net.Conn) *multicast {
 		for {
 			msg, err := ReadCtlMessage(ctlMulticast.ctl)
 			if err != nil {
-				glog.Infof("Read on CTL channel ended: %s\n", err)
+				logger().Infof("Read on CTL channel ended: %s", err)
 				break
 			}
 
 			err = ctlMulticast.write(msg)
 			if err != nil {
-				glog.Errorf("Multicaster write error: %s\n", err)
+				logger().Errorf("Multicaster write error: %s", err)
 				break
 			}
 		}
@@ -78,20 +76,26 @@ func (m *multicast) buildEventID(containerID, processID string) string {
 func (m *multicast) sendEvent(msg *DecodedMessage) error {
 	var paeData PAECommand
 
-	err := json.Unmarshal(msg.Message, paeData)
+	err := json.Unmarshal(msg.Message, &paeData)
 	if err != nil {
 		return err
 	}
 
 	uniqueID := m.buildEventID(paeData.Container, paeData.Process)
+
+	m.Lock()
 	channel, exist := m.event[uniqueID]
 	if !exist {
+		m.Unlock()
 		return nil
 	}
 
-	channel <- msg
-
 	delete(m.event, uniqueID)
+	m.Unlock()
+
+	// The channel has been removed from the map, nobody else can write
+	// on it, that's why we can send out of the mutex.
+	channel <- msg
 
 	return nil
 }
@@ -161,14 +165,18 @@ func (m *multicast) listen(containerID, processID string, dataType ctlDataType)
 	case eventType:
 		uniqueID := m.buildEventID(containerID, processID)
 
+		m.Lock()
+		defer m.Unlock()
+
 		_, exist := m.event[uniqueID]
 		if exist {
 			return nil, fmt.Errorf("Channel already assigned for ID %s", uniqueID)
 		}
 
-		m.event[uniqueID] = make(chan *DecodedMessage)
+		newChan := make(chan *DecodedMessage)
+		m.event[uniqueID] = newChan
 
-		return m.event[uniqueID], nil
+		return newChan, nil
 	default:
 		return nil, fmt.Errorf("Unknown data type: %s", dataType)
 	}
@@ -199,6 +199,11 @@ type Route struct {
 	Device  string `json:"device,omitempty"`
 }
 
+// Routes describes the routes to setup with the SetupRoute command.
+type Routes struct {
+	Routes []Route `json:"routes"`
+}
+
 // Pod describes the pod configuration to start inside the VM.
 type Pod struct {
 	Hostname   string         `json:"hostname"`
@@ -23,7 +23,6 @@ import (
 	"strconv"
 	"strings"
 
-	log "github.com/Sirupsen/logrus"
 	vc "github.com/containers/virtcontainers"
 	spec "github.com/opencontainers/runtime-spec/specs-go"
 )
@@ -131,6 +130,11 @@ func networkConfig(ocispec spec.Spec) (vc.NetworkConfig, error) {
 // PodConfig converts an OCI compatible runtime configuration file
 // to a virtcontainers pod configuration structure.
 func PodConfig(runtime RuntimeConfig, bundlePath, cid, console string) (*vc.PodConfig, *spec.Spec, error) {
+	log := vc.GetLogger().WithFields(vc.Fields{
+		vc.SubsystemField:   "oci",
+		vc.ContainerIDField: cid,
+	})
+
 	configPath := filepath.Join(bundlePath, "config.json")
 	log.Debugf("converting %s", configPath)
 
@@ -17,6 +17,7 @@
 package virtcontainers
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -25,7 +26,6 @@ import (
 	"time"
 
 	"github.com/01org/ciao/ssntp/uuid"
-	"github.com/golang/glog"
 )
 
 // controlSocket is the pod control socket.
@@ -39,6 +39,15 @@ const controlSocket = "ctrl.sock"
 // to understand if the VM is still alive or not.
 const monitorSocket = "monitor.sock"
 
+// vmStartTimeout is the time we wait for the VM to be started when
+// the caller did not set any deadline on the context.
+const vmStartTimeout = time.Second
+
+// vmRestoreTimeout is the time we wait for the VM to be restored from a
+// checkpoint when the caller did not set any deadline on the context.
+// The whole VM memory has to be loaded first.
+const vmRestoreTimeout = time.Minute
+
 // stateString is a string representing a pod state.
 type stateString string
 
@@ -49,8 +58,16 @@ const (
 	// StateRunning represents a pod/container that's currently running.
 	StateRunning stateString = "running"
 
+	// StatePaused represents a pod that has been paused. Its VM does not
+	// run anymore but keeps its memory state.
+	StatePaused stateString = "paused"
+
 	// StateStopped represents a pod/container that has been stopped.
 	StateStopped stateString = "stopped"
+
+	// StateCrashed represents a pod whose VM went away without being
+	// asked to. Its containers are stopped, and it can only be deleted.
+	StateCrashed stateString = "crashed"
 )
 
 // State is a pod state structure.
@@ -60,7 +77,7 @@ type State struct {
 
 // valid checks that the pod state is valid.
 func (state *State) valid() bool {
-	for _, validState := range []stateString{StateReady, StateRunning, StateStopped} {
+	for _, validState := range []stateString{StateReady, StateRunning, StatePaused, StateStopped, StateCrashed} {
 		if state.State == validState {
 			return true
 		}
@@ -73,7 +90,7 @@ func (state *State) valid() bool {
 // an unreachable state.
 func (state *State) validTransition(oldState stateString, newState stateString) error {
 	if state.State != oldState {
-		return fmt.Errorf("Invalid state %s (Expecting %s)", state.State, oldState)
+		return &StateError{Op: "move", From: state.State, To: newState}
 	}
 
 	switch state.State {
@@ -83,7 +100,12 @@ func (state *State) validTransition(oldState stateString, newState stateString)
 		}
 
 	case StateRunning:
-		if newState == StateStopped {
+		if newState == StatePaused || newState == StateStopped {
+			return nil
+		}
+
+	case StatePaused:
+		if newState == StateRunning {
 			return nil
 		}
 
@@ -93,8 +115,7 @@ func (state *State) validTransition(oldState stateString, newState stateString)
 		}
 	}
 
-	return fmt.Errorf("Can not move from %s to %s",
-		state.State, newState)
+	return &StateError{Op: "move", From: state.State, To: newState}
 }
 
 // Volume is a shared volume between the host and the VM,
@@ -247,7 +268,9 @@ type PodConfig struct {
 	// Field specific to OCI specs, needed to setup all the hooks
 	Hooks Hooks
 
-	// VMConfig is the VM configuration to set for this pod.
+	// VMConfig is the VM configuration to set for this pod, i.e. the
+	// resources of its VM. UpdatePodResources updates it when resizing
+	// the VM.
 	VMConfig Resources
 
 	HypervisorType   HypervisorType
@@ -289,30 +312,116 @@ func (podConfig *PodConfig) valid() bool {
 		podConfig.ID = uuid.Generate().String()
 	}
 
+	podConfig.HypervisorConfig = podConfig.HypervisorConfig.withAnnotations(podConfig.Annotations)
+
 	return true
 }
 
-// lock locks any pod to prevent it from being accessed by other processes.
-func lockPod(podID string) (*os.File, error) {
-	fs := filesystem{}
-	podlockFile, _, err := fs.podURI(podID, lockFileType)
+// lockMode is the mode a pod lock is taken in.
+type lockMode int
+
+const (
+	// exclusiveLock is taken by the calls modifying a pod.
+	exclusiveLock lockMode = syscall.LOCK_EX
+
+	// sharedLock is taken by the calls only reading a pod. They can all
+	// hold it at the same time, but never with an exclusive lock.
+	sharedLock lockMode = syscall.LOCK_SH
+)
+
+// podLockRetryInterval is how often lockPod tries again to take a lock held
+// by another process, when it has to give up after some time.
+var podLockRetryInterval = 10 * time.Millisecond
+
+// statusLockTimeout bounds the time status queries wait for a pod lock, for
+// a hung operation not to block them forever.
+var statusLockTimeout = 10 * time.Second
+
+func openPodLock(podID string) (*os.File, error) {
+	podlockFile, _, err := newStorage().podURI(podID, lockFileType)
 	if err != nil {
 		return nil, err
 	}
 
 	lockFile, err := os.Open(podlockFile)
+	if err != nil {
+		return nil, podNotFound(podID, err)
+	}
+
+	return lockFile, nil
+}
+
+// lock locks any pod to prevent it from being accessed by other processes.
+// It waits for the processes holding a conflicting lock to release it, and
+// returns ErrPodLocked if ctx expires first.
+func lockPod(ctx context.Context, podID string, mode lockMode) (*os.File, error) {
+	lockFile, err := openPodLock(podID)
 	if err != nil {
 		return nil, err
 	}
 
-	err = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX)
+	// Without a deadline nor a cancellation, there is no need to poll.
+	if ctx.Done() == nil {
+		if err := syscall.Flock(int(lockFile.Fd()), int(mode)); err != nil {
+			lockFile.Close()
+			return nil, err
+		}
+
+		return lockFile, nil
+	}
+
+	for {
+		err := syscall.Flock(int(lockFile.Fd()), int(mode)|syscall.LOCK_NB)
+		if err == nil {
+			return lockFile, nil
+		}
+
+		if err != syscall.EWOULDBLOCK {
+			lockFile.Close()
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			lockFile.Close()
+			if ctx.Err() == context.DeadlineExceeded {
+				return nil, ErrPodLocked
+			}
+			return nil, ctx.Err()
+		case <-time.After(podLockRetryInterval):
+		}
+	}
+}
+
+// tryLockPod locks a pod if no other process holds a conflicting lock, and
+// returns ErrPodLocked otherwise.
+func tryLockPod(podID string, mode lockMode) (*os.File, error) {
+	lockFile, err := openPodLock(podID)
 	if err != nil {
 		return nil, err
 	}
 
+	err = syscall.Flock(int(lockFile.Fd()), int(mode)|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		lockFile.Close()
+		return nil, ErrPodLocked
+	} else if err != nil {
+		lockFile.Close()
+		return nil, err
+	}
+
 	return lockFile, nil
 }
 
+// lockPodForStatus takes a shared lock on a pod, waiting for it at most
+// statusLockTimeout.
+func lockPodForStatus(ctx context.Context, podID string) (*os.File, error) {
+	ctx, cancel := context.WithTimeout(ctx, statusLockTimeout)
+	defer cancel()
+
+	return lockPod(ctx, podID, sharedLock)
+}
+
 // unlock unlocks any pod to allow it being accessed by other processes.
 func unlockPod(lockFile *os.File) error {
 	err := syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
@@ -356,6 +465,18 @@ func (p *Pod) ID() string {
 	return p.id
 }
 
+func (p *Pod) logger() Logger {
+	return podLogger("pod", p.id)
+}
+
+// operationLogger returns the logger of an operation started at begin.
+func (p *Pod) operationLogger(operation string, begin time.Time) Logger {
+	return p.logger().WithFields(Fields{
+		OperationField: operation,
+		DurationField:  time.Since(begin),
+	})
+}
+
 // Annotations returns any annotation that a user could have stored through the pod.
 func (p *Pod) Annotations(key string) (string, error) {
 	value, exist := p.config.Annotations[key]
@@ -409,7 +530,7 @@ func createPod(podConfig PodConfig) (*Pod, error) {
 
 	err = hypervisor.init(podConfig.HypervisorConfig)
 	if err != nil {
-		return nil, err
+		return nil, &HypervisorError{Op: "initialize", Err: err}
 	}
 
 	network := newNetwork(podConfig.NetworkModel)
@@ -418,7 +539,7 @@ func createPod(podConfig PodConfig) (*Pod, error) {
 		id:         podConfig.ID,
 		hypervisor: hypervisor,
 		agent:      agent,
-		storage:    &filesystem{},
+		storage:    newStorage(),
 		network:    network,
 		config:     &podConfig,
 		volumes:    podConfig.Volumes,
@@ -439,10 +560,21 @@ func createPod(podConfig PodConfig) (*Pod, error) {
 		return nil, err
 	}
 
-	err = p.hypervisor.createPod(podConfig)
+	state, err := p.storage.fetchPodState(p.id)
+	existing := err == nil && state.State != ""
+
+	vmConfig := podConfig
+	if existing {
+		vmConfig, err = vmBootConfig(p.storage, podConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = p.hypervisor.createPod(vmConfig)
 	if err != nil {
 		p.storage.deletePodResources(p.id, nil)
-		return nil, err
+		return nil, &HypervisorError{Op: "create the pod", Err: err}
 	}
 
 	var agentConfig interface{}
@@ -461,15 +593,20 @@ func createPod(podConfig PodConfig) (*Pod, error) {
 	err = p.agent.init(p, agentConfig)
 	if err != nil {
 		p.storage.deletePodResources(p.id, nil)
-		return nil, err
+		return nil, &AgentError{Op: "initialize", Err: err}
 	}
 
-	state, err := p.storage.fetchPodState(p.id)
-	if err == nil && state.State != "" {
+	if existing {
 		p.state = state
 		return p, nil
 	}
 
+	err = p.addRootfsDrives()
+	if err != nil {
+		p.storage.deletePodResources(p.id, nil)
+		return nil, err
+	}
+
 	err = p.createSetStates()
 	if err != nil {
 		p.storage.deletePodResources(p.id, nil)
@@ -479,56 +616,244 @@ func createPod(podConfig PodConfig) (*Pod, error) {
 	return p, nil
 }
 
-// storePod stores a pod config.
-func (p *Pod) storePod() error {
-	err := p.storage.storePodResource(p.id, configFileType, *(p.config))
+// addRootfsDrives passes the block device and image containers rootfs
+// through to the VM, and stores the drives for the agent to find out their
+// guest names. It can only be done before the VM starts.
+func (p *Pod) addRootfsDrives() error {
+	drives, err := newRootfsDrives(*(p.config))
 	if err != nil {
 		return err
 	}
 
-	for _, container := range p.containers {
-		err = p.storage.storeContainerResource(p.id, container.id, configFileType, *(container.config))
+	for _, drive := range drives {
+		err = p.hypervisor.addDevice(drive, blockDev)
+		if err != nil {
+			return &HypervisorError{Op: "add a rootfs drive", Err: err}
+		}
+	}
+
+	return p.storage.storePodDevices(p.id, podDevices{RootfsDrives: drives})
+}
+
+// storePod stores a pod config, and its containers configs.
+func (p *Pod) storePod() error {
+	return p.storage.transaction(func(storage resourceStorage) error {
+		err := storage.storePodResource(p.id, configFileType, *(p.config))
+		if err != nil {
+			return err
+		}
+
+		for _, container := range p.containers {
+			err = storage.storeContainerResource(p.id, container.id, configFileType, *(container.config))
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// setup stores a freshly created pod, sets its network up and starts its VM.
+// Every completed step registers its undo action into rb, so that the caller
+// can unwind all of them if this or any later step fails.
+func (p *Pod) setup(ctx context.Context, rb *rollback) (NetworkNamespace, error) {
+	rb.add("pod resources", func() error {
+		err := p.storage.deletePodResources(p.id, nil)
 		if err != nil {
 			return err
 		}
+
+		events.publish(Event{
+			Type:  PodDeleted,
+			PodID: p.id,
+		})
+
+		return nil
+	})
+
+	// Store it.
+	span, _ := p.startSpan(ctx, "storePod")
+	err := p.storePod()
+	finishSpan(span, err)
+	if err != nil {
+		return NetworkNamespace{}, err
 	}
 
-	return nil
+	// Initialize the network.
+	netNSPath := p.config.NetworkConfig.NetNSPath
+	span, _ = p.startSpan(ctx, "network.init")
+	err = p.network.init(&(p.config.NetworkConfig))
+	finishSpan(span, err)
+	if err != nil {
+		return NetworkNamespace{}, &NetworkError{Op: "initialize", Err: err}
+	}
+
+	// Only remove the network namespace if we created it.
+	if netNSPath == "" && p.config.NetworkConfig.NetNSPath != "" {
+		createdNetNSPath := p.config.NetworkConfig.NetNSPath
+		rb.add("network namespace", func() error {
+			// network.remove() may already have deleted it.
+			if _, err := os.Stat(createdNetNSPath); os.IsNotExist(err) {
+				return nil
+			}
+
+			return deleteNetNS(createdNetNSPath, true)
+		})
+	}
+
+	// Execute prestart hooks inside netns
+	span, _ = p.startSpan(ctx, "preStartHooks")
+	err = p.network.run(p.config.NetworkConfig.NetNSPath, func() error {
+		return p.config.Hooks.preStartHooks(p.id)
+	})
+	finishSpan(span, err)
+	if err != nil {
+		return NetworkNamespace{}, err
+	}
+
+	// Add the network
+	span, spanCtx := p.startSpan(ctx, "network.add")
+	networkNS, err := p.network.add(spanCtx, *p, p.config.NetworkConfig)
+	finishSpan(span, err)
+	if err != nil {
+		return NetworkNamespace{}, &NetworkError{Op: "add the pod network", Err: err}
+	}
+
+	// Undo actions must not depend on a context that may be already done.
+	rb.add("network", func() error {
+		return p.network.remove(context.Background(), *p, networkNS)
+	})
+
+	// Store the network
+	err = p.storage.storePodNetwork(p.id, networkNS)
+	if err != nil {
+		return NetworkNamespace{}, err
+	}
+
+	// Start the VM
+	err = p.startVM(ctx)
+	if err != nil {
+		return NetworkNamespace{}, err
+	}
+
+	rb.add("VM", func() error {
+		return p.stopVM(context.Background())
+	})
+
+	return networkNS, nil
 }
 
 // fetchPod fetches a pod config from a pod ID and returns a pod.
 func fetchPod(podID string) (*Pod, error) {
-	fs := filesystem{}
-	config, err := fs.fetchPodConfig(podID)
+	config, err := newStorage().fetchPodConfig(podID)
 	if err != nil {
-		return nil, err
+		return nil, podNotFound(podID, err)
 	}
 
-	glog.Infof("Info structure:\n%+v\n", config)
+	podLogger("pod", podID).Debugf("Fetched pod config")
 
 	return createPod(config)
 }
 
+// fetchPodStatus reads a pod status from storage. Unlike fetchPod, it never
+// modifies the pod storage, and can safely run under a shared lock.
+func fetchPodStatus(storage resourceStorage, podID string) (PodStatus, error) {
+	config, err := storage.fetchPodConfig(podID)
+	if err != nil {
+		return PodStatus{}, podNotFound(podID, err)
+	}
+
+	state, err := storage.fetchPodState(podID)
+	if err != nil {
+		return PodStatus{}, err
+	}
+
+	var contStatusList []ContainerStatus
+	for _, contConfig := range config.Containers {
+		contStatus := ContainerStatus{
+			ID:     contConfig.ID,
+			RootFs: contConfig.RootFs,
+		}
+
+		if state, err := storage.fetchContainerState(podID, contConfig.ID); err == nil {
+			contStatus.State.State = state.State
+		}
+
+		if process, err := storage.fetchContainerProcess(podID, contConfig.ID); err == nil {
+			contStatus.PID = process.Pid
+			contStatus.ExitCode = process.ExitCode
+			contStatus.FinishedAt = process.FinishedAt
+		}
+
+		contStatusList = append(contStatusList, contStatus)
+	}
+
+	return PodStatus{
+		ID:               podID,
+		State:            state,
+		Hypervisor:       config.HypervisorType,
+		Agent:            config.AgentType,
+		ContainersStatus: contStatusList,
+	}, nil
+}
+
+// fetchAllPodStatuses reads the statuses of all the pods in storage. Pods
+// being created or deleted, whose resources are incomplete, are skipped.
+func fetchAllPodStatuses(storage resourceStorage) ([]PodStatus, error) {
+	podIDs, err := storage.listPods()
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []PodStatus
+	for _, podID := range podIDs {
+		status, err := fetchPodStatus(storage, podID)
+		if err != nil {
+			continue
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
 // delete deletes an already created pod.
 // The VM in which the pod is running will be shut down.
 func (p *Pod) delete() error {
-	state, err := p.storage.fetchPodState(p.id)
-	if err != nil {
+	if _, err := p.deleteCheckState(); err != nil {
 		return err
 	}
 
-	if state.State != StateReady && state.State != StateStopped {
-		return fmt.Errorf("Pod not ready or stopped, impossible to delete")
-	}
-
-	err = p.storage.deletePodResources(p.id, nil)
+	err := p.storage.deletePodResources(p.id, nil)
 	if err != nil {
 		return err
 	}
 
+	events.publish(Event{
+		Type:  PodDeleted,
+		PodID: p.id,
+	})
+
 	return nil
 }
 
+// deleteCheckState returns the pod state, or an error if the pod cannot be
+// deleted from it. Running and paused pods have to be stopped first.
+func (p *Pod) deleteCheckState() (State, error) {
+	state, err := p.storage.fetchPodState(p.id)
+	if err != nil {
+		return State{}, err
+	}
+
+	if state.State != StateReady && state.State != StateStopped && state.State != StateCrashed {
+		return State{}, &StateError{PodID: p.id, Op: "delete", From: state.State}
+	}
+
+	return state, nil
+}
+
 func (p *Pod) startCheckStates() error {
 	state, err := p.storage.fetchPodState(p.id)
 	if err != nil {
@@ -570,13 +895,49 @@ func (p *Pod) startSetStates() error {
 
 // startVM starts the VM, ensuring it is started before it returns or issuing
 // an error in case of timeout. Then it connects to the agent inside the VM.
-func (p *Pod) startVM() error {
+// If ctx has no deadline, we give up waiting for the VM after vmStartTimeout.
+// A pre-booted VM is used if a VM pool matches the pod configuration.
+func (p *Pod) startVM(ctx context.Context) (err error) {
+	span, ctx := p.startSpan(ctx, "startVM")
+	defer func() { finishSpan(span, err) }()
+
+	if vm, ok := p.claimPooledVM(); ok {
+		err := p.adoptPooledVM(ctx, vm)
+		if err == nil {
+			return nil
+		}
+
+		p.logger().Warnf("Could not adopt pooled VM %s, booting a new one: %s", vm.ID, err)
+
+		if err := destroyPooledVM(p.poolKey(), vm); err != nil {
+			p.logger().Errorf("Could not destroy pooled VM %s: %s", vm.ID, err)
+		}
+	}
+
+	return p.launchVM(ctx, vmStartTimeout, p.hypervisor.startPod)
+}
+
+// launchVM runs the hypervisor launch function from the pod network
+// namespace, and waits for it like startVM does, with a different timeout.
+func (p *Pod) launchVM(ctx context.Context, timeout time.Duration, launch func(ctx context.Context, startCh, stopCh chan struct{}) error) error {
+	if err := createConsoleLogDir(p.id); err != nil {
+		return err
+	}
+
+	begin := time.Now()
 	vmStartedCh := make(chan struct{})
 	vmStoppedCh := make(chan struct{})
 
+	startCtx := ctx
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		startCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
 	go func() {
 		p.network.run(p.config.NetworkConfig.NetNSPath, func() error {
-			err := p.hypervisor.startPod(vmStartedCh, vmStoppedCh)
+			err := launch(startCtx, vmStartedCh, vmStoppedCh)
 			return err
 		})
 	}()
@@ -584,34 +945,50 @@ func (p *Pod) startVM() error {
 	// Wait for the pod started notification
 	select {
 	case <-vmStartedCh:
-		break
-	case <-time.After(time.Second):
-		return fmt.Errorf("Did not receive the pod started notification")
+		observeHypervisorLaunch(p.config.HypervisorType, begin)
+	case <-startCtx.Done():
+		// The hypervisor may be up but unable to notify us.
+		p.hypervisor.stopPod(context.Background())
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		return &HypervisorError{
+			Op:  "start the VM",
+			Err: &TimeoutError{Op: "receive the pod started notification", Timeout: timeout},
+		}
 	}
 
-	err := p.agent.start(p)
+	span, agentCtx := p.startSpan(ctx, "agent.start")
+	err := p.agent.start(agentCtx, p)
+	finishSpan(span, err)
 	if err != nil {
-		p.stop()
-		return err
+		p.hypervisor.stopPod(context.Background())
+		return &AgentError{Op: "start", Err: err}
 	}
 
-	glog.Infof("VM started\n")
+	p.operationLogger("start the VM", begin).Infof("VM started")
 
 	return nil
 }
 
 // start starts a pod. The containers that are making the pod
 // will be started.
-func (p *Pod) start() error {
+func (p *Pod) start(ctx context.Context) error {
+	begin := time.Now()
+
 	err := p.startCheckStates()
 	if err != nil {
 		return err
 	}
 
-	err = p.agent.startPod(*p)
+	span, agentCtx := p.startSpan(ctx, "agent.startPod")
+	err = p.agent.startPod(agentCtx, *p)
+	finishSpan(span, err)
 	if err != nil {
-		p.stop()
-		return err
+		p.stop(ctx)
+		return &AgentError{Op: "start the pod", Err: err}
 	}
 
 	err = p.startSetStates()
@@ -619,7 +996,11 @@ func (p *Pod) start() error {
 		return err
 	}
 
-	glog.Infof("Started Pod %s\n", p.ID())
+	for _, c := range p.containers {
+		c.watch()
+	}
+
+	p.operationLogger("start", begin).Infof("Started pod")
 
 	return nil
 }
@@ -653,15 +1034,15 @@ func (p *Pod) stopSetStates() error {
 }
 
 // stopVM stops the agent inside the VM and shut down the VM itself.
-func (p *Pod) stopVM() error {
-	err := p.agent.stop(*p)
+func (p *Pod) stopVM(ctx context.Context) error {
+	err := p.agent.stop(ctx, *p)
 	if err != nil {
-		return err
+		return &AgentError{Op: "stop", Err: err}
 	}
 
-	err = p.hypervisor.stopPod()
+	err = p.hypervisor.stopPod(ctx)
 	if err != nil {
-		return err
+		return &HypervisorError{Op: "stop the VM", Err: err}
 	}
 
 	return nil
@@ -669,15 +1050,19 @@ func (p *Pod) stopVM() error {
 
 // stop stops a pod. The containers that are making the pod
 // will be destroyed.
-func (p *Pod) stop() error {
+func (p *Pod) stop(ctx context.Context) error {
+	begin := time.Now()
+
 	err := p.stopCheckStates()
 	if err != nil {
 		return err
 	}
 
-	err = p.agent.stopPod(*p)
+	span, agentCtx := p.startSpan(ctx, "agent.stopPod")
+	err = p.agent.stopPod(agentCtx, *p)
+	finishSpan(span, err)
 	if err != nil {
-		return err
+		return &AgentError{Op: "stop the pod", Err: err}
 	}
 
 	err = p.stopSetStates()
@@ -685,9 +1070,245 @@ func (p *Pod) stop() error {
 		return err
 	}
 
+	p.operationLogger("stop", begin).Infof("Stopped pod")
+
+	return nil
+}
+
+// pause pauses a running pod. The VM is frozen but keeps its memory
+// state, and the containers states are left untouched.
+func (p *Pod) pause(ctx context.Context) error {
+	begin := time.Now()
+
+	state, err := p.storage.fetchPodState(p.id)
+	if err != nil {
+		return err
+	}
+
+	err = state.validTransition(StateRunning, StatePaused)
+	if err != nil {
+		return err
+	}
+
+	err = p.hypervisor.pausePod(ctx)
+	if err != nil {
+		return &HypervisorError{Op: "pause the VM", Err: err}
+	}
+
+	err = p.setPodState(StatePaused)
+	if err != nil {
+		return err
+	}
+
+	p.operationLogger("pause", begin).Infof("Paused pod")
+
 	return nil
 }
 
+// resume resumes a paused pod.
+func (p *Pod) resume(ctx context.Context) error {
+	begin := time.Now()
+
+	state, err := p.storage.fetchPodState(p.id)
+	if err != nil {
+		return err
+	}
+
+	err = state.validTransition(StatePaused, StateRunning)
+	if err != nil {
+		return err
+	}
+
+	err = p.hypervisor.resumePod(ctx)
+	if err != nil {
+		return &HypervisorError{Op: "resume the VM", Err: err}
+	}
+
+	err = p.setPodState(StateRunning)
+	if err != nil {
+		return err
+	}
+
+	p.operationLogger("resume", begin).Infof("Resumed pod")
+
+	return nil
+}
+
+// updateResources hot plugs or hot unplugs vCPUs and memory into the VM of
+// a running pod, and stores the new VM resources. Zero values are left
+// untouched. The VM is resized back if the agent fails to online the new
+// resources.
+func (p *Pod) updateResources(ctx context.Context, resources Resources) error {
+	state, err := p.storage.fetchPodState(p.id)
+	if err != nil {
+		return err
+	}
+
+	if state.State != StateRunning {
+		return &StateError{PodID: p.id, Op: "update its resources", From: state.State}
+	}
+
+	previous, err := p.hypervisor.resizePod(ctx, resources)
+	if err != nil {
+		return &HypervisorError{Op: "resize the VM", Err: err}
+	}
+
+	err = p.agent.onlineCPUMem(ctx, *p)
+	if err != nil {
+		if _, rbErr := p.hypervisor.resizePod(context.Background(), previous); rbErr != nil {
+			p.logger().Warnf("Could not resize the VM back to %+v: %v", previous, rbErr)
+		}
+
+		return &AgentError{Op: "online the hot plugged vCPUs and memory", Err: err}
+	}
+
+	devices, err := p.storage.fetchPodDevices(p.id)
+	if err != nil {
+		return err
+	}
+
+	// The boot resources are never hot unplugged, the hypervisor needs
+	// to know what has been hot plugged on top of them.
+	hotplugged := &devices.HotpluggedResources
+	if resources.VCPUs > 0 {
+		hotplugged.VCPUs = hotplugged.VCPUs + resources.VCPUs - previous.VCPUs
+		p.config.VMConfig.VCPUs = resources.VCPUs
+	}
+
+	if resources.Memory > 0 {
+		hotplugged.Memory = hotplugged.Memory + resources.Memory - previous.Memory
+		p.config.VMConfig.Memory = resources.Memory
+	}
+
+	err = p.storage.transaction(func(storage resourceStorage) error {
+		err := storage.storePodResource(p.id, configFileType, *(p.config))
+		if err != nil {
+			return err
+		}
+
+		return storage.storePodDevices(p.id, devices)
+	})
+	if err != nil {
+		return err
+	}
+
+	p.logger().Infof("Updated pod resources to %+v, hot plugged %+v", p.config.VMConfig, *hotplugged)
+
+	return nil
+}
+
+// vmBootConfig returns the configuration the VM of a created pod booted
+// with, for the hypervisor to handle that VM. VMConfig holds the VM
+// resources, including the ones hot plugged since it booted.
+func vmBootConfig(storage resourceStorage, config PodConfig) (PodConfig, error) {
+	devices, err := storage.fetchPodDevices(config.ID)
+	if err != nil {
+		return PodConfig{}, err
+	}
+
+	config.VMConfig.VCPUs -= devices.HotpluggedResources.VCPUs
+	config.VMConfig.Memory -= devices.HotpluggedResources.Memory
+
+	return config, nil
+}
+
+// fetchPodStats collects the resource usage of a running or paused pod,
+// from its hypervisor and from the host side of its network endpoints. Like
+// fetchPodStatus, it never modifies the pod storage: only the hypervisor
+// handle needed to query the VM is built from the stored configuration.
+func fetchPodStats(ctx context.Context, storage resourceStorage, podID string) (PodStats, error) {
+	config, err := storage.fetchPodConfig(podID)
+	if err != nil {
+		return PodStats{}, podNotFound(podID, err)
+	}
+
+	state, err := storage.fetchPodState(podID)
+	if err != nil {
+		return PodStats{}, err
+	}
+
+	if state.State != StateRunning && state.State != StatePaused {
+		return PodStats{}, &StateError{PodID: podID, Op: "get its statistics", From: state.State}
+	}
+
+	hypervisor, err := newHypervisor(config.HypervisorType)
+	if err != nil {
+		return PodStats{}, err
+	}
+
+	err = hypervisor.init(config.HypervisorConfig)
+	if err != nil {
+		return PodStats{}, &HypervisorError{Op: "initialize", Err: err}
+	}
+
+	config, err = vmBootConfig(storage, config)
+	if err != nil {
+		return PodStats{}, err
+	}
+
+	err = hypervisor.createPod(config)
+	if err != nil {
+		return PodStats{}, &HypervisorError{Op: "create the pod", Err: err}
+	}
+
+	stats, err := hypervisor.statsPod(ctx)
+	if err != nil {
+		return PodStats{}, &HypervisorError{Op: "get the VM statistics", Err: err}
+	}
+
+	networkNS, err := storage.fetchPodNetwork(podID)
+	if err != nil {
+		return PodStats{}, err
+	}
+
+	stats.Network, err = endpointsStats(networkNS)
+	if err != nil {
+		return PodStats{}, err
+	}
+
+	stats.ID = podID
+	stats.Time = time.Now().UTC()
+
+	return stats, nil
+}
+
+// fetchContainerStats gets the resource usage of a container, out of the
+// statistics of its pod.
+func fetchContainerStats(ctx context.Context, storage resourceStorage, podID, containerID string) (ContainerStats, error) {
+	config, err := storage.fetchPodConfig(podID)
+	if err != nil {
+		return ContainerStats{}, podNotFound(podID, err)
+	}
+
+	found := false
+	for _, c := range config.Containers {
+		if c.ID == containerID {
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		return ContainerStats{}, &NotFoundError{PodID: podID, ContainerID: containerID}
+	}
+
+	podStats, err := fetchPodStats(ctx, storage, podID)
+	if err != nil {
+		return ContainerStats{}, err
+	}
+
+	devices, err := storage.fetchPodDevices(podID)
+	if err != nil {
+		return ContainerStats{}, err
+	}
+
+	return ContainerStats{
+		ID:    containerID,
+		Block: containerBlockStats(podStats, devices, containerID),
+		Pod:   podStats,
+	}, nil
+}
+
 // list lists all pod running on the host.
 func (p *Pod) list() ([]Pod, error) {
 	return nil, nil
@@ -699,6 +1320,8 @@ func (p *Pod) enter(args []string) error {
 }
 
 func (p *Pod) setPodState(state stateString) error {
+	oldState := p.state.State
+
 	p.state = State{
 		State: state,
 	}
@@ -708,6 +1331,12 @@ func (p *Pod) setPodState(state stateString) error {
 		return err
 	}
 
+	events.publish(Event{
+		Type:  podStateEvent(oldState, state),
+		PodID: p.id,
+		State: state,
+	})
+
 	return nil
 }
 
@@ -726,6 +1355,13 @@ func (p *Pod) setContainerState(contID string, state stateString) error {
 		return err
 	}
 
+	events.publish(Event{
+		Type:        ContainerStateChanged,
+		PodID:       p.id,
+		ContainerID: contID,
+		State:       state,
+	})
+
 	return nil
 }
 
@@ -17,11 +17,13 @@
 package virtcontainers
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func newHypervisorConfig(kernelParams []Param, hParams []Param) HypervisorConfig {
@@ -90,6 +92,34 @@ func TestCreateMockPod(t *testing.T) {
 	}
 }
 
+func TestCreatePodHypervisorAnnotations(t *testing.T) {
+	config := PodConfig{
+		ID:               testPodID,
+		HypervisorType:   QemuHypervisor,
+		HypervisorConfig: newHypervisorConfig(nil, nil),
+		AgentType:        NoopAgentType,
+		Annotations: map[string]string{
+			MachineTypeAnnotation: "q35",
+			AcceleratorAnnotation: "tcg",
+		},
+	}
+
+	p, err := createPod(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.storage.deletePodResources(p.id, nil)
+
+	q := p.hypervisor.(*qemu)
+	if q.qemuConfig.Machine.Type != "q35" || q.qemuConfig.Machine.Acceleration != "tcg,nvdimm" {
+		t.Fatalf("Annotations should override the machine: %+v", q.qemuConfig.Machine)
+	}
+
+	if q.qemuConfig.CPUModel != defaultTCGCPUModel {
+		t.Fatalf("Got CPU model %s, expecting %s", q.qemuConfig.CPUModel, defaultTCGCPUModel)
+	}
+}
+
 func TestCreatePodEmtpyID(t *testing.T) {
 	hConfig := newHypervisorConfig(nil, nil)
 
@@ -124,13 +154,20 @@ func TestPodStateReadyRunning(t *testing.T) {
 }
 
 func TestPodStateRunningPaused(t *testing.T) {
-	err := testPodStateTransition(t, StateRunning, StateStopped)
+	err := testPodStateTransition(t, StateRunning, StatePaused)
 	if err != nil {
 		t.Fatal(err)
 	}
 }
 
 func TestPodStatePausedRunning(t *testing.T) {
+	err := testPodStateTransition(t, StatePaused, StateRunning)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPodStateStoppedRunning(t *testing.T) {
 	err := testPodStateTransition(t, StateStopped, StateRunning)
 	if err != nil {
 		t.Fatal(err)
@@ -145,16 +182,30 @@ func TestPodStateRunningStopped(t *testing.T) {
 }
 
 func TestPodStateReadyPaused(t *testing.T) {
-	err := testPodStateTransition(t, StateReady, StateStopped)
+	err := testPodStateTransition(t, StateReady, StatePaused)
 	if err == nil {
 		t.Fatal("Invalid transition from Ready to Paused")
 	}
 }
 
 func TestPodStatePausedReady(t *testing.T) {
+	err := testPodStateTransition(t, StatePaused, StateReady)
+	if err == nil {
+		t.Fatal("Invalid transition from Paused to Ready")
+	}
+}
+
+func TestPodStatePausedStopped(t *testing.T) {
+	err := testPodStateTransition(t, StatePaused, StateStopped)
+	if err == nil {
+		t.Fatal("Invalid transition from Paused to Stopped")
+	}
+}
+
+func TestPodStateStoppedReady(t *testing.T) {
 	err := testPodStateTransition(t, StateStopped, StateReady)
 	if err == nil {
-		t.Fatal("Invalid transition from Ready to Paused")
+		t.Fatal("Invalid transition from Stopped to Ready")
 	}
 }
 
@@ -258,6 +309,7 @@ func testStateValid(t *testing.T, stateStr stateString, expected bool) {
 func TestStateValidSuccessful(t *testing.T) {
 	testStateValid(t, StateReady, true)
 	testStateValid(t, StateRunning, true)
+	testStateValid(t, StatePaused, true)
 	testStateValid(t, StateStopped, true)
 }
 
@@ -710,3 +762,273 @@ func TestPodCheckContainersStateFailingEmptyPodID(t *testing.T) {
 		t.Fatal()
 	}
 }
+
+// setupFailure is the pod setup step a test makes fail.
+type setupFailure int
+
+const (
+	noSetupFailure setupFailure = iota
+	networkInitFailure
+	networkAddFailure
+	storePodNetworkFailure
+	hypervisorStartFailure
+	agentStartFailure
+	agentStartPodFailure
+)
+
+var errTestSetupFailure = fmt.Errorf("Injected setup failure")
+
+// setupTestNetwork is a noop network failing on demand, and keeping track
+// of what has been added and removed.
+type setupTestNetwork struct {
+	noopNetwork
+	failure setupFailure
+	added   bool
+	removed bool
+}
+
+func (n *setupTestNetwork) init(config *NetworkConfig) error {
+	if n.failure == networkInitFailure {
+		return errTestSetupFailure
+	}
+
+	return nil
+}
+
+func (n *setupTestNetwork) add(ctx context.Context, pod Pod, config NetworkConfig) (NetworkNamespace, error) {
+	if n.failure == networkAddFailure {
+		return NetworkNamespace{}, errTestSetupFailure
+	}
+
+	n.added = true
+
+	return NetworkNamespace{}, nil
+}
+
+func (n *setupTestNetwork) remove(ctx context.Context, pod Pod, networkNS NetworkNamespace) error {
+	n.removed = true
+	return nil
+}
+
+// setupTestStorage is a filesystem storage failing on demand.
+type setupTestStorage struct {
+	filesystem
+	failure setupFailure
+}
+
+func (fs *setupTestStorage) storePodNetwork(podID string, networkNS NetworkNamespace) error {
+	if fs.failure == storePodNetworkFailure {
+		return errTestSetupFailure
+	}
+
+	return fs.filesystem.storePodNetwork(podID, networkNS)
+}
+
+// setupTestHypervisor is a mock hypervisor failing on demand, and keeping
+// track of whether it is running.
+type setupTestHypervisor struct {
+	mockHypervisor
+	failure setupFailure
+	running bool
+}
+
+func (h *setupTestHypervisor) startPod(ctx context.Context, startCh, stopCh chan struct{}) error {
+	if h.failure == hypervisorStartFailure {
+		return errTestSetupFailure
+	}
+
+	h.running = true
+
+	return h.mockHypervisor.startPod(ctx, startCh, stopCh)
+}
+
+func (h *setupTestHypervisor) stopPod(ctx context.Context) error {
+	h.running = false
+	return nil
+}
+
+// setupTestAgent is a noop agent failing on demand.
+type setupTestAgent struct {
+	noopAgent
+	failure setupFailure
+}
+
+func (a *setupTestAgent) start(ctx context.Context, pod *Pod) error {
+	if a.failure == agentStartFailure {
+		return errTestSetupFailure
+	}
+
+	return nil
+}
+
+func (a *setupTestAgent) startPod(ctx context.Context, pod Pod) error {
+	if a.failure == agentStartPodFailure {
+		return errTestSetupFailure
+	}
+
+	return nil
+}
+
+func testPodSetupRollback(t *testing.T, failure setupFailure) {
+	p, err := createPod(newTestPodConfigNoop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	network := &setupTestNetwork{failure: failure}
+	hypervisor := &setupTestHypervisor{failure: failure}
+	p.network = network
+	p.hypervisor = hypervisor
+	p.agent = &setupTestAgent{failure: failure}
+	p.storage = &setupTestStorage{failure: failure}
+
+	rb := &rollback{}
+
+	// Same sequence as RunPod().
+	_, err = p.setup(context.Background(), rb)
+	if err == nil {
+		err = p.start(context.Background())
+	}
+	if err == nil {
+		t.Fatal("Pod setup should have failed")
+	}
+
+	rb.run()
+
+	for _, dir := range []string{p.configPath, p.runPath} {
+		if _, err := os.Stat(dir); os.IsNotExist(err) == false {
+			t.Fatalf("Pod directory %s should have been removed", dir)
+		}
+	}
+
+	if network.added && !network.removed {
+		t.Fatal("Network should have been removed")
+	}
+
+	if hypervisor.running {
+		t.Fatal("Hypervisor should have been stopped")
+	}
+}
+
+func TestPodSetupRollbackNetworkInit(t *testing.T) {
+	testPodSetupRollback(t, networkInitFailure)
+}
+
+func TestPodSetupRollbackNetworkAdd(t *testing.T) {
+	testPodSetupRollback(t, networkAddFailure)
+}
+
+func TestPodSetupRollbackStorePodNetwork(t *testing.T) {
+	testPodSetupRollback(t, storePodNetworkFailure)
+}
+
+func TestPodSetupRollbackHypervisorStart(t *testing.T) {
+	testPodSetupRollback(t, hypervisorStartFailure)
+}
+
+func TestPodSetupRollbackAgentStart(t *testing.T) {
+	testPodSetupRollback(t, agentStartFailure)
+}
+
+func TestPodSetupRollbackAgentStartPod(t *testing.T) {
+	testPodSetupRollback(t, agentStartPodFailure)
+}
+
+func TestLockPodSharedLocks(t *testing.T) {
+	p, err := CreatePod(newTestPodConfigNoop())
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := lockPod(context.Background(), p.id, sharedLock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlockPod(first)
+
+	second, err := tryLockPod(p.id, sharedLock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlockPod(second)
+
+	if _, err := tryLockPod(p.id, exclusiveLock); err != ErrPodLocked {
+		t.Fatalf("Got %v, expecting %v", err, ErrPodLocked)
+	}
+}
+
+func TestLockPodTimeout(t *testing.T) {
+	p, err := CreatePod(newTestPodConfigNoop())
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	lockFile, err := lockPod(context.Background(), p.id, exclusiveLock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlockPod(lockFile)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := lockPod(ctx, p.id, sharedLock); err != ErrPodLocked {
+		t.Fatalf("Got %v, expecting %v", err, ErrPodLocked)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := lockPod(ctx, p.id, sharedLock); err != context.Canceled {
+		t.Fatalf("Got %v, expecting %v", err, context.Canceled)
+	}
+}
+
+func TestLockPodWaitsForRelease(t *testing.T) {
+	p, err := CreatePod(newTestPodConfigNoop())
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	lockFile, err := lockPod(context.Background(), p.id, exclusiveLock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		unlockPod(lockFile)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	lockFile, err = lockPod(ctx, p.id, exclusiveLock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlockPod(lockFile)
+}
+
+func TestStatusPodFailingHungOperation(t *testing.T) {
+	p, err := CreatePod(newTestPodConfigNoop())
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	savedTimeout := statusLockTimeout
+	statusLockTimeout = 50 * time.Millisecond
+	defer func() {
+		statusLockTimeout = savedTimeout
+	}()
+
+	lockFile, err := lockPod(context.Background(), p.id, exclusiveLock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlockPod(lockFile)
+
+	if _, err := StatusPod(p.id); err != ErrPodLocked {
+		t.Fatalf("Got %v, expecting %v", err, ErrPodLocked)
+	}
+}
@@ -17,6 +17,7 @@
 package virtcontainers
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/mitchellh/mapstructure"
@@ -95,13 +96,15 @@ type ProxyInfo struct {
 }
 
 // proxy is the virtcontainers proxy interface.
+// Every call talking to the proxy takes a context, and returns ctx.Err()
+// if the context is done before the proxy answers.
 type proxy interface {
 	// register connects and registers the proxy to the given VM.
 	// It also returns information related to containers workloads.
-	register(pod Pod) ([]ProxyInfo, string, error)
+	register(ctx context.Context, pod Pod) ([]ProxyInfo, string, error)
 
 	// unregister unregisters and disconnects the proxy from the given VM.
-	unregister(pod Pod) error
+	unregister(ctx context.Context, pod Pod) error
 
 	// connect gets the proxy a handle to a previously registered VM.
 	// It also returns information related to containers workloads.
@@ -109,11 +112,15 @@ type proxy interface {
 	// createToken is intended to be true in case we don't want
 	// the proxy to create a new token, but instead only get a handle
 	// to be able to communicate with the agent inside the VM.
-	connect(pod Pod, createToken bool) (ProxyInfo, string, error)
+	connect(ctx context.Context, pod Pod, createToken bool) (ProxyInfo, string, error)
 
 	// disconnect disconnects from the proxy.
 	disconnect() error
 
 	// sendCmd sends a command to the agent inside the VM through the proxy.
-	sendCmd(cmd interface{}) (interface{}, error)
+	sendCmd(ctx context.Context, cmd interface{}) (interface{}, error)
+
+	// waitProcess waits for a process running inside the VM to exit and
+	// returns its exit code.
+	waitProcess(ctx context.Context, pod Pod, containerID, processID string) (int, error)
 }
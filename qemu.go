@@ -18,20 +18,26 @@ package virtcontainers
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"math"
 	"os"
+	"path/filepath"
 	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	ciaoQemu "github.com/01org/ciao/qemu"
 	"github.com/01org/ciao/ssntp/uuid"
-	"github.com/golang/glog"
 )
 
 type qmpChannel struct {
 	ctx          context.Context
+	cancel       context.CancelFunc
 	path         string
 	disconnectCh chan struct{}
 	wg           sync.WaitGroup
@@ -43,6 +49,8 @@ type qemu struct {
 	path   string
 	config HypervisorConfig
 
+	podID string
+
 	hypervisorParams []string
 	kernelParams     []string
 
@@ -54,6 +62,14 @@ type qemu struct {
 
 const defaultQemuPath = "/usr/bin/qemu-system-x86_64"
 
+// The VM settings used when HypervisorConfig leaves them empty.
+const (
+	defaultQemuMachineType = "pc-lite"
+	defaultKVMCPUModel     = "host"
+	defaultTCGCPUModel     = "qemu64"
+	defaultKVMGlobalParam  = "kvm-pit.lost_tick_policy=discard"
+)
+
 const (
 	defaultSockets uint32 = 1
 	defaultThreads uint32 = 1
@@ -73,28 +89,67 @@ const (
 	maxDevIDSize = 31
 )
 
-type qmpGlogLogger struct{}
+// The devices exposing the guest image through a disk.
+const (
+	imageDriveID     = "image"
+	scsiControllerID = "scsi0"
+
+	qemuVirtioSCSI ciaoQemu.DeviceDriver      = "virtio-scsi-pci"
+	qemuSCSIDisk   ciaoQemu.DeviceDriver      = "scsi-hd"
+	qemuRawFormat  ciaoQemu.BlockDeviceFormat = "raw"
+)
+
+// qmpLogger routes the QMP library logs through our Logger. Its verbose
+// logs are debug entries, only built when the Logger writes them.
+type qmpLogger struct {
+	logger Logger
+}
+
+func newQMPLogger(podID string) qmpLogger {
+	return qmpLogger{logger: podLogger("qmp", podID)}
+}
+
+func (l qmpLogger) V(level int32) bool {
+	return debugEnabled(l.logger)
+}
+
+func (l qmpLogger) Infof(format string, v ...interface{}) {
+	l.logger.Debugf(format, v...)
+}
 
-func (l qmpGlogLogger) V(level int32) bool {
-	return bool(glog.V(glog.Level(level)))
+func (l qmpLogger) Warningf(format string, v ...interface{}) {
+	l.logger.Warnf(format, v...)
 }
 
-func (l qmpGlogLogger) Infof(format string, v ...interface{}) {
-	glog.InfoDepth(2, fmt.Sprintf(format, v...))
+func (l qmpLogger) Errorf(format string, v ...interface{}) {
+	l.logger.Errorf(format, v...)
 }
 
-func (l qmpGlogLogger) Warningf(format string, v ...interface{}) {
-	glog.WarningDepth(2, fmt.Sprintf(format, v...))
+func (q *qemu) logger() Logger {
+	return podLogger("qemu", q.podID)
 }
 
-func (l qmpGlogLogger) Errorf(format string, v ...interface{}) {
-	glog.ErrorDepth(2, fmt.Sprintf(format, v...))
+// kernelRootParams are the kernel parameters mounting the guest image as
+// the root filesystem, for each image transport.
+var kernelRootParams = map[ImageTransport][]Param{
+	NVDIMMImage: {
+		{"root", "/dev/pmem0p1"},
+		{"rootflags", "dax,data=ordered,errors=remount-ro rw"},
+		{"rootfstype", "ext4"},
+	},
+	VirtioBlockImage: {
+		{"root", "/dev/vda1"},
+		{"rootflags", "data=ordered,errors=remount-ro rw"},
+		{"rootfstype", "ext4"},
+	},
+	VirtioSCSIImage: {
+		{"root", "/dev/sda1"},
+		{"rootflags", "data=ordered,errors=remount-ro rw"},
+		{"rootfstype", "ext4"},
+	},
 }
 
 var kernelDefaultParams = []Param{
-	{"root", "/dev/pmem0p1"},
-	{"rootflags", "dax,data=ordered,errors=remount-ro rw"},
-	{"rootfstype", "ext4"},
 	{"tsc", "reliable"},
 	{"no_timer_check", ""},
 	{"rcupdate.rcu_expedited", "1"},
@@ -132,8 +187,21 @@ var kernelDefaultParamsDebug = []Param{
 	{"systemd.log_level", "debug"},
 }
 
+// imageTransport returns the transport config exposes the guest image
+// through.
+func imageTransport(config HypervisorConfig) ImageTransport {
+	if config.ImageTransport == "" {
+		return NVDIMMImage
+	}
+
+	return config.ImageTransport
+}
+
 func (q *qemu) buildKernelParams(config HypervisorConfig) error {
-	params := kernelDefaultParams
+	var params []Param
+
+	params = append(params, kernelRootParams[imageTransport(config)]...)
+	params = append(params, kernelDefaultParams...)
 
 	if config.Debug == true {
 		params = append(params, kernelDefaultParamsDebug...)
@@ -211,7 +279,8 @@ func (q *qemu) appendNetworks(devices []ciaoQemu.Device, endpoints []Endpoint) [
 func (q *qemu) appendFSDevices(devices []ciaoQemu.Device, podConfig PodConfig) []ciaoQemu.Device {
 	// Add the containers rootfs
 	for idx, c := range podConfig.Containers {
-		if c.RootFs == "" || c.ID == "" {
+		// Block device and image rootfs are passed through as drives.
+		if c.RootFs == "" || c.ID == "" || isBlockRootfs(c.RootFs) {
 			continue
 		}
 
@@ -235,6 +304,19 @@ func (q *qemu) appendFSDevices(devices []ciaoQemu.Device, podConfig PodConfig) [
 	return devices
 }
 
+func (q *qemu) appendRootfsDrive(devices []ciaoQemu.Device, drive rootfsDrive) []ciaoQemu.Device {
+	return append(devices,
+		ciaoQemu.BlockDevice{
+			Driver:    ciaoQemu.VirtioBlock,
+			ID:        drive.driveID(),
+			File:      drive.HostPath,
+			Interface: ciaoQemu.NoInterface,
+			AIO:       ciaoQemu.Threads,
+			Format:    qemuRawFormat,
+		},
+	)
+}
+
 func (q *qemu) appendConsoles(devices []ciaoQemu.Device, podConfig PodConfig) []ciaoQemu.Device {
 	serial := ciaoQemu.SerialDevice{
 		Driver: ciaoQemu.VirtioSerial,
@@ -243,19 +325,15 @@ func (q *qemu) appendConsoles(devices []ciaoQemu.Device, podConfig PodConfig) []
 
 	devices = append(devices, serial)
 
-	var console ciaoQemu.CharDevice
-
+	// The consoles exposed through a socket are logged.
 	offset := 0
 	if podConfig.Console != "" {
-		console = ciaoQemu.CharDevice{
-			Driver:   ciaoQemu.Console,
-			Backend:  ciaoQemu.Socket,
+		devices = append(devices, qemuConsoleDevice{
 			DeviceID: "console0",
 			ID:       "charconsole0",
 			Path:     podConfig.Console,
-		}
-
-		devices = append(devices, console)
+			LogFile:  consoleLogPath(podConfig.ID, consoleLogName(0, "")),
+		})
 
 		offset++
 	}
@@ -263,26 +341,24 @@ func (q *qemu) appendConsoles(devices []ciaoQemu.Device, podConfig PodConfig) []
 	for i, c := range podConfig.Containers {
 		// Need to add an offset because of the console created for the pod.
 		idx := i + offset
+		deviceID := fmt.Sprintf("console%d", idx)
 
 		if c.Interactive == false || c.Console == "" {
-			console = ciaoQemu.CharDevice{
-				Driver:   ciaoQemu.Console,
-				Backend:  ciaoQemu.Socket,
-				DeviceID: fmt.Sprintf("console%d", idx),
+			devices = append(devices, qemuConsoleDevice{
+				DeviceID: deviceID,
 				ID:       fmt.Sprintf("charconsole%d", idx),
-				Path:     fmt.Sprintf("%s/%s/%s/%s", runStoragePath, podConfig.ID, c.ID, defaultConsole),
-			}
+				Path:     containerConsolePath(podConfig.ID, c.ID),
+				LogFile:  consoleLogPath(podConfig.ID, consoleLogName(idx, c.ID)),
+			})
 		} else {
-			console = ciaoQemu.CharDevice{
+			devices = append(devices, ciaoQemu.CharDevice{
 				Driver:   ciaoQemu.Console,
 				Backend:  ciaoQemu.Serial,
-				DeviceID: fmt.Sprintf("console%d", idx),
+				DeviceID: deviceID,
 				ID:       fmt.Sprintf("charconsole%d", idx),
 				Path:     c.Console,
-			}
+			})
 		}
-
-		devices = append(devices, console)
 	}
 
 	return devices
@@ -300,16 +376,45 @@ func (q *qemu) appendImage(devices []ciaoQemu.Device, podConfig PodConfig) ([]ci
 		return nil, err
 	}
 
-	object := ciaoQemu.Object{
-		Driver:   ciaoQemu.NVDIMM,
-		Type:     ciaoQemu.MemoryBackendFile,
-		DeviceID: "nv0",
-		ID:       "mem0",
-		MemPath:  q.config.ImagePath,
-		Size:     (uint64)(imageStat.Size()),
-	}
+	switch imageTransport(q.config) {
+	case VirtioBlockImage:
+		devices = append(devices, ciaoQemu.BlockDevice{
+			Driver:    ciaoQemu.VirtioBlock,
+			ID:        imageDriveID,
+			File:      q.config.ImagePath,
+			Interface: ciaoQemu.NoInterface,
+			AIO:       ciaoQemu.Threads,
+			Format:    qemuRawFormat,
+		})
+
+	case VirtioSCSIImage:
+		devices = append(devices,
+			qemuSCSIController{
+				ID: scsiControllerID,
+			},
+			ciaoQemu.BlockDevice{
+				Driver:    qemuSCSIDisk,
+				ID:        imageDriveID,
+				File:      q.config.ImagePath,
+				Interface: ciaoQemu.NoInterface,
+				AIO:       ciaoQemu.Threads,
+				Format:    qemuRawFormat,
+				// Keep virtio-blk only properties out of the device.
+				SCSI: true,
+				WCE:  true,
+			},
+		)
 
-	devices = append(devices, object)
+	default:
+		devices = append(devices, ciaoQemu.Object{
+			Driver:   ciaoQemu.NVDIMM,
+			Type:     ciaoQemu.MemoryBackendFile,
+			DeviceID: "nv0",
+			ID:       "mem0",
+			MemPath:  q.config.ImagePath,
+			Size:     (uint64)(imageStat.Size()),
+		})
+	}
 
 	return devices, nil
 }
@@ -333,6 +438,15 @@ func (q *qemu) forceUUIDFormat(str string) string {
 	return uuidSlice.String()
 }
 
+// qemuPath returns the QEMU binary config points to.
+func qemuPath(config HypervisorConfig) string {
+	if config.HypervisorPath == "" {
+		return defaultQemuPath
+	}
+
+	return config.HypervisorPath
+}
+
 // init intializes the Qemu structure.
 func (q *qemu) init(config HypervisorConfig) error {
 	valid, err := config.valid()
@@ -340,13 +454,8 @@ func (q *qemu) init(config HypervisorConfig) error {
 		return err
 	}
 
-	p := config.HypervisorPath
-	if p == "" {
-		p = defaultQemuPath
-	}
-
 	q.config = config
-	q.path = p
+	q.path = qemuPath(config)
 
 	err = q.buildKernelParams(config)
 	if err != nil {
@@ -357,33 +466,80 @@ func (q *qemu) init(config HypervisorConfig) error {
 }
 
 func (q *qemu) qmpMonitor(connectedCh chan struct{}) {
-	defer func(qemu *qemu) {
-		if q.qmpMonitorCh.qmp != nil {
-			q.qmpMonitorCh.qmp.Shutdown()
-		}
-
-		q.qmpMonitorCh.wg.Done()
-	}(q)
+	eventCh := make(chan ciaoQemu.QMPEvent)
+	cfg := ciaoQemu.QMPConfig{
+		EventCh: eventCh,
+		Logger:  newQMPLogger(q.podID),
+	}
 
-	cfg := ciaoQemu.QMPConfig{Logger: qmpGlogLogger{}}
 	qmp, ver, err := ciaoQemu.QMPStart(q.qmpMonitorCh.ctx, q.qmpMonitorCh.path, cfg, q.qmpMonitorCh.disconnectCh)
 	if err != nil {
-		glog.Errorf("Failed to connect to QEMU instance %v", err)
+		q.logger().Errorf("Failed to connect to QEMU instance: %s", err)
+		q.qmpMonitorCh.wg.Done()
 		return
 	}
 
 	q.qmpMonitorCh.qmp = qmp
 
-	glog.Infof("QMP version %d.%d.%d", ver.Major, ver.Minor, ver.Micro)
-	glog.Infof("QMP capabilities %s", ver.Capabilities)
+	q.logger().Infof("QMP version %d.%d.%d, capabilities %s", ver.Major, ver.Minor, ver.Micro, ver.Capabilities)
 
 	err = q.qmpMonitorCh.qmp.ExecuteQMPCapabilities(q.qmpMonitorCh.ctx)
 	if err != nil {
-		glog.Errorf("Unable to send qmp_capabilities command: %v", err)
+		q.logger().Errorf("Unable to send qmp_capabilities command: %s", err)
+		q.qmpMonitorCh.qmp.Shutdown()
+		q.qmpMonitorCh.wg.Done()
 		return
 	}
 
 	close(connectedCh)
+
+	go q.watchVM(eventCh)
+}
+
+// qmpVMEvents are the QMP events changing the pod state.
+var qmpVMEvents = map[string]vmEvent{
+	"SHUTDOWN":       vmShutdown,
+	"GUEST_PANICKED": vmPanicked,
+	"RESET":          vmReset,
+	"STOP":           vmStopped,
+}
+
+// watchVM follows the VM events until the QMP monitor connection goes away,
+// and reports them to the pod VM monitor. QEMU always sends a SHUTDOWN event
+// before exiting on purpose, losing the connection without receiving it
+// first means that QEMU died.
+func (q *qemu) watchVM(eventCh chan ciaoQemu.QMPEvent) {
+	monitor := newVMMonitor(q.podID)
+
+	defer func() {
+		monitor.close()
+		q.qmpMonitorCh.qmp.Shutdown()
+		q.qmpMonitorCh.wg.Done()
+	}()
+
+	shutdown := false
+
+	for {
+		select {
+		case event := <-eventCh:
+			q.logger().Infof("QMP event %s received", event.Name)
+
+			if event.Name == "SHUTDOWN" {
+				shutdown = true
+			}
+
+			if e, ok := qmpVMEvents[event.Name]; ok {
+				monitor.report(e)
+			}
+		case <-q.qmpMonitorCh.disconnectCh:
+			if !shutdown {
+				q.logger().Errorf("QEMU instance exited unexpectedly")
+				monitor.report(vmExited)
+			}
+
+			return
+		}
+	}
 }
 
 func (q *qemu) setCPUResources(podConfig PodConfig) ciaoQemu.SMP {
@@ -392,11 +548,18 @@ func (q *qemu) setCPUResources(podConfig PodConfig) ciaoQemu.SMP {
 		vcpus = podConfig.VMConfig.VCPUs
 	}
 
+	// Leave room for hot plugging vCPUs, up to the number of host CPUs.
+	maxVCPUs := uint(runtime.NumCPU())
+	if vcpus > maxVCPUs {
+		maxVCPUs = vcpus
+	}
+
 	smp := ciaoQemu.SMP{
 		CPUs:    uint32(vcpus),
-		Cores:   uint32(vcpus),
+		Cores:   uint32(maxVCPUs),
 		Sockets: defaultSockets,
 		Threads: defaultThreads,
+		MaxCPUs: uint32(maxVCPUs),
 	}
 
 	return smp
@@ -420,14 +583,83 @@ func (q *qemu) setMemoryResources(podConfig PodConfig) ciaoQemu.Memory {
 	return memory
 }
 
+func qemuMachineType(config HypervisorConfig) string {
+	if config.MachineType == "" {
+		return defaultQemuMachineType
+	}
+
+	return config.MachineType
+}
+
+func qemuAccelerator(config HypervisorConfig) Accelerator {
+	if config.Accelerator == "" {
+		return KVMAccelerator
+	}
+
+	return config.Accelerator
+}
+
+// qemuMachine returns the machine config asks for. The in-kernel irqchip
+// needs KVM, and the NVDIMM devices need to be enabled on the machine.
+func qemuMachine(config HypervisorConfig) ciaoQemu.Machine {
+	acceleration := string(qemuAccelerator(config))
+	if qemuAccelerator(config) == KVMAccelerator {
+		acceleration += ",kernel_irqchip"
+	}
+
+	if imageTransport(config) == NVDIMMImage {
+		acceleration += ",nvdimm"
+	}
+
+	return ciaoQemu.Machine{
+		Type:         qemuMachineType(config),
+		Acceleration: acceleration,
+	}
+}
+
+func qemuCPUModel(config HypervisorConfig) string {
+	switch {
+	case config.CPUModel != "":
+		return config.CPUModel
+	case qemuAccelerator(config) == TCGAccelerator:
+		return defaultTCGCPUModel
+	default:
+		return defaultKVMCPUModel
+	}
+}
+
+// qemuGlobalParam returns the global device property config asks for. The
+// KVM PIT one does not apply to TCG VMs.
+func qemuGlobalParam(config HypervisorConfig) string {
+	if config.GlobalParam == "" && qemuAccelerator(config) == KVMAccelerator {
+		return defaultKVMGlobalParam
+	}
+
+	return config.GlobalParam
+}
+
+func qemuRTC(config HypervisorConfig) ciaoQemu.RTC {
+	rtc := ciaoQemu.RTC{
+		Base:     "utc",
+		DriftFix: "slew",
+	}
+
+	if config.RTCBase == "localtime" {
+		rtc.Base = "localtime"
+	}
+
+	if config.RTCDriftFix == "none" {
+		rtc.DriftFix = "none"
+	}
+
+	return rtc
+}
+
 // createPod is the Hypervisor pod creation implementation for ciaoQemu.
 func (q *qemu) createPod(podConfig PodConfig) error {
 	var devices []ciaoQemu.Device
 
-	machine := ciaoQemu.Machine{
-		Type:         "pc-lite",
-		Acceleration: "kvm,kernel_irqchip,nvdimm",
-	}
+	machine := qemuMachine(q.config)
 
 	smp := q.setCPUResources(podConfig)
 
@@ -445,10 +677,9 @@ func (q *qemu) createPod(podConfig PodConfig) error {
 		Params: strings.Join(q.kernelParams, " "),
 	}
 
-	rtc := ciaoQemu.RTC{
-		Base:     "utc",
-		DriftFix: "slew",
-	}
+	rtc := qemuRTC(q.config)
+
+	q.podID = podConfig.ID
 
 	q.qmpMonitorCh = qmpChannel{
 		ctx:  context.Background(),
@@ -491,13 +722,13 @@ func (q *qemu) createPod(podConfig PodConfig) error {
 		SMP:         smp,
 		Memory:      memory,
 		Devices:     devices,
-		CPUModel:    "host",
+		CPUModel:    qemuCPUModel(q.config),
 		Kernel:      kernel,
 		RTC:         rtc,
 		QMPSockets:  qmpSockets,
 		Knobs:       knobs,
 		VGA:         "none",
-		GlobalParam: "kvm-pit.lost_tick_policy=discard",
+		GlobalParam: qemuGlobalParam(q.config),
 	}
 
 	q.qemuConfig = qemuConfig
@@ -505,39 +736,951 @@ func (q *qemu) createPod(podConfig PodConfig) error {
 	return nil
 }
 
-// startPod will start the Pod's VM.
-func (q *qemu) startPod(startCh, stopCh chan struct{}) error {
-	strErr, err := ciaoQemu.LaunchQemu(q.qemuConfig, qmpGlogLogger{})
+// startPod will start the Pod's VM. ctx only bounds the launch, QEMU
+// daemonizes and outlives it.
+func (q *qemu) startPod(ctx context.Context, startCh, stopCh chan struct{}) error {
+	q.qemuConfig.Ctx = ctx
+
+	span, _ := startSpan(ctx, "qemu.launch")
+	span.SetTag(podIDTag, q.podID)
+
+	strErr, err := ciaoQemu.LaunchQemu(q.qemuConfig, newQMPLogger(q.podID))
 	if err != nil {
-		return fmt.Errorf("%s", strErr)
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		} else {
+			err = fmt.Errorf("%s", strErr)
+		}
+
+		finishSpan(span, err)
+		return err
 	}
 
-	// Start the QMP monitoring thread
+	finishSpan(span, nil)
+
+	q.monitorVM(ctx, startCh, stopCh)
+
+	return nil
+}
+
+// monitorVM starts the QMP monitoring thread of a running VM. The monitor
+// outlives the call starting the VM, it gets its own context, cancelled by
+// stopPod.
+func (q *qemu) monitorVM(ctx context.Context, startCh, stopCh chan struct{}) {
+	q.qmpMonitorCh.ctx, q.qmpMonitorCh.cancel = context.WithCancel(context.Background())
 	q.qmpMonitorCh.disconnectCh = stopCh
 	q.qmpMonitorCh.wg.Add(1)
+
+	span, _ := startSpan(ctx, "qmp.connect")
+	span.SetTag(podIDTag, q.podID)
 	q.qmpMonitor(startCh)
+	span.Finish()
+}
+
+// stopPod will stop the Pod's VM, and its QMP monitor if it runs in this
+// process.
+func (q *qemu) stopPod(ctx context.Context) error {
+	if q.qmpMonitorCh.cancel != nil {
+		defer q.qmpMonitorCh.cancel()
+	}
+
+	qmp, err := qmpConnect(ctx, q.podID, q.qmpControlCh.path)
+	if err != nil {
+		return err
+	}
+	defer qmp.close()
+
+	return qmp.execute(ctx, "quit", nil, nil)
+}
+
+// pausePod will pause the Pod's VM, keeping its memory state.
+func (q *qemu) pausePod(ctx context.Context) error {
+	qmp, err := qmpConnect(ctx, q.podID, q.qmpControlCh.path)
+	if err != nil {
+		return err
+	}
+	defer qmp.close()
+
+	return qmp.execute(ctx, "stop", nil, nil)
+}
+
+// resumePod will resume a paused Pod's VM.
+func (q *qemu) resumePod(ctx context.Context) error {
+	qmp, err := qmpConnect(ctx, q.podID, q.qmpControlCh.path)
+	if err != nil {
+		return err
+	}
+	defer qmp.close()
+
+	return qmp.execute(ctx, "cont", nil, nil)
+}
+
+type qmpCPUInfo struct {
+	CPU      int `json:"CPU"`
+	ThreadID int `json:"thread_id"`
+}
+
+type qmpBalloonInfo struct {
+	Actual uint64 `json:"actual"`
+}
+
+type qmpBlockStats struct {
+	Device string `json:"device"`
+	Stats  struct {
+		ReadBytes  uint64 `json:"rd_bytes"`
+		WriteBytes uint64 `json:"wr_bytes"`
+		ReadOps    uint64 `json:"rd_operations"`
+		WriteOps   uint64 `json:"wr_operations"`
+	} `json:"stats"`
+}
+
+// memorySize converts a qemu memory size string, e.g. "2G" or "512M",
+// into a number of bytes.
+func memorySize(size string) (uint64, error) {
+	shifts := map[string]uint{
+		"K": 10,
+		"M": 20,
+		"G": 30,
+		"T": 40,
+	}
+
+	shift := uint(20)
+	if len(size) > 0 {
+		if s, ok := shifts[strings.ToUpper(size[len(size)-1:])]; ok {
+			shift = s
+			size = size[:len(size)-1]
+		}
+	}
+
+	value, err := strconv.ParseUint(size, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid memory size %q: %s", size, err)
+	}
+
+	return value << shift, nil
+}
+
+// statsPod collects the Pod's VM vCPUs, memory and block devices usage.
+func (q *qemu) statsPod(ctx context.Context) (PodStats, error) {
+	var stats PodStats
+
+	qmp, err := qmpConnect(ctx, q.podID, q.qmpControlCh.path)
+	if err != nil {
+		return stats, err
+	}
+	defer qmp.close()
+
+	var cpus []qmpCPUInfo
+	if err := qmp.execute(ctx, "query-cpus", nil, &cpus); err != nil {
+		return stats, err
+	}
+
+	qemuPid := -1
+	for _, cpu := range cpus {
+		cpuTime, err := threadCPUTime(cpu.ThreadID)
+		if err != nil {
+			return stats, err
+		}
+
+		stats.VCPUs = append(stats.VCPUs, VCPUStats{
+			CPU:      cpu.CPU,
+			ThreadID: cpu.ThreadID,
+			Time:     cpuTime,
+		})
+
+		if qemuPid < 0 {
+			qemuPid, err = threadProcess(cpu.ThreadID)
+			if err != nil {
+				return stats, err
+			}
+		}
+	}
+
+	if qemuPid >= 0 {
+		stats.Memory.Used, err = processRSS(qemuPid)
+		if err != nil {
+			return stats, err
+		}
+	}
+
+	// query-balloon fails when the VM has no balloon device, meaning
+	// nothing has been ballooned.
+	var balloon qmpBalloonInfo
+	if err := qmp.execute(ctx, "query-balloon", nil, &balloon); err == nil {
+		memSize, err := memorySize(q.qemuConfig.Memory.Size)
+		if err != nil {
+			return stats, err
+		}
+
+		dimms, _, err := hotpluggedDIMMs(ctx, qmp)
+		if err != nil {
+			return stats, err
+		}
+
+		for _, dimm := range dimms {
+			memSize += dimm.Data.Size
+		}
+
+		if memSize > balloon.Actual {
+			stats.Memory.Ballooned = memSize - balloon.Actual
+		}
+	}
+
+	var blockStats []qmpBlockStats
+	if err := qmp.execute(ctx, "query-blockstats", nil, &blockStats); err != nil {
+		return stats, err
+	}
+
+	for _, b := range blockStats {
+		stats.Block = append(stats.Block, BlockStats{
+			Device:     b.Device,
+			ReadBytes:  b.Stats.ReadBytes,
+			WriteBytes: b.Stats.WriteBytes,
+			ReadOps:    b.Stats.ReadOps,
+			WriteOps:   b.Stats.WriteOps,
+		})
+	}
+
+	return stats, nil
+}
+
+type qmpHotpluggableCPU struct {
+	Type    string                 `json:"type"`
+	Props   map[string]interface{} `json:"props"`
+	QOMPath string                 `json:"qom-path"`
+}
+
+type qmpMemoryDevice struct {
+	Type string `json:"type"`
+	Data struct {
+		ID     string `json:"id"`
+		Addr   uint64 `json:"addr"`
+		Size   uint64 `json:"size"`
+		Memdev string `json:"memdev"`
+	} `json:"data"`
+}
+
+const (
+	// hotplugCPUPrefix and hotplugMemPrefix prefix the IDs of the vCPUs
+	// and DIMMs we hot plug.
+	hotplugCPUPrefix = "cpu-"
+	hotplugMemPrefix = "dimm-"
+
+	// peripheralQOMPath is the QOM path of the devices created with an ID,
+	// i.e. the hot plugged ones.
+	peripheralQOMPath = "/machine/peripheral/"
+
+	// memoryBlockSize is the granularity the Linux guest onlines memory at.
+	memoryBlockSize = 128 << 20
+)
+
+// resizePod hot plugs or hot unplugs vCPUs and memory DIMMs so that the
+// Pod's VM gets the resources it is asked for. Zero values are left
+// untouched. Nothing is changed if any of the resizing steps fails.
+// The resources the VM had before are returned, for the resizing to be
+// undone.
+func (q *qemu) resizePod(ctx context.Context, resources Resources) (Resources, error) {
+	var previous Resources
+
+	qmp, err := qmpConnect(ctx, q.podID, q.qmpControlCh.path)
+	if err != nil {
+		return previous, err
+	}
+	defer qmp.close()
+
+	rb := &rollback{}
+	defer rb.run()
+
+	if resources.VCPUs > 0 {
+		previous.VCPUs, err = q.resizeVCPUs(ctx, qmp, resources.VCPUs, rb)
+		if err != nil {
+			return Resources{}, err
+		}
+	}
+
+	if resources.Memory > 0 {
+		previous.Memory, err = q.resizeMemory(ctx, qmp, resources.Memory, rb)
+		if err != nil {
+			return Resources{}, err
+		}
+	}
+
+	rb.commit()
+
+	return previous, nil
+}
+
+func (q *qemu) hotplugCPU(ctx context.Context, qmp *qmpClient, cpu qmpHotpluggableCPU) (string, error) {
+	var topology []string
+	for _, key := range []string{"node-id", "socket-id", "core-id", "thread-id"} {
+		if value, ok := cpu.Props[key]; ok {
+			topology = append(topology, fmt.Sprintf("%v", value))
+		}
+	}
+	id := hotplugCPUPrefix + strings.Join(topology, "-")
+
+	args := map[string]interface{}{
+		"driver": cpu.Type,
+		"id":     id,
+	}
+
+	for key, value := range cpu.Props {
+		args[key] = value
+	}
+
+	return id, qmp.execute(ctx, "device_add", args, nil)
+}
+
+// resizeVCPUs returns the number of vCPUs the VM had before resizing.
+func (q *qemu) resizeVCPUs(ctx context.Context, qmp *qmpClient, vcpus uint, rb *rollback) (uint, error) {
+	var cpus []qmpHotpluggableCPU
+	if err := qmp.execute(ctx, "query-hotpluggable-cpus", nil, &cpus); err != nil {
+		return 0, err
+	}
+
+	var plugged, free, removable []qmpHotpluggableCPU
+	for _, cpu := range cpus {
+		switch {
+		case cpu.QOMPath == "":
+			free = append(free, cpu)
+		case strings.HasPrefix(cpu.QOMPath, peripheralQOMPath):
+			removable = append(removable, cpu)
+			fallthrough
+		default:
+			plugged = append(plugged, cpu)
+		}
+	}
+
+	if int(vcpus) > len(plugged) {
+		needed := int(vcpus) - len(plugged)
+		if needed > len(free) {
+			return 0, fmt.Errorf("Cannot hot plug %d vCPUs, only %d available", needed, len(free))
+		}
+
+		for _, cpu := range free[:needed] {
+			id, err := q.hotplugCPU(ctx, qmp, cpu)
+			if err != nil {
+				return 0, err
+			}
+
+			rb.add("vCPU "+id, func() error {
+				return qmp.execute(context.Background(), "device_del", map[string]interface{}{"id": id}, nil)
+			})
+		}
+	} else if int(vcpus) < len(plugged) {
+		needed := len(plugged) - int(vcpus)
+		if needed > len(removable) {
+			return 0, fmt.Errorf("Cannot hot unplug %d vCPUs, only %d were hot plugged", needed, len(removable))
+		}
+
+		for i := len(removable) - 1; i >= len(removable)-needed; i-- {
+			cpu := removable[i]
+			id := strings.TrimPrefix(cpu.QOMPath, peripheralQOMPath)
+
+			if err := qmp.execute(ctx, "device_del", map[string]interface{}{"id": id}, nil); err != nil {
+				return 0, err
+			}
+
+			rb.add("vCPU "+id+" removal", func() error {
+				_, err := q.hotplugCPU(context.Background(), qmp, cpu)
+				return err
+			})
+		}
+	}
+
+	return uint(len(plugged)), nil
+}
+
+// dimmBackend returns the ID of the memory backend of a hot plugged DIMM.
+func dimmBackend(id string) string {
+	return "mem-" + strings.TrimPrefix(id, hotplugMemPrefix)
+}
+
+func (q *qemu) hotplugDIMM(ctx context.Context, qmp *qmpClient, id string, size uint64) error {
+	memdev := dimmBackend(id)
+
+	err := qmp.execute(ctx, "object-add", map[string]interface{}{
+		"qom-type": "memory-backend-ram",
+		"id":       memdev,
+		"props": map[string]interface{}{
+			"size": size,
+		},
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	err = qmp.execute(ctx, "device_add", map[string]interface{}{
+		"driver": "pc-dimm",
+		"id":     id,
+		"memdev": memdev,
+	}, nil)
+	if err != nil {
+		qmp.execute(context.Background(), "object-del", map[string]interface{}{"id": memdev}, nil)
+		return err
+	}
 
 	return nil
 }
 
-// stopPod will stop the Pod's VM.
-func (q *qemu) stopPod() error {
-	cfg := ciaoQemu.QMPConfig{Logger: qmpGlogLogger{}}
-	q.qmpControlCh.disconnectCh = make(chan struct{})
+// deleteDevice hot unplugs a device, and waits for the guest to release it.
+func deleteDevice(ctx context.Context, qmp *qmpClient, id string) error {
+	if err := qmp.execute(ctx, "device_del", map[string]interface{}{"id": id}, nil); err != nil {
+		return err
+	}
+
+	return qmp.waitEvent(ctx, "DEVICE_DELETED", func(data map[string]interface{}) bool {
+		return data["device"] == id
+	})
+}
+
+// hotunplugDIMM removes a DIMM and its memory backend. The backend can only
+// go away once the guest released the DIMM.
+func (q *qemu) hotunplugDIMM(ctx context.Context, qmp *qmpClient, id, memdev string) error {
+	if err := deleteDevice(ctx, qmp, id); err != nil {
+		return err
+	}
+
+	return qmp.execute(ctx, "object-del", map[string]interface{}{"id": filepath.Base(memdev)}, nil)
+}
+
+// hotpluggedDIMMs returns the DIMMs hot plugged into the VM, and the IDs of
+// all its memory devices.
+func hotpluggedDIMMs(ctx context.Context, qmp *qmpClient) ([]qmpMemoryDevice, map[string]bool, error) {
+	var devices []qmpMemoryDevice
+	if err := qmp.execute(ctx, "query-memory-devices", nil, &devices); err != nil {
+		return nil, nil, err
+	}
+
+	var dimms []qmpMemoryDevice
+	ids := make(map[string]bool)
+	for _, dev := range devices {
+		ids[dev.Data.ID] = true
+		if dev.Type == "dimm" && strings.HasPrefix(dev.Data.ID, hotplugMemPrefix) {
+			dimms = append(dimms, dev)
+		}
+	}
+
+	return dimms, ids, nil
+}
+
+// resizeMemory returns the amount of memory the VM had before resizing, in
+// MiB. That is its boot memory plus the memory of the hot plugged DIMMs.
+func (q *qemu) resizeMemory(ctx context.Context, qmp *qmpClient, memory uint, rb *rollback) (uint, error) {
+	current, err := memorySize(q.qemuConfig.Memory.Size)
+	if err != nil {
+		return 0, err
+	}
 
-	qmp, _, err := ciaoQemu.QMPStart(q.qmpControlCh.ctx, q.qmpControlCh.path, cfg, q.qmpControlCh.disconnectCh)
+	dimms, ids, err := hotpluggedDIMMs(ctx, qmp)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, dimm := range dimms {
+		current += dimm.Data.Size
+	}
+
+	previous := uint(current >> 20)
+
+	target := uint64(memory) << 20
+	if target == current {
+		return previous, nil
+	}
+
+	if target > current {
+		size := target - current
+		if size%memoryBlockSize != 0 {
+			return 0, fmt.Errorf("Memory can only be hot plugged by multiples of %d MiB", memoryBlockSize>>20)
+		}
+
+		var id string
+		for i := 0; ; i++ {
+			id = fmt.Sprintf("%s%d", hotplugMemPrefix, i)
+			if !ids[id] {
+				break
+			}
+		}
+
+		if err := q.hotplugDIMM(ctx, qmp, id, size); err != nil {
+			return 0, err
+		}
+
+		rb.add("DIMM "+id, func() error {
+			return q.hotunplugDIMM(context.Background(), qmp, id, dimmBackend(id))
+		})
+
+		return previous, nil
+	}
+
+	// Only whole hot plugged DIMMs can be removed, the most recent first.
+	size := current - target
+	var removed []qmpMemoryDevice
+	for i := len(dimms) - 1; i >= 0 && size > 0; i-- {
+		if dimms[i].Data.Size > size {
+			break
+		}
+
+		size -= dimms[i].Data.Size
+		removed = append(removed, dimms[i])
+	}
+
+	if size != 0 {
+		return 0, fmt.Errorf("Cannot hot unplug %d MiB of memory, it does not match the hot plugged DIMMs", (current-target)>>20)
+	}
+
+	for _, dimm := range removed {
+		id := dimm.Data.ID
+		dimmSize := dimm.Data.Size
+
+		if err := q.hotunplugDIMM(ctx, qmp, id, dimm.Data.Memdev); err != nil {
+			return 0, err
+		}
+
+		rb.add("DIMM "+id+" removal", func() error {
+			return q.hotplugDIMM(context.Background(), qmp, id, dimmSize)
+		})
+	}
+
+	return previous, nil
+}
+
+// checkpointFdName is the name the checkpoint file descriptor is given to
+// QEMU with the getfd command.
+const checkpointFdName = "checkpoint"
+
+// qmpPollInterval is how often QEMU is polled when waiting for it, e.g. for
+// a migration to complete.
+var qmpPollInterval = 100 * time.Millisecond
+
+type qmpMigrationInfo struct {
+	Status    string `json:"status"`
+	ErrorDesc string `json:"error-desc"`
+}
+
+type qmpStatusInfo struct {
+	Status string `json:"status"`
+}
+
+// pollQMP runs a QMP query every qmpPollInterval, until done returns
+// true or an error.
+func pollQMP(ctx context.Context, qmp *qmpClient, command string, result interface{}, done func() (bool, error)) error {
+	for {
+		if err := qmp.execute(ctx, command, nil, result); err != nil {
+			return err
+		}
+
+		finished, err := done()
+		if finished || err != nil {
+			return err
+		}
+
+		select {
+		case <-time.After(qmpPollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+type qmpPCIDevice struct {
+	Slot     int    `json:"slot"`
+	Function int    `json:"function"`
+	QdevID   string `json:"qdev_id"`
+}
+
+type qmpPCIBus struct {
+	Devices []qmpPCIDevice `json:"devices"`
+}
+
+// qemuSavedDevices describes what was hot plugged into a saved VM. QEMU can
+// only load the VM state into a VM with the same devices at the same
+// addresses.
+type qemuSavedDevices struct {
+	// CPUs are the hot plugged vCPUs.
+	CPUs []qmpHotpluggableCPU `json:"cpus"`
+
+	// DIMMs are the hot plugged DIMMs.
+	DIMMs []qmpMemoryDevice `json:"dimms"`
+
+	// PCIAddrs are the PCI addresses of the VM devices which have an ID,
+	// as slot.function.
+	PCIAddrs map[string]string `json:"pciAddrs"`
+}
+
+// savedDevices lists the devices hot plugged into the VM.
+func (q *qemu) savedDevices(ctx context.Context, qmp *qmpClient) (qemuSavedDevices, error) {
+	devices := qemuSavedDevices{PCIAddrs: make(map[string]string)}
+
+	var cpus []qmpHotpluggableCPU
+	if err := qmp.execute(ctx, "query-hotpluggable-cpus", nil, &cpus); err != nil {
+		return qemuSavedDevices{}, err
+	}
+
+	for _, cpu := range cpus {
+		if strings.HasPrefix(cpu.QOMPath, peripheralQOMPath) {
+			devices.CPUs = append(devices.CPUs, cpu)
+		}
+	}
+
+	dimms, _, err := hotpluggedDIMMs(ctx, qmp)
+	if err != nil {
+		return qemuSavedDevices{}, err
+	}
+	devices.DIMMs = dimms
+
+	var buses []qmpPCIBus
+	if err := qmp.execute(ctx, "query-pci", nil, &buses); err != nil {
+		return qemuSavedDevices{}, err
+	}
+
+	for _, bus := range buses {
+		for _, dev := range bus.Devices {
+			if dev.QdevID != "" {
+				devices.PCIAddrs[dev.QdevID] = fmt.Sprintf("%x.%x", dev.Slot, dev.Function)
+			}
+		}
+	}
+
+	return devices, nil
+}
+
+// restoreDevices puts the devices hot plugged into a saved VM on the command
+// line of the VM restoring it, where they were. The network endpoints and
+// volumes were added with addDevice, while the vCPUs and DIMMs are rebuilt
+// from the saved devices only.
+func restoreDevices(devices []ciaoQemu.Device, saved qemuSavedDevices) []ciaoQemu.Device {
+	var restored []ciaoQemu.Device
+
+	for _, device := range devices {
+		switch dev := device.(type) {
+		case ciaoQemu.NetDevice:
+			// The network endpoints of VMs taken from a pool are
+			// hot plugged.
+			if addr, ok := saved.PCIAddrs["virtio-"+dev.ID]; ok {
+				device = qemuNetDevice{
+					ID:         dev.ID,
+					IFName:     dev.IFName,
+					MACAddress: dev.MACAddress,
+					Addr:       addr,
+				}
+			}
+		case qemuNetDevice:
+			dev.Addr = saved.PCIAddrs["virtio-"+dev.ID]
+			device = dev
+		}
+
+		restored = append(restored, device)
+	}
+
+	for _, cpu := range saved.CPUs {
+		restored = append(restored, qemuCPUDevice{
+			Driver: cpu.Type,
+			ID:     strings.TrimPrefix(cpu.QOMPath, peripheralQOMPath),
+			Props:  cpu.Props,
+		})
+	}
+
+	for _, dimm := range saved.DIMMs {
+		restored = append(restored, qemuDIMMDevice{
+			ID:     dimm.Data.ID,
+			Memdev: filepath.Base(dimm.Data.Memdev),
+			Size:   dimm.Data.Size,
+			Addr:   dimm.Data.Addr,
+		})
+	}
+
+	return restored
+}
+
+// saveVM saves the device and RAM state of the paused Pod's VM into the dir
+// checkpoint directory, by migrating the VM to a file. The devices hot
+// plugged into the VM are saved along.
+func (q *qemu) saveVM(ctx context.Context, dir string) error {
+	qmp, err := qmpConnect(ctx, q.podID, q.qmpControlCh.path)
 	if err != nil {
-		glog.Errorf("Failed to connect to QEMU instance %v", err)
 		return err
 	}
+	defer qmp.close()
 
-	err = qmp.ExecuteQMPCapabilities(q.qmpMonitorCh.ctx)
+	devices, err := q.savedDevices(ctx, qmp)
 	if err != nil {
-		glog.Errorf("Failed to negotiate capabilities with QEMU %v", err)
 		return err
 	}
 
-	return qmp.ExecuteQuit(q.qmpMonitorCh.ctx)
+	data, err := json.Marshal(devices)
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, checkpointVMDevicesFile), data, 0600); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, checkpointVMStateFile), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = qmp.getFD(ctx, checkpointFdName, f)
+	if err != nil {
+		return err
+	}
+
+	// The default migration bandwidth limit is meant for networks, not
+	// for local files.
+	err = qmp.execute(ctx, "migrate_set_speed", map[string]interface{}{"value": math.MaxInt64}, nil)
+	if err != nil {
+		return err
+	}
+
+	err = qmp.execute(ctx, "migrate", map[string]interface{}{"uri": "fd:" + checkpointFdName}, nil)
+	if err != nil {
+		return err
+	}
+
+	var info qmpMigrationInfo
+	err = pollQMP(ctx, qmp, "query-migrate", &info, func() (bool, error) {
+		switch info.Status {
+		case "completed":
+			return true, nil
+		case "failed", "cancelled":
+			return true, fmt.Errorf("Could not save pod %s VM state: %s %s", q.podID, info.Status, info.ErrorDesc)
+		default:
+			return false, nil
+		}
+	})
+	if err != nil && ctx.Err() != nil {
+		qmp.execute(context.Background(), "migrate_cancel", nil, nil)
+	}
+
+	return err
+}
+
+// restorePod starts the Pod's VM from the state saveVM saved into the dir
+// checkpoint directory, with the devices the saved VM had. startCh is
+// notified once the VM state has been fully loaded. The VM is left in the
+// state it was when saved.
+func (q *qemu) restorePod(ctx context.Context, dir string, startCh, stopCh chan struct{}) error {
+	data, err := ioutil.ReadFile(filepath.Join(dir, checkpointVMDevicesFile))
+	if err != nil {
+		return err
+	}
+
+	var saved qemuSavedDevices
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+
+	q.qemuConfig.Devices = restoreDevices(q.qemuConfig.Devices, saved)
+
+	f, err := os.Open(filepath.Join(dir, checkpointVMStateFile))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// QEMU waits for the VM state to be given through QMP, the same way
+	// saveVM takes it.
+	q.qemuConfig.Devices = append(q.qemuConfig.Devices, qemuIncoming{URI: qemuDeferredIncoming})
+
+	err = q.startPod(ctx, make(chan struct{}), stopCh)
+	if err != nil {
+		return err
+	}
+
+	qmp, err := qmpConnect(ctx, q.podID, q.qmpControlCh.path)
+	if err != nil {
+		return err
+	}
+	defer qmp.close()
+
+	err = qmp.getFD(ctx, checkpointFdName, f)
+	if err != nil {
+		return err
+	}
+
+	err = qmp.execute(ctx, "migrate-incoming", map[string]interface{}{"uri": "fd:" + checkpointFdName}, nil)
+	if err != nil {
+		return err
+	}
+
+	var status qmpStatusInfo
+	err = pollQMP(ctx, qmp, "query-status", &status, func() (bool, error) {
+		return status.Status != "inmigrate", nil
+	})
+	if err != nil {
+		return err
+	}
+
+	close(startCh)
+
+	return nil
+}
+
+// bootPooledVM launches a VM which is not bound to any Pod yet, and waits
+// for its QMP control socket to be ready. The QMP monitor socket is left
+// alone for the Pod adopting the VM.
+func (q *qemu) bootPooledVM(ctx context.Context) error {
+	q.qemuConfig.Ctx = ctx
+
+	strErr, err := ciaoQemu.LaunchQemu(q.qemuConfig, newQMPLogger(q.podID))
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		return fmt.Errorf("%s", strErr)
+	}
+
+	for {
+		qmp, err := qmpConnect(ctx, q.podID, q.qmpControlCh.path)
+		if err == nil {
+			qmp.close()
+			return nil
+		}
+
+		select {
+		case <-time.After(qmpPollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// adoptPooledVM binds a pre-booted VM to the Pod: its QMP sockets are moved
+// where the Pod expects them, and the Pod network devices are hot plugged.
+// This must run from the Pod network namespace, for the TAP interfaces to
+// be found.
+func (q *qemu) adoptPooledVM(ctx context.Context, vm pooledVM, startCh, stopCh chan struct{}) error {
+	if err := os.Rename(vm.ControlSocket, q.qmpControlCh.path); err != nil {
+		return err
+	}
+
+	if err := os.Rename(vm.MonitorSocket, q.qmpMonitorCh.path); err != nil {
+		return err
+	}
+
+	qmp, err := qmpConnect(ctx, q.podID, q.qmpControlCh.path)
+	if err != nil {
+		return err
+	}
+	defer qmp.close()
+
+	for _, device := range q.qemuConfig.Devices {
+		netDevice, ok := device.(ciaoQemu.NetDevice)
+		if !ok {
+			continue
+		}
+
+		if err := q.hotplugNetDevice(ctx, qmp, netDevice); err != nil {
+			return err
+		}
+	}
+
+	q.monitorVM(ctx, startCh, stopCh)
+
+	return nil
+}
+
+// hotplugNetDevice opens a TAP interface on behalf of QEMU, which may not
+// live in the same network namespace, and plugs it into the VM.
+func (q *qemu) hotplugNetDevice(ctx context.Context, qmp *qmpClient, netDevice ciaoQemu.NetDevice) error {
+	tap, err := openTAP(netDevice.IFName)
+	if err != nil {
+		return err
+	}
+	defer tap.Close()
+
+	fdName := "fd-" + netDevice.ID
+
+	err = qmp.getFD(ctx, fdName, tap)
+	if err != nil {
+		return err
+	}
+
+	err = qmp.execute(ctx, "netdev_add", map[string]interface{}{
+		"type": "tap",
+		"id":   netDevice.ID,
+		"fd":   fdName,
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	return qmp.execute(ctx, "device_add", map[string]interface{}{
+		"driver": "virtio-net-pci",
+		"id":     "virtio-" + netDevice.ID,
+		"netdev": netDevice.ID,
+		"mac":    netDevice.MACAddress,
+	}, nil)
+}
+
+// endpointNetDevice returns the device a network endpoint hot plugged into
+// the running VM is. It is named after the endpoint TAP interface, the
+// network devices the VM starts with being named after their index.
+func endpointNetDevice(endpoint Endpoint) ciaoQemu.NetDevice {
+	return ciaoQemu.NetDevice{
+		Type:       ciaoQemu.TAP,
+		Driver:     ciaoQemu.VirtioNet,
+		ID:         "network-" + endpoint.NetPair.TAPIface.Name,
+		IFName:     endpoint.NetPair.TAPIface.Name,
+		MACAddress: endpoint.NetPair.VirtIface.HardAddr,
+	}
+}
+
+// hotunplugNetDevice removes a hot plugged network device and its TAP
+// backend.
+func (q *qemu) hotunplugNetDevice(ctx context.Context, qmp *qmpClient, netDevice ciaoQemu.NetDevice) error {
+	if err := deleteDevice(ctx, qmp, "virtio-"+netDevice.ID); err != nil {
+		return err
+	}
+
+	return qmp.execute(ctx, "netdev_del", map[string]interface{}{"id": netDevice.ID}, nil)
+}
+
+// hotplugAddDevice plugs a network endpoint into the running VM, through
+// QMP. Network endpoints must be plugged from the Pod network
+// namespace, for their TAP interfaces to be found.
+func (q *qemu) hotplugAddDevice(ctx context.Context, devInfo interface{}, devType deviceType) error {
+	qmp, err := qmpConnect(ctx, q.podID, q.qmpControlCh.path)
+	if err != nil {
+		return err
+	}
+	defer qmp.close()
+
+	switch devType {
+	case netDev:
+		endpoint := devInfo.(Endpoint)
+		return q.hotplugNetDevice(ctx, qmp, endpointNetDevice(endpoint))
+	default:
+		return fmt.Errorf("Cannot hot plug devices of type %d", devType)
+	}
+}
+
+// hotplugRemoveDevice unplugs a network endpoint hot plugged with
+// hotplugAddDevice from the running VM.
+func (q *qemu) hotplugRemoveDevice(ctx context.Context, devInfo interface{}, devType deviceType) error {
+	qmp, err := qmpConnect(ctx, q.podID, q.qmpControlCh.path)
+	if err != nil {
+		return err
+	}
+	defer qmp.close()
+
+	switch devType {
+	case netDev:
+		endpoint := devInfo.(Endpoint)
+		return q.hotunplugNetDevice(ctx, qmp, endpointNetDevice(endpoint))
+	default:
+		return fmt.Errorf("Cannot hot unplug devices of type %d", devType)
+	}
+}
+
+// pingVM checks that the Pod's VM is still alive, i.e. that QEMU still
+// listens to its QMP control socket.
+func (q *qemu) pingVM(ctx context.Context) error {
+	return dialSocket(ctx, q.qmpControlCh.path)
 }
 
 // addDevice will add extra devices to Qemu command line.
@@ -549,9 +1692,23 @@ func (q *qemu) addDevice(devInfo interface{}, devType deviceType) error {
 	case serialPortDev:
 		socket := devInfo.(Socket)
 		q.qemuConfig.Devices = q.appendSocket(q.qemuConfig.Devices, socket)
+	case blockDev:
+		drive := devInfo.(rootfsDrive)
+		q.qemuConfig.Devices = q.appendRootfsDrive(q.qemuConfig.Devices, drive)
 	case netDev:
-		endpoints := devInfo.([]Endpoint)
-		q.qemuConfig.Devices = q.appendNetworks(q.qemuConfig.Devices, endpoints)
+		switch endpoints := devInfo.(type) {
+		case []Endpoint:
+			q.qemuConfig.Devices = q.appendNetworks(q.qemuConfig.Devices, endpoints)
+		case Endpoint:
+			// Only VMs restored from a checkpoint start with
+			// hot plugged network endpoints.
+			netDevice := endpointNetDevice(endpoints)
+			q.qemuConfig.Devices = append(q.qemuConfig.Devices, qemuNetDevice{
+				ID:         netDevice.ID,
+				IFName:     netDevice.IFName,
+				MACAddress: netDevice.MACAddress,
+			})
+		}
 	default:
 		break
 	}
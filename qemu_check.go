@@ -0,0 +1,254 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// The oldest QEMU version we support. From 2.9 on, the 9p local backend
+// opens files relative to the shared directory it opened at startup, which
+// lets us rename the shared directory of a running pooled VM for a pod to
+// adopt it.
+const (
+	qemuMinMajor = 2
+	qemuMinMinor = 9
+)
+
+// qemuProbeTimeout bounds each QEMU binary run while probing it.
+var qemuProbeTimeout = 10 * time.Second
+
+var qemuVersionRegexp = regexp.MustCompile(`version (\d+)\.(\d+)(\.\d+)?`)
+
+// qemuProbe is what we learnt from running a QEMU binary. It is only valid
+// as long as the binary size and modification time do not change.
+type qemuProbe struct {
+	size    int64
+	modTime time.Time
+	caps    HypervisorCapabilities
+}
+
+// qemuProbes caches the QEMU binaries probes, by path, so that pods
+// creation does not run QEMU several times.
+var qemuProbes = struct {
+	sync.Mutex
+	probes map[string]qemuProbe
+}{
+	probes: make(map[string]qemuProbe),
+}
+
+// runQemuProbe runs the QEMU binary at path with args, and returns its
+// standard output.
+func runQemuProbe(ctx context.Context, path string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, qemuProbeTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, path, args...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("%s %s failed: %s", path, strings.Join(args, " "), strings.TrimSpace(string(exitErr.Stderr)))
+		}
+
+		return "", fmt.Errorf("%s %s failed: %s", path, strings.Join(args, " "), err)
+	}
+
+	return string(out), nil
+}
+
+// parseQemuMachineTypes parses the -machine help output, listing a
+// machine type per line after a header line.
+func parseQemuMachineTypes(out string) []string {
+	var types []string
+
+	lines := strings.Split(out, "\n")
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) > 0 {
+			types = append(types, fields[0])
+		}
+	}
+
+	return types
+}
+
+// parseQemuAccelerators parses the -accel help output, listing the
+// accelerators after a colon, either on the same line or one per line.
+func parseQemuAccelerators(out string) []string {
+	i := strings.Index(out, ":")
+	if i < 0 {
+		return nil
+	}
+
+	return strings.FieldsFunc(out[i+1:], func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+}
+
+// probeQemu runs the QEMU binary at path to find out its version, machine
+// types, devices and accelerators.
+func probeQemu(ctx context.Context, path string) (HypervisorCapabilities, error) {
+	caps := HypervisorCapabilities{Path: path}
+
+	out, err := runQemuProbe(ctx, path, "-version")
+	if err != nil {
+		return caps, err
+	}
+
+	match := qemuVersionRegexp.FindStringSubmatch(out)
+	if match == nil {
+		return caps, fmt.Errorf("Could not find the version of %s in %q", path, strings.TrimSpace(out))
+	}
+
+	caps.Version = strings.TrimPrefix(match[0], "version ")
+
+	out, err = runQemuProbe(ctx, path, "-machine", "help")
+	if err != nil {
+		return caps, err
+	}
+
+	caps.MachineTypes = parseQemuMachineTypes(out)
+
+	out, err = runQemuProbe(ctx, path, "-device", "help")
+	if err != nil {
+		return caps, err
+	}
+
+	caps.NVDIMM = strings.Contains(out, `"nvdimm"`)
+	caps.VirtioBlock = strings.Contains(out, `"virtio-blk-pci"`)
+	caps.VirtioSCSI = strings.Contains(out, `"virtio-scsi-pci"`)
+
+	// Older QEMU versions cannot list their accelerators.
+	if out, err := runQemuProbe(ctx, path, "-accel", "help"); err == nil {
+		caps.Accelerators = parseQemuAccelerators(out)
+	}
+
+	return caps, nil
+}
+
+// cachedProbeQemu returns the QEMU binary at path probe, probing it again
+// only if the binary changed.
+func cachedProbeQemu(ctx context.Context, path string) (HypervisorCapabilities, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return HypervisorCapabilities{Path: path}, err
+	}
+
+	qemuProbes.Lock()
+	probe, ok := qemuProbes.probes[path]
+	qemuProbes.Unlock()
+
+	if ok && probe.size == info.Size() && probe.modTime.Equal(info.ModTime()) {
+		return probe.caps, nil
+	}
+
+	// Probe without the lock, so that probing one binary does not hold up
+	// the pods using the others. Concurrent probes of the same binary
+	// store the same capabilities.
+	caps, err := probeQemu(ctx, path)
+	if err != nil {
+		return caps, err
+	}
+
+	qemuProbes.Lock()
+	qemuProbes.probes[path] = qemuProbe{
+		size:    info.Size(),
+		modTime: info.ModTime(),
+		caps:    caps,
+	}
+	qemuProbes.Unlock()
+
+	return caps, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkQemu probes the QEMU binary config points to, and checks it against
+// the VMs we build from config.
+func checkQemu(ctx context.Context, config HypervisorConfig) (HypervisorCapabilities, error) {
+	caps, err := cachedProbeQemu(ctx, qemuPath(config))
+	if err != nil {
+		return caps, err
+	}
+
+	// The cached probe is shared.
+	caps.MachineTypes = append([]string(nil), caps.MachineTypes...)
+	caps.Accelerators = append([]string(nil), caps.Accelerators...)
+	caps.KVM = kvmAccessible()
+
+	major, minor := 0, 0
+	if match := qemuVersionRegexp.FindStringSubmatch("version " + caps.Version); match != nil {
+		major, _ = strconv.Atoi(match[1])
+		minor, _ = strconv.Atoi(match[2])
+	}
+
+	if major < qemuMinMajor || (major == qemuMinMajor && minor < qemuMinMinor) {
+		caps.missing("QEMU %d.%d or newer (found %s)", qemuMinMajor, qemuMinMinor, caps.Version)
+	}
+
+	if machineType := qemuMachineType(config); !containsString(caps.MachineTypes, machineType) {
+		caps.missing("%s machine type", machineType)
+	}
+
+	switch imageTransport(config) {
+	case NVDIMMImage:
+		if !caps.NVDIMM {
+			caps.missing("NVDIMM device")
+		}
+	case VirtioBlockImage:
+		if !caps.VirtioBlock {
+			caps.missing("virtio-blk device")
+		}
+	case VirtioSCSIImage:
+		if !caps.VirtioSCSI {
+			caps.missing("virtio-scsi device")
+		}
+	}
+
+	accel := qemuAccelerator(config)
+	if len(caps.Accelerators) > 0 && !containsString(caps.Accelerators, string(accel)) {
+		caps.missing("%s accelerator", strings.ToUpper(string(accel)))
+	}
+
+	// TCG VMs do not need KVM.
+	if accel == KVMAccelerator && !caps.KVM {
+		caps.missing("read and write access to %s", kvmDevicePath)
+	}
+
+	return caps, nil
+}
+
+// check is the Hypervisor capabilities check implementation for ciaoQemu.
+func (q *qemu) check(ctx context.Context) (HypervisorCapabilities, error) {
+	return checkQemu(ctx, q.config)
+}
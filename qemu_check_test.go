@@ -0,0 +1,362 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeQemu describes the answers of a fake QEMU binary to our probes.
+type fakeQemu struct {
+	version  string
+	machines string
+	devices  string
+	accels   string
+}
+
+var goodFakeQemu = fakeQemu{
+	version:  "QEMU emulator version 2.9.0(qemu-lite), Copyright (c) 2003-2008 Fabrice Bellard",
+	machines: "Supported machines are:\npc-lite              Light weight PC (alias of pc-lite-2.9)\npc                   Standard PC (i440FX + PIIX, 1996)",
+	devices:  "Storage devices:\nname \"nvdimm\", desc \"DIMM memory module\"\nname \"virtio-blk-pci\", bus PCI\nname \"virtio-scsi-pci\", bus PCI",
+	accels:   "Accelerators supported in QEMU binary:\ntcg\nkvm",
+}
+
+// qemuCheckTestEnv runs the capabilities checks against fake QEMU binaries
+// and KVM device.
+type qemuCheckTestEnv struct {
+	dir string
+
+	savedKVMDevicePath string
+}
+
+func newQemuCheckTestEnv(t *testing.T) *qemuCheckTestEnv {
+	dir, err := ioutil.TempDir(testDir, "qemu-check")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := &qemuCheckTestEnv{
+		dir:                dir,
+		savedKVMDevicePath: kvmDevicePath,
+	}
+
+	kvmDevicePath = filepath.Join(dir, "kvm")
+	if err := ioutil.WriteFile(kvmDevicePath, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return env
+}
+
+func (env *qemuCheckTestEnv) restore() {
+	kvmDevicePath = env.savedKVMDevicePath
+
+	os.RemoveAll(env.dir)
+}
+
+// writeQemu writes a fake QEMU binary printing the fake answers.
+func (env *qemuCheckTestEnv) writeQemu(t *testing.T, name string, fake fakeQemu) string {
+	script := fmt.Sprintf(`#!/bin/sh
+case "$1" in
+-version) echo '%s' ;;
+-machine) echo '%s' ;;
+-device) echo '%s' ;;
+-accel) [ -n '%s' ] || exit 1; echo '%s' ;;
+esac
+`, fake.version, fake.machines, fake.devices, fake.accels, fake.accels)
+
+	path := filepath.Join(env.dir, name)
+	if err := ioutil.WriteFile(path, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestParseQemuAccelerators(t *testing.T) {
+	expected := []string{"kvm", "tcg"}
+
+	for _, out := range []string{
+		"Accelerators supported in QEMU binary:\nkvm\ntcg\n",
+		"Possible accelerators: kvm, tcg\n",
+	} {
+		accels := parseQemuAccelerators(out)
+		if !reflect.DeepEqual(accels, expected) {
+			t.Fatalf("Got %v from %q, expecting %v", accels, out, expected)
+		}
+	}
+}
+
+func TestCheckQemu(t *testing.T) {
+	env := newQemuCheckTestEnv(t)
+	defer env.restore()
+
+	path := env.writeQemu(t, "qemu-good", goodFakeQemu)
+
+	caps, err := CheckHypervisor(HypervisorConfig{HypervisorPath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := HypervisorCapabilities{
+		Path:         path,
+		Version:      "2.9.0",
+		MachineTypes: []string{"pc-lite", "pc"},
+		Accelerators: []string{"tcg", "kvm"},
+		NVDIMM:       true,
+		VirtioBlock:  true,
+		VirtioSCSI:   true,
+		KVM:          true,
+	}
+
+	if !reflect.DeepEqual(caps, expected) {
+		t.Fatalf("Got %+v, expecting %+v", caps, expected)
+	}
+
+	if !caps.Supported() {
+		t.Fatal("The hypervisor should be supported")
+	}
+}
+
+func TestCheckQemuMissing(t *testing.T) {
+	env := newQemuCheckTestEnv(t)
+	defer env.restore()
+
+	path := env.writeQemu(t, "qemu-bad", fakeQemu{
+		version:  "QEMU emulator version 2.5.0 (Debian 1:2.5+dfsg-5ubuntu10)",
+		machines: "Supported machines are:\npc                   Standard PC (i440FX + PIIX, 1996)",
+		devices:  "Storage devices:\nname \"virtio-blk-pci\"",
+		accels:   "Possible accelerators: tcg",
+	})
+
+	os.Remove(kvmDevicePath)
+
+	caps, err := CheckHypervisor(HypervisorConfig{HypervisorPath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"QEMU 2.9 or newer (found 2.5.0)",
+		"pc-lite machine type",
+		"NVDIMM device",
+		"KVM accelerator",
+		"read and write access to " + kvmDevicePath,
+	}
+
+	if !reflect.DeepEqual(caps.Missing, expected) {
+		t.Fatalf("Got %q, expecting %q", caps.Missing, expected)
+	}
+}
+
+func TestCheckQemuImageTransport(t *testing.T) {
+	env := newQemuCheckTestEnv(t)
+	defer env.restore()
+
+	path := env.writeQemu(t, "qemu-blk-only", fakeQemu{
+		version:  goodFakeQemu.version,
+		machines: goodFakeQemu.machines,
+		devices:  "Storage devices:\nname \"virtio-blk-pci\", bus PCI",
+		accels:   goodFakeQemu.accels,
+	})
+
+	for transport, missing := range map[ImageTransport][]string{
+		NVDIMMImage:      {"NVDIMM device"},
+		VirtioBlockImage: nil,
+		VirtioSCSIImage:  {"virtio-scsi device"},
+	} {
+		caps, err := CheckHypervisor(HypervisorConfig{
+			HypervisorPath: path,
+			ImageTransport: transport,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(caps.Missing, missing) {
+			t.Fatalf("Got %q with %s, expecting %q", caps.Missing, transport, missing)
+		}
+	}
+}
+
+func TestCheckQemuTCG(t *testing.T) {
+	env := newQemuCheckTestEnv(t)
+	defer env.restore()
+
+	fake := goodFakeQemu
+	fake.machines = "Supported machines are:\nq35                  Standard PC (Q35 + ICH9, 2009)"
+	fake.accels = "Possible accelerators: tcg"
+	path := env.writeQemu(t, "qemu-tcg", fake)
+
+	os.Remove(kvmDevicePath)
+
+	config := HypervisorConfig{
+		HypervisorPath: path,
+		MachineType:    "q35",
+		Accelerator:    TCGAccelerator,
+	}
+
+	caps, err := CheckHypervisor(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !caps.Supported() {
+		t.Fatalf("TCG VMs should not need KVM: %q", caps.Missing)
+	}
+
+	config.Accelerator = KVMAccelerator
+
+	caps, err = CheckHypervisor(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"KVM accelerator", "read and write access to " + kvmDevicePath}
+	if !reflect.DeepEqual(caps.Missing, expected) {
+		t.Fatalf("Got %q, expecting %q", caps.Missing, expected)
+	}
+}
+
+func TestCheckQemuWithoutAccelHelp(t *testing.T) {
+	env := newQemuCheckTestEnv(t)
+	defer env.restore()
+
+	fake := goodFakeQemu
+	fake.accels = ""
+	path := env.writeQemu(t, "qemu-no-accel", fake)
+
+	caps, err := CheckHypervisor(HypervisorConfig{HypervisorPath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(caps.Accelerators) != 0 || !caps.Supported() {
+		t.Fatalf("Unknown accelerators should not be reported missing: %+v", caps)
+	}
+}
+
+func TestCheckQemuProbeCache(t *testing.T) {
+	env := newQemuCheckTestEnv(t)
+	defer env.restore()
+
+	path := env.writeQemu(t, "qemu-upgraded", goodFakeQemu)
+
+	if _, err := checkQemu(context.Background(), HypervisorConfig{HypervisorPath: path}); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := goodFakeQemu
+	fake.version = "QEMU emulator version 2.9.1"
+	env.writeQemu(t, "qemu-upgraded", fake)
+
+	// Same size, different modification time.
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	caps, err := checkQemu(context.Background(), HypervisorConfig{HypervisorPath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if caps.Version != "2.9.1" {
+		t.Fatalf("Got version %s, the upgraded binary should have been probed", caps.Version)
+	}
+}
+
+func TestCheckQemuProbeConcurrent(t *testing.T) {
+	env := newQemuCheckTestEnv(t)
+	defer env.restore()
+
+	hung := filepath.Join(env.dir, "qemu-hung")
+	if err := ioutil.WriteFile(hung, []byte("#!/bin/sh\nexec sleep 10\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	go func() {
+		checkQemu(ctx, HypervisorConfig{HypervisorPath: hung})
+		close(done)
+	}()
+
+	// Let the hung probe start first.
+	time.Sleep(100 * time.Millisecond)
+
+	path := env.writeQemu(t, "qemu-concurrent", goodFakeQemu)
+
+	checkCtx, checkCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer checkCancel()
+
+	if _, err := checkQemu(checkCtx, HypervisorConfig{HypervisorPath: path}); err != nil {
+		t.Fatalf("Probing a binary should not wait for the probe of another one: %s", err)
+	}
+}
+
+func TestCheckQemuFailure(t *testing.T) {
+	env := newQemuCheckTestEnv(t)
+	defer env.restore()
+
+	path := filepath.Join(env.dir, "qemu-broken")
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\necho broken >&2\nexit 1\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := CheckHypervisor(HypervisorConfig{HypervisorPath: path}); err == nil {
+		t.Fatal("Checking a failing binary should fail")
+	}
+
+	if _, err := CheckHypervisor(HypervisorConfig{HypervisorPath: filepath.Join(env.dir, "none")}); err == nil {
+		t.Fatal("Checking a missing binary should fail")
+	}
+}
+
+func TestCreatePodHypervisorCheck(t *testing.T) {
+	env := newQemuCheckTestEnv(t)
+	defer env.restore()
+
+	fake := goodFakeQemu
+	fake.devices = "Storage devices:"
+
+	config := newTestPodConfigNoop()
+	config.ID = "hypervisor-check"
+	config.HypervisorType = QemuHypervisor
+	config.HypervisorConfig.HypervisorPath = env.writeQemu(t, "qemu-no-nvdimm", fake)
+
+	_, err := CreatePod(config)
+	if !IsHypervisorError(err) {
+		t.Fatalf("Got %v, expecting a hypervisor error", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(configStoragePath, config.ID)); !os.IsNotExist(err) {
+		t.Fatal("No pod resources should have been created")
+	}
+}
@@ -0,0 +1,176 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"fmt"
+	"sort"
+
+	ciaoQemu "github.com/01org/ciao/qemu"
+)
+
+// The devices below are the ones ciao cannot describe: the logged consoles,
+// the SCSI controller of the guest image disk, the incoming migration of a
+// restored VM, and the devices hot plugged into a VM saved in a checkpoint,
+// that must be found at the very same addresses when the VM is restored.
+
+// qemuConsoleDevice is a virtio console exposed through a unix socket, whose
+// output QEMU also appends to a log file, whether a client is attached to
+// the socket or not.
+type qemuConsoleDevice struct {
+	DeviceID string
+	ID       string
+	Path     string
+	LogFile  string
+}
+
+// Valid returns true if the console can be put on the command line.
+func (dev qemuConsoleDevice) Valid() bool {
+	return dev.ID != "" && dev.Path != "" && dev.LogFile != ""
+}
+
+// QemuParams returns the console and socket character device command line
+// parameters.
+func (dev qemuConsoleDevice) QemuParams(config *ciaoQemu.Config) []string {
+	return []string{
+		"-device", fmt.Sprintf("%s,chardev=%s,id=%s", ciaoQemu.Console, dev.ID, dev.DeviceID),
+		"-chardev", fmt.Sprintf("socket,id=%s,path=%s,server,nowait,logfile=%s,logappend=on", dev.ID, dev.Path, dev.LogFile),
+	}
+}
+
+// qemuSCSIController is a virtio-scsi controller, the bus of the SCSI disks.
+type qemuSCSIController struct {
+	ID string
+}
+
+// Valid returns true if the SCSI controller can be put on the command line.
+func (dev qemuSCSIController) Valid() bool {
+	return dev.ID != ""
+}
+
+// QemuParams returns the SCSI controller command line parameters.
+func (dev qemuSCSIController) QemuParams(config *ciaoQemu.Config) []string {
+	return []string{"-device", fmt.Sprintf("%s,id=%s", qemuVirtioSCSI, dev.ID)}
+}
+
+// qemuDeferredIncoming has QEMU wait for the migrate-incoming QMP command to
+// load the VM state.
+const qemuDeferredIncoming = "defer"
+
+// qemuIncoming has QEMU load the VM state from an incoming migration,
+// instead of booting the VM.
+type qemuIncoming struct {
+	URI string
+}
+
+// Valid returns true if the incoming migration can be put on the command
+// line.
+func (dev qemuIncoming) Valid() bool {
+	return dev.URI != ""
+}
+
+// QemuParams returns the incoming migration command line parameters.
+func (dev qemuIncoming) QemuParams(config *ciaoQemu.Config) []string {
+	return []string{"-incoming", dev.URI}
+}
+
+// pciAddr returns the addr property of a PCI device, if its address is known.
+func pciAddr(addr string) string {
+	if addr == "" {
+		return ""
+	}
+
+	return ",addr=" + addr
+}
+
+// qemuNetDevice is a network endpoint hot plugged into the VM, through a
+// TAP interface.
+type qemuNetDevice struct {
+	// ID is the network backend ID, the device ID being "virtio-" + ID.
+	ID         string
+	IFName     string
+	MACAddress string
+
+	// Addr is the device PCI address, as slot.function.
+	Addr string
+}
+
+// Valid returns true if the network device can be put on the command line.
+func (dev qemuNetDevice) Valid() bool {
+	return dev.ID != "" && dev.IFName != ""
+}
+
+// QemuParams returns the network device command line parameters.
+func (dev qemuNetDevice) QemuParams(config *ciaoQemu.Config) []string {
+	return []string{
+		"-netdev", fmt.Sprintf("tap,id=%s,ifname=%s,script=no,downscript=no", dev.ID, dev.IFName),
+		"-device", fmt.Sprintf("virtio-net-pci,id=virtio-%s,netdev=%s,mac=%s%s", dev.ID, dev.ID, dev.MACAddress, pciAddr(dev.Addr)),
+	}
+}
+
+// qemuCPUDevice is a hot plugged vCPU.
+type qemuCPUDevice struct {
+	Driver string
+	ID     string
+
+	// Props are the vCPU topology properties, e.g. "socket-id".
+	Props map[string]interface{}
+}
+
+// Valid returns true if the vCPU can be put on the command line.
+func (dev qemuCPUDevice) Valid() bool {
+	return dev.Driver != "" && dev.ID != ""
+}
+
+// QemuParams returns the vCPU command line parameters.
+func (dev qemuCPUDevice) QemuParams(config *ciaoQemu.Config) []string {
+	var keys []string
+	for key := range dev.Props {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	params := fmt.Sprintf("%s,id=%s", dev.Driver, dev.ID)
+	for _, key := range keys {
+		params += fmt.Sprintf(",%s=%v", key, dev.Props[key])
+	}
+
+	return []string{"-device", params}
+}
+
+// qemuDIMMDevice is a hot plugged DIMM, and its memory backend.
+type qemuDIMMDevice struct {
+	ID     string
+	Memdev string
+	Size   uint64
+
+	// Addr is the DIMM guest physical address.
+	Addr uint64
+}
+
+// Valid returns true if the DIMM can be put on the command line.
+func (dev qemuDIMMDevice) Valid() bool {
+	return dev.ID != "" && dev.Memdev != "" && dev.Size > 0
+}
+
+// QemuParams returns the DIMM and memory backend command line parameters.
+func (dev qemuDIMMDevice) QemuParams(config *ciaoQemu.Config) []string {
+	return []string{
+		"-object", fmt.Sprintf("memory-backend-ram,id=%s,size=%d", dev.Memdev, dev.Size),
+		"-device", fmt.Sprintf("pc-dimm,id=%s,memdev=%s,addr=%d", dev.ID, dev.Memdev, dev.Addr),
+	}
+}
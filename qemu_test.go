@@ -17,9 +17,14 @@
 package virtcontainers
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
 	"strings"
 	"testing"
 
@@ -253,12 +258,11 @@ func TestQemuAppendConsoles(t *testing.T) {
 			Driver: ciaoQemu.VirtioSerial,
 			ID:     "serial0",
 		},
-		ciaoQemu.CharDevice{
-			Driver:   ciaoQemu.Console,
-			Backend:  ciaoQemu.Socket,
+		qemuConsoleDevice{
 			DeviceID: "console0",
 			ID:       "charconsole0",
 			Path:     podConsolePath,
+			LogFile:  consoleLogPath(podID, "console0"),
 		},
 		ciaoQemu.CharDevice{
 			Driver:   ciaoQemu.Console,
@@ -267,12 +271,11 @@ func TestQemuAppendConsoles(t *testing.T) {
 			ID:       "charconsole1",
 			Path:     contConsolePath,
 		},
-		ciaoQemu.CharDevice{
-			Driver:   ciaoQemu.Console,
-			Backend:  ciaoQemu.Socket,
+		qemuConsoleDevice{
 			DeviceID: "console2",
 			ID:       "charconsole2",
 			Path:     fmt.Sprintf("%s/%s/%s/%s", runStoragePath, podID, cID2, defaultConsole),
+			LogFile:  consoleLogPath(podID, "console2-"+cID2),
 		},
 	}
 
@@ -298,6 +301,24 @@ func TestQemuAppendConsoles(t *testing.T) {
 	testQemuAppend(t, podConfig, expectedOut, consoleDev)
 }
 
+func TestQemuConsoleDeviceParams(t *testing.T) {
+	console := qemuConsoleDevice{
+		DeviceID: "console0",
+		ID:       "charconsole0",
+		Path:     "/run/pod/console.sock",
+		LogFile:  "/var/log/pod/console0.log",
+	}
+
+	expected := []string{
+		"-device", "virtconsole,chardev=charconsole0,id=console0",
+		"-chardev", "socket,id=charconsole0,path=/run/pod/console.sock,server,nowait,logfile=/var/log/pod/console0.log,logappend=on",
+	}
+
+	if params := console.QemuParams(nil); !reflect.DeepEqual(params, expected) {
+		t.Fatalf("Got %v\nExpecting %v", params, expected)
+	}
+}
+
 func TestQemuAppendImage(t *testing.T) {
 	var devices []ciaoQemu.Device
 
@@ -340,6 +361,167 @@ func TestQemuAppendImage(t *testing.T) {
 	}
 }
 
+func TestQemuAppendImageDisk(t *testing.T) {
+	for transport, expectedOut := range map[ImageTransport][]ciaoQemu.Device{
+		VirtioBlockImage: {
+			ciaoQemu.BlockDevice{
+				Driver:    ciaoQemu.VirtioBlock,
+				ID:        imageDriveID,
+				File:      testQemuImagePath,
+				Interface: ciaoQemu.NoInterface,
+				AIO:       ciaoQemu.Threads,
+				Format:    qemuRawFormat,
+			},
+		},
+		VirtioSCSIImage: {
+			qemuSCSIController{
+				ID: scsiControllerID,
+			},
+			ciaoQemu.BlockDevice{
+				Driver:    qemuSCSIDisk,
+				ID:        imageDriveID,
+				File:      testQemuImagePath,
+				Interface: ciaoQemu.NoInterface,
+				AIO:       ciaoQemu.Threads,
+				Format:    qemuRawFormat,
+				SCSI:      true,
+				WCE:       true,
+			},
+		},
+	} {
+		qemuConfig := newQemuConfig()
+		qemuConfig.ImageTransport = transport
+		q := &qemu{
+			config: qemuConfig,
+		}
+
+		devices, err := q.appendImage(nil, PodConfig{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if reflect.DeepEqual(devices, expectedOut) == false {
+			t.Fatalf("Got %v with %s\nExpecting %v", devices, transport, expectedOut)
+		}
+	}
+}
+
+func TestQemuSCSIControllerParams(t *testing.T) {
+	controller := qemuSCSIController{ID: scsiControllerID}
+	if !controller.Valid() {
+		t.Fatalf("SCSI controller %+v should be valid", controller)
+	}
+
+	expected := []string{"-device", "virtio-scsi-pci,id=scsi0"}
+	if params := controller.QemuParams(nil); !reflect.DeepEqual(params, expected) {
+		t.Fatalf("Got %v\nExpecting %v", params, expected)
+	}
+
+	if (qemuSCSIController{}).Valid() {
+		t.Fatal("SCSI controller without ID should not be valid")
+	}
+}
+
+func TestQemuIncomingParams(t *testing.T) {
+	incoming := qemuIncoming{URI: qemuDeferredIncoming}
+	if !incoming.Valid() {
+		t.Fatalf("Incoming migration %+v should be valid", incoming)
+	}
+
+	expected := []string{"-incoming", "defer"}
+	if params := incoming.QemuParams(nil); !reflect.DeepEqual(params, expected) {
+		t.Fatalf("Got %v\nExpecting %v", params, expected)
+	}
+
+	if (qemuIncoming{}).Valid() {
+		t.Fatal("Incoming migration without URI should not be valid")
+	}
+}
+
+func TestQemuVMSettings(t *testing.T) {
+	type vmSettings struct {
+		machine     ciaoQemu.Machine
+		cpuModel    string
+		globalParam string
+		rtc         ciaoQemu.RTC
+	}
+
+	tcgConfig := newQemuConfig()
+	tcgConfig.MachineType = "q35"
+	tcgConfig.Accelerator = TCGAccelerator
+	tcgConfig.ImageTransport = VirtioBlockImage
+	tcgConfig.RTCBase = "localtime"
+	tcgConfig.RTCDriftFix = "none"
+
+	customConfig := newQemuConfig()
+	customConfig.CPUModel = "Haswell"
+	customConfig.GlobalParam = "kvm-pit.lost_tick_policy=delay"
+
+	for _, test := range []struct {
+		config   HypervisorConfig
+		expected vmSettings
+	}{
+		{
+			config: newQemuConfig(),
+			expected: vmSettings{
+				machine:     ciaoQemu.Machine{Type: "pc-lite", Acceleration: "kvm,kernel_irqchip,nvdimm"},
+				cpuModel:    "host",
+				globalParam: "kvm-pit.lost_tick_policy=discard",
+				rtc:         ciaoQemu.RTC{Base: "utc", DriftFix: "slew"},
+			},
+		},
+		{
+			config: tcgConfig,
+			expected: vmSettings{
+				machine:  ciaoQemu.Machine{Type: "q35", Acceleration: "tcg"},
+				cpuModel: "qemu64",
+				rtc:      ciaoQemu.RTC{Base: "localtime", DriftFix: "none"},
+			},
+		},
+		{
+			config: customConfig,
+			expected: vmSettings{
+				machine:     ciaoQemu.Machine{Type: "pc-lite", Acceleration: "kvm,kernel_irqchip,nvdimm"},
+				cpuModel:    "Haswell",
+				globalParam: "kvm-pit.lost_tick_policy=delay",
+				rtc:         ciaoQemu.RTC{Base: "utc", DriftFix: "slew"},
+			},
+		},
+	} {
+		settings := vmSettings{
+			machine:     qemuMachine(test.config),
+			cpuModel:    qemuCPUModel(test.config),
+			globalParam: qemuGlobalParam(test.config),
+			rtc:         qemuRTC(test.config),
+		}
+
+		if !reflect.DeepEqual(settings, test.expected) {
+			t.Fatalf("Got %+v, expecting %+v", settings, test.expected)
+		}
+	}
+}
+
+func TestQemuBuildKernelParamsImageTransport(t *testing.T) {
+	for transport, root := range map[ImageTransport]string{
+		NVDIMMImage:      "root=/dev/pmem0p1 rootflags=dax,data=ordered,errors=remount-ro rw rootfstype=ext4",
+		VirtioBlockImage: "root=/dev/vda1 rootflags=data=ordered,errors=remount-ro rw rootfstype=ext4",
+		VirtioSCSIImage:  "root=/dev/sda1 rootflags=data=ordered,errors=remount-ro rw rootfstype=ext4",
+	} {
+		qemuConfig := newQemuConfig()
+		qemuConfig.ImageTransport = transport
+		q := &qemu{}
+
+		if err := q.buildKernelParams(qemuConfig); err != nil {
+			t.Fatal(err)
+		}
+
+		params := strings.Join(q.kernelParams, " ")
+		if !strings.HasPrefix(params, root+" tsc=reliable") {
+			t.Fatalf("Got %q with %s, expecting it to start with %q", params, transport, root)
+		}
+	}
+}
+
 func TestQemuInit(t *testing.T) {
 	qemuConfig := newQemuConfig()
 	q := &qemu{}
@@ -367,14 +549,16 @@ func TestQemuInit(t *testing.T) {
 
 func TestQemuSetCPUResources(t *testing.T) {
 	vcpus := 1
+	maxVCPUs := runtime.NumCPU()
 
 	q := &qemu{}
 
 	expectedOut := ciaoQemu.SMP{
 		CPUs:    uint32(vcpus),
-		Cores:   uint32(vcpus),
+		Cores:   uint32(maxVCPUs),
 		Sockets: uint32(1),
 		Threads: uint32(1),
+		MaxCPUs: uint32(maxVCPUs),
 	}
 
 	vmConfig := Resources{
@@ -418,6 +602,456 @@ func TestQemuSetMemoryResources(t *testing.T) {
 	}
 }
 
+func TestQemuMemorySize(t *testing.T) {
+	sizes := map[string]uint64{
+		"2G":   2 << 30,
+		"512M": 512 << 20,
+		"1024": 1024 << 20,
+		"64k":  64 << 10,
+	}
+
+	for size, expected := range sizes {
+		bytes, err := memorySize(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if bytes != expected {
+			t.Fatalf("Got %d bytes for %s, expecting %d", bytes, size, expected)
+		}
+	}
+
+	if _, err := memorySize("foo"); err == nil {
+		t.Fatal("Invalid memory size should fail")
+	}
+}
+
+func TestQemuStatsPod(t *testing.T) {
+	pid := os.Getpid()
+
+	s := startFakeQMPServer(t, map[string]string{
+		"query-cpus":           fmt.Sprintf(`[{"CPU": 0, "current": true, "thread_id": %d}]`, pid),
+		"query-balloon":        `{"actual": 1073741824}`,
+		"query-memory-devices": `[{"type": "dimm", "data": {"id": "dimm-0", "size": 536870912, "memdev": "/objects/mem-0"}}]`,
+		"query-blockstats":     `[{"device": "drive-0", "stats": {"rd_bytes": 4096, "wr_bytes": 8192, "rd_operations": 1, "wr_operations": 2}}]`,
+	})
+	defer s.stop()
+
+	q := &qemu{
+		qmpControlCh: qmpChannel{
+			path: s.path,
+		},
+		qemuConfig: ciaoQemu.Config{
+			Memory: ciaoQemu.Memory{
+				Size: "2G",
+			},
+		},
+	}
+
+	stats, err := q.statsPod(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stats.VCPUs) != 1 || stats.VCPUs[0].ThreadID != pid {
+		t.Fatalf("Unexpected vCPU statistics %+v", stats.VCPUs)
+	}
+
+	// The hot plugged DIMM memory can be ballooned too.
+	if stats.Memory.Used == 0 || stats.Memory.Ballooned != 3<<29 {
+		t.Fatalf("Unexpected memory statistics %+v", stats.Memory)
+	}
+
+	expectedBlock := []BlockStats{
+		{
+			Device:     "drive-0",
+			ReadBytes:  4096,
+			WriteBytes: 8192,
+			ReadOps:    1,
+			WriteOps:   2,
+		},
+	}
+
+	if reflect.DeepEqual(stats.Block, expectedBlock) == false {
+		t.Fatalf("Got %+v\nExpecting %+v", stats.Block, expectedBlock)
+	}
+}
+
+func TestQemuMonitorOutlivesLaunch(t *testing.T) {
+	s := startFakeQMPServer(t, map[string]string{
+		"quit": `{}`,
+	})
+	defer s.stop()
+
+	s.Lock()
+	s.noAsyncEvents = true
+	s.Unlock()
+
+	q := &qemu{
+		podID: "monitor-outlives-launch",
+		qmpMonitorCh: qmpChannel{
+			path: s.path,
+		},
+		qmpControlCh: qmpChannel{
+			path: s.path,
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	startCh := make(chan struct{})
+	q.monitorVM(ctx, startCh, make(chan struct{}))
+
+	select {
+	case <-startCh:
+	default:
+		t.Fatal("The QMP monitor should be connected")
+	}
+
+	// The launch is over.
+	cancel()
+
+	if err := q.qmpMonitorCh.ctx.Err(); err != nil {
+		t.Fatalf("The QMP monitor should outlive the launch: %s", err)
+	}
+
+	if err := q.stopPod(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if q.qmpMonitorCh.ctx.Err() == nil {
+		t.Fatal("Stopping the VM should stop the QMP monitor")
+	}
+}
+
+func TestQemuStatsPodNoBalloon(t *testing.T) {
+	s := startFakeQMPServer(t, map[string]string{
+		"query-cpus":       `[]`,
+		"query-blockstats": `[]`,
+	})
+	defer s.stop()
+
+	q := &qemu{
+		qmpControlCh: qmpChannel{
+			path: s.path,
+		},
+	}
+
+	stats, err := q.statsPod(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Memory.Ballooned != 0 {
+		t.Fatalf("Unexpected memory statistics %+v", stats.Memory)
+	}
+}
+
+const testHotpluggableCPUs = `[
+	{"type": "qemu64-x86_64-cpu", "vcpus-count": 1, "props": {"socket-id": 0, "core-id": 3, "thread-id": 0}},
+	{"type": "qemu64-x86_64-cpu", "vcpus-count": 1, "props": {"socket-id": 0, "core-id": 2, "thread-id": 0}},
+	{"type": "qemu64-x86_64-cpu", "vcpus-count": 1, "props": {"socket-id": 0, "core-id": 1, "thread-id": 0}, "qom-path": "/machine/peripheral/cpu-0-1-0"},
+	{"type": "qemu64-x86_64-cpu", "vcpus-count": 1, "props": {"socket-id": 0, "core-id": 0, "thread-id": 0}, "qom-path": "/machine/unattached/device[0]"}
+]`
+
+func testQemuResizePod(t *testing.T, replies map[string]string, resources Resources, expectedCommands []string, expectedPrevious Resources, success bool) {
+	s := startFakeQMPServer(t, replies)
+	defer s.stop()
+
+	s.setEvents(map[string]string{
+		"device_del": `{"event": "DEVICE_DELETED", "data": {"device": "dimm-0"}}`,
+	})
+
+	q := &qemu{
+		qmpControlCh: qmpChannel{
+			path: s.path,
+		},
+		qemuConfig: ciaoQemu.Config{
+			Memory: ciaoQemu.Memory{
+				Size: "1024M",
+			},
+		},
+	}
+
+	previous, err := q.resizePod(context.Background(), resources)
+	if success && err != nil {
+		t.Fatal(err)
+	} else if !success && err == nil {
+		t.Fatal("Resizing should fail")
+	}
+
+	if previous != expectedPrevious {
+		t.Fatalf("Got previous resources %+v, expecting %+v", previous, expectedPrevious)
+	}
+
+	// Skip qmp_capabilities.
+	commands := s.received()[1:]
+	if reflect.DeepEqual(commands, expectedCommands) == false {
+		t.Fatalf("Got %v\nExpecting %v", commands, expectedCommands)
+	}
+}
+
+var testQemuResizeReplies = map[string]string{
+	"query-hotpluggable-cpus": testHotpluggableCPUs,
+	"query-memory-devices":    `[{"type": "dimm", "data": {"id": "dimm-0", "size": 1073741824, "memdev": "/objects/mem-0"}}]`,
+	"device_add":              `{}`,
+	"device_del":              `{}`,
+	"object-add":              `{}`,
+	"object-del":              `{}`,
+}
+
+func TestQemuResizePodGrow(t *testing.T) {
+	expected := []string{
+		"query-hotpluggable-cpus", "device_add", "device_add",
+		"query-memory-devices", "object-add", "device_add",
+	}
+
+	testQemuResizePod(t, testQemuResizeReplies, Resources{VCPUs: 4, Memory: 3072}, expected, Resources{VCPUs: 2, Memory: 2048}, true)
+}
+
+func TestQemuResizePodShrink(t *testing.T) {
+	expected := []string{
+		"query-hotpluggable-cpus", "device_del",
+		"query-memory-devices", "device_del", "object-del",
+	}
+
+	testQemuResizePod(t, testQemuResizeReplies, Resources{VCPUs: 1, Memory: 1024}, expected, Resources{VCPUs: 2, Memory: 2048}, true)
+}
+
+func TestQemuResizePodUnchanged(t *testing.T) {
+	expected := []string{"query-hotpluggable-cpus", "query-memory-devices"}
+
+	testQemuResizePod(t, testQemuResizeReplies, Resources{VCPUs: 2, Memory: 2048}, expected, Resources{VCPUs: 2, Memory: 2048}, true)
+}
+
+func TestQemuResizePodFailingTooManyVCPUs(t *testing.T) {
+	expected := []string{"query-hotpluggable-cpus"}
+
+	testQemuResizePod(t, testQemuResizeReplies, Resources{VCPUs: 5}, expected, Resources{}, false)
+}
+
+func TestQemuResizePodFailingUnalignedMemory(t *testing.T) {
+	expected := []string{"query-memory-devices"}
+
+	testQemuResizePod(t, testQemuResizeReplies, Resources{Memory: 2100}, expected, Resources{}, false)
+}
+
+func TestQemuResizePodRollback(t *testing.T) {
+	replies := make(map[string]string)
+	for cmd, reply := range testQemuResizeReplies {
+		replies[cmd] = reply
+	}
+	delete(replies, "object-add")
+
+	// The vCPUs are unplugged once the memory hot plug failed.
+	expected := []string{
+		"query-hotpluggable-cpus", "device_add", "device_add",
+		"query-memory-devices", "object-add",
+		"device_del", "device_del",
+	}
+
+	testQemuResizePod(t, replies, Resources{VCPUs: 4, Memory: 3072}, expected, Resources{}, false)
+}
+
+var testQemuSaveReplies = map[string]string{
+	"query-hotpluggable-cpus": `[
+		{"type": "host-x86_64-cpu", "props": {"socket-id": 0, "core-id": 1, "thread-id": 0}, "qom-path": "/machine/peripheral/cpu-0-1-0"},
+		{"type": "host-x86_64-cpu", "props": {"socket-id": 0, "core-id": 0, "thread-id": 0}, "qom-path": "/machine/unattached/device[0]"}
+	]`,
+	"query-memory-devices": `[{"type": "dimm", "data": {"id": "dimm-0", "addr": 4294967296, "size": 1073741824, "memdev": "/objects/mem-0"}}]`,
+	"query-pci": `[{"bus": 0, "devices": [
+		{"bus": 0, "slot": 2, "function": 0, "qdev_id": ""},
+		{"bus": 0, "slot": 5, "function": 0, "qdev_id": "virtio-network-tap1"},
+		{"bus": 0, "slot": 6, "function": 0, "qdev_id": "virtio-network-tap3"}
+	]}]`,
+	"getfd":             `{}`,
+	"migrate_set_speed": `{}`,
+	"migrate":           `{}`,
+	"query-migrate":     `{"status": "completed"}`,
+}
+
+func TestQemuSaveVM(t *testing.T) {
+	s := startFakeQMPServer(t, testQemuSaveReplies)
+	defer s.stop()
+
+	q := &qemu{
+		qmpControlCh: qmpChannel{
+			path: s.path,
+		},
+	}
+
+	dir := filepath.Dir(s.path)
+	err := q.saveVM(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, checkpointVMStateFile)); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"qmp_capabilities", "query-hotpluggable-cpus", "query-memory-devices", "query-pci",
+		"getfd", "migrate_set_speed", "migrate", "query-migrate",
+	}
+	if commands := s.received(); reflect.DeepEqual(commands, expected) == false {
+		t.Fatalf("Got %v\nExpecting %v", commands, expected)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, checkpointVMDevicesFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var saved qemuSavedDevices
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(saved.CPUs) != 1 || len(saved.DIMMs) != 1 {
+		t.Fatalf("Unexpected saved vCPUs %+v and DIMMs %+v", saved.CPUs, saved.DIMMs)
+	}
+
+	expectedAddrs := map[string]string{"virtio-network-tap1": "5.0", "virtio-network-tap3": "6.0"}
+	if !reflect.DeepEqual(saved.PCIAddrs, expectedAddrs) {
+		t.Fatalf("Got PCI addresses %v, expecting %v", saved.PCIAddrs, expectedAddrs)
+	}
+}
+
+func TestQemuSaveVMFailing(t *testing.T) {
+	replies := make(map[string]string)
+	for cmd, reply := range testQemuSaveReplies {
+		replies[cmd] = reply
+	}
+	replies["query-migrate"] = `{"status": "failed", "error-desc": "migration is disabled"}`
+
+	s := startFakeQMPServer(t, replies)
+	defer s.stop()
+
+	q := &qemu{
+		qmpControlCh: qmpChannel{
+			path: s.path,
+		},
+	}
+
+	err := q.saveVM(context.Background(), filepath.Dir(s.path))
+	if err == nil {
+		t.Fatal("Failed migration should fail")
+	}
+}
+
+func TestQemuRestoreDevices(t *testing.T) {
+	pooledNIC := ciaoQemu.NetDevice{Type: ciaoQemu.TAP, ID: "network-0", IFName: "tap0", MACAddress: "02:00:00:00:00:01"}
+	bootNIC := ciaoQemu.NetDevice{Type: ciaoQemu.TAP, ID: "network-1", IFName: "tap2", MACAddress: "02:00:00:00:00:03"}
+	hotpluggedNIC := qemuNetDevice{ID: "network-tap1", IFName: "tap1", MACAddress: "02:00:00:00:00:02"}
+
+	var cpu qmpHotpluggableCPU
+	cpu.Type = "host-x86_64-cpu"
+	cpu.Props = map[string]interface{}{"socket-id": 0, "core-id": 1}
+	cpu.QOMPath = peripheralQOMPath + "cpu-0-1"
+
+	var dimm qmpMemoryDevice
+	dimm.Data.ID = "dimm-0"
+	dimm.Data.Addr = 1 << 32
+	dimm.Data.Size = 1 << 30
+	dimm.Data.Memdev = "/objects/mem-0"
+
+	saved := qemuSavedDevices{
+		CPUs:  []qmpHotpluggableCPU{cpu},
+		DIMMs: []qmpMemoryDevice{dimm},
+		PCIAddrs: map[string]string{
+			"virtio-network-0":    "3.0",
+			"virtio-network-tap1": "4.0",
+		},
+	}
+
+	devices := restoreDevices([]ciaoQemu.Device{pooledNIC, bootNIC, hotpluggedNIC}, saved)
+
+	pinnedNIC := qemuNetDevice{ID: "network-0", IFName: "tap0", MACAddress: "02:00:00:00:00:01", Addr: "3.0"}
+	hotpluggedNIC.Addr = "4.0"
+
+	expected := []ciaoQemu.Device{
+		pinnedNIC,
+		bootNIC,
+		hotpluggedNIC,
+		qemuCPUDevice{Driver: "host-x86_64-cpu", ID: "cpu-0-1", Props: cpu.Props},
+		qemuDIMMDevice{ID: "dimm-0", Memdev: "mem-0", Size: 1 << 30, Addr: 1 << 32},
+	}
+
+	if !reflect.DeepEqual(devices, expected) {
+		t.Fatalf("Got %+v\nExpecting %+v", devices, expected)
+	}
+
+	params := expected[3].QemuParams(nil)
+	expectedParams := []string{"-device", "host-x86_64-cpu,id=cpu-0-1,core-id=1,socket-id=0"}
+	if !reflect.DeepEqual(params, expectedParams) {
+		t.Fatalf("Got %v, expecting %v", params, expectedParams)
+	}
+
+	params = hotpluggedNIC.QemuParams(nil)
+	expectedParams = []string{
+		"-netdev", "tap,id=network-tap1,ifname=tap1,script=no,downscript=no",
+		"-device", "virtio-net-pci,id=virtio-network-tap1,netdev=network-tap1,mac=02:00:00:00:00:02,addr=4.0",
+	}
+	if !reflect.DeepEqual(params, expectedParams) {
+		t.Fatalf("Got %v, expecting %v", params, expectedParams)
+	}
+}
+
+func testQemuHotplug(t *testing.T, replies map[string]string, events map[string]string, devInfo interface{}, devType deviceType, remove bool, expectedCommands []string, success bool) {
+	s := startFakeQMPServer(t, replies)
+	defer s.stop()
+
+	s.setEvents(events)
+
+	q := &qemu{
+		qmpControlCh: qmpChannel{
+			path: s.path,
+		},
+	}
+
+	var err error
+	if remove {
+		err = q.hotplugRemoveDevice(context.Background(), devInfo, devType)
+	} else {
+		err = q.hotplugAddDevice(context.Background(), devInfo, devType)
+	}
+
+	if success && err != nil {
+		t.Fatal(err)
+	} else if !success && err == nil {
+		t.Fatal("Hot plugging should fail")
+	}
+
+	// Skip qmp_capabilities.
+	commands := s.received()[1:]
+	if reflect.DeepEqual(commands, expectedCommands) == false {
+		t.Fatalf("Got %v\nExpecting %v", commands, expectedCommands)
+	}
+}
+
+func TestQemuHotunplugNetDevice(t *testing.T) {
+	endpoint, err := createNetworkEndpoint(1, "test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replies := map[string]string{
+		"device_del": `{}`,
+		"netdev_del": `{}`,
+	}
+
+	events := map[string]string{
+		"device_del": `{"event": "DEVICE_DELETED", "data": {"device": "virtio-network-tap1"}}`,
+	}
+
+	testQemuHotplug(t, replies, events, endpoint, netDev, true, []string{"device_del", "netdev_del"}, true)
+}
+
+func TestQemuHotplugFailingDeviceType(t *testing.T) {
+	testQemuHotplug(t, map[string]string{}, nil, Socket{}, serialPortDev, false, []string{}, false)
+}
+
 func testQemuAddDevice(t *testing.T, devInfo interface{}, devType deviceType, expected []ciaoQemu.Device) {
 	q := &qemu{}
 
@@ -454,6 +1088,28 @@ func TestQemuAddDeviceFsDev(t *testing.T) {
 	testQemuAddDevice(t, volume, fsDev, expectedOut)
 }
 
+func TestQemuAddDeviceBlockDev(t *testing.T) {
+	drive := rootfsDrive{
+		ContainerID: "100",
+		HostPath:    "/dev/dm-1",
+		Device:      "vdb",
+		Fstype:      "ext4",
+	}
+
+	expectedOut := []ciaoQemu.Device{
+		ciaoQemu.BlockDevice{
+			Driver:    ciaoQemu.VirtioBlock,
+			ID:        "drive-vdb",
+			File:      drive.HostPath,
+			Interface: ciaoQemu.NoInterface,
+			AIO:       ciaoQemu.Threads,
+			Format:    qemuRawFormat,
+		},
+	}
+
+	testQemuAddDevice(t, drive, blockDev, expectedOut)
+}
+
 func TestQemuAddDeviceSerialPordDev(t *testing.T) {
 	deviceID := "channelTest"
 	id := "charchTest"
@@ -0,0 +1,287 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// qmpClient runs the commands we send on the QMP control socket. The ciao
+// QMP client only runs a fixed set of commands and cannot pass any file
+// descriptor to QEMU, so the QMP protocol is spoken here. The client
+// negotiates the QMP capabilities on connection, records the commands
+// metrics, and keeps the asynchronous events for waitEvent() to find them.
+type qmpClient struct {
+	conn *net.UnixConn
+
+	// cmdLock serializes the commands, QMP runs them one at a time.
+	cmdLock sync.Mutex
+	lastID  uint64
+
+	// disconnectCh is closed once the connection is lost or closed.
+	disconnectCh chan struct{}
+
+	sync.Mutex
+
+	// pendingCh receives the response to the running command, whose ID
+	// is pendingID. It is nil when no command is running.
+	pendingID uint64
+	pendingCh chan qmpMessage
+
+	events []qmpEvent
+
+	// eventNotify is signalled each time an event is buffered.
+	eventNotify chan struct{}
+}
+
+// qmpCommand is a QMP command. QEMU copies its ID into the response.
+type qmpCommand struct {
+	Execute   string                 `json:"execute"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+	ID        uint64                 `json:"id"`
+}
+
+type qmpError struct {
+	Class string `json:"class"`
+	Desc  string `json:"desc"`
+}
+
+// qmpMessage is any message QEMU sends on a QMP socket: the greeting, a
+// command response or an asynchronous event.
+type qmpMessage struct {
+	QMP    json.RawMessage        `json:"QMP"`
+	ID     *uint64                `json:"id"`
+	Return json.RawMessage        `json:"return"`
+	Error  *qmpError              `json:"error"`
+	Event  string                 `json:"event"`
+	Data   map[string]interface{} `json:"data"`
+}
+
+type qmpEvent struct {
+	Name string
+	Data map[string]interface{}
+}
+
+// qmpConnect connects to a QMP socket and negotiates the QMP capabilities.
+// The caller is responsible for closing the returned client.
+func qmpConnect(ctx context.Context, podID, socketPath string) (*qmpClient, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", socketPath)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		return nil, err
+	}
+
+	q := &qmpClient{
+		conn:         conn.(*net.UnixConn),
+		disconnectCh: make(chan struct{}),
+		eventNotify:  make(chan struct{}, 1),
+	}
+
+	decoder := json.NewDecoder(conn)
+
+	greetingCh := make(chan error, 1)
+	go func() {
+		var greeting qmpMessage
+		err := decoder.Decode(&greeting)
+		if err == nil && greeting.QMP == nil {
+			err = fmt.Errorf("Unexpected QMP greeting")
+		}
+
+		greetingCh <- err
+	}()
+
+	select {
+	case err := <-greetingCh:
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("Could not read pod %s QMP greeting: %v", podID, err)
+		}
+	case <-ctx.Done():
+		conn.Close()
+		<-greetingCh
+		return nil, ctx.Err()
+	}
+
+	go q.readMessages(decoder)
+
+	err = q.execute(ctx, "qmp_capabilities", nil, nil)
+	if err != nil {
+		q.close()
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// readMessages reads the messages QEMU sends, until the connection is closed.
+// Responses are handed over to the running command, and events are buffered.
+func (q *qmpClient) readMessages(decoder *json.Decoder) {
+	defer close(q.disconnectCh)
+
+	for {
+		var msg qmpMessage
+		if err := decoder.Decode(&msg); err != nil {
+			return
+		}
+
+		q.Lock()
+
+		if msg.Event != "" {
+			q.events = append(q.events, qmpEvent{Name: msg.Event, Data: msg.Data})
+
+			select {
+			case q.eventNotify <- struct{}{}:
+			default:
+			}
+		} else if q.pendingCh != nil && (msg.ID == nil || *msg.ID == q.pendingID) {
+			// QEMU can only answer without the command ID when
+			// the command could not be parsed. Responses to the
+			// commands given up on are dropped.
+			q.pendingCh <- msg
+			q.pendingCh = nil
+		}
+
+		q.Unlock()
+	}
+}
+
+// execute runs a QMP command and decodes its return value into result,
+// unless result is nil.
+func (q *qmpClient) execute(ctx context.Context, command string, args map[string]interface{}, result interface{}) error {
+	return q.run(ctx, command, args, result, nil)
+}
+
+// getFD passes file to QEMU, under the name fdName.
+func (q *qmpClient) getFD(ctx context.Context, fdName string, file *os.File) error {
+	return q.run(ctx, "getfd", map[string]interface{}{"fdname": fdName}, nil, file)
+}
+
+// run sends a QMP command, along with the file descriptor of file if it is
+// not nil, and waits for its response. It records the command metrics.
+func (q *qmpClient) run(ctx context.Context, command string, args map[string]interface{}, result interface{}, file *os.File) (err error) {
+	begin := time.Now()
+	defer func() { observeQMPCommand(command, begin, err) }()
+
+	q.cmdLock.Lock()
+	defer q.cmdLock.Unlock()
+
+	q.lastID++
+	data, err := json.Marshal(qmpCommand{
+		Execute:   command,
+		Arguments: args,
+		ID:        q.lastID,
+	})
+	if err != nil {
+		return err
+	}
+
+	responseCh := make(chan qmpMessage, 1)
+
+	q.Lock()
+	q.pendingID = q.lastID
+	q.pendingCh = responseCh
+	q.Unlock()
+
+	defer func() {
+		q.Lock()
+		if q.pendingCh == responseCh {
+			q.pendingCh = nil
+		}
+		q.Unlock()
+	}()
+
+	var rights []byte
+	if file != nil {
+		rights = syscall.UnixRights(int(file.Fd()))
+	}
+
+	if _, _, err := q.conn.WriteMsgUnix(data, rights, nil); err != nil {
+		return err
+	}
+
+	select {
+	case msg := <-responseCh:
+		return qmpResult(command, msg, result)
+	case <-q.disconnectCh:
+		// QEMU closes the connection right after answering some
+		// commands, e.g. quit.
+		select {
+		case msg := <-responseCh:
+			return qmpResult(command, msg, result)
+		default:
+		}
+
+		return fmt.Errorf("QMP connection closed while running %s", command)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// qmpResult checks the response to a QMP command, and decodes its return
+// value into result, unless result is nil.
+func qmpResult(command string, msg qmpMessage, result interface{}) error {
+	if msg.Error != nil {
+		return fmt.Errorf("QMP command %s failed: %s", command, msg.Error.Desc)
+	}
+
+	if result == nil || len(msg.Return) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(msg.Return, result)
+}
+
+// waitEvent waits for an asynchronous event named name, and for which match
+// returns true when given the event data. A nil match accepts any data.
+func (q *qmpClient) waitEvent(ctx context.Context, name string, match func(data map[string]interface{}) bool) error {
+	for {
+		q.Lock()
+		for i, event := range q.events {
+			if event.Name == name && (match == nil || match(event.Data)) {
+				q.events = append(q.events[:i], q.events[i+1:]...)
+				q.Unlock()
+				return nil
+			}
+		}
+		q.Unlock()
+
+		select {
+		case <-q.eventNotify:
+		case <-q.disconnectCh:
+			return fmt.Errorf("QMP connection closed while waiting for %s", name)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// close closes the connection, and waits for the messages reader to return.
+func (q *qmpClient) close() {
+	q.conn.Close()
+	<-q.disconnectCh
+}
@@ -0,0 +1,421 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type fakeQMPCommand struct {
+	Execute string          `json:"execute"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type fakeQMPError struct {
+	Class string `json:"class"`
+	Desc  string `json:"desc"`
+}
+
+// fakeQMPServer is a QMP server replying to the commands it receives with
+// canned return values. Commands without any canned value fail. Canned
+// events are sent after the reply to their command. As QEMU, it copies the
+// commands ID into their reply.
+type fakeQMPServer struct {
+	sync.Mutex
+	listener net.Listener
+	path     string
+	replies  map[string]string
+	events   map[string]string
+	delays   map[string]time.Duration
+	commands []string
+
+	// noAsyncEvents stops the server from sending an event before each
+	// reply, as QEMU does not before the capabilities are negotiated.
+	noAsyncEvents bool
+}
+
+func startFakeQMPServer(t *testing.T, replies map[string]string) *fakeQMPServer {
+	dir, err := ioutil.TempDir("", "qmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "qmp.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	s := &fakeQMPServer{
+		listener: l,
+		path:     path,
+		replies:  replies,
+	}
+
+	go s.serve()
+
+	return s
+}
+
+func (s *fakeQMPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeQMPServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	encoder := json.NewEncoder(conn)
+	decoder := json.NewDecoder(conn)
+
+	encoder.Encode(map[string]interface{}{
+		"QMP": map[string]interface{}{},
+	})
+
+	for {
+		var cmd fakeQMPCommand
+		if err := decoder.Decode(&cmd); err != nil {
+			return
+		}
+
+		s.Lock()
+		s.commands = append(s.commands, cmd.Execute)
+		reply, ok := s.replies[cmd.Execute]
+		event, hasEvent := s.events[cmd.Execute]
+		delay := s.delays[cmd.Execute]
+		noAsyncEvents := s.noAsyncEvents
+		s.Unlock()
+
+		time.Sleep(delay)
+
+		// Make sure the client copes with asynchronous events.
+		if !noAsyncEvents {
+			encoder.Encode(map[string]interface{}{
+				"event": "RTC_CHANGE",
+			})
+		}
+
+		id := "null"
+		if cmd.ID != nil {
+			id = string(cmd.ID)
+		}
+
+		switch {
+		case cmd.Execute == "qmp_capabilities":
+			fmt.Fprintf(conn, "{\"return\": {}, \"id\": %s}\n", id)
+		case ok:
+			fmt.Fprintf(conn, "{\"return\": %s, \"id\": %s}\n", reply, id)
+		default:
+			encoder.Encode(map[string]interface{}{
+				"error": fakeQMPError{
+					Class: "CommandNotFound",
+					Desc:  fmt.Sprintf("The command %s has not been found", cmd.Execute),
+				},
+				"id": cmd.ID,
+			})
+		}
+
+		if hasEvent {
+			fmt.Fprintf(conn, "%s\n", event)
+		}
+	}
+}
+
+func (s *fakeQMPServer) setEvents(events map[string]string) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.events = events
+}
+
+func (s *fakeQMPServer) received() []string {
+	s.Lock()
+	defer s.Unlock()
+
+	return append([]string{}, s.commands...)
+}
+
+func (s *fakeQMPServer) stop() {
+	s.listener.Close()
+	os.RemoveAll(filepath.Dir(s.path))
+}
+
+func TestQMPExecute(t *testing.T) {
+	s := startFakeQMPServer(t, map[string]string{
+		"query-status": `{"running": true, "status": "running"}`,
+	})
+	defer s.stop()
+
+	q, err := qmpConnect(context.Background(), testPodID, s.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.close()
+
+	var status struct {
+		Running bool   `json:"running"`
+		Status  string `json:"status"`
+	}
+
+	err = q.execute(context.Background(), "query-status", nil, &status)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !status.Running || status.Status != "running" {
+		t.Fatalf("Unexpected status %+v", status)
+	}
+
+	commands := s.received()
+	if len(commands) != 2 || commands[0] != "qmp_capabilities" {
+		t.Fatalf("Unexpected commands %v", commands)
+	}
+}
+
+func TestQMPWaitEvent(t *testing.T) {
+	s := startFakeQMPServer(t, map[string]string{
+		"device_del": `{}`,
+	})
+	defer s.stop()
+
+	s.setEvents(map[string]string{
+		"device_del": `{"event": "DEVICE_DELETED", "data": {"device": "dimm-0"}}`,
+	})
+
+	q, err := qmpConnect(context.Background(), testPodID, s.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.close()
+
+	err = q.execute(context.Background(), "device_del", map[string]interface{}{"id": "dimm-0"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = q.waitEvent(context.Background(), "DEVICE_DELETED", func(data map[string]interface{}) bool {
+		return data["device"] == "dimm-0"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The buffered RTC_CHANGE events can be waited for too.
+	err = q.waitEvent(context.Background(), "RTC_CHANGE", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQMPExecuteFailure(t *testing.T) {
+	s := startFakeQMPServer(t, nil)
+	defer s.stop()
+
+	q, err := qmpConnect(context.Background(), testPodID, s.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.close()
+
+	err = q.execute(context.Background(), "query-status", nil, nil)
+	if err == nil {
+		t.Fatal("Unknown command should fail")
+	}
+}
+
+func TestQMPConnectFailure(t *testing.T) {
+	_, err := qmpConnect(context.Background(), testPodID, "/tmp/no/such/qmp.sock")
+	if err == nil {
+		t.Fatal("Connecting to a non existing socket should fail")
+	}
+}
+
+func TestQMPExecuteCanceled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// This server never sends the QMP greeting.
+	path := filepath.Join(dir, "qmp.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err = qmpConnect(ctx, testPodID, path)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Got %v, expecting %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestQMPGetFD(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "qmp.sock")
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// The fake server does not read the file descriptors, this server
+	// only expects qmp_capabilities and getfd.
+	fdCh := make(chan int, 1)
+	go func() {
+		defer close(fdCh)
+
+		conn, err := l.AcceptUnix()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		fmt.Fprintf(conn, "{\"QMP\": {}}\n")
+
+		for i := 0; i < 2; i++ {
+			buf := make([]byte, 4096)
+			oob := make([]byte, syscall.CmsgSpace(4))
+
+			n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+			if err != nil {
+				return
+			}
+
+			var cmd fakeQMPCommand
+			if err := json.Unmarshal(buf[:n], &cmd); err != nil {
+				return
+			}
+
+			if cmd.Execute == "getfd" {
+				msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+				if err != nil || len(msgs) != 1 {
+					return
+				}
+
+				fds, err := syscall.ParseUnixRights(&msgs[0])
+				if err != nil || len(fds) != 1 {
+					return
+				}
+
+				fdCh <- fds[0]
+			}
+
+			fmt.Fprintf(conn, "{\"return\": {}, \"id\": %s}\n", cmd.ID)
+		}
+	}()
+
+	q, err := qmpConnect(context.Background(), testPodID, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.close()
+
+	f, err := ioutil.TempFile(dir, "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := q.getFD(context.Background(), "state", f); err != nil {
+		t.Fatal(err)
+	}
+
+	fd, ok := <-fdCh
+	if !ok {
+		t.Fatal("No file descriptor was received")
+	}
+
+	received := os.NewFile(uintptr(fd), "received")
+	defer received.Close()
+
+	// Both descriptors refer to the same file.
+	if _, err := received.WriteString("state"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "state" {
+		t.Fatalf("Got %q, expecting %q", data, "state")
+	}
+}
+
+func TestQMPStaleResponse(t *testing.T) {
+	s := startFakeQMPServer(t, map[string]string{
+		"query-status": `{"running": true, "status": "running"}`,
+	})
+	defer s.stop()
+
+	q, err := qmpConnect(context.Background(), testPodID, s.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.close()
+
+	s.Lock()
+	s.delays = map[string]time.Duration{"query-status": 200 * time.Millisecond}
+	s.Unlock()
+
+	// The response to a command given up on must not be taken for the
+	// response to the next one.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	var status map[string]interface{}
+	if err := q.execute(ctx, "query-status", nil, &status); err != context.DeadlineExceeded {
+		t.Fatalf("Got %v, expecting %v", err, context.DeadlineExceeded)
+	}
+
+	var kvm struct {
+		Enabled bool `json:"enabled"`
+	}
+
+	err = q.execute(context.Background(), "query-kvm", nil, &kvm)
+	if err == nil {
+		t.Fatal("Unknown command should fail")
+	}
+}
@@ -0,0 +1,72 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+// undoAction is a named action reverting one completed step.
+type undoAction struct {
+	name string
+	undo func() error
+}
+
+// rollback tracks the undo actions registered by the completed steps of a
+// multi step operation. If the operation fails before commit() is called,
+// run() unwinds those steps in reverse order.
+//
+// The usual pattern is:
+//
+//	rb := &rollback{}
+//	defer rb.run()
+//	...
+//	rb.add("step", undoStep)
+//	...
+//	rb.commit()
+type rollback struct {
+	actions   []undoAction
+	committed bool
+}
+
+// add registers the undo action of a step that just completed.
+func (rb *rollback) add(name string, undo func() error) {
+	rb.actions = append(rb.actions, undoAction{
+		name: name,
+		undo: undo,
+	})
+}
+
+// commit marks the operation as successful, turning run() into a no-op.
+func (rb *rollback) commit() {
+	rb.committed = true
+}
+
+// run calls all the registered undo actions, the most recent first.
+// A failing undo action is logged and does not prevent the remaining ones
+// from running, as we want to release as much as we can.
+func (rb *rollback) run() {
+	if rb.committed {
+		return
+	}
+
+	for i := len(rb.actions) - 1; i >= 0; i-- {
+		action := rb.actions[i]
+
+		if err := action.undo(); err != nil {
+			subsystemLogger("rollback").WithFields(Fields{OperationField: action.name}).Errorf("Could not roll back: %s", err)
+		}
+	}
+
+	rb.actions = nil
+}
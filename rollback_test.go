@@ -0,0 +1,96 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestRollbackRunReverseOrder(t *testing.T) {
+	var order []string
+
+	rb := &rollback{}
+	for _, name := range []string{"first", "second", "third"} {
+		step := name
+		rb.add(step, func() error {
+			order = append(order, step)
+			return nil
+		})
+	}
+
+	rb.run()
+
+	expected := []string{"third", "second", "first"}
+	if reflect.DeepEqual(order, expected) == false {
+		t.Fatalf("Got %v, expecting %v", order, expected)
+	}
+}
+
+func TestRollbackRunContinuesOnError(t *testing.T) {
+	firstUndone := false
+
+	rb := &rollback{}
+	rb.add("first", func() error {
+		firstUndone = true
+		return nil
+	})
+	rb.add("second", func() error {
+		return fmt.Errorf("Undo failure")
+	})
+
+	rb.run()
+
+	if firstUndone == false {
+		t.Fatal("First step should have been undone")
+	}
+}
+
+func TestRollbackRunOnce(t *testing.T) {
+	count := 0
+
+	rb := &rollback{}
+	rb.add("step", func() error {
+		count++
+		return nil
+	})
+
+	rb.run()
+	rb.run()
+
+	if count != 1 {
+		t.Fatalf("Undo action called %d times, expecting 1", count)
+	}
+}
+
+func TestRollbackCommit(t *testing.T) {
+	undone := false
+
+	rb := &rollback{}
+	rb.add("step", func() error {
+		undone = true
+		return nil
+	})
+
+	rb.commit()
+	rb.run()
+
+	if undone == true {
+		t.Fatal("Committed rollback should not undo anything")
+	}
+}
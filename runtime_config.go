@@ -0,0 +1,136 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// The hyperstart sockets file names, relative to RuntimeConfig.SocketDir.
+const (
+	hyperCtlSockTemplate = "hyper-pod-%s.sock"
+	hyperTtySockTemplate = "tty-pod%s.sock"
+)
+
+// RuntimeConfig is the runtime-wide virtcontainers configuration, setting
+// the host directories all the pods resources live under. virtcontainers
+// instances using different directories can share a host without seeing
+// each other pods, VM pools or network namespaces.
+type RuntimeConfig struct {
+	// Root is the directory all the paths left empty are set under.
+	// The default paths are used if Root is empty too.
+	Root string
+
+	// ConfigStoragePath is the pods configuration directory.
+	ConfigStoragePath string
+
+	// RunStoragePath is the pods runtime directory, holding their states,
+	// lock files and VM sockets. The VM pools and the network namespaces
+	// we created are tracked next to it.
+	RunStoragePath string
+
+	// SharedDir is the directory the hyperstart pods share with their VM.
+	SharedDir string
+
+	// SocketDir is the directory holding the hyperstart sockets.
+	SocketDir string
+
+	// ConsoleLogDir is the directory the VM consoles are logged under. The
+	// logs are kept after their pod is deleted.
+	ConsoleLogDir string
+}
+
+// defaultRuntimeConfig is the configuration used when SetRuntimeConfig has
+// not been called, or with an empty configuration.
+var defaultRuntimeConfig = RuntimeConfig{
+	ConfigStoragePath: filepath.Join("/var/lib", storagePathSuffix),
+	RunStoragePath:    filepath.Join("/run", storagePathSuffix),
+	SharedDir:         "/tmp/hyper/shared/pods/",
+	SocketDir:         "/tmp",
+	ConsoleLogDir:     "/var/log/virtcontainers/consoles",
+}
+
+// withDefaults returns config with its empty paths set, under config.Root
+// or to their default value.
+func (config RuntimeConfig) withDefaults() RuntimeConfig {
+	defaults := defaultRuntimeConfig
+	if config.Root != "" {
+		defaults = RuntimeConfig{
+			ConfigStoragePath: filepath.Join(config.Root, "config"),
+			RunStoragePath:    filepath.Join(config.Root, "run"),
+			SharedDir:         filepath.Join(config.Root, "shared"),
+			SocketDir:         filepath.Join(config.Root, "sockets"),
+			ConsoleLogDir:     filepath.Join(config.Root, "consoles"),
+		}
+	}
+
+	if config.ConfigStoragePath == "" {
+		config.ConfigStoragePath = defaults.ConfigStoragePath
+	}
+
+	if config.RunStoragePath == "" {
+		config.RunStoragePath = defaults.RunStoragePath
+	}
+
+	if config.SharedDir == "" {
+		config.SharedDir = defaults.SharedDir
+	}
+
+	if config.SocketDir == "" {
+		config.SocketDir = defaults.SocketDir
+	}
+
+	if config.ConsoleLogDir == "" {
+		config.ConsoleLogDir = defaults.ConsoleLogDir
+	}
+
+	return config
+}
+
+func (config RuntimeConfig) validate() error {
+	for _, path := range []string{config.Root, config.ConfigStoragePath,
+		config.RunStoragePath, config.SharedDir, config.SocketDir, config.ConsoleLogDir} {
+		if path != "" && !filepath.IsAbs(path) {
+			return fmt.Errorf("Runtime path %s is not absolute", path)
+		}
+	}
+
+	return nil
+}
+
+// SetRuntimeConfig sets the host directories used by all the API calls.
+// It must be called before any other API call, and all the processes
+// sharing pods must use the same configuration.
+func SetRuntimeConfig(config RuntimeConfig) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+
+	config = config.withDefaults()
+
+	configStoragePath = config.ConfigStoragePath
+	runStoragePath = config.RunStoragePath
+	defaultSharedDir = config.SharedDir
+	defaultSockPathTemplates = []string{
+		filepath.Join(config.SocketDir, hyperCtlSockTemplate),
+		filepath.Join(config.SocketDir, hyperTtySockTemplate),
+	}
+	consoleLogDir = config.ConsoleLogDir
+
+	return nil
+}
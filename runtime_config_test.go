@@ -0,0 +1,117 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// saveRuntimeConfig returns a function restoring the current runtime
+// configuration.
+func saveRuntimeConfig() func() {
+	savedConfigStoragePath := configStoragePath
+	savedRunStoragePath := runStoragePath
+	savedSharedDir := defaultSharedDir
+	savedSockTemplates := defaultSockPathTemplates
+	savedConsoleLogDir := consoleLogDir
+
+	return func() {
+		configStoragePath = savedConfigStoragePath
+		runStoragePath = savedRunStoragePath
+		defaultSharedDir = savedSharedDir
+		defaultSockPathTemplates = savedSockTemplates
+		consoleLogDir = savedConsoleLogDir
+	}
+}
+
+func TestRuntimeConfigWithDefaults(t *testing.T) {
+	if config := (RuntimeConfig{}).withDefaults(); !reflect.DeepEqual(config, defaultRuntimeConfig) {
+		t.Fatalf("Got %+v, expecting %+v", config, defaultRuntimeConfig)
+	}
+
+	config := RuntimeConfig{
+		Root:      "/tmp/tenant",
+		SharedDir: "/tmp/shared",
+	}.withDefaults()
+
+	expected := RuntimeConfig{
+		Root:              "/tmp/tenant",
+		ConfigStoragePath: "/tmp/tenant/config",
+		RunStoragePath:    "/tmp/tenant/run",
+		SharedDir:         "/tmp/shared",
+		SocketDir:         "/tmp/tenant/sockets",
+		ConsoleLogDir:     "/tmp/tenant/consoles",
+	}
+
+	if !reflect.DeepEqual(config, expected) {
+		t.Fatalf("Got %+v, expecting %+v", config, expected)
+	}
+}
+
+func TestSetRuntimeConfigFailingRelativePath(t *testing.T) {
+	defer saveRuntimeConfig()()
+
+	if err := SetRuntimeConfig(RuntimeConfig{Root: "tenant"}); err == nil {
+		t.Fatal("A relative runtime path should be rejected")
+	}
+}
+
+func TestSetRuntimeConfigIsolation(t *testing.T) {
+	defer saveRuntimeConfig()()
+
+	var pods []*Pod
+	for _, tenant := range []string{"tenant1", "tenant2"} {
+		root, err := ioutil.TempDir(testDir, tenant)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(root)
+
+		if err := SetRuntimeConfig(RuntimeConfig{Root: root}); err != nil {
+			t.Fatal(err)
+		}
+
+		if defaultSockPathTemplates[0] != filepath.Join(root, "sockets", hyperCtlSockTemplate) {
+			t.Fatalf("Unexpected hyperstart sockets %v", defaultSockPathTemplates)
+		}
+
+		p, err := CreatePod(newTestPodConfigNoop())
+		if p == nil || err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := os.Stat(filepath.Join(root, "config", p.id)); err != nil {
+			t.Fatal(err)
+		}
+
+		pods = append(pods, p)
+	}
+
+	// Only the second tenant pod is visible from its configuration.
+	podStatusList, err := ListPod()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(podStatusList) != 1 || podStatusList[0].ID != pods[1].id {
+		t.Fatalf("Unexpected pods list %+v", podStatusList)
+	}
+}
@@ -0,0 +1,97 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// schemaMigration upgrades a stored document of the resource type from one
+// schema version to the next one. Migrations get every stored document, and
+// must return the ones they do not apply to untouched. Pod and container
+// configurations are both configFileType documents.
+type schemaMigration func(resource podResource, data json.RawMessage) (json.RawMessage, error)
+
+// schemaMigrations upgrade the stored documents, schemaMigrations[i]
+// upgrading a version i document to version i+1. A structure change
+// breaking the documents already stored, e.g. a renamed or retyped field,
+// must come with a new migration.
+var schemaMigrations = []schemaMigration{
+	// Version 0 documents are the bare structures stored before the
+	// documents got versioned. Only the envelope changed.
+	func(resource podResource, data json.RawMessage) (json.RawMessage, error) {
+		return data, nil
+	},
+}
+
+// currentSchemaVersion is the schema version of the documents we store.
+var currentSchemaVersion = len(schemaMigrations)
+
+// document is the envelope of all stored resources.
+type document struct {
+	SchemaVersion *int            `json:"schemaVersion"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// encodeDocument marshals data into a document of the current schema
+// version.
+func encodeDocument(data interface{}) ([]byte, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("Could not marshall data: %s", err)
+	}
+
+	version := currentSchemaVersion
+
+	return json.Marshal(document{
+		SchemaVersion: &version,
+		Data:          raw,
+	})
+}
+
+// decodeDocument upgrades a stored document of the resource type to the
+// current schema version if needed, and unmarshals it into data.
+func decodeDocument(raw []byte, resource podResource, data interface{}) error {
+	var doc document
+
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return err
+	}
+
+	version := 0
+	if doc.SchemaVersion != nil {
+		version = *doc.SchemaVersion
+	} else {
+		doc.Data = raw
+	}
+
+	if version < 0 || version > currentSchemaVersion {
+		return fmt.Errorf("Unsupported schema version %d, expecting at most %d", version, currentSchemaVersion)
+	}
+
+	for ; version < currentSchemaVersion; version++ {
+		migrated, err := schemaMigrations[version](resource, doc.Data)
+		if err != nil {
+			return fmt.Errorf("Could not migrate document from schema version %d: %s", version, err)
+		}
+
+		doc.Data = migrated
+	}
+
+	return json.Unmarshal(doc.Data, data)
+}
@@ -0,0 +1,149 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestEncodeDecodeDocument(t *testing.T) {
+	state := State{State: StateRunning}
+
+	raw, err := encodeDocument(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := State{}
+	if err := decodeDocument(raw, stateFileType, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded != state {
+		t.Fatalf("Got %+v, expecting %+v", decoded, state)
+	}
+}
+
+func TestDecodeDocumentUnversioned(t *testing.T) {
+	decoded := State{}
+	if err := decodeDocument([]byte(`{"state":"running"}`), stateFileType, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded.State != StateRunning {
+		t.Fatalf("Got %+v, expecting a running state", decoded)
+	}
+}
+
+func TestDecodeDocumentFailingNewerVersion(t *testing.T) {
+	raw := fmt.Sprintf(`{"schemaVersion":%d,"data":{"state":"running"}}`, currentSchemaVersion+1)
+
+	decoded := State{}
+	if err := decodeDocument([]byte(raw), stateFileType, &decoded); err == nil {
+		t.Fatal("Documents from a newer schema version should not be decoded")
+	}
+}
+
+func TestDecodeDocumentMigrations(t *testing.T) {
+	savedMigrations := schemaMigrations
+	savedVersion := currentSchemaVersion
+	defer func() {
+		schemaMigrations = savedMigrations
+		currentSchemaVersion = savedVersion
+	}()
+
+	// Pretend the state field used to be named "status".
+	schemaMigrations = append(schemaMigrations, func(resource podResource, data json.RawMessage) (json.RawMessage, error) {
+		return bytes.Replace(data, []byte(`"status"`), []byte(`"state"`), 1), nil
+	})
+	currentSchemaVersion = len(schemaMigrations)
+
+	for _, raw := range []string{
+		`{"status":"paused"}`,
+		`{"schemaVersion":1,"data":{"status":"paused"}}`,
+	} {
+		decoded := State{}
+		if err := decodeDocument([]byte(raw), stateFileType, &decoded); err != nil {
+			t.Fatal(err)
+		}
+
+		expected := State{State: StatePaused}
+		if !reflect.DeepEqual(decoded, expected) {
+			t.Fatalf("Got %+v from %s, expecting %+v", decoded, raw, expected)
+		}
+	}
+}
+
+func TestDecodeDocumentMigrationsByResource(t *testing.T) {
+	savedMigrations := schemaMigrations
+	savedVersion := currentSchemaVersion
+	defer func() {
+		schemaMigrations = savedMigrations
+		currentSchemaVersion = savedVersion
+	}()
+
+	// Pretend network namespaces used to hold a single endpoint, and
+	// that the migration turns it into a list of endpoints.
+	schemaMigrations = append(schemaMigrations, func(resource podResource, data json.RawMessage) (json.RawMessage, error) {
+		if resource != networkFileType {
+			return data, nil
+		}
+
+		var old map[string]json.RawMessage
+		if err := json.Unmarshal(data, &old); err != nil {
+			return nil, err
+		}
+
+		if endpoint, ok := old["Endpoint"]; ok {
+			old["Endpoints"] = json.RawMessage(fmt.Sprintf("[%s]", endpoint))
+			delete(old, "Endpoint")
+		}
+
+		return json.Marshal(old)
+	})
+	currentSchemaVersion = len(schemaMigrations)
+
+	raw := `{"schemaVersion":1,"data":{"NetNsPath":"/var/run/netns/test","Endpoint":{"NetPair":{"ID":"uniqueTestID"}}}}`
+
+	networkNS := NetworkNamespace{}
+	if err := decodeDocument([]byte(raw), networkFileType, &networkNS); err != nil {
+		t.Fatal(err)
+	}
+
+	if networkNS.NetNsPath != "/var/run/netns/test" || len(networkNS.Endpoints) != 1 || networkNS.Endpoints[0].NetPair.ID != "uniqueTestID" {
+		t.Fatalf("Unexpected migrated network namespace %+v", networkNS)
+	}
+
+	// Other resources are left untouched, and a corrupted network
+	// namespace makes the migration fail.
+	state := State{}
+	if err := decodeDocument([]byte(`{"schemaVersion":1,"data":{"state":"running"}}`), stateFileType, &state); err != nil {
+		t.Fatal(err)
+	}
+
+	if state.State != StateRunning {
+		t.Fatalf("Got %+v, expecting a running state", state)
+	}
+
+	if err := decodeDocument([]byte(`{"schemaVersion":1,"data":"invalid"}`), networkFileType, &networkNS); err == nil {
+		t.Fatal("Migrating an invalid network namespace should fail")
+	}
+}
@@ -17,6 +17,7 @@
 package virtcontainers
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"strings"
@@ -26,6 +27,13 @@ import (
 	"golang.org/x/crypto/ssh"
 )
 
+// sshdDialRetries and sshdDialInterval bound the time spent waiting for
+// the sshd server to come up when no deadline is set on the context.
+const (
+	sshdDialRetries  = 1000
+	sshdDialInterval = 100 * time.Millisecond
+)
+
 // SshdConfig is a structure storing information needed for
 // sshd agent initialization.
 type SshdConfig struct {
@@ -90,7 +98,7 @@ func (s *sshd) init(pod *Pod, config interface{}) error {
 }
 
 // start is the agent starting implementation for sshd.
-func (s *sshd) start(pod *Pod) error {
+func (s *sshd) start(ctx context.Context, pod *Pod) error {
 	if s.client != nil {
 		session, err := s.client.NewSession()
 		if err == nil {
@@ -110,15 +118,17 @@ func (s *sshd) start(pod *Pod) error {
 		},
 	}
 
-	for i := 0; i < 1000; i++ {
+	for i := 0; i < sshdDialRetries; i++ {
 		s.client, err = ssh.Dial(s.config.Protocol, s.config.Server+":"+s.config.Port, sshConfig)
 		if err == nil {
 			break
 		}
 
 		select {
-		case <-time.After(100 * time.Millisecond):
+		case <-time.After(sshdDialInterval):
 			break
+		case <-ctx.Done():
+			return ctx.Err()
 		}
 	}
 
@@ -130,12 +140,12 @@ func (s *sshd) start(pod *Pod) error {
 }
 
 // stop is the agent stopping implementation for sshd.
-func (s *sshd) stop(pod Pod) error {
+func (s *sshd) stop(ctx context.Context, pod Pod) error {
 	return nil
 }
 
 // exec is the agent command execution implementation for sshd.
-func (s *sshd) exec(pod *Pod, c Container, cmd Cmd) (*Process, error) {
+func (s *sshd) exec(ctx context.Context, pod *Pod, c Container, cmd Cmd) (*Process, error) {
 	session, err := s.client.NewSession()
 	if err != nil {
 		return nil, fmt.Errorf("Failed to create session")
@@ -155,31 +165,58 @@ func (s *sshd) exec(pod *Pod, c Container, cmd Cmd) (*Process, error) {
 }
 
 // startPod is the agent Pod starting implementation for sshd.
-func (s *sshd) startPod(pod Pod) error {
+func (s *sshd) startPod(ctx context.Context, pod Pod) error {
 	return nil
 }
 
 // stopPod is the agent Pod stopping implementation for sshd.
-func (s *sshd) stopPod(pod Pod) error {
+func (s *sshd) stopPod(ctx context.Context, pod Pod) error {
 	return nil
 }
 
 // createContainer is the agent Container creation implementation for sshd.
-func (s *sshd) createContainer(pod *Pod, c *Container) error {
+func (s *sshd) createContainer(ctx context.Context, pod *Pod, c *Container) error {
 	return nil
 }
 
 // startContainer is the agent Container starting implementation for sshd.
-func (s *sshd) startContainer(pod Pod, c Container) error {
+func (s *sshd) startContainer(ctx context.Context, pod Pod, c Container) error {
 	return nil
 }
 
 // stopContainer is the agent Container stopping implementation for sshd.
-func (s *sshd) stopContainer(pod Pod, c Container) error {
+func (s *sshd) stopContainer(ctx context.Context, pod Pod, c Container) error {
 	return nil
 }
 
 // killContainer is the agent Container signaling implementation for sshd.
-func (s *sshd) killContainer(pod Pod, c Container, signal syscall.Signal) error {
+func (s *sshd) killContainer(ctx context.Context, pod Pod, c Container, signal syscall.Signal) error {
+	return nil
+}
+
+// watchContainer is the agent Container watching implementation for sshd.
+// It does nothing, sshd does not report workload exits.
+func (s *sshd) watchContainer(ctx context.Context, pod Pod, c Container, exited func(exitCode int)) error {
+	return nil
+}
+
+// onlineCPUMem is the agent vCPUs and memory onlining implementation for sshd.
+func (s *sshd) onlineCPUMem(ctx context.Context, pod Pod) error {
 	return nil
 }
+
+// addInterface is the agent network interface hot plug implementation for sshd.
+func (s *sshd) addInterface(ctx context.Context, pod Pod, endpoint Endpoint) error {
+	return nil
+}
+
+// removeInterface is the agent network interface hot unplug implementation
+// for sshd.
+func (s *sshd) removeInterface(ctx context.Context, pod Pod, endpoint Endpoint) error {
+	return nil
+}
+
+// waitContainer is the agent Container waiting implementation for sshd.
+func (s *sshd) waitContainer(ctx context.Context, pod Pod, c Container) (int, error) {
+	return -1, fmt.Errorf("Waiting for a container is not supported by the sshd agent")
+}
@@ -0,0 +1,214 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// procPath is the procfs mount point.
+var procPath = "/proc"
+
+// clockTicks is the number of clock ticks per second used by /proc/<pid>/stat.
+// This is USER_HZ, which is 100 on all the architectures we support.
+const clockTicks = 100
+
+// VCPUStats describes the usage of one virtual CPU.
+type VCPUStats struct {
+	// CPU is the vCPU index.
+	CPU int
+
+	// ThreadID is the host thread running this vCPU.
+	ThreadID int
+
+	// Time is the CPU time consumed by this vCPU, user and system.
+	Time time.Duration
+}
+
+// MemoryStats describes a pod VM memory usage, in bytes.
+type MemoryStats struct {
+	// Used is the host memory used by the hypervisor process.
+	Used uint64
+
+	// Ballooned is the guest memory reclaimed by the balloon device.
+	Ballooned uint64
+}
+
+// BlockStats describes the I/O on one block device of the pod VM.
+type BlockStats struct {
+	Device     string
+	ReadBytes  uint64
+	WriteBytes uint64
+	ReadOps    uint64
+	WriteOps   uint64
+}
+
+// InterfaceStats describes the traffic going through a host network interface.
+type InterfaceStats struct {
+	Name      string
+	RxBytes   uint64
+	RxPackets uint64
+	RxErrors  uint64
+	RxDropped uint64
+	TxBytes   uint64
+	TxPackets uint64
+	TxErrors  uint64
+	TxDropped uint64
+}
+
+// EndpointStats gathers the statistics of both interfaces of a network pair.
+type EndpointStats struct {
+	Name      string
+	TAPIface  InterfaceStats
+	VirtIface InterfaceStats
+}
+
+// PodStats describes a pod resource usage.
+type PodStats struct {
+	ID   string
+	Time time.Time
+
+	VCPUs   []VCPUStats
+	Memory  MemoryStats
+	Block   []BlockStats
+	Network []EndpointStats
+}
+
+// ContainerStats describes a container resource usage.
+// All containers of a pod share the pod VM, and the agents do not report any
+// per container usage. The host can only tell apart the I/O on the drive a
+// container rootfs is passed through as, everything else is pod wide.
+type ContainerStats struct {
+	ID string
+
+	// Block is the I/O on the container rootfs drive. It is empty when
+	// the container rootfs is shared with the VM through a filesystem.
+	Block []BlockStats
+
+	// Pod is the resource usage of the whole pod: vCPUs, memory, all the
+	// block devices and the network are shared by its containers.
+	Pod PodStats
+}
+
+// containerBlockStats returns the statistics of a container rootfs drive,
+// picked from its pod block statistics.
+func containerBlockStats(podStats PodStats, devices podDevices, containerID string) []BlockStats {
+	drive, ok := devices.rootfsDrive(containerID)
+	if !ok {
+		return nil
+	}
+
+	var stats []BlockStats
+	for _, b := range podStats.Block {
+		if b.Device == drive.driveID() {
+			stats = append(stats, b)
+		}
+	}
+
+	return stats
+}
+
+// threadCPUTime returns the CPU time consumed by a host thread, reading
+// utime and stime from /proc/<tid>/stat.
+func threadCPUTime(tid int) (time.Duration, error) {
+	data, err := ioutil.ReadFile(filepath.Join(procPath, strconv.Itoa(tid), "stat"))
+	if err != nil {
+		return 0, err
+	}
+
+	// The command name is between parenthesis and may contain spaces.
+	stat := string(data)
+	idx := strings.LastIndex(stat, ")")
+	if idx < 0 {
+		return 0, fmt.Errorf("Invalid stat file for thread %d", tid)
+	}
+
+	// Fields start from the state, which is the 3rd field of the file.
+	// utime and stime are the 14th and 15th fields.
+	fields := strings.Fields(stat[idx+1:])
+	if len(fields) < 13 {
+		return 0, fmt.Errorf("Invalid stat file for thread %d", tid)
+	}
+
+	var ticks uint64
+	for _, field := range fields[11:13] {
+		value, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+
+		ticks += value
+	}
+
+	return time.Duration(ticks) * time.Second / clockTicks, nil
+}
+
+// procStatusValue returns the value of a /proc/<pid>/status field.
+func procStatusValue(pid int, key string) (string, error) {
+	f, err := os.Open(filepath.Join(procPath, strconv.Itoa(pid), "status"))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), ":", 2)
+		if len(fields) == 2 && fields[0] == key {
+			return strings.TrimSpace(fields[1]), nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	return "", fmt.Errorf("No %s field for process %d", key, pid)
+}
+
+// threadProcess returns the process a host thread belongs to.
+func threadProcess(tid int) (int, error) {
+	value, err := procStatusValue(tid, "Tgid")
+	if err != nil {
+		return -1, err
+	}
+
+	return strconv.Atoi(value)
+}
+
+// processRSS returns the resident memory of a process, in bytes.
+func processRSS(pid int) (uint64, error) {
+	value, err := procStatusValue(pid, "VmRSS")
+	if err != nil {
+		return 0, err
+	}
+
+	// VmRSS is always expressed in kB.
+	kb, err := strconv.ParseUint(strings.TrimSuffix(value, " kB"), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return kb * 1024, nil
+}
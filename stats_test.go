@@ -0,0 +1,139 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testProcStat = "4242 (CPU 0/KVM) S 1 4240 4240 0 -1 138412224 1083 0 0 0 250 150 0 0 20 0 1 0 1000 0 0"
+
+const testProcStatus = `Name:	qemu-system-x86
+State:	S (sleeping)
+Tgid:	4240
+Pid:	4242
+VmRSS:	  204800 kB
+Threads:	4
+`
+
+func setupTestProc(t *testing.T, pid string) string {
+	dir, err := ioutil.TempDir("", "proc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pidDir := filepath.Join(dir, pid)
+	if err := os.MkdirAll(pidDir, dirMode); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(pidDir, "stat"), []byte(testProcStat), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(pidDir, "status"), []byte(testProcStatus), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func TestThreadCPUTime(t *testing.T) {
+	dir := setupTestProc(t, "4242")
+	defer os.RemoveAll(dir)
+
+	savedProcPath := procPath
+	procPath = dir
+	defer func() { procPath = savedProcPath }()
+
+	cpuTime, err := threadCPUTime(4242)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cpuTime != 4*time.Second {
+		t.Fatalf("Got %s, expecting %s", cpuTime, 4*time.Second)
+	}
+
+	if _, err := threadCPUTime(4243); err == nil {
+		t.Fatal("Non existing thread should fail")
+	}
+}
+
+func TestThreadProcessAndRSS(t *testing.T) {
+	dir := setupTestProc(t, "4242")
+	defer os.RemoveAll(dir)
+
+	savedProcPath := procPath
+	procPath = dir
+	defer func() { procPath = savedProcPath }()
+
+	pid, err := threadProcess(4242)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pid != 4240 {
+		t.Fatalf("Got pid %d, expecting 4240", pid)
+	}
+
+	rss, err := processRSS(4242)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rss != 204800*1024 {
+		t.Fatalf("Got %d bytes, expecting %d", rss, 204800*1024)
+	}
+
+	if _, err := procStatusValue(4242, "VmSwap"); err == nil {
+		t.Fatal("Non existing field should fail")
+	}
+}
+
+func TestContainerBlockStats(t *testing.T) {
+	podStats := PodStats{
+		Block: []BlockStats{
+			{Device: "drive-0", ReadBytes: 1},
+			{Device: "drive-vdb", ReadBytes: 2},
+			{Device: "drive-vdc", ReadBytes: 3},
+		},
+	}
+
+	devices := podDevices{
+		RootfsDrives: []rootfsDrive{
+			{ContainerID: "1", Device: "vdb"},
+			{ContainerID: "2", Device: "vdc"},
+		},
+	}
+
+	stats := containerBlockStats(podStats, devices, "2")
+	expected := []BlockStats{{Device: "drive-vdc", ReadBytes: 3}}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Fatalf("Got %+v, expecting %+v", stats, expected)
+	}
+
+	// A container sharing its rootfs through a filesystem has no drive.
+	if stats := containerBlockStats(podStats, devices, "3"); len(stats) != 0 {
+		t.Fatalf("Unexpected container block statistics %+v", stats)
+	}
+}
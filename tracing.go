@@ -0,0 +1,129 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+// The tags virtcontainers sets on its spans.
+const (
+	podIDTag       = "pod.id"
+	containerIDTag = "container.id"
+)
+
+var (
+	tracerLock sync.RWMutex
+	tracer     opentracing.Tracer = opentracing.NoopTracer{}
+)
+
+// SetTracer sets the OpenTracing tracer all the API calls are traced with.
+// Each API call gets a span, with one child span per phase of the call.
+// A span found in the API call context becomes the parent of the API call
+// span. A nil tracer restores the default one, which does nothing.
+func SetTracer(t opentracing.Tracer) {
+	if t == nil {
+		t = opentracing.NoopTracer{}
+	}
+
+	tracerLock.Lock()
+	tracer = t
+	tracerLock.Unlock()
+}
+
+func getTracer() opentracing.Tracer {
+	tracerLock.RLock()
+	defer tracerLock.RUnlock()
+
+	return tracer
+}
+
+// startSpan starts a span, child of the ctx one if any, and returns it
+// with a context carrying it.
+func startSpan(ctx context.Context, operation string) (opentracing.Span, context.Context) {
+	var opts []opentracing.StartSpanOption
+
+	if parent := opentracing.SpanFromContext(ctx); parent != nil {
+		opts = append(opts, opentracing.ChildOf(parent.Context()))
+	}
+
+	span := getTracer().StartSpan(operation, opts...)
+
+	return span, opentracing.ContextWithSpan(ctx, span)
+}
+
+// finishSpan finishes a span, flagging it if its operation failed.
+func finishSpan(span opentracing.Span, err error) {
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogKV("error", err.Error())
+	}
+
+	span.Finish()
+}
+
+// startSpan starts the span of a pod phase.
+func (p *Pod) startSpan(ctx context.Context, operation string) (opentracing.Span, context.Context) {
+	span, ctx := startSpan(ctx, operation)
+	span.SetTag(podIDTag, p.id)
+
+	return span, ctx
+}
+
+// apiCall is an API call being traced and measured.
+type apiCall struct {
+	operation string
+	begin     time.Time
+	span      opentracing.Span
+}
+
+// startAPICall starts tracing an API call. Empty IDs are not set.
+func startAPICall(ctx context.Context, operation, podID, containerID string) (*apiCall, context.Context) {
+	span, ctx := startSpan(ctx, operation)
+
+	call := &apiCall{
+		operation: operation,
+		begin:     time.Now(),
+		span:      span,
+	}
+	call.setIDs(podID, containerID)
+
+	return call, ctx
+}
+
+// setIDs sets the pod and container IDs of a call, for the calls not
+// knowing them upfront.
+func (call *apiCall) setIDs(podID, containerID string) {
+	if podID != "" {
+		call.span.SetTag(podIDTag, podID)
+	}
+
+	if containerID != "" {
+		call.span.SetTag(containerIDTag, containerID)
+	}
+}
+
+// end ends an API call, err being its result.
+func (call *apiCall) end(err error) {
+	finishSpan(call.span, err)
+	observeAPICall(call.operation, call.begin, err)
+}
@@ -0,0 +1,112 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"context"
+	"testing"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+func findSpan(tracer *mocktracer.MockTracer, operation string) *mocktracer.MockSpan {
+	for _, span := range tracer.FinishedSpans() {
+		if span.OperationName == operation {
+			return span
+		}
+	}
+
+	return nil
+}
+
+func TestCreatePodSpans(t *testing.T) {
+	tracer := mocktracer.New()
+	SetTracer(tracer)
+	defer SetTracer(nil)
+
+	parent := tracer.StartSpan("caller")
+	ctx := opentracing.ContextWithSpan(context.Background(), parent)
+
+	p, err := CreatePodWithContext(ctx, newTestPodConfigNoop())
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	parent.Finish()
+
+	call := findSpan(tracer, "CreatePod")
+	if call == nil {
+		t.Fatalf("No CreatePod span in %v", tracer.FinishedSpans())
+	}
+
+	if call.ParentID != parent.(*mocktracer.MockSpan).SpanContext.SpanID {
+		t.Fatal("The CreatePod span should be a child of the context span")
+	}
+
+	if call.Tag(podIDTag) != p.id {
+		t.Fatalf("Got pod ID tag %v, expecting %s", call.Tag(podIDTag), p.id)
+	}
+
+	for _, phase := range []struct {
+		operation string
+		parent    string
+	}{
+		{"storePod", "CreatePod"},
+		{"network.init", "CreatePod"},
+		{"preStartHooks", "CreatePod"},
+		{"network.add", "CreatePod"},
+		{"startVM", "CreatePod"},
+		{"agent.start", "startVM"},
+	} {
+		span := findSpan(tracer, phase.operation)
+		if span == nil {
+			t.Fatalf("No %s span", phase.operation)
+		}
+
+		if span.ParentID != findSpan(tracer, phase.parent).SpanContext.SpanID {
+			t.Fatalf("The %s span should be a child of the %s span", phase.operation, phase.parent)
+		}
+
+		if span.Tag(podIDTag) != p.id {
+			t.Fatalf("Got %s pod ID tag %v, expecting %s", phase.operation, span.Tag(podIDTag), p.id)
+		}
+	}
+}
+
+func TestAPISpanError(t *testing.T) {
+	tracer := mocktracer.New()
+	SetTracer(tracer)
+	defer SetTracer(nil)
+
+	if _, err := StartContainer("not-a-pod", "not-a-container"); err == nil {
+		t.Fatal("Starting a container from an unknown pod should fail")
+	}
+
+	span := findSpan(tracer, "StartContainer")
+	if span == nil {
+		t.Fatalf("No StartContainer span in %v", tracer.FinishedSpans())
+	}
+
+	if span.Tag("error") != true {
+		t.Fatal("The StartContainer span should be flagged as failed")
+	}
+
+	if span.Tag(podIDTag) != "not-a-pod" || span.Tag(containerIDTag) != "not-a-container" {
+		t.Fatalf("Unexpected span tags %v", span.Tags())
+	}
+}
@@ -94,8 +94,16 @@ func TestMain(m *testing.M) {
 	}
 
 	// allow the tests to run without affecting the host system.
-	configStoragePath = filepath.Join(testDir, storagePathSuffix, "config")
-	runStoragePath = filepath.Join(testDir, storagePathSuffix, "run")
+	err = SetRuntimeConfig(RuntimeConfig{
+		ConfigStoragePath: filepath.Join(testDir, storagePathSuffix, "config"),
+		RunStoragePath:    filepath.Join(testDir, storagePathSuffix, "run"),
+		ConsoleLogDir:     filepath.Join(testDir, storagePathSuffix, "consoles"),
+	})
+	if err != nil {
+		fmt.Println("Could not set the runtime configuration:", err)
+		os.RemoveAll(testDir)
+		os.Exit(1)
+	}
 
 	// set now that configStoragePath has been overridden.
 	podDirConfig = filepath.Join(configStoragePath, testPodID)
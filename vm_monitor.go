@@ -0,0 +1,295 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"context"
+	"time"
+)
+
+// vmEvent is a pod VM event reported by the hypervisor.
+type vmEvent string
+
+const (
+	// vmShutdown is reported when the VM has been powered off.
+	vmShutdown vmEvent = "shutdown"
+
+	// vmPanicked is reported when the guest kernel panicked.
+	vmPanicked vmEvent = "panicked"
+
+	// vmReset is reported when the VM has been reset, losing the guest
+	// workloads.
+	vmReset vmEvent = "reset"
+
+	// vmStopped is reported when the VM execution has been stopped.
+	vmStopped vmEvent = "stopped"
+
+	// vmExited is reported when the hypervisor exited without powering
+	// the VM off first.
+	vmExited vmEvent = "exited"
+)
+
+// vmEventTypes are the events published for the VM events.
+var vmEventTypes = map[vmEvent]EventType{
+	vmShutdown: VMShutdown,
+	vmPanicked: VMPanicked,
+	vmReset:    VMReset,
+	vmStopped:  VMStopped,
+	vmExited:   VMCrashed,
+}
+
+// vmEventLockTimeout bounds how long a VM event handler waits for the pod
+// lock, held by the operation running on the pod if any.
+var vmEventLockTimeout = time.Minute
+
+// vmPingTimeout bounds how long we wait for a pod VM to answer when checking
+// it is still there.
+var vmPingTimeout = 5 * time.Second
+
+// vmMonitorQueueSize is the number of VM events a monitor can lag behind.
+const vmMonitorQueueSize = 16
+
+// vmMonitor applies the events of a pod VM to the pod, in order and one at
+// a time, so that the hypervisor event loop never waits for the pod lock.
+type vmMonitor struct {
+	podID string
+	ch    chan vmEvent
+}
+
+func newVMMonitor(podID string) *vmMonitor {
+	m := &vmMonitor{
+		podID: podID,
+		ch:    make(chan vmEvent, vmMonitorQueueSize),
+	}
+
+	go m.run()
+
+	return m
+}
+
+// report queues a VM event. It never blocks.
+func (m *vmMonitor) report(event vmEvent) {
+	select {
+	case m.ch <- event:
+	default:
+		podLogger("vmmonitor", m.podID).Errorf("Dropping VM %s event, monitor too slow", event)
+	}
+}
+
+// close stops the monitor once the queued events have been handled.
+func (m *vmMonitor) close() {
+	close(m.ch)
+}
+
+func (m *vmMonitor) run() {
+	for event := range m.ch {
+		if err := handleVMEvent(m.podID, event); err != nil {
+			podLogger("vmmonitor", m.podID).Errorf("Could not handle VM %s event: %s", event, err)
+		}
+	}
+}
+
+// handleVMEvent updates a pod after its VM went away or stopped on its own.
+// All the operations stopping or pausing a VM on purpose hold the pod lock,
+// and leave the pod deleted or in the expected state. The events they cause
+// are then ignored.
+func handleVMEvent(podID string, event vmEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), vmEventLockTimeout)
+	defer cancel()
+
+	lockFile, err := lockPod(ctx, podID, exclusiveLock)
+	if IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer unlockPod(lockFile)
+
+	p, err := fetchPod(podID)
+	if IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	state, err := p.storage.fetchPodState(podID)
+	if err != nil {
+		return err
+	}
+
+	if event == vmStopped {
+		if state.State != StateRunning {
+			return nil
+		}
+
+		events.publish(Event{
+			Type:    VMStopped,
+			PodID:   podID,
+			Message: "VM execution stopped by the hypervisor",
+		})
+
+		return p.setPodState(StatePaused)
+	}
+
+	if state.State == StateCrashed {
+		return nil
+	}
+
+	p.logger().Errorf("VM went away: %s", event)
+
+	events.publish(Event{
+		Type:  vmEventTypes[event],
+		PodID: podID,
+	})
+
+	return p.crashed(state.State)
+}
+
+// crashed moves a pod whose VM is gone to the crashed state, and its
+// containers to the stopped state. The PostStop hooks are run if asked to,
+// unless the pod had already been stopped.
+func (p *Pod) crashed(oldState stateString) error {
+	for _, container := range p.containers {
+		state, err := p.storage.fetchContainerState(p.id, container.id)
+		if err == nil && state.State == StateStopped {
+			continue
+		}
+
+		if err := p.setContainerState(container.id, StateStopped); err != nil {
+			return err
+		}
+	}
+
+	if err := p.setPodState(StateCrashed); err != nil {
+		return err
+	}
+
+	if !p.config.Hooks.PostStopOnVMExit || (oldState != StateRunning && oldState != StatePaused) {
+		return nil
+	}
+
+	networkNS, err := p.storage.fetchPodNetwork(p.id)
+	if err != nil {
+		return err
+	}
+
+	return p.network.run(networkNS.NetNsPath, func() error {
+		return p.config.Hooks.postStopHooks(p.id)
+	})
+}
+
+// pingPodVM checks that the VM of a pod is alive, from the pod configuration
+// alone.
+func pingPodVM(ctx context.Context, config PodConfig) error {
+	hypervisor, err := newHypervisor(config.HypervisorType)
+	if err != nil {
+		return err
+	}
+
+	if err := hypervisor.init(config.HypervisorConfig); err != nil {
+		return err
+	}
+
+	if err := hypervisor.createPod(config); err != nil {
+		return err
+	}
+
+	return hypervisor.pingVM(ctx)
+}
+
+// podVMGone returns true if the VM of a running or paused pod went away.
+// The VM monitor lives in the process which started the VM and goes away
+// with it, so the pod status readers check the VM as well. They only report
+// it, without the pod lock: moving the pod to the crashed state is left to
+// the VM monitor, DeletePod and the gc.
+func podVMGone(ctx context.Context, podID string, state stateString) (bool, error) {
+	if state != StateRunning && state != StatePaused {
+		return false, nil
+	}
+
+	config, err := newStorage().fetchPodConfig(podID)
+	if err != nil {
+		if err = podNotFound(podID, err); IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, vmPingTimeout)
+	defer cancel()
+
+	err = pingPodVM(pingCtx, config)
+	if err == nil {
+		return false, nil
+	} else if ctx.Err() != nil {
+		return false, ctx.Err()
+	} else if pingCtx.Err() != nil {
+		// A VM too busy to answer is not gone.
+		podLogger("vm", podID).Warnf("VM did not answer: %s", err)
+		return false, nil
+	}
+
+	podLogger("vm", podID).Warnf("VM went away: %s", err)
+
+	return true, nil
+}
+
+// crashedPodStatus returns the status of a pod whose VM went away, as the
+// VM monitor stores it.
+func crashedPodStatus(status PodStatus) PodStatus {
+	status.State.State = StateCrashed
+
+	containers := make([]ContainerStatus, len(status.ContainersStatus))
+	for i, container := range status.ContainersStatus {
+		container.State.State = StateStopped
+		containers[i] = container
+	}
+	status.ContainersStatus = containers
+
+	return status
+}
+
+// checkVM moves a running or paused pod whose VM went away to the crashed
+// state. The pod must be locked exclusively.
+func (p *Pod) checkVM(ctx context.Context) error {
+	state, err := p.storage.fetchPodState(p.id)
+	if err != nil {
+		return err
+	}
+
+	if state.State != StateRunning && state.State != StatePaused {
+		return nil
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, vmPingTimeout)
+	defer cancel()
+
+	err = p.hypervisor.pingVM(pingCtx)
+	if err == nil || pingCtx.Err() != nil {
+		return ctx.Err()
+	}
+
+	p.logger().Errorf("VM went away: %s", err)
+
+	events.publish(Event{
+		Type:    VMCrashed,
+		PodID:   p.id,
+		Message: "VM found gone while deleting the pod",
+	})
+
+	return p.crashed(state.State)
+}
@@ -0,0 +1,239 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"testing"
+)
+
+func TestHandleVMEventCrash(t *testing.T) {
+	p, err := RunPod(newTestPodConfigNoop())
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	ch, cancel := SubscribeEvents(EventFilter{
+		PodID: p.id,
+		Types: []EventType{VMPanicked, PodCrashed},
+	})
+	defer cancel()
+
+	if err := handleVMEvent(p.id, vmPanicked); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []EventType{VMPanicked, PodCrashed} {
+		if e := receiveEvent(t, ch); e.Type != expected {
+			t.Fatalf("Got %s event, expecting %s", e.Type, expected)
+		}
+	}
+
+	status, err := StatusPod(p.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status.State.State != StateCrashed {
+		t.Fatalf("Got pod state %s, expecting %s", status.State.State, StateCrashed)
+	}
+
+	for _, container := range status.ContainersStatus {
+		if container.State.State != StateStopped {
+			t.Fatalf("Got container %s state %s, expecting %s", container.ID, container.State.State, StateStopped)
+		}
+	}
+
+	// A crashed pod is only reported once.
+	if err := handleVMEvent(p.id, vmExited); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case e := <-ch:
+		t.Fatalf("Unexpected event %+v", e)
+	default:
+	}
+
+	if _, err := StartPod(p.id); !IsInvalidState(err) {
+		t.Fatalf("Got %v, expecting an invalid state error", err)
+	}
+
+	if _, err := DeletePod(p.id); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandleVMEventStop(t *testing.T) {
+	p, err := RunPod(newTestPodConfigNoop())
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	ch, cancel := SubscribeEvents(EventFilter{PodID: p.id, Types: []EventType{VMStopped}})
+	defer cancel()
+
+	for i := 0; i < 2; i++ {
+		if err := handleVMEvent(p.id, vmStopped); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	receiveEvent(t, ch)
+
+	select {
+	case e := <-ch:
+		t.Fatalf("A paused pod should not be paused again: %+v", e)
+	default:
+	}
+
+	status, err := StatusPod(p.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status.State.State != StatePaused {
+		t.Fatalf("Got pod state %s, expecting %s", status.State.State, StatePaused)
+	}
+
+	if _, err := ResumePod(p.id); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandleVMEventUnknownPod(t *testing.T) {
+	if err := handleVMEvent("not-a-pod", vmShutdown); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// killMockVM makes a pod mock VM go away without its monitor noticing, as if
+// the process which started it was gone.
+func killMockVM(podID string) {
+	mockVMs.Lock()
+	defer mockVMs.Unlock()
+
+	delete(mockVMs.vms, podID)
+}
+
+func TestStatusPodVMGone(t *testing.T) {
+	p, err := RunPod(newTestPodConfigNoop())
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+	defer DeletePod(p.id)
+
+	status, err := StatusPod(p.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status.State.State != StateRunning {
+		t.Fatalf("Got pod state %s, expecting %s", status.State.State, StateRunning)
+	}
+
+	killMockVM(p.id)
+
+	status, err = StatusPod(p.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status.State.State != StateCrashed {
+		t.Fatalf("Got pod state %s, expecting %s", status.State.State, StateCrashed)
+	}
+
+	for _, container := range status.ContainersStatus {
+		if container.State.State != StateStopped {
+			t.Fatalf("Got container %s state %s, expecting %s", container.ID, container.State.State, StateStopped)
+		}
+	}
+
+	// Reading the status only reports the crash.
+	state, err := p.storage.fetchPodState(p.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state.State != StateRunning {
+		t.Fatalf("Got stored pod state %s, expecting %s", state.State, StateRunning)
+	}
+}
+
+func TestListPodVMGone(t *testing.T) {
+	p, err := RunPod(newTestPodConfigNoop())
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+	defer DeletePod(p.id)
+
+	killMockVM(p.id)
+
+	statuses, err := ListPod()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, status := range statuses {
+		if status.ID != p.id {
+			continue
+		}
+
+		found = true
+		if status.State.State != StateCrashed {
+			t.Fatalf("Got pod state %s, expecting %s", status.State.State, StateCrashed)
+		}
+	}
+
+	if !found {
+		t.Fatalf("Pod %s not listed", p.id)
+	}
+
+	state, err := p.storage.fetchPodState(p.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state.State != StateRunning {
+		t.Fatalf("Got stored pod state %s, expecting %s", state.State, StateRunning)
+	}
+}
+
+func TestDeletePodVMGone(t *testing.T) {
+	p, err := RunPod(newTestPodConfigNoop())
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	ch, cancel := SubscribeEvents(EventFilter{
+		PodID: p.id,
+		Types: []EventType{VMCrashed, PodCrashed, PodDeleted},
+	})
+	defer cancel()
+
+	killMockVM(p.id)
+
+	if _, err := DeletePod(p.id); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []EventType{VMCrashed, PodCrashed, PodDeleted} {
+		if e := receiveEvent(t, ch); e.Type != expected {
+			t.Fatalf("Got %s event, expecting %s", e.Type, expected)
+		}
+	}
+}
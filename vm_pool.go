@@ -0,0 +1,587 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/01org/ciao/ssntp/uuid"
+)
+
+// vmPoolDirName is the directory, next to the pods runtime directory, where
+// the pre-booted VMs are published. There is one sub directory per pool,
+// named after the pool hash, holding one JSON file per ready VM.
+const vmPoolDirName = "vms"
+
+// pooledVMPrefix prefixes the IDs of the pre-booted VMs.
+const pooledVMPrefix = "vm-"
+
+// defaultVMPoolRefillInterval is how often a pool gets refilled when no
+// refill interval is configured.
+const defaultVMPoolRefillInterval = time.Second
+
+// vmPoolBootTimeout is the time we wait for a pooled VM to boot.
+const vmPoolBootTimeout = 10 * time.Second
+
+// VMPoolConfig describes a pool of pre-booted VMs. Pods get a VM from the
+// pool when their hypervisor, VM and agent configurations match the pool
+// ones.
+type VMPoolConfig struct {
+	HypervisorType   HypervisorType
+	HypervisorConfig HypervisorConfig
+
+	// VMConfig is the resources of the pooled VMs.
+	VMConfig Resources
+
+	AgentType AgentType
+
+	// Size is the number of ready VMs the pool keeps.
+	Size uint
+
+	// RefillInterval is how often the pool replaces the claimed VMs.
+	// defaultVMPoolRefillInterval is used if it is zero.
+	RefillInterval time.Duration
+
+	// RefillBatch is the maximum number of VMs booted at each refill.
+	// Zero means no limit.
+	RefillBatch uint
+}
+
+// VMPoolStatus describes the content of a VM pool.
+type VMPoolStatus struct {
+	// Hash identifies the pool, from its hypervisor, VM and agent configurations.
+	Hash string
+
+	Size uint
+
+	// ReadyVMs is the list of the VMs ready to be claimed by a pod.
+	ReadyVMs []string
+}
+
+// vmPoolKey gathers everything a pooled VM depends on.
+type vmPoolKey struct {
+	HypervisorType   HypervisorType
+	HypervisorConfig HypervisorConfig
+	VMConfig         Resources
+	AgentType        AgentType
+}
+
+// hash identifies a pool. The Go syntax representation of the key is used,
+// rather than its JSON encoding, as the latter skips the Param fields.
+func (k vmPoolKey) hash() string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%#v", k)))
+
+	return hex.EncodeToString(sum[:])
+}
+
+func (config VMPoolConfig) key() vmPoolKey {
+	return vmPoolKey{
+		HypervisorType:   config.HypervisorType,
+		HypervisorConfig: config.HypervisorConfig,
+		VMConfig:         config.VMConfig,
+		AgentType:        config.AgentType,
+	}
+}
+
+func (config VMPoolConfig) valid() error {
+	if config.Size == 0 {
+		return fmt.Errorf("VM pool size cannot be zero")
+	}
+
+	if _, err := config.HypervisorConfig.valid(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func vmPoolDir(hash string) string {
+	return filepath.Join(filepath.Dir(runStoragePath), vmPoolDirName, hash)
+}
+
+// pooledVM describes a pre-booted VM, and where to find its resources.
+type pooledVM struct {
+	ID string
+
+	ControlSocket string
+	MonitorSocket string
+
+	// AgentSockets and SharedDir are the hyperstart agent resources.
+	AgentSockets []Socket
+	SharedDir    string
+}
+
+func poolLogger(vmID string) Logger {
+	return subsystemLogger("vmpool").WithFields(Fields{"vm": vmID})
+}
+
+// templatePod returns an in memory pod, never stored, for booting or
+// destroying a pooled VM.
+func templatePod(key vmPoolKey, vmID string) (*Pod, error) {
+	config := PodConfig{
+		ID:               vmID,
+		HypervisorType:   key.HypervisorType,
+		HypervisorConfig: key.HypervisorConfig,
+		VMConfig:         key.VMConfig,
+		AgentType:        key.AgentType,
+	}
+
+	hypervisor, err := newHypervisor(config.HypervisorType)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := hypervisor.init(config.HypervisorConfig); err != nil {
+		return nil, err
+	}
+
+	if err := hypervisor.createPod(config); err != nil {
+		return nil, err
+	}
+
+	p := &Pod{
+		id:         vmID,
+		hypervisor: hypervisor,
+		agent:      newAgent(config.AgentType),
+		storage:    newStorage(),
+		config:     &config,
+		runPath:    filepath.Join(runStoragePath, vmID),
+	}
+
+	var agentConfig interface{}
+	if config.AgentType == HyperstartAgent {
+		agentConfig = HyperConfig{}
+	}
+
+	if err := p.agent.init(p, agentConfig); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// bootPooledVM boots a new VM and publishes it into its pool.
+func bootPooledVM(ctx context.Context, key vmPoolKey, hash string) (pooledVM, error) {
+	vmID := pooledVMPrefix + uuid.Generate().String()
+
+	p, err := templatePod(key, vmID)
+	if err != nil {
+		return pooledVM{}, err
+	}
+
+	vm := pooledVM{
+		ID:            vmID,
+		ControlSocket: filepath.Join(p.runPath, controlSocket),
+		MonitorSocket: filepath.Join(p.runPath, monitorSocket),
+	}
+
+	if hyperConfig, ok := p.config.AgentConfig.(HyperConfig); ok {
+		vm.AgentSockets = hyperConfig.Sockets
+		vm.SharedDir = filepath.Join(defaultSharedDir, vmID)
+	}
+
+	rb := &rollback{}
+	defer rb.run()
+
+	rb.add("VM resources", func() error {
+		return removePooledVMResources(vm)
+	})
+
+	if err := os.MkdirAll(p.runPath, dirMode); err != nil {
+		return pooledVM{}, err
+	}
+
+	bootCtx, cancel := context.WithTimeout(ctx, vmPoolBootTimeout)
+	defer cancel()
+
+	if err := p.hypervisor.bootPooledVM(bootCtx); err != nil {
+		return pooledVM{}, err
+	}
+
+	rb.add("VM", func() error {
+		return p.hypervisor.stopPod(context.Background())
+	})
+
+	// Publish the VM atomically, for no pod to find a partial file.
+	dir := vmPoolDir(hash)
+	tmpFile := filepath.Join(dir, "."+vmID)
+
+	data, err := json.Marshal(vm)
+	if err != nil {
+		return pooledVM{}, err
+	}
+
+	if err := ioutil.WriteFile(tmpFile, data, 0600); err != nil {
+		return pooledVM{}, err
+	}
+
+	if err := os.Rename(tmpFile, filepath.Join(dir, vmID)); err != nil {
+		os.Remove(tmpFile)
+		return pooledVM{}, err
+	}
+
+	rb.commit()
+
+	poolLogger(vmID).Infof("Pooled VM booted")
+
+	return vm, nil
+}
+
+// removePooledVMResources removes whatever is left of a pooled VM once it
+// has been adopted or destroyed.
+func removePooledVMResources(vm pooledVM) error {
+	if vm.ID == "" {
+		return nil
+	}
+
+	if err := os.RemoveAll(filepath.Join(runStoragePath, vm.ID)); err != nil {
+		return err
+	}
+
+	for _, socket := range vm.AgentSockets {
+		if err := os.Remove(socket.HostPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if vm.SharedDir != "" {
+		return os.RemoveAll(vm.SharedDir)
+	}
+
+	return nil
+}
+
+// readyVMs lists the ready VMs of a pool.
+func readyVMs(hash string) ([]string, error) {
+	files, err := ioutil.ReadDir(vmPoolDir(hash))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var vms []string
+	for _, f := range files {
+		if strings.HasPrefix(f.Name(), pooledVMPrefix) {
+			vms = append(vms, f.Name())
+		}
+	}
+
+	return vms, nil
+}
+
+// claimVM takes a ready VM out of its pool. Removing the VM file is what
+// makes the claim exclusive: only one caller can succeed.
+func claimVM(hash, vmID string) (pooledVM, bool) {
+	var vm pooledVM
+
+	path := filepath.Join(vmPoolDir(hash), vmID)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return vm, false
+	}
+
+	if err := os.Remove(path); err != nil {
+		return vm, false
+	}
+
+	if err := json.Unmarshal(data, &vm); err != nil {
+		poolLogger(vmID).Errorf("Invalid pooled VM: %s", err)
+		return vm, false
+	}
+
+	return vm, true
+}
+
+// destroyPooledVM stops a claimed VM which is not going to be adopted.
+func destroyPooledVM(key vmPoolKey, vm pooledVM) error {
+	p, err := templatePod(key, vm.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := p.hypervisor.stopPod(context.Background()); err != nil {
+		poolLogger(vm.ID).Errorf("Could not stop pooled VM: %s", err)
+	}
+
+	return removePooledVMResources(vm)
+}
+
+// VMPool keeps pre-booted VMs ready for being claimed by new pods.
+// The pool lives as long as the process which started it, while the pooled
+// VMs can be claimed from any process.
+type VMPool struct {
+	config VMPoolConfig
+	key    vmPoolKey
+	hash   string
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// startVMPool boots the pool VMs and starts refilling the pool.
+func startVMPool(ctx context.Context, config VMPoolConfig) (*VMPool, error) {
+	if err := config.valid(); err != nil {
+		return nil, err
+	}
+
+	if err := checkHypervisor(ctx, config.HypervisorType, config.HypervisorConfig); err != nil {
+		return nil, err
+	}
+
+	if config.RefillInterval == 0 {
+		config.RefillInterval = defaultVMPoolRefillInterval
+	}
+
+	key := config.key()
+	hash := key.hash()
+
+	if err := os.MkdirAll(vmPoolDir(hash), dirMode); err != nil {
+		return nil, err
+	}
+
+	pool := &VMPool{
+		config: config,
+		key:    key,
+		hash:   hash,
+		stopCh: make(chan struct{}),
+	}
+
+	if err := pool.refill(ctx); err != nil {
+		pool.drain()
+		return nil, err
+	}
+
+	pool.wg.Add(1)
+	go pool.run()
+
+	return pool, nil
+}
+
+func (pool *VMPool) run() {
+	defer pool.wg.Done()
+
+	ticker := time.NewTicker(pool.config.RefillInterval)
+	defer ticker.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		<-pool.stopCh
+		cancel()
+	}()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := pool.refill(ctx); err != nil {
+				subsystemLogger("vmpool").Errorf("Could not refill VM pool %s: %s", pool.hash, err)
+			}
+		case <-pool.stopCh:
+			return
+		}
+	}
+}
+
+// refill boots the VMs missing from the pool, up to RefillBatch of them.
+func (pool *VMPool) refill(ctx context.Context) error {
+	vms, err := readyVMs(pool.hash)
+	if err != nil {
+		return err
+	}
+
+	if uint(len(vms)) >= pool.config.Size {
+		return nil
+	}
+
+	missing := pool.config.Size - uint(len(vms))
+	if pool.config.RefillBatch > 0 && missing > pool.config.RefillBatch {
+		missing = pool.config.RefillBatch
+	}
+
+	for i := uint(0); i < missing; i++ {
+		if _, err := bootPooledVM(ctx, pool.key, pool.hash); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// drain destroys all the ready VMs of the pool.
+func (pool *VMPool) drain() error {
+	vms, err := readyVMs(pool.hash)
+	if err != nil {
+		return err
+	}
+
+	for _, vmID := range vms {
+		vm, ok := claimVM(pool.hash, vmID)
+		if !ok {
+			continue
+		}
+
+		if err := destroyPooledVM(pool.key, vm); err != nil {
+			poolLogger(vmID).Errorf("Could not destroy pooled VM: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// Stop stops refilling the pool and destroys its ready VMs.
+func (pool *VMPool) Stop() error {
+	close(pool.stopCh)
+	pool.wg.Wait()
+
+	return pool.drain()
+}
+
+// Status returns the pool status.
+func (pool *VMPool) Status() (VMPoolStatus, error) {
+	return poolStatus(pool.config)
+}
+
+func poolStatus(config VMPoolConfig) (VMPoolStatus, error) {
+	hash := config.key().hash()
+
+	vms, err := readyVMs(hash)
+	if err != nil {
+		return VMPoolStatus{}, err
+	}
+
+	return VMPoolStatus{
+		Hash:     hash,
+		Size:     config.Size,
+		ReadyVMs: vms,
+	}, nil
+}
+
+// poolable checks if the pod can run in a pooled VM. Pooled VMs are booted
+// without any pod specific device, and the ones which cannot be hot plugged
+// rule the pool out.
+func (p *Pod) poolable() bool {
+	if len(p.config.Volumes) > 0 || p.config.Console != "" {
+		return false
+	}
+
+	if hyperConfig, ok := p.config.AgentConfig.(HyperConfig); ok && len(hyperConfig.Volumes) > 0 {
+		return false
+	}
+
+	for _, c := range p.config.Containers {
+		if c.Interactive && c.Console != "" {
+			return false
+		}
+
+		// Rootfs drives are only added before the VM starts.
+		if isBlockRootfs(c.RootFs) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (p *Pod) poolKey() vmPoolKey {
+	return vmPoolKey{
+		HypervisorType:   p.config.HypervisorType,
+		HypervisorConfig: p.config.HypervisorConfig,
+		VMConfig:         p.config.VMConfig,
+		AgentType:        p.config.AgentType,
+	}
+}
+
+// claimPooledVM takes a VM out of the pool matching the pod configuration,
+// if there is any.
+func (p *Pod) claimPooledVM() (pooledVM, bool) {
+	if !p.poolable() {
+		return pooledVM{}, false
+	}
+
+	hash := p.poolKey().hash()
+
+	vms, err := readyVMs(hash)
+	if err != nil {
+		return pooledVM{}, false
+	}
+
+	for _, vmID := range vms {
+		if vm, ok := claimVM(hash, vmID); ok {
+			return vm, true
+		}
+	}
+
+	return pooledVM{}, false
+}
+
+// adoptPooledVM moves the agent resources of a pooled VM where the pod
+// expects them, then lets the hypervisor bind the VM to the pod and
+// connects to the agent.
+func (p *Pod) adoptPooledVM(ctx context.Context, vm pooledVM) error {
+	if hyperConfig, ok := p.config.AgentConfig.(HyperConfig); ok {
+		if len(hyperConfig.Sockets) != len(vm.AgentSockets) {
+			return fmt.Errorf("Pooled VM %s has %d agent sockets, expecting %d",
+				vm.ID, len(vm.AgentSockets), len(hyperConfig.Sockets))
+		}
+
+		for i, socket := range hyperConfig.Sockets {
+			if err := os.Rename(vm.AgentSockets[i].HostPath, socket.HostPath); err != nil {
+				return err
+			}
+		}
+
+		// The pod shared directory is still empty at this point.
+		sharedDir := filepath.Join(defaultSharedDir, p.id)
+		if err := os.Remove(sharedDir); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		// The VM QEMU keeps serving the directory it opened at
+		// startup over 9p, whatever its path, see qemuMinMinor.
+		if err := os.Rename(vm.SharedDir, sharedDir); err != nil {
+			return err
+		}
+	}
+
+	err := p.launchVM(ctx, vmStartTimeout, func(ctx context.Context, startCh, stopCh chan struct{}) error {
+		return p.hypervisor.adoptPooledVM(ctx, vm, startCh, stopCh)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := removePooledVMResources(pooledVM{ID: vm.ID}); err != nil {
+		poolLogger(vm.ID).Warnf("Could not remove pooled VM resources: %s", err)
+	}
+
+	poolLogger(vm.ID).WithFields(Fields{PodIDField: p.id}).Infof("Pod adopted pooled VM")
+
+	return nil
+}
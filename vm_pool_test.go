@@ -0,0 +1,289 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestVMPoolConfig(size uint) VMPoolConfig {
+	podConfig := newTestPodConfigNoop()
+
+	return VMPoolConfig{
+		HypervisorType:   podConfig.HypervisorType,
+		HypervisorConfig: podConfig.HypervisorConfig,
+		VMConfig:         podConfig.VMConfig,
+		AgentType:        podConfig.AgentType,
+		Size:             size,
+		RefillInterval:   time.Hour,
+	}
+}
+
+func TestStartVMPoolZeroSizeFailure(t *testing.T) {
+	_, err := StartVMPool(newTestVMPoolConfig(0))
+	if err == nil {
+		t.Fatal("An empty VM pool should not start")
+	}
+}
+
+func TestStartVMPoolInvalidHypervisorConfigFailure(t *testing.T) {
+	config := newTestVMPoolConfig(1)
+	config.HypervisorConfig.KernelPath = ""
+
+	_, err := StartVMPool(config)
+	if err == nil {
+		t.Fatal("A VM pool with an invalid hypervisor configuration should not start")
+	}
+}
+
+func TestStartVMPoolCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := StartVMPoolWithContext(ctx, newTestVMPoolConfig(1))
+	if err != context.Canceled {
+		t.Fatalf("Got %v, expecting %v", err, context.Canceled)
+	}
+}
+
+func TestStartStopVMPool(t *testing.T) {
+	config := newTestVMPoolConfig(2)
+
+	pool, err := StartVMPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := PoolStatus(config)
+	if err != nil {
+		pool.Stop()
+		t.Fatal(err)
+	}
+
+	if status.Size != 2 || len(status.ReadyVMs) != 2 {
+		pool.Stop()
+		t.Fatalf("Unexpected pool status %+v", status)
+	}
+
+	for _, vmID := range status.ReadyVMs {
+		if _, err := os.Stat(filepath.Join(runStoragePath, vmID)); err != nil {
+			pool.Stop()
+			t.Fatal(err)
+		}
+	}
+
+	vms := status.ReadyVMs
+
+	if err := pool.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err = pool.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(status.ReadyVMs) != 0 {
+		t.Fatalf("Stopped pool still has VMs %v", status.ReadyVMs)
+	}
+
+	for _, vmID := range vms {
+		if _, err := os.Stat(filepath.Join(runStoragePath, vmID)); !os.IsNotExist(err) {
+			t.Fatalf("VM %s run directory should have been removed", vmID)
+		}
+	}
+}
+
+func TestVMPoolRefill(t *testing.T) {
+	config := newTestVMPoolConfig(2)
+	config.RefillInterval = 10 * time.Millisecond
+	config.RefillBatch = 1
+
+	pool, err := StartVMPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Stop()
+
+	status, err := pool.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, vmID := range status.ReadyVMs {
+		if _, ok := claimVM(status.Hash, vmID); !ok {
+			t.Fatalf("Could not claim VM %s", vmID)
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		status, err = pool.Status()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(status.ReadyVMs) == 2 {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("Pool has not been refilled: %+v", status)
+}
+
+func TestClaimVMOnlyOnce(t *testing.T) {
+	config := newTestVMPoolConfig(1)
+
+	pool, err := StartVMPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Stop()
+
+	status, err := pool.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vmID := status.ReadyVMs[0]
+
+	vm, ok := claimVM(status.Hash, vmID)
+	if !ok || vm.ID != vmID {
+		t.Fatalf("Could not claim VM %s: %+v", vmID, vm)
+	}
+	defer removePooledVMResources(vm)
+
+	if _, ok := claimVM(status.Hash, vmID); ok {
+		t.Fatalf("VM %s claimed twice", vmID)
+	}
+}
+
+func TestStartPodAdoptsPooledVM(t *testing.T) {
+	config := newTestVMPoolConfig(1)
+
+	pool, err := StartVMPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Stop()
+
+	status, err := pool.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vmID := status.ReadyVMs[0]
+
+	p, err := RunPod(newTestPodConfigNoop())
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	status, err = pool.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(status.ReadyVMs) != 0 {
+		t.Fatalf("Pooled VM %s has not been claimed", vmID)
+	}
+
+	if _, err := os.Stat(filepath.Join(runStoragePath, vmID)); !os.IsNotExist(err) {
+		t.Fatalf("VM %s run directory should have been removed", vmID)
+	}
+
+	if _, err := StopPod(p.id); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := DeletePod(p.id); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStartPodWithoutMatchingPool(t *testing.T) {
+	config := newTestVMPoolConfig(1)
+	config.VMConfig.VCPUs = 2
+
+	pool, err := StartVMPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Stop()
+
+	p, err := RunPod(newTestPodConfigNoop())
+	if p == nil || err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := pool.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(status.ReadyVMs) != 1 {
+		t.Fatalf("Pooled VM should not have been claimed: %+v", status)
+	}
+}
+
+func TestPodPoolable(t *testing.T) {
+	config := newTestPodConfigNoop()
+	p := &Pod{config: &config}
+
+	if !p.poolable() {
+		t.Fatal("A pod without volumes nor console should be poolable")
+	}
+
+	config.Volumes = []Volume{{MountTag: "tag", HostPath: "/tmp"}}
+	if p.poolable() {
+		t.Fatal("A pod with volumes should not be poolable")
+	}
+
+	config.Volumes = nil
+	config.Containers[0].Interactive = true
+	config.Containers[0].Console = "/dev/pts/0"
+	if p.poolable() {
+		t.Fatal("A pod with a console should not be poolable")
+	}
+
+	config.Containers[0].Interactive = false
+	config.Containers[0].RootFs = filepath.Join(testDir, testImage)
+	if p.poolable() {
+		t.Fatal("A pod with an image rootfs should not be poolable")
+	}
+}
+
+func TestVMPoolKeyHash(t *testing.T) {
+	config := newTestVMPoolConfig(1)
+	hash := config.key().hash()
+
+	config.Size = 3
+	config.RefillBatch = 2
+	if config.key().hash() != hash {
+		t.Fatal("The pool sizing should not change the pool hash")
+	}
+
+	config.HypervisorConfig.KernelParams = []Param{{"foo", "bar"}}
+	if config.key().hash() == hash {
+		t.Fatal("Kernel parameters should change the pool hash")
+	}
+}